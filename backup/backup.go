@@ -0,0 +1,152 @@
+// Package backup sauvegarde et restaure le forum : la base SQLite, copiée à
+// chaud avec l'API de sauvegarde de SQLite, et les images envoyées par les
+// membres, réunies dans une archive .tar.gz.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"forum/database"
+)
+
+// Entrées de l'archive.
+const (
+	dbEntry      = "forum.db"
+	uploadsEntry = "uploads"
+)
+
+// Write écrit dans w l'archive de la base de stores et du répertoire uploads
+// (absent : l'archive n'a que la base).
+func Write(ctx context.Context, stores database.Stores, w io.Writer, uploads string) error {
+	tmp, err := os.MkdirTemp("", "forum-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	snapshot := filepath.Join(tmp, dbEntry)
+	if err := stores.Backup(ctx, snapshot); err != nil {
+		return fmt.Errorf("copie de la base : %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := addFile(tw, snapshot, dbEntry); err != nil {
+		return err
+	}
+	err = filepath.WalkDir(uploads, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == uploads && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(uploads, path)
+		if err != nil {
+			return err
+		}
+		return addFile(tw, path, uploadsEntry+"/"+filepath.ToSlash(rel))
+	})
+	if err != nil {
+		return fmt.Errorf("images envoyées : %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Nom des archives planifiées : forum-20060102-150405.tar.gz, en UTC, dans
+// l'ordre chronologique une fois triées.
+const (
+	snapshotPrefix = "forum-"
+	snapshotSuffix = ".tar.gz"
+	snapshotLayout = "20060102-150405"
+)
+
+// Snapshot écrit une archive datée de now dans dir et renvoie son chemin.
+// L'archive n'apparaît sous son nom qu'une fois complète.
+func Snapshot(ctx context.Context, stores database.Stores, dir, uploads string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, snapshotPrefix+now.UTC().Format(snapshotLayout)+snapshotSuffix)
+	f, err := os.CreateTemp(dir, ".forum-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if err := Write(ctx, stores, f, uploads); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(f.Name(), path)
+}
+
+// Prune supprime les archives planifiées de dir au-delà des keep plus
+// récentes et renvoie les chemins supprimés. Les autres fichiers sont ignorés.
+func Prune(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix)
+		if _, err := time.Parse(snapshotLayout, stamp); err == nil {
+			snapshots = append(snapshots, name)
+		}
+	}
+	sort.Strings(snapshots)
+	var removed []string
+	for len(snapshots) > keep {
+		path := filepath.Join(dir, snapshots[0])
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+		snapshots = snapshots[1:]
+	}
+	return removed, nil
+}
@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+)
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	stores := dbtest.New(t)
+	ctx := context.Background()
+	userID, _ := stores.Users.Create(ctx, "alice", "alice@example.com", "x")
+	stores.Posts.Create(ctx, userID, "sauvegardé", "contenu", "static/uploads/affiche.png", true)
+	dir := t.TempDir()
+	uploads := filepath.Join(dir, "uploads")
+	os.MkdirAll(filepath.Join(uploads, "2024"), 0o755)
+	os.WriteFile(filepath.Join(uploads, "affiche.png"), []byte("png"), 0o644)
+	os.WriteFile(filepath.Join(uploads, "2024", "ancienne.png"), []byte("old"), 0o644)
+
+	var archive bytes.Buffer
+	if err := Write(ctx, stores, &archive, uploads); err != nil {
+		t.Fatal(err)
+	}
+	// Écrit après la sauvegarde : absent de la restauration.
+	stores.Posts.Create(ctx, userID, "perdu", "contenu", "", true)
+	os.WriteFile(filepath.Join(uploads, "nouvelle.png"), []byte("new"), 0o644)
+	stores.Close()
+
+	dbPath := filepath.Join(dir, "forum.db")
+	os.WriteFile(dbPath, []byte("ancienne base"), 0o644)
+	if err := Restore(ctx, &archive, dbPath, uploads); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := database.InitDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	posts, err := restored.Posts.List(ctx)
+	if err != nil || len(posts) != 1 || posts[0].Title != "sauvegardé" {
+		t.Fatalf("posts restaurés : %+v, %v", posts, err)
+	}
+	for name, want := range map[string]bool{"affiche.png": true, "2024/ancienne.png": true, "nouvelle.png": false} {
+		if _, err := os.Stat(filepath.Join(uploads, name)); (err == nil) != want {
+			t.Errorf("%s présent = %v, attendu %v", name, err == nil, want)
+		}
+	}
+	if old, _ := os.ReadFile(dbPath + PreviousSuffix); string(old) != "ancienne base" {
+		t.Errorf("base remplacée non conservée : %q", old)
+	}
+	if _, err := os.Stat(filepath.Join(uploads+PreviousSuffix, "nouvelle.png")); err != nil {
+		t.Errorf("images remplacées non conservées : %v", err)
+	}
+}
+
+func TestRestoreRejectsInvalidArchives(t *testing.T) {
+	archive := func(files map[string]string) *bytes.Buffer {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for name, content := range files {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(content))
+		}
+		tw.Close()
+		gz.Close()
+		return &buf
+	}
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"sans base", map[string]string{"uploads/a.png": "png"}},
+		{"hors du répertoire", map[string]string{"forum.db": "", "uploads/../../evil": "x"}},
+		{"entrée inconnue", map[string]string{"forum.db": "", "config.json": "{}"}},
+		{"base illisible", map[string]string{"forum.db": "pas une base SQLite"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dbPath := filepath.Join(dir, "forum.db")
+			os.WriteFile(dbPath, []byte("en place"), 0o644)
+			if err := Restore(context.Background(), archive(tt.files), dbPath, filepath.Join(dir, "uploads")); err == nil {
+				t.Fatal("archive acceptée")
+			}
+			if current, _ := os.ReadFile(dbPath); string(current) != "en place" {
+				t.Errorf("base remplacée malgré l'échec : %q", current)
+			}
+		})
+	}
+}
+
+func TestPruneKeepsMostRecent(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		name := snapshotPrefix + start.AddDate(0, 0, i).Format(snapshotLayout) + snapshotSuffix
+		os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+	}
+	os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644)
+
+	removed, err := Prune(dir, 2)
+	if err != nil || len(removed) != 3 {
+		t.Fatalf("Prune = %v, %v ; attendu 3 archives supprimées", removed, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	want := []string{"forum-20240504-030000.tar.gz", "forum-20240505-030000.tar.gz", "notes.txt"}
+	if len(left) != len(want) || left[0] != want[0] || left[1] != want[1] || left[2] != want[2] {
+		t.Errorf("restant : %v, attendu %v", left, want)
+	}
+}
@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"forum/database"
+)
+
+// PreviousSuffix est ajouté à la base et au répertoire d'images remplacés
+// par une restauration : ils restent disponibles jusqu'à la suivante.
+const PreviousSuffix = ".avant-restauration"
+
+// Restore remplace la base SQLite dbPath et le répertoire uploads par le
+// contenu de l'archive r. L'archive est d'abord extraite à côté de la base,
+// vérifiée (chemins, intégrité, version) et sa base migrée : rien n'est
+// remplacé si l'une de ces étapes échoue. Le forum doit être arrêté.
+func Restore(ctx context.Context, r io.Reader, dbPath, uploads string) error {
+	staging, err := os.MkdirTemp(filepath.Dir(dbPath), ".restauration-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if err := extract(r, staging); err != nil {
+		return fmt.Errorf("archive invalide : %w", err)
+	}
+	db := filepath.Join(staging, dbEntry)
+	if err := database.VerifySnapshot(ctx, db); err != nil {
+		return fmt.Errorf("archive invalide : %w", err)
+	}
+	migrated, err := database.InitDB(db)
+	if err != nil {
+		return fmt.Errorf("migration de la base restaurée : %w", err)
+	}
+	if err := migrated.Close(); err != nil {
+		return err
+	}
+
+	// Le journal WAL et la mémoire partagée d'une base suivent son fichier.
+	for _, suffix := range []string{"-wal", "-shm", ""} {
+		if err := replace(db+suffix, dbPath+suffix, dbPath+PreviousSuffix+suffix); err != nil {
+			return err
+		}
+	}
+	return replace(filepath.Join(staging, uploadsEntry), uploads, uploads+PreviousSuffix)
+}
+
+// replace met src à la place de dst, en gardant dst sous le nom previous.
+// Un src absent laisse dst de côté sans le remplacer.
+func replace(src, dst, previous string) error {
+	if err := os.RemoveAll(previous); err != nil {
+		return err
+	}
+	if err := os.Rename(dst, previous); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// extract décompresse l'archive dans dir. Seuls la base et les fichiers
+// sous uploads/ sont acceptés, sans remontée hors de dir.
+func extract(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	if err := os.Mkdir(filepath.Join(dir, uploadsEntry), 0o755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(hdr.Name)
+		switch {
+		case hdr.Typeflag == tar.TypeDir:
+			continue
+		case hdr.Typeflag != tar.TypeReg:
+			return fmt.Errorf("%s : type d'entrée non pris en charge", hdr.Name)
+		case !filepath.IsLocal(name) || name != dbEntry && !strings.HasPrefix(name, uploadsEntry+"/"):
+			return fmt.Errorf("%s : entrée inattendue", hdr.Name)
+		}
+		found = found || name == dbEntry
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s absent", dbEntry)
+	}
+	return nil
+}
@@ -0,0 +1,459 @@
+// Package config charge la configuration du forum : un fichier JSON
+// facultatif, puis les variables d'environnement, qui ont priorité.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Fuseaux embarqués : server.timezone et les préférences des comptes
+	// restent valides sur un système sans base zoneinfo.
+	_ "time/tzdata"
+)
+
+// Config est la configuration complète de l'application. Le tag env donne
+// la variable d'environnement qui surcharge le champ ; sur une sous-structure,
+// il sert de préfixe aux variables de ses champs.
+type Config struct {
+	Server   Server   `json:"server"`
+	Database Database `json:"database"`
+	Session  Session  `json:"session"`
+	OAuth    OAuth    `json:"oauth"`
+	OIDC     OIDC     `json:"oidc" env:"OIDC_"`
+	APIs     APIs     `json:"apis"`
+	Log      Log      `json:"log"`
+	Metrics  Metrics  `json:"metrics"`
+	Backup   Backup   `json:"backup"`
+}
+
+// Server décrit les écouteurs HTTP(S) et le comportement des middlewares.
+// Sans certificat ni domaine, le forum démarre en HTTP sur HTTPAddr ; avec
+// CertFile/KeyFile en HTTPS local ; avec seulement Domain, en HTTPS Let's
+// Encrypt (challenge HTTP-01 sur ACMEAddr). TemplatesReload relit les
+// templates modifiés sans redémarrer, pour le développement. Timezone est le
+// fuseau d'affichage des visiteurs et des comptes sans préférence.
+type Server struct {
+	Domain          string   `json:"domain" env:"DOMAIN"`
+	HTTPAddr        string   `json:"http_addr" env:"HTTP_ADDR"`
+	HTTPSAddr       string   `json:"https_addr" env:"HTTPS_ADDR"`
+	ACMEAddr        string   `json:"acme_addr" env:"ACME_ADDR"`
+	CertFile        string   `json:"cert_file" env:"CERT_FILE"`
+	KeyFile         string   `json:"key_file" env:"KEY_FILE"`
+	CertCache       string   `json:"cert_cache" env:"CERT_CACHE"`
+	Timeouts        Timeouts `json:"timeouts"`
+	TrustedProxies  []string `json:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	Brotli          bool     `json:"brotli" env:"ENABLE_BROTLI"`
+	CSPReportOnly   bool     `json:"csp_report_only" env:"CSP_REPORT_ONLY"`
+	TemplatesReload bool     `json:"templates_reload" env:"TEMPLATES_RELOAD"`
+	Timezone        string   `json:"timezone" env:"TIMEZONE"`
+}
+
+// Timeouts protège les serveurs des clients lents ; Shutdown est le délai
+// laissé aux requêtes en cours lors d'un arrêt.
+type Timeouts struct {
+	ReadHeader Duration `json:"read_header" env:"READ_HEADER_TIMEOUT"`
+	Read       Duration `json:"read" env:"READ_TIMEOUT"`
+	Write      Duration `json:"write" env:"WRITE_TIMEOUT"`
+	Idle       Duration `json:"idle" env:"IDLE_TIMEOUT"`
+	Shutdown   Duration `json:"shutdown" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// Database choisit le moteur (Driver : "sqlite" ou "postgres"), désigne la
+// base — fichier SQLite ou URL PostgreSQL — et règle l'accès concurrent :
+// attente maximale d'un verrou SQLite et nombre de connexions du pool.
+type Database struct {
+	Driver       string   `json:"driver" env:"DATABASE_DRIVER"`
+	Path         string   `json:"path" env:"DATABASE_PATH"`
+	URL          Secret   `json:"url" env:"DATABASE_URL"`
+	BusyTimeout  Duration `json:"busy_timeout" env:"DATABASE_BUSY_TIMEOUT"`
+	MaxOpenConns int      `json:"max_open_conns" env:"DATABASE_MAX_OPEN_CONNS"`
+}
+
+// Session règle la durée de vie des sessions et le secret des cookies OAuth.
+type Session struct {
+	Lifetime         Duration `json:"lifetime" env:"SESSION_LIFETIME"`
+	RememberLifetime Duration `json:"remember_lifetime" env:"SESSION_REMEMBER_LIFETIME"`
+	Secret           Secret   `json:"secret" env:"SESSION_SECRET"`
+}
+
+// OAuth regroupe les identifiants des fournisseurs sociaux.
+type OAuth struct {
+	Google   Provider `json:"google" env:"GOOGLE_"`
+	Facebook Provider `json:"facebook" env:"FACEBOOK_"`
+	GitHub   Provider `json:"github" env:"GITHUB_"`
+	Twitter  Provider `json:"twitter" env:"TWITTER_"`
+}
+
+// Provider est une paire d'identifiants OAuth.
+type Provider struct {
+	Key    string `json:"key" env:"KEY"`
+	Secret Secret `json:"secret" env:"SECRET"`
+}
+
+// OIDC configure le fournisseur OpenID Connect générique, désactivé tant que
+// Issuer est vide. RoleMap associe une valeur de RoleClaim à un rôle du forum
+// (OIDC_ROLE_MAP="forum-admins=admin,forum-modos=moderator"), appliqué aux
+// seuls comptes créés par ce fournisseur.
+type OIDC struct {
+	Issuer        string            `json:"issuer" env:"ISSUER"`
+	Name          string            `json:"name" env:"NAME"`
+	Label         string            `json:"label" env:"LABEL"`
+	ClientID      string            `json:"client_id" env:"CLIENT_ID"`
+	ClientSecret  Secret            `json:"client_secret" env:"CLIENT_SECRET"`
+	Scopes        []string          `json:"scopes" env:"SCOPES"`
+	UsernameClaim string            `json:"username_claim" env:"USERNAME_CLAIM"`
+	RoleClaim     string            `json:"role_claim" env:"ROLE_CLAIM"`
+	RoleMap       map[string]string `json:"role_map" env:"ROLE_MAP"`
+}
+
+// APIs contient les clés et points d'accès des services externes.
+type APIs struct {
+	TMDBKey    Secret `json:"tmdb_key" env:"TMDB_API_KEY"`
+	TMDBURL    string `json:"tmdb_url" env:"TMDB_URL"`
+	NewsAPIKey Secret `json:"newsapi_key" env:"NEWSAPI_KEY"`
+	NewsAPIURL string `json:"newsapi_url" env:"NEWSAPI_URL"`
+	GeminiKey  Secret `json:"gemini_key" env:"GOOGLE_API_KEY"`
+	GeminiURL  string `json:"gemini_url" env:"GEMINI_URL"`
+}
+
+// Log choisit le format du journal : "text" pour la console, "json" pour un
+// collecteur de logs.
+type Log struct {
+	Format string `json:"format" env:"LOG_FORMAT"`
+	Level  string `json:"level" env:"LOG_LEVEL"`
+}
+
+// Metrics expose /metrics pour Prometheus, soit sur un écouteur dédié (Addr,
+// ex. "127.0.0.1:9100", à ne pas publier), soit sur le site lui-même, ce qui
+// exige alors Token. Sans l'un ni l'autre, les métriques ne sont pas servies.
+type Metrics struct {
+	Addr  string `json:"addr" env:"METRICS_ADDR"`
+	Token Secret `json:"token" env:"METRICS_TOKEN"`
+}
+
+// Backup planifie les sauvegardes : toutes les Interval (0 pour les
+// désactiver), une archive de la base et des images est écrite dans Dir,
+// qui garde les Keep plus récentes.
+type Backup struct {
+	Dir      string   `json:"dir" env:"BACKUP_DIR"`
+	Interval Duration `json:"interval" env:"BACKUP_INTERVAL"`
+	Keep     int      `json:"keep" env:"BACKUP_KEEP"`
+}
+
+// Default renvoie la configuration utilisée quand rien n'est précisé.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			HTTPAddr:  ":2020",
+			HTTPSAddr: ":443",
+			ACMEAddr:  ":80",
+			CertCache: "cert-cache",
+			Timezone:  "Europe/Paris",
+			Timeouts: Timeouts{
+				ReadHeader: Duration{10 * time.Second},
+				Read:       Duration{time.Minute},
+				Write:      Duration{time.Minute},
+				Idle:       Duration{2 * time.Minute},
+				Shutdown:   Duration{30 * time.Second},
+			},
+		},
+		Database: Database{Driver: "sqlite", Path: "./forum.db", BusyTimeout: Duration{5 * time.Second}, MaxOpenConns: 8},
+		Session: Session{
+			Lifetime:         Duration{24 * time.Hour},
+			RememberLifetime: Duration{30 * 24 * time.Hour},
+		},
+		OIDC: OIDC{
+			Name:          "oidc",
+			Label:         "SSO",
+			Scopes:        []string{"openid", "email", "profile"},
+			UsernameClaim: "preferred_username",
+		},
+		APIs: APIs{
+			TMDBURL:    "https://api.themoviedb.org/3",
+			NewsAPIURL: "https://newsapi.org/v2",
+			GeminiURL:  "https://generativelanguage.googleapis.com/v1",
+		},
+		Log:    Log{Format: "text", Level: "info"},
+		Backup: Backup{Dir: "./backups", Interval: Duration{24 * time.Hour}, Keep: 7},
+	}
+}
+
+// Mode indique comment le serveur écoute : "http", "tls" (certificat local)
+// ou "autocert" (Let's Encrypt).
+func (c *Config) Mode() string {
+	switch {
+	case c.Server.CertFile != "" && c.Server.KeyFile != "":
+		return "tls"
+	case c.Server.Domain != "":
+		return "autocert"
+	}
+	return "http"
+}
+
+// BaseURL est l'URL publique du forum, utilisée pour les callbacks OAuth.
+func (c *Config) BaseURL() string {
+	switch c.Mode() {
+	case "http":
+		return "http://" + publicHost("localhost", c.Server.HTTPAddr, "80")
+	case "tls":
+		return "https://" + publicHost(firstNonEmpty(c.Server.Domain, "localhost"), c.Server.HTTPSAddr, "443")
+	}
+	return "https://" + c.Server.Domain
+}
+
+// publicHost ajoute le port de addr à host s'il n'est pas le port par défaut.
+func publicHost(host, addr, defaultPort string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "" || port == defaultPort {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Validate vérifie la cohérence de la configuration et renvoie toutes les
+// erreurs trouvées d'un coup.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s : %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	for field, addr := range map[string]string{
+		"server.http_addr":  c.Server.HTTPAddr,
+		"server.https_addr": c.Server.HTTPSAddr,
+		"server.acme_addr":  c.Server.ACMEAddr,
+	} {
+		if err := checkAddr(addr); err != nil {
+			fail(field, "%v", err)
+		}
+	}
+	if (c.Server.CertFile == "") != (c.Server.KeyFile == "") {
+		fail("server.cert_file/key_file", "le certificat et la clé doivent être fournis ensemble")
+	}
+	for field, path := range map[string]string{"server.cert_file": c.Server.CertFile, "server.key_file": c.Server.KeyFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			fail(field, "fichier %q introuvable", path)
+		}
+	}
+	if strings.ContainsAny(c.Server.Domain, "/: ") {
+		fail("server.domain", "%q doit être un nom d'hôte seul (sans schéma ni port)", c.Server.Domain)
+	}
+	for _, p := range c.Server.TrustedProxies {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			fail("server.trusted_proxies", "%q n'est ni une IP ni un CIDR", p)
+		}
+	}
+
+	if _, err := time.LoadLocation(c.Server.Timezone); err != nil || c.Server.Timezone == "" {
+		fail("server.timezone", "%q n'est pas un fuseau IANA (ex. \"Europe/Paris\")", c.Server.Timezone)
+	}
+
+	for field, d := range map[string]Duration{
+		"server.timeouts.read_header": c.Server.Timeouts.ReadHeader,
+		"server.timeouts.read":        c.Server.Timeouts.Read,
+		"server.timeouts.write":       c.Server.Timeouts.Write,
+		"server.timeouts.idle":        c.Server.Timeouts.Idle,
+		"server.timeouts.shutdown":    c.Server.Timeouts.Shutdown,
+	} {
+		if d.Duration <= 0 {
+			fail(field, "doit être positif (ex. \"30s\")")
+		}
+	}
+
+	switch c.Database.Driver {
+	case "sqlite":
+		if strings.TrimSpace(c.Database.Path) == "" {
+			fail("database.path", "chemin vide")
+		}
+	case "postgres":
+		if strings.TrimSpace(c.Database.URL.Value()) == "" {
+			fail("database.url", "requise avec le moteur postgres (ex. \"postgres://forum@localhost/forum\")")
+		}
+	default:
+		fail("database.driver", "%q inconnu (\"sqlite\" ou \"postgres\")", c.Database.Driver)
+	}
+	if c.Database.BusyTimeout.Duration < 0 {
+		fail("database.busy_timeout", "ne peut pas être négative")
+	}
+	if c.Database.MaxOpenConns < 1 {
+		fail("database.max_open_conns", "au moins 1 connexion")
+	}
+
+	if c.Session.Lifetime.Duration <= 0 {
+		fail("session.lifetime", "doit être positive (ex. \"24h\")")
+	}
+	if c.Session.RememberLifetime.Duration < c.Session.Lifetime.Duration {
+		fail("session.remember_lifetime", "doit être au moins égale à session.lifetime")
+	}
+
+	for name, p := range map[string]Provider{
+		"google": c.OAuth.Google, "facebook": c.OAuth.Facebook,
+		"github": c.OAuth.GitHub, "twitter": c.OAuth.Twitter,
+	} {
+		if (p.Key == "") != (p.Secret == "") {
+			fail("oauth."+name, "la clé et le secret doivent être fournis ensemble")
+		}
+	}
+
+	if c.OIDC.Enabled() {
+		if err := checkURL(c.OIDC.Issuer); err != nil {
+			fail("oidc.issuer", "%v", err)
+		}
+		if c.OIDC.ClientID == "" {
+			fail("oidc.client_id", "obligatoire quand oidc.issuer est défini")
+		}
+		if c.OIDC.Name == "" {
+			fail("oidc.name", "obligatoire quand oidc.issuer est défini")
+		}
+		for value, role := range c.OIDC.RoleMap {
+			if role != "user" && role != "moderator" && role != "admin" {
+				fail("oidc.role_map", "rôle %q inconnu pour %q (user, moderator ou admin)", role, value)
+			}
+		}
+		if len(c.OIDC.RoleMap) > 0 && c.OIDC.RoleClaim == "" {
+			fail("oidc.role_claim", "obligatoire quand oidc.role_map est défini")
+		}
+	}
+
+	for field, u := range map[string]string{
+		"apis.tmdb_url": c.APIs.TMDBURL, "apis.newsapi_url": c.APIs.NewsAPIURL, "apis.gemini_url": c.APIs.GeminiURL,
+	} {
+		if err := checkURL(u); err != nil {
+			fail(field, "%v", err)
+		}
+	}
+
+	if c.Metrics.Addr != "" {
+		if err := checkAddr(c.Metrics.Addr); err != nil {
+			fail("metrics.addr", "%v", err)
+		}
+	}
+
+	if f := strings.ToLower(c.Log.Format); f != "text" && f != "json" {
+		fail("log.format", "%q inconnu (text ou json)", c.Log.Format)
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("log.level", "%q inconnu (debug, info, warn ou error)", c.Log.Level)
+	}
+
+	if c.Backup.Interval.Duration < 0 {
+		fail("backup.interval", "ne peut pas être négatif (0 pour désactiver)")
+	}
+	if c.Backup.Interval.Duration > 0 && strings.TrimSpace(c.Backup.Dir) == "" {
+		fail("backup.dir", "répertoire vide")
+	}
+	if c.Backup.Keep < 1 {
+		fail("backup.keep", "au moins 1 archive")
+	}
+
+	// Les maps ci-dessus sont parcourues dans un ordre aléatoire.
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// Enabled indique si le fournisseur OIDC est configuré.
+func (o OIDC) Enabled() bool {
+	return o.Issuer != ""
+}
+
+func checkAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("adresse %q invalide (attendu \"hôte:port\" ou \":port\")", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("port %q invalide", port)
+	}
+	return nil
+}
+
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("URL %q invalide", raw)
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// String affiche la configuration effective, secrets masqués.
+func (c *Config) String() string {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// Secret est une valeur sensible : elle n'apparaît jamais dans les logs ni
+// dans les sorties JSON. Value renvoie la valeur réelle.
+type Secret string
+
+const redacted = "********"
+
+// Value renvoie la valeur en clair, à ne transmettre qu'au service concerné.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString masque aussi la valeur pour %#v.
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Duration accepte en JSON les durées au format Go ("24h", "90m").
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durée attendue sous forme de texte (ex. \"24h\")")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("durée %q invalide", s)
+	}
+	d.Duration = v
+	return nil
+}
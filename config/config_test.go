@@ -0,0 +1,249 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig écrit un fichier de configuration temporaire et renvoie son chemin.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("configuration par défaut invalide : %v", err)
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	path := writeConfig(t, `{
+		"server": {"http_addr": ":8080", "timezone": "UTC", "brotli": true},
+		"database": {"path": "fichier.db", "max_open_conns": 4},
+		"session": {"lifetime": "2h"},
+		"log": {"level": "debug"}
+	}`)
+	t.Setenv("HTTP_ADDR", ":9090")
+	t.Setenv("DATABASE_MAX_OPEN_CONNS", "2")
+	t.Setenv("ENABLE_BROTLI", "false")
+	// Une variable vide ne surcharge pas le fichier.
+	t.Setenv("TIMEZONE", "")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.HTTPAddr != ":9090" || cfg.Database.MaxOpenConns != 2 || cfg.Server.Brotli {
+		t.Errorf("l'environnement doit l'emporter sur le fichier : %+v, %+v", cfg.Server, cfg.Database)
+	}
+	if cfg.Server.Timezone != "UTC" || cfg.Database.Path != "fichier.db" || cfg.Session.Lifetime.Duration != 2*time.Hour || cfg.Log.Level != "debug" {
+		t.Errorf("valeurs du fichier perdues : %+v, %+v, %+v", cfg.Server, cfg.Database, cfg.Session)
+	}
+	// Les champs absents du fichier gardent leur valeur par défaut.
+	if cfg.Server.HTTPSAddr != ":443" || cfg.Session.RememberLifetime.Duration != 30*24*time.Hour {
+		t.Errorf("valeurs par défaut perdues : %+v, %+v", cfg.Server, cfg.Session)
+	}
+}
+
+func TestLoadEnvOverrideTypes(t *testing.T) {
+	tests := []struct {
+		env, value string
+		got        func(*Config) any
+		want       any
+	}{
+		{"DOMAIN", "forum.example", func(c *Config) any { return c.Server.Domain }, "forum.example"},
+		{"TEMPLATES_RELOAD", "1", func(c *Config) any { return c.Server.TemplatesReload }, true},
+		{"BACKUP_KEEP", "12", func(c *Config) any { return c.Backup.Keep }, 12},
+		{"SESSION_LIFETIME", "90m", func(c *Config) any { return c.Session.Lifetime.Duration }, 90 * time.Minute},
+		{"READ_TIMEOUT", "5s", func(c *Config) any { return c.Server.Timeouts.Read.Duration }, 5 * time.Second},
+		{"TRUSTED_PROXIES", "10.0.0.1, 192.168.0.0/16 172.16.0.1", func(c *Config) any { return c.Server.TrustedProxies }, []string{"10.0.0.1", "192.168.0.0/16", "172.16.0.1"}},
+		{"SESSION_SECRET", "chut", func(c *Config) any { return c.Session.Secret.Value() }, "chut"},
+		{"GITHUB_KEY", "cle", func(c *Config) any { return c.OAuth.GitHub.Key }, "cle"},
+		{"OIDC_SCOPES", "openid,email", func(c *Config) any { return c.OIDC.Scopes }, []string{"openid", "email"}},
+		{"OIDC_ROLE_MAP", "forum-admins=admin, forum-modos=moderator", func(c *Config) any { return c.OIDC.RoleMap }, map[string]string{"forum-admins": "admin", "forum-modos": "moderator"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			cfg := Default()
+			if err := applyEnv(reflect.ValueOf(cfg).Elem(), ""); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.got(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s=%q : %#v, attendu %#v", tt.env, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidEnv(t *testing.T) {
+	tests := []struct{ env, value string }{
+		{"ENABLE_BROTLI", "peut-être"},
+		{"BACKUP_KEEP", "sept"},
+		{"SESSION_LIFETIME", "un jour"},
+		{"OIDC_ROLE_MAP", "forum-admins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			_, err := Load(writeConfig(t, `{}`))
+			if err == nil || !strings.Contains(err.Error(), "variable "+tt.env) {
+				t.Errorf("%s=%q : erreur %v, attendu une erreur nommant la variable", tt.env, tt.value, err)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"syntaxe", "{\n\"server\": {\n\"http_addr\": \":80\",\n}\n}", "ligne 4"},
+		{"champ inconnu", `{"serveur": {}}`, `"serveur"`},
+		{"durée invalide", `{"session": {"lifetime": "un jour"}}`, `durée "un jour" invalide`},
+		{"durée numérique", `{"session": {"lifetime": 3600}}`, "durée attendue sous forme de texte"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("erreur %v, attendu %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "absent.json")); err == nil {
+		t.Error("fichier désigné explicitement mais absent : aucune erreur")
+	}
+}
+
+func TestLoadWithoutDefaultFile(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	cfg, err := Load(DefaultPath)
+	if err != nil {
+		t.Fatalf("sans %s : %v", DefaultPath, err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("configuration %v, attendu les valeurs par défaut", cfg)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		field  string
+	}{
+		{"adresse sans port", func(c *Config) { c.Server.HTTPAddr = "localhost" }, "server.http_addr"},
+		{"port hors limites", func(c *Config) { c.Server.HTTPSAddr = ":70000" }, "server.https_addr"},
+		{"certificat sans clé", func(c *Config) { c.Server.CertFile = "cert.pem" }, "server.cert_file/key_file"},
+		{"certificat introuvable", func(c *Config) { c.Server.CertFile, c.Server.KeyFile = "absent.pem", "absent.key" }, "server.cert_file"},
+		{"domaine avec schéma", func(c *Config) { c.Server.Domain = "https://forum.example" }, "server.domain"},
+		{"proxy invalide", func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.0/33"} }, "server.trusted_proxies"},
+		{"fuseau inconnu", func(c *Config) { c.Server.Timezone = "Mars/Olympus" }, "server.timezone"},
+		{"délai nul", func(c *Config) { c.Server.Timeouts.Write = Duration{} }, "server.timeouts.write"},
+		{"moteur inconnu", func(c *Config) { c.Database.Driver = "mysql" }, "database.driver"},
+		{"postgres sans URL", func(c *Config) { c.Database.Driver = "postgres" }, "database.url"},
+		{"chemin SQLite vide", func(c *Config) { c.Database.Path = " " }, "database.path"},
+		{"pool vide", func(c *Config) { c.Database.MaxOpenConns = 0 }, "database.max_open_conns"},
+		{"session nulle", func(c *Config) { c.Session.Lifetime = Duration{} }, "session.lifetime"},
+		{"souvenir plus court", func(c *Config) { c.Session.RememberLifetime = Duration{time.Hour} }, "session.remember_lifetime"},
+		{"clé OAuth sans secret", func(c *Config) { c.OAuth.Google.Key = "cle" }, "oauth.google"},
+		{"émetteur OIDC invalide", func(c *Config) { c.OIDC.Issuer, c.OIDC.ClientID = "idp.example", "forum" }, "oidc.issuer"},
+		{"OIDC sans client", func(c *Config) { c.OIDC.Issuer = "https://idp.example" }, "oidc.client_id"},
+		{"rôle OIDC inconnu", func(c *Config) {
+			c.OIDC.Issuer, c.OIDC.ClientID, c.OIDC.RoleClaim = "https://idp.example", "forum", "groups"
+			c.OIDC.RoleMap = map[string]string{"forum-admins": "root"}
+		}, "oidc.role_map"},
+		{"rôles OIDC sans claim", func(c *Config) {
+			c.OIDC.Issuer, c.OIDC.ClientID = "https://idp.example", "forum"
+			c.OIDC.RoleMap = map[string]string{"forum-admins": "admin"}
+		}, "oidc.role_claim"},
+		{"URL d'API invalide", func(c *Config) { c.APIs.TMDBURL = "ftp://tmdb.example" }, "apis.tmdb_url"},
+		{"écouteur de métriques invalide", func(c *Config) { c.Metrics.Addr = "9100" }, "metrics.addr"},
+		{"format de journal inconnu", func(c *Config) { c.Log.Format = "xml" }, "log.format"},
+		{"niveau de journal inconnu", func(c *Config) { c.Log.Level = "trace" }, "log.level"},
+		{"intervalle négatif", func(c *Config) { c.Backup.Interval = Duration{-time.Hour} }, "backup.interval"},
+		{"répertoire de sauvegarde vide", func(c *Config) { c.Backup.Dir = "" }, "backup.dir"},
+		{"aucune archive gardée", func(c *Config) { c.Backup.Keep = 0 }, "backup.keep"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.field+" :") {
+				t.Errorf("erreur %v, attendu une erreur sur %s", err, tt.field)
+			}
+		})
+	}
+
+	// Toutes les erreurs sont rapportées d'un coup.
+	cfg := Default()
+	cfg.Log.Format, cfg.Backup.Keep = "xml", 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "log.format") || !strings.Contains(err.Error(), "backup.keep") {
+		t.Errorf("erreur %v, attendu log.format et backup.keep", err)
+	}
+	if _, err := Load(writeConfig(t, `{"log": {"format": "xml"}}`)); err == nil || !strings.Contains(err.Error(), "log.format") {
+		t.Errorf("Load : erreur %v, attendu la validation", err)
+	}
+}
+
+func TestSecretsNeverPrinted(t *testing.T) {
+	const value = "valeur-tres-secrete"
+	cfg := Default()
+	cfg.Database.URL = value
+	cfg.Session.Secret = value
+	cfg.OAuth.GitHub = Provider{Key: "cle", Secret: value}
+	cfg.OIDC.ClientSecret = value
+	cfg.APIs.TMDBKey = value
+	cfg.Metrics.Token = value
+
+	js, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := map[string]string{
+		"String":      cfg.String(),
+		"%v":          fmt.Sprintf("%v", cfg),
+		"%v (valeur)": fmt.Sprintf("%v", *cfg),
+		"%+v":         fmt.Sprintf("%+v", *cfg),
+		"%#v":         fmt.Sprintf("%#v", *cfg),
+		"%s":          fmt.Sprintf("%s", cfg.Session.Secret),
+		"JSON":        string(js),
+	}
+	for name, out := range outputs {
+		if strings.Contains(out, value) {
+			t.Errorf("%s révèle le secret : %s", name, out)
+		}
+	}
+	if !strings.Contains(cfg.String(), redacted) {
+		t.Errorf("String ne signale pas les secrets masqués : %s", cfg.String())
+	}
+	if cfg.Session.Secret.Value() != value {
+		t.Errorf("Value = %q, attendu la valeur en clair", cfg.Session.Secret.Value())
+	}
+	// Un secret absent reste visiblement vide.
+	if s := Secret("").String(); s != "" {
+		t.Errorf("secret vide affiché %q", s)
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPath est le fichier lu quand FORUM_CONFIG n'est pas défini ; son
+// absence n'est pas une erreur.
+const DefaultPath = "config.json"
+
+// Load part des valeurs par défaut, applique le fichier path (ignoré s'il
+// n'existe pas et que path vaut DefaultPath), puis les variables
+// d'environnement, et valide le résultat.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if err := cfg.loadFile(path); err != nil {
+		return nil, err
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), ""); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("configuration invalide :\n%w", err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && path == DefaultPath {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("lecture de la configuration : %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line := bytes.Count(data[:syntax.Offset], []byte("\n")) + 1
+			return fmt.Errorf("%s, ligne %d : %v", path, line, err)
+		}
+		return fmt.Errorf("%s : %v", path, err)
+	}
+	return nil
+}
+
+// applyEnv parcourt la structure et remplace chaque champ dont la variable
+// d'environnement (préfixe + tag env) est définie et non vide.
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("env")
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && field.Type != reflect.TypeOf(Duration{}) {
+			if err := applyEnv(fv, prefix+tag); err != nil {
+				return err
+			}
+			continue
+		}
+		if tag == "" {
+			continue
+		}
+		name := prefix + tag
+		raw, ok := os.LookupEnv(name)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setFromString(fv, raw); err != nil {
+			return fmt.Errorf("variable %s : %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setFromString(fv reflect.Value, raw string) error {
+	switch fv.Interface().(type) {
+	case Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("durée %q invalide (ex. \"24h\")", raw)
+		}
+		fv.Set(reflect.ValueOf(Duration{d}))
+		return nil
+	case []string:
+		fv.Set(reflect.ValueOf(splitList(raw)))
+		return nil
+	case map[string]string:
+		m := map[string]string{}
+		for _, pair := range splitList(raw) {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("%q n'est pas de la forme clé=valeur", pair)
+			}
+			m[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		fv.Set(reflect.ValueOf(m))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("booléen %q invalide (1/0, true/false)", raw)
+		}
+		fv.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("entier %q invalide", raw)
+		}
+		fv.SetInt(int64(n))
+	default:
+		return fmt.Errorf("type %s non géré", fv.Type())
+	}
+	return nil
+}
+
+// splitList découpe une liste séparée par des virgules ou des espaces.
+func splitList(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
@@ -97,3 +97,94 @@ CREATE TABLE IF NOT EXISTS sessions (
     expires_at   DATETIME NOT NULL,
     FOREIGN KEY(user_id) REFERENCES users(id)
 );
+
+-- Codes de secours de la double authentification (hachés avec bcrypt)
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER NOT NULL,
+    code_hash  TEXT NOT NULL,
+    used_at    DATETIME DEFAULT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- Connexions en attente du second facteur (mot de passe déjà vérifié)
+CREATE TABLE IF NOT EXISTS login_challenges (
+    token       TEXT PRIMARY KEY,
+    user_id     INTEGER NOT NULL,
+    attempts    INTEGER NOT NULL DEFAULT 0,
+    created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at  DATETIME NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- Réglages du site modifiables par les administrateurs
+CREATE TABLE IF NOT EXISTS settings (
+    key    TEXT PRIMARY KEY,
+    value  TEXT NOT NULL
+);
+
+-- Comptes externes (OAuth / OpenID Connect) liés à un utilisateur
+CREATE TABLE IF NOT EXISTS oauth_identities (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     INTEGER NOT NULL,
+    provider    TEXT NOT NULL,
+    subject     TEXT NOT NULL,
+    email       TEXT NOT NULL DEFAULT '',
+    created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+-- Inscriptions OAuth en attente du choix du nom d'utilisateur
+CREATE TABLE IF NOT EXISTS oauth_pending (
+    token       TEXT PRIMARY KEY,
+    provider    TEXT NOT NULL,
+    subject     TEXT NOT NULL,
+    email       TEXT NOT NULL DEFAULT '',
+    name        TEXT NOT NULL DEFAULT '',
+    created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at  DATETIME NOT NULL
+);
+
+-- Échecs de connexion par compte, identifiant inconnu ou adresse IP
+CREATE TABLE IF NOT EXISTS login_throttle (
+    scope           TEXT NOT NULL,
+    key             TEXT NOT NULL,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    locked_until    DATETIME,
+    PRIMARY KEY (scope, key)
+);
+
+-- Rapports de violation de la Content-Security-Policy
+CREATE TABLE IF NOT EXISTS csp_reports (
+    id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+    document_uri       TEXT NOT NULL DEFAULT '',
+    violated_directive TEXT NOT NULL DEFAULT '',
+    blocked_uri        TEXT NOT NULL DEFAULT '',
+    source_file        TEXT NOT NULL DEFAULT '',
+    line_number        INTEGER NOT NULL DEFAULT 0,
+    user_agent         TEXT NOT NULL DEFAULT '',
+    created_at         DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Journal d'audit des actions d'administration (changements de rôle…)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor_id    INTEGER,
+    action      TEXT NOT NULL,
+    target_id   INTEGER,
+    detail      TEXT NOT NULL DEFAULT '',
+    created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(actor_id) REFERENCES users(id)
+);
+
+-- Index des requêtes fréquentes : votes et commentaires d'un post,
+-- notifications et sessions d'un utilisateur
+CREATE INDEX IF NOT EXISTS idx_likes_post ON likes(post_id);
+CREATE INDEX IF NOT EXISTS idx_likes_comment ON likes(comment_id);
+CREATE INDEX IF NOT EXISTS idx_likes_user ON likes(user_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post ON comments(post_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
@@ -0,0 +1,174 @@
+-- Schéma PostgreSQL : mêmes tables que database.sql, avec d'emblée les
+-- colonnes que les migrations ajoutent aux bases SQLite. Les dates sont
+-- en UTC (la connexion fixe TIME ZONE 'UTC').
+
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    photo TEXT NOT NULL DEFAULT 'profil.png',
+    role TEXT NOT NULL DEFAULT 'user',
+    totp_secret TEXT NOT NULL DEFAULT '',
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_last_step INTEGER NOT NULL DEFAULT 0,
+    timezone TEXT NOT NULL DEFAULT '',
+    banned_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    original_content TEXT DEFAULT NULL,
+    image_path TEXT,
+    moderation_status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS likes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    post_id INTEGER REFERENCES posts(id),
+    comment_id INTEGER REFERENCES comments(id),
+    value INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS post_categories (
+    post_id INTEGER NOT NULL REFERENCES posts(id),
+    category_id INTEGER NOT NULL REFERENCES categories(id),
+    PRIMARY KEY (post_id, category_id)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    message TEXT NOT NULL,
+    post_id INTEGER REFERENCES posts(id),
+    comment_id INTEGER REFERENCES comments(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table des sessions serveur. rowid est explicite : PostgreSQL n'a pas
+-- l'identifiant de ligne implicite de SQLite, utilisé pour révoquer une
+-- session sans exposer son identifiant.
+CREATE TABLE IF NOT EXISTS sessions (
+    rowid        BIGSERIAL UNIQUE,
+    session_id   TEXT PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES users(id),
+    user_agent   TEXT NOT NULL DEFAULT '',
+    ip           TEXT NOT NULL DEFAULT '',
+    remember     BOOLEAN NOT NULL DEFAULT FALSE,
+    csrf_token   TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP,
+    expires_at   TIMESTAMP NOT NULL
+);
+
+-- Codes de secours de la double authentification (hachés avec bcrypt)
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users(id),
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMP DEFAULT NULL
+);
+
+-- Connexions en attente du second facteur (mot de passe déjà vérifié)
+CREATE TABLE IF NOT EXISTS login_challenges (
+    token       TEXT PRIMARY KEY,
+    user_id     INTEGER NOT NULL REFERENCES users(id),
+    attempts    INTEGER NOT NULL DEFAULT 0,
+    remember    BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at  TIMESTAMP NOT NULL
+);
+
+-- Réglages du site modifiables par les administrateurs
+CREATE TABLE IF NOT EXISTS settings (
+    key    TEXT PRIMARY KEY,
+    value  TEXT NOT NULL
+);
+
+-- Comptes externes (OAuth / OpenID Connect) liés à un utilisateur
+CREATE TABLE IF NOT EXISTS oauth_identities (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER NOT NULL REFERENCES users(id),
+    provider    TEXT NOT NULL,
+    subject     TEXT NOT NULL,
+    email       TEXT NOT NULL DEFAULT '',
+    created_user BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+-- Inscriptions OAuth en attente du choix du nom d'utilisateur
+CREATE TABLE IF NOT EXISTS oauth_pending (
+    token       TEXT PRIMARY KEY,
+    provider    TEXT NOT NULL,
+    subject     TEXT NOT NULL,
+    email       TEXT NOT NULL DEFAULT '',
+    name        TEXT NOT NULL DEFAULT '',
+    role        TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at  TIMESTAMP NOT NULL
+);
+
+-- Échecs de connexion par compte, identifiant inconnu ou adresse IP
+CREATE TABLE IF NOT EXISTS login_throttle (
+    scope           TEXT NOT NULL,
+    key             TEXT NOT NULL,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until    TIMESTAMP,
+    PRIMARY KEY (scope, key)
+);
+
+-- Rapports de violation de la Content-Security-Policy
+CREATE TABLE IF NOT EXISTS csp_reports (
+    id                 SERIAL PRIMARY KEY,
+    document_uri       TEXT NOT NULL DEFAULT '',
+    violated_directive TEXT NOT NULL DEFAULT '',
+    blocked_uri        TEXT NOT NULL DEFAULT '',
+    source_file        TEXT NOT NULL DEFAULT '',
+    line_number        INTEGER NOT NULL DEFAULT 0,
+    user_agent         TEXT NOT NULL DEFAULT '',
+    created_at         TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Journal d'audit des actions d'administration (changements de rôle…)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          SERIAL PRIMARY KEY,
+    actor_id    INTEGER REFERENCES users(id),
+    action      TEXT NOT NULL,
+    target_id   INTEGER,
+    detail      TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Index des requêtes fréquentes : votes et commentaires d'un post,
+-- notifications et sessions d'un utilisateur, posts par statut
+CREATE INDEX IF NOT EXISTS idx_likes_post ON likes(post_id);
+CREATE INDEX IF NOT EXISTS idx_likes_comment ON likes(comment_id);
+CREATE INDEX IF NOT EXISTS idx_likes_user ON likes(user_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post ON comments(post_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_posts_status ON posts(moderation_status, created_at);
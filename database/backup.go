@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrBackupUnsupported signale une sauvegarde demandée sur PostgreSQL, qui
+// se sauvegarde avec ses propres outils (pg_dump).
+var ErrBackupUnsupported = errors.New("sauvegarde en ligne disponible avec SQLite seulement (PostgreSQL : pg_dump)")
+
+// Backup copie la base ouverte dans le fichier SQLite dst avec l'API de
+// sauvegarde de SQLite : la copie est cohérente même si des écritures ont
+// lieu pendant qu'elle est faite, sans arrêter le forum.
+func (s Stores) Backup(ctx context.Context, dst string) error {
+	if s.dialect().name != SQLite {
+		return ErrBackupUnsupported
+	}
+	if s.db == nil {
+		return errNoDatabase
+	}
+	dest, err := (&sqlite3.SQLiteDriver{}).Open(dst)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	src, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return src.Raw(func(driverConn any) error {
+		b, err := dest.(*sqlite3.SQLiteConn).Backup("main", driverConn.(*observedConn).SQLiteConn, "main")
+		if err != nil {
+			return err
+		}
+		// Une seule étape : toutes les pages sont lues dans la même
+		// transaction de lecture, qui en WAL ne bloque pas les écrivains.
+		if _, err := b.Step(-1); err != nil {
+			b.Finish()
+			return err
+		}
+		return b.Finish()
+	})
+}
+
+// VerifySnapshot vérifie, sans la modifier, qu'une copie de base à restaurer
+// est intacte, qu'il s'agit bien d'une base du forum et qu'elle ne vient pas
+// d'une version plus récente (migrations inconnues).
+func VerifySnapshot(ctx context.Context, path string) error {
+	db, err := sql.Open(sqliteDriverName, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check;").Scan(&integrity); err != nil {
+		return fmt.Errorf("base illisible : %w", err)
+	}
+	if integrity != "ok" {
+		return fmt.Errorf("base corrompue : %s", integrity)
+	}
+	var tables int
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('users', 'posts', 'schema_migrations');"
+	if err := db.QueryRowContext(ctx, query).Scan(&tables); err != nil {
+		return err
+	}
+	if tables != 3 {
+		return errors.New("ce n'est pas une base du forum")
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations;").Scan(&version); err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].version; version > latest {
+		return fmt.Errorf("base migrée en version %d par une version plus récente du forum (celle-ci s'arrête à %d)", version, latest)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+)
+
+// Volumes de la base de benchmark.
+const (
+	benchUsers    = 50
+	benchPosts    = 200
+	benchComments = 1000
+	benchVotes    = 3000
+)
+
+type benchData struct {
+	stores   database.Stores
+	users    []int
+	posts    []int
+	sessions []string
+}
+
+// seedBench remplit une base neuve, de façon reproductible.
+func seedBench(b *testing.B) benchData {
+	b.Helper()
+	d := benchData{stores: dbtest.New(b)}
+	ctx := context.Background()
+	rng := rand.New(rand.NewPCG(1, 2))
+	err := d.stores.InTx(ctx, func(tx database.Stores) error {
+		for i := range benchUsers {
+			id, err := tx.Users.Create(ctx, fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i), "x")
+			if err != nil {
+				return err
+			}
+			d.users = append(d.users, id)
+			s := database.Session{ID: fmt.Sprintf("session-%d", i), UserID: id, ExpiresAt: time.Now().Add(time.Hour)}
+			if err := tx.Sessions.Create(ctx, s); err != nil {
+				return err
+			}
+			d.sessions = append(d.sessions, s.ID)
+		}
+		for i := range benchPosts {
+			id, err := tx.Posts.Create(ctx, d.user(rng), fmt.Sprintf("post %d", i), "contenu", "", true)
+			if err != nil {
+				return err
+			}
+			d.posts = append(d.posts, id)
+		}
+		var comments []int
+		for range benchComments {
+			id, err := tx.Comments.Create(ctx, d.post(rng), d.user(rng), "commentaire")
+			if err != nil {
+				return err
+			}
+			comments = append(comments, id)
+		}
+		for i := range benchVotes {
+			value := 1 - 2*rng.IntN(2)
+			if i%3 == 0 {
+				if err := tx.Comments.SetVote(ctx, d.user(rng), comments[rng.IntN(len(comments))], value); err != nil {
+					return err
+				}
+			} else if err := tx.Posts.SetVote(ctx, d.user(rng), d.post(rng), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	return d
+}
+
+func (d benchData) user(rng *rand.Rand) int { return d.users[rng.IntN(len(d.users))] }
+func (d benchData) post(rng *rand.Rand) int { return d.posts[rng.IntN(len(d.posts))] }
+
+// seq donne à chaque goroutine de RunParallel sa propre graine.
+var seq atomic.Uint64
+
+func newRand() *rand.Rand { return rand.New(rand.NewPCG(seq.Add(1), 0)) }
+
+// BenchmarkSessionGet mesure la lecture de session faite à chaque requête.
+func BenchmarkSessionGet(b *testing.B) {
+	d := seedBench(b)
+	ctx := context.Background()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := newRand()
+		for pb.Next() {
+			if _, err := d.stores.Sessions.Get(ctx, d.sessions[rng.IntN(len(d.sessions))], time.Now()); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkPostGet mesure l'affichage d'un post et le comptage de ses votes.
+func BenchmarkPostGet(b *testing.B) {
+	d := seedBench(b)
+	ctx := context.Background()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := newRand()
+		for pb.Next() {
+			if _, err := d.stores.Posts.GetByID(ctx, d.post(rng)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkPostComments mesure la page d'un post : commentaires et votes.
+func BenchmarkPostComments(b *testing.B) {
+	d := seedBench(b)
+	ctx := context.Background()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := newRand()
+		for pb.Next() {
+			if _, err := d.stores.Comments.ListByPost(ctx, d.post(rng)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkMixed fait tourner lecteurs et écrivains en même temps : une
+// opération sur writeEvery est un vote notifié, en transaction, les autres
+// des lectures de session et de post. Sans WAL ni busy_timeout, les
+// écrivains échouent aussitôt sur « database is locked ».
+func BenchmarkMixed(b *testing.B) {
+	for _, writeEvery := range []int{10, 2} {
+		b.Run(fmt.Sprintf("1_ecriture_sur_%d", writeEvery), func(b *testing.B) {
+			d := seedBench(b)
+			ctx := context.Background()
+			b.RunParallel(func(pb *testing.PB) {
+				rng := newRand()
+				for i := 0; pb.Next(); i++ {
+					var err error
+					if i%writeEvery == 0 {
+						err = d.stores.InTx(ctx, func(tx database.Stores) error {
+							postID := d.post(rng)
+							if err := tx.Posts.SetVote(ctx, d.user(rng), postID, 1); err != nil {
+								return err
+							}
+							return tx.Notifications.Create(ctx, d.user(rng), "vote", postID, 0)
+						})
+					} else {
+						if _, err = d.stores.Sessions.Get(ctx, d.sessions[rng.IntN(len(d.sessions))], time.Now()); err == nil {
+							_, err = d.stores.Posts.GetByID(ctx, d.post(rng))
+						}
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
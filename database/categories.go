@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+)
+
+// Category est une catégorie de posts.
+type Category struct {
+	ID   int
+	Name string
+}
+
+// categoryStore implémente CategoryStore.
+type categoryStore struct {
+	db querier
+}
+
+func (s *categoryStore) Ensure(ctx context.Context, name string) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO categories (name) VALUES (?) ON CONFLICT (name) DO UPDATE SET name = excluded.name RETURNING id;`,
+		name).Scan(&id)
+	return id, err
+}
+
+func (s *categoryStore) AddPost(ctx context.Context, postID, categoryID int) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO post_categories (post_id, category_id) VALUES (?, ?) ON CONFLICT DO NOTHING;`, postID, categoryID)
+	return err
+}
+
+func (s *categoryStore) ListByPost(ctx context.Context, postID int) ([]Category, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.id, c.name FROM categories c
+		JOIN post_categories pc ON pc.category_id = c.id
+		WHERE pc.post_id = ?
+		ORDER BY c.name;`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var categories []Category
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// Orphans compte les lignes de Table dont la clé étrangère vers Parent
+// désigne une ligne absente.
+type Orphans struct {
+	Table  string
+	Parent string
+	Rows   int
+}
+
+// maxRepairPasses borne les passes de réparation : supprimer un post orphelin
+// peut rendre orphelines des lignes qui en dépendaient.
+const maxRepairPasses = 10
+
+// CheckConsistency relève les lignes orphelines de la base (PRAGMA
+// foreign_key_check). Avec repair, elles sont supprimées dans une seule
+// transaction, posts et commentaires avec leurs dépendances, jusqu'à ce qu'il
+// n'en reste plus ; le résultat cumule alors toutes les passes.
+// PostgreSQL vérifie toujours les clés étrangères : il n'y a rien à relever.
+func (s Stores) CheckConsistency(ctx context.Context, repair bool) ([]Orphans, error) {
+	if s.dialect().name == Postgres {
+		return nil, nil
+	}
+	if !repair {
+		found, _, err := foreignKeyViolations(ctx, s.q)
+		return found, err
+	}
+	var total []Orphans
+	err := inTx(ctx, s.q, func(tx querier) error {
+		for pass := 0; pass < maxRepairPasses; pass++ {
+			found, rows, err := foreignKeyViolations(ctx, tx)
+			if err != nil || len(rows) == 0 {
+				return err
+			}
+			total = mergeOrphans(total, found)
+			for _, row := range rows {
+				if err := deleteOrphan(ctx, tx, row.table, row.rowid); err != nil {
+					return fmt.Errorf("suppression de %s %d: %w", row.table, row.rowid, err)
+				}
+			}
+		}
+		return fmt.Errorf("lignes orphelines restantes après %d passes", maxRepairPasses)
+	})
+	return total, err
+}
+
+type orphanRow struct {
+	table string
+	rowid int64
+}
+
+func foreignKeyViolations(ctx context.Context, q querier) ([]Orphans, []orphanRow, error) {
+	rows, err := q.QueryContext(ctx, "PRAGMA foreign_key_check;")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var found []Orphans
+	var orphans []orphanRow
+	seen := map[orphanRow]bool{}
+	for rows.Next() {
+		var (
+			table, parent string
+			rowid         int64
+			fkid          int
+		)
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return nil, nil, err
+		}
+		found = mergeOrphans(found, []Orphans{{table, parent, 1}})
+		// Une ligne peut violer plusieurs clés : une seule suppression suffit.
+		if r := (orphanRow{table, rowid}); !seen[r] {
+			seen[r] = true
+			orphans = append(orphans, r)
+		}
+	}
+	return found, orphans, rows.Err()
+}
+
+func mergeOrphans(into, from []Orphans) []Orphans {
+next:
+	for _, o := range from {
+		for i := range into {
+			if into[i].Table == o.Table && into[i].Parent == o.Parent {
+				into[i].Rows += o.Rows
+				continue next
+			}
+		}
+		into = append(into, o)
+	}
+	return into
+}
+
+// deleteOrphan supprime une ligne orpheline ; un post ou un commentaire
+// emporte ce qui en dépend.
+func deleteOrphan(ctx context.Context, tx querier, table string, rowid int64) error {
+	switch table {
+	case "posts":
+		return deletePost(ctx, tx, int(rowid))
+	case "comments":
+		return deleteComments(ctx, tx, "id = ?", rowid)
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %q WHERE rowid = ?;", table), rowid)
+	return err
+}
@@ -0,0 +1,107 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"forum/database"
+	"forum/database/dbtest"
+)
+
+func TestAdminDeleteRemovesDependents(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		author, _ := stores.Users.Create(ctx, "auteur", "auteur@example.com", "x")
+		reader, _ := stores.Users.Create(ctx, "lecteur", "lecteur@example.com", "x")
+		postID, err := stores.Posts.Create(ctx, author, "titre", "contenu", "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commentID, err := stores.Comments.Create(ctx, postID, reader, "commentaire")
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps := []error{
+			stores.Posts.SetVote(ctx, reader, postID, 1),
+			stores.Comments.SetVote(ctx, author, commentID, -1),
+			stores.Notifications.Create(ctx, author, "commentaire", postID, 0),
+			stores.Notifications.Create(ctx, reader, "dislike", postID, commentID),
+			stores.Notifications.Create(ctx, reader, "sans post", 0, 0),
+		}
+		for _, err := range steps {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := stores.Posts.AdminDelete(ctx, postID); err != nil {
+			t.Fatalf("suppression refusée : %v", err)
+		}
+		for _, table := range []string{"posts", "comments", "likes"} {
+			var n int
+			stores.RawDB().QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n)
+			if n != 0 {
+				t.Errorf("%s : %d ligne(s) restante(s)", table, n)
+			}
+		}
+		if n, _ := stores.Notifications.CountUnread(ctx, reader); n != 1 {
+			t.Errorf("%d notification(s) pour le lecteur, attendu 1 (celle sans post)", n)
+		}
+		if orphans, err := stores.CheckConsistency(ctx, false); err != nil || len(orphans) != 0 {
+			t.Fatalf("orphelins après suppression : %v, %v", orphans, err)
+		}
+		if err := stores.Notifications.Create(ctx, reader, "post supprimé", postID, 0); err == nil {
+			t.Fatal("notification acceptée vers un post supprimé : clés étrangères inactives")
+		}
+	})
+}
+
+// TestCheckConsistencyRepairsOrphans ne concerne que SQLite : PostgreSQL
+// vérifie toujours les clés étrangères.
+func TestCheckConsistencyRepairsOrphans(t *testing.T) {
+	stores := dbtest.New(t)
+	ctx := context.Background()
+	author, _ := stores.Users.Create(ctx, "auteur", "auteur@example.com", "x")
+	postID, _ := stores.Posts.Create(ctx, author, "titre", "contenu", "", true)
+	commentID, _ := stores.Comments.Create(ctx, postID, author, "commentaire")
+	stores.Comments.SetVote(ctx, author, commentID, 1)
+	stores.Notifications.Create(ctx, author, "commentaire", postID, commentID)
+
+	// Suppression à l'ancienne, sans clés étrangères ni nettoyage.
+	conn, err := stores.RawDB().Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF;")
+	if _, err := conn.ExecContext(ctx, "DELETE FROM posts WHERE id = ?;", postID); err != nil {
+		t.Fatal(err)
+	}
+	conn.ExecContext(ctx, "PRAGMA foreign_keys = ON;")
+	conn.Close()
+
+	orphans, err := stores.CheckConsistency(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"comments": 1, "notifications": 1}
+	if len(orphans) != len(want) {
+		t.Fatalf("orphelins %+v, attendu %v", orphans, want)
+	}
+	for _, o := range orphans {
+		if want[o.Table] != o.Rows || o.Parent != "posts" {
+			t.Errorf("orphelins %+v, attendu %v vers posts", o, want)
+		}
+	}
+
+	if _, err := stores.CheckConsistency(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if orphans, _ := stores.CheckConsistency(ctx, false); len(orphans) != 0 {
+		t.Fatalf("orphelins après réparation : %+v", orphans)
+	}
+	var likes int
+	stores.RawDB().QueryRow("SELECT COUNT(*) FROM likes").Scan(&likes)
+	if likes != 0 {
+		t.Errorf("%d vote(s) sur le commentaire supprimé", likes)
+	}
+}
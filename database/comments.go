@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Comment représente un commentaire sur un post.
+type Comment struct {
+	ID        int
+	PostID    int
+	UserID    int
+	Username  string
+	Content   string
+	CreatedAt time.Time
+	Likes     int
+	Dislikes  int
+	Photo     string // photo de l'utilisateur
+}
+
+// commentStore implémente CommentStore sur SQLite.
+type commentStore struct {
+	db querier
+}
+
+const commentSelect = `
+		SELECT c.id, c.post_id, c.user_id, u.username, c.content, c.created_at, u.photo
+		FROM comments c
+		JOIN users u ON c.user_id = u.id`
+
+func (s *commentStore) scan(ctx context.Context, row interface{ Scan(...any) error }) (Comment, error) {
+	var c Comment
+	if err := row.Scan(&c.ID, &c.PostID, &c.UserID, &c.Username, &c.Content, scanTime(&c.CreatedAt), &c.Photo); err != nil {
+		return c, err
+	}
+	c.Likes, c.Dislikes, _ = countVotes(ctx, s.db, "comment_id", c.ID)
+	return c, nil
+}
+
+func (s *commentStore) Create(ctx context.Context, postID, userID int, content string) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx, "INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?) RETURNING id;", postID, userID, content).Scan(&id)
+	return id, err
+}
+
+func (s *commentStore) GetByID(ctx context.Context, id int) (Comment, error) {
+	return s.scan(ctx, s.db.QueryRowContext(ctx, commentSelect+" WHERE c.id = ?;", id))
+}
+
+func (s *commentStore) ListByPost(ctx context.Context, postID int) ([]Comment, error) {
+	rows, err := s.db.QueryContext(ctx, commentSelect+" WHERE c.post_id = ? ORDER BY c.created_at ASC;", postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var comments []Comment
+	for rows.Next() {
+		c, err := s.scan(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (s *commentStore) Delete(ctx context.Context, id, userID int) error {
+	return inTx(ctx, s.db, func(tx querier) error {
+		var n int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE id = ? AND user_id = ?;", id, userID).Scan(&n); err != nil || n == 0 {
+			return err
+		}
+		return deleteComments(ctx, tx, "id = ?", id)
+	})
+}
+
+func (s *commentStore) AdminDelete(ctx context.Context, id int) error {
+	return inTx(ctx, s.db, func(tx querier) error {
+		return deleteComments(ctx, tx, "id = ?", id)
+	})
+}
+
+// deleteComments supprime les commentaires sélectionnés par where, puis
+// leurs votes et notifications. tx doit être une transaction.
+func deleteComments(ctx context.Context, tx querier, where string, args ...any) error {
+	ids := "SELECT id FROM comments WHERE " + where
+	for _, query := range []string{
+		"DELETE FROM likes WHERE comment_id IN (" + ids + ");",
+		"DELETE FROM notifications WHERE comment_id IN (" + ids + ");",
+		"DELETE FROM comments WHERE " + where + ";",
+	} {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *commentStore) SetVote(ctx context.Context, userID, commentID, value int) error {
+	return setVote(ctx, s.db, "comment_id", userID, commentID, value)
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// cspReportRetention est la durée de conservation des rapports CSP.
+const cspReportRetention = 30 * 24 * time.Hour
+
+// CSPReport est une violation de la Content-Security-Policy signalée par un navigateur.
+type CSPReport struct {
+	DocumentURI       string
+	ViolatedDirective string
+	BlockedURI        string
+	SourceFile        string
+	LineNumber        int
+	UserAgent         string
+}
+
+// cspReportStore implémente CSPReportStore.
+type cspReportStore struct {
+	db querier
+}
+
+func (s *cspReportStore) Create(ctx context.Context, c CSPReport) error {
+	query := `INSERT INTO csp_reports (document_uri, violated_directive, blocked_uri, source_file, line_number, user_agent) VALUES (?, ?, ?, ?, ?, ?);`
+	_, err := s.db.ExecContext(ctx, query, c.DocumentURI, c.ViolatedDirective, c.BlockedURI, c.SourceFile, c.LineNumber, c.UserAgent)
+	return err
+}
+
+// purgeCSPReports supprime les rapports plus anciens que la durée de conservation.
+func purgeCSPReports(ctx context.Context, q querier, now time.Time) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM csp_reports WHERE created_at <= ?;`, dbTime(now.Add(-cspReportRetention)))
+	return err
+}
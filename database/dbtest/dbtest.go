@@ -0,0 +1,52 @@
+// Package dbtest fournit des bases jetables pour les tests : SQLite dans un
+// répertoire temporaire, PostgreSQL sur un serveur local démarré à la demande.
+package dbtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"forum/database"
+)
+
+// New crée une base SQLite vierge, migrée, dans un répertoire temporaire du
+// test et renvoie ses stores ; elle est fermée à la fin du test.
+func New(t testing.TB) database.Stores {
+	t.Helper()
+	return NewAt(t, filepath.Join(t.TempDir(), "forum.db"))
+}
+
+// NewAt crée, comme New, une base SQLite vierge au chemin path : d'autres
+// connexions peuvent l'ouvrir, comme celles des commandes d'administration.
+func NewAt(t testing.TB, path string) database.Stores {
+	t.Helper()
+	return open(t, database.SQLite, path)
+}
+
+// Each exécute fn sur une base vierge de chaque moteur, dans les sous-tests
+// « sqlite » et « postgres » ; le second est sauté si PostgreSQL n'est pas
+// disponible (voir NewPostgres).
+func Each(t *testing.T, fn func(t *testing.T, stores database.Stores)) {
+	t.Run(database.SQLite, func(t *testing.T) { fn(t, New(t)) })
+	t.Run(database.Postgres, func(t *testing.T) { fn(t, NewPostgres(t)) })
+}
+
+// Main exécute les tests du paquet puis arrête le serveur PostgreSQL démarré
+// pour eux. Les paquets qui utilisent NewPostgres ou Each l'appellent depuis
+// TestMain.
+func Main(m *testing.M) {
+	code := m.Run()
+	stopPostgres()
+	os.Exit(code)
+}
+
+func open(t testing.TB, backend, dsn string) database.Stores {
+	t.Helper()
+	stores, err := database.Open(backend, dsn)
+	if err != nil {
+		t.Fatalf("base de test : %v", err)
+	}
+	t.Cleanup(func() { stores.Close() })
+	return stores
+}
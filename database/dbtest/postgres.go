@@ -0,0 +1,138 @@
+package dbtest
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"forum/database"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresURLEnv désigne un serveur PostgreSQL existant (URL postgres://…
+// d'un rôle autorisé à créer des bases) à utiliser plutôt que d'en démarrer
+// un.
+const PostgresURLEnv = "FORUM_TEST_POSTGRES_URL"
+
+// postgresServer est le serveur des tests : chaque test y reçoit sa base.
+type postgresServer struct {
+	dir    string // répertoire du serveur démarré ici, vide pour un serveur externe
+	pgCtl  string
+	dsn    func(dbname string) string
+	dbs    atomic.Int64
+	failed error  // démarrage impossible alors que PostgreSQL est installé
+	skip   string // PostgreSQL absent
+}
+
+var (
+	pgOnce   sync.Once
+	pgServer *postgresServer
+)
+
+// NewPostgres crée une base PostgreSQL vierge, migrée, et renvoie ses stores,
+// comme New. Le serveur est celui de FORUM_TEST_POSTGRES_URL ou, à défaut, un
+// serveur local démarré au premier appel avec initdb et pg_ctl (cherchés dans
+// le PATH puis /usr/lib/postgresql) et arrêté par Main. Sans PostgreSQL, le
+// test est sauté.
+func NewPostgres(t testing.TB) database.Stores {
+	t.Helper()
+	pgOnce.Do(func() { pgServer = startPostgres() })
+	switch {
+	case pgServer.skip != "":
+		t.Skip(pgServer.skip)
+	case pgServer.failed != nil:
+		t.Fatalf("serveur PostgreSQL de test : %v", pgServer.failed)
+	}
+
+	admin, err := sql.Open("postgres", pgServer.dsn("postgres"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Les paquets de tests tournent en parallèle sur un serveur externe.
+	name := fmt.Sprintf("forum_test_%d_%d", os.Getpid(), pgServer.dbs.Add(1))
+	if _, err := admin.Exec("CREATE DATABASE " + name + ";"); err != nil {
+		admin.Close()
+		t.Fatalf("base de test : %v", err)
+	}
+	// Enregistré avant open : la base est fermée avant d'être supprimée.
+	t.Cleanup(func() {
+		admin.Exec("DROP DATABASE IF EXISTS " + name + ";")
+		admin.Close()
+	})
+	return open(t, database.Postgres, pgServer.dsn(name))
+}
+
+func startPostgres() *postgresServer {
+	if raw := os.Getenv(PostgresURLEnv); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return &postgresServer{failed: fmt.Errorf("%s : %w", PostgresURLEnv, err)}
+		}
+		return &postgresServer{dsn: func(dbname string) string {
+			u := *u
+			u.Path = "/" + dbname
+			return u.String()
+		}}
+	}
+
+	initdb, pgCtl := postgresBin("initdb"), postgresBin("pg_ctl")
+	if initdb == "" || pgCtl == "" {
+		return &postgresServer{skip: "PostgreSQL absent : initdb et pg_ctl introuvables (ou définir " + PostgresURLEnv + ")"}
+	}
+	if os.Geteuid() == 0 {
+		return &postgresServer{skip: "PostgreSQL refuse de démarrer en root (définir " + PostgresURLEnv + ")"}
+	}
+	dir, err := os.MkdirTemp("", "forum-pg-")
+	if err != nil {
+		return &postgresServer{failed: err}
+	}
+	s := &postgresServer{dir: dir, pgCtl: pgCtl, dsn: func(dbname string) string {
+		return fmt.Sprintf("host=%s user=postgres dbname=%s sslmode=disable", dir, dbname)
+	}}
+	data := filepath.Join(dir, "data")
+	// Connexions par socket Unix dans dir uniquement, sans fsync : le serveur
+	// ne survit pas aux tests.
+	steps := [][]string{
+		{initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync"},
+		{pgCtl, "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-w",
+			"-o", "-k " + dir + " -c listen_addresses='' -F", "start"},
+	}
+	for _, step := range steps {
+		if out, err := exec.Command(step[0], step[1:]...).CombinedOutput(); err != nil {
+			os.RemoveAll(dir)
+			return &postgresServer{failed: fmt.Errorf("%s : %w\n%s", filepath.Base(step[0]), err, out)}
+		}
+	}
+	return s
+}
+
+// postgresBin cherche un exécutable PostgreSQL ; Debian et Ubuntu ne les
+// mettent pas dans le PATH.
+func postgresBin(name string) string {
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	matches, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql/*/bin", name))
+	if len(matches) == 0 {
+		return ""
+	}
+	// Plusieurs versions installées : la dernière dans l'ordre des noms.
+	return matches[len(matches)-1]
+}
+
+// stopPostgres arrête le serveur démarré par NewPostgres et supprime ses
+// fichiers.
+func stopPostgres() {
+	if pgServer == nil || pgServer.dir == "" {
+		return
+	}
+	exec.Command(pgServer.pgCtl, "-D", filepath.Join(pgServer.dir, "data"), "-m", "immediate", "-w", "stop").Run()
+	os.RemoveAll(pgServer.dir)
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Moteurs de base de données pris en charge (database.driver).
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+// dialect regroupe ce qui diffère d'un moteur à l'autre. Les requêtes des
+// dépôts restent communes : écrites avec des « ? », réécrites en $1, $2…
+// par le pilote PostgreSQL (voir rebind).
+type dialect struct {
+	name   string
+	driver string // pilote database/sql instrumenté
+	schema string
+	// dsn complète la chaîne de connexion de la configuration.
+	dsn func(string) string
+	// columns liste les colonnes d'une table (paramètre : son nom), pour
+	// les migrations.
+	columns string
+}
+
+// schema est le schéma SQLite de SQL/database.sql, embarqué dans le binaire
+// pour que la base puisse être créée depuis n'importe quel répertoire (tests).
+//
+//go:embed SQL/database.sql
+var schema string
+
+// postgresSchema déclare d'emblée les colonnes ajoutées par les migrations
+// SQLite.
+//
+//go:embed SQL/postgres.sql
+var postgresSchema string
+
+var dialects = map[string]*dialect{
+	SQLite: {
+		name:    SQLite,
+		driver:  sqliteDriverName,
+		schema:  schema,
+		dsn:     sqliteDSN,
+		columns: "SELECT name FROM pragma_table_info(?);",
+	},
+	Postgres: {
+		name:    Postgres,
+		driver:  postgresDriverName,
+		schema:  postgresSchema,
+		dsn:     func(dsn string) string { return dsn },
+		columns: "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?;",
+	},
+}
+
+// Backend renvoie le moteur de la base (SQLite ou Postgres) ; SQLite pour des
+// dépôts assemblés à la main.
+func (s Stores) Backend() string {
+	return s.dialect().name
+}
+
+func lookupDialect(name string) (*dialect, error) {
+	d, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("moteur %q inconnu (attendu %q ou %q)", name, SQLite, Postgres)
+	}
+	return d, nil
+}
+
+// sqliteDSN ajoute au chemin de la base les options appliquées à chaque
+// connexion du pool :
+//   - clés étrangères vérifiées (SQLite ne le fait que sur demande) ;
+//   - journal WAL, pour que les lectures ne bloquent pas l'écriture en cours,
+//     avec synchronous=NORMAL, sûr en WAL et bien moins coûteux que FULL ;
+//   - busy_timeout, pour attendre un verrou plutôt qu'échouer aussitôt ;
+//   - transactions BEGIN IMMEDIATE : une transaction qui lit puis écrit
+//     prend le verrou d'écriture d'emblée et ne peut pas échouer à mi-course
+//     faute de pouvoir l'obtenir.
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_foreign_keys=on&_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=%d&_txlock=immediate",
+		path, sep, BusyTimeout.Milliseconds())
+}
+
+// rebind remplace les « ? » de query par les paramètres numérotés de
+// PostgreSQL ($1, $2…), sauf dans les chaînes littérales.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n, quoted := 0, false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// exportFormat identifie les fichiers écrits par Export.
+const exportFormat = "forum-export"
+
+// tables liste les tables du forum, chacune après celles qu'elle référence.
+var tables = []string{
+	"users", "categories", "posts", "comments", "likes", "post_categories",
+	"notifications", "sessions", "recovery_codes", "login_challenges",
+	"settings", "oauth_identities", "oauth_pending", "login_throttle",
+	"csp_reports", "audit_log",
+}
+
+// transientTables ne sont pas exportées : sessions, connexions en cours et
+// suivi des échecs n'ont de sens que sur la base qui les a produites.
+var transientTables = map[string]bool{
+	"sessions":         true,
+	"login_challenges": true,
+	"oauth_pending":    true,
+	"login_throttle":   true,
+}
+
+// dump est le contenu d'un export : les lignes de chaque table, avec la
+// version du schéma qui les a produites.
+type dump struct {
+	Format     string      `json:"format"`
+	Version    int         `json:"version"`
+	ExportedAt time.Time   `json:"exported_at"`
+	Tables     []tableDump `json:"tables"`
+}
+
+type tableDump struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// schemaVersion est la version du schéma après toutes les migrations.
+func schemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Export écrit dans w, en JSON, le contenu de la base ouverte, hors données
+// de connexion temporaires. Le fichier se recharge avec Import sur l'un ou
+// l'autre moteur : il sert aussi à passer de SQLite à PostgreSQL. Une base
+// aux lignes orphelines est refusée : l'import échouerait sur leurs clés
+// étrangères.
+func (s Stores) Export(ctx context.Context, w io.Writer) error {
+	orphans, err := s.CheckConsistency(ctx, false)
+	if err != nil {
+		return err
+	}
+	if len(orphans) > 0 {
+		return fmt.Errorf("%d table(s) avec des lignes orphelines : les supprimer avec « forum check -repair » avant d'exporter", len(orphans))
+	}
+	d := dump{Format: exportFormat, Version: schemaVersion(), ExportedAt: time.Now().UTC()}
+	err = inTx(ctx, s.q, func(tx querier) error {
+		for _, table := range tables {
+			if transientTables[table] {
+				continue
+			}
+			t, err := exportTable(ctx, tx, table)
+			if err != nil {
+				return fmt.Errorf("%s : %w", table, err)
+			}
+			d.Tables = append(d.Tables, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(d)
+}
+
+func exportTable(ctx context.Context, q querier, table string) (tableDump, error) {
+	t := tableDump{Name: table, Rows: [][]any{}}
+	rows, err := q.QueryContext(ctx, "SELECT * FROM "+table+";")
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+	if t.Columns, err = rows.Columns(); err != nil {
+		return t, err
+	}
+	for rows.Next() {
+		row := make([]any, len(t.Columns))
+		dest := make([]any, len(row))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return t, err
+		}
+		for i, v := range row {
+			switch v := v.(type) {
+			case time.Time:
+				row[i] = dbTime(v)
+			case []byte:
+				row[i] = string(v)
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t, rows.Err()
+}
+
+// Import charge dans la base ouverte, vide, un fichier écrit par Export
+// avec la même version du schéma. Tout est chargé dans une transaction : en
+// cas d'erreur, la base reste vide.
+func (s Stores) Import(ctx context.Context, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var d dump
+	if err := dec.Decode(&d); err != nil {
+		return fmt.Errorf("export illisible : %w", err)
+	}
+	if d.Format != exportFormat {
+		return errors.New("ce fichier n'est pas un export du forum")
+	}
+	if d.Version != schemaVersion() {
+		return fmt.Errorf("export du schéma %d, base au schéma %d : exporter et importer avec la même version du forum",
+			d.Version, schemaVersion())
+	}
+	known := map[string]bool{}
+	for _, table := range tables {
+		known[table] = !transientTables[table]
+	}
+	return inTx(ctx, s.q, func(tx querier) error {
+		for _, table := range tables {
+			var n int
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+";").Scan(&n); err != nil {
+				return err
+			}
+			if n > 0 {
+				return fmt.Errorf("la base cible n'est pas vide (table %s)", table)
+			}
+		}
+		for _, t := range d.Tables {
+			if !known[t.Name] {
+				return fmt.Errorf("table %q inattendue dans l'export", t.Name)
+			}
+			if err := importTable(ctx, tx, s.dialect().columns, t); err != nil {
+				return fmt.Errorf("%s : %w", t.Name, err)
+			}
+		}
+		if s.dialect().name == Postgres {
+			return resetSequences(ctx, tx, d.Tables)
+		}
+		return nil
+	})
+}
+
+func importTable(ctx context.Context, tx querier, columns string, t tableDump) error {
+	if len(t.Rows) == 0 {
+		return nil
+	}
+	// Les noms de colonnes viennent du fichier : seules celles de la table
+	// cible sont acceptées avant d'être placées dans la requête.
+	rows, err := tx.QueryContext(ctx, columns, t.Name)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, c := range t.Columns {
+		if !existing[c] {
+			return fmt.Errorf("colonne %q inconnue", c)
+		}
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", t.Name,
+		strings.Join(t.Columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(t.Columns)), ", "))
+	for _, row := range t.Rows {
+		if len(row) != len(t.Columns) {
+			return fmt.Errorf("ligne de %d valeurs pour %d colonnes", len(row), len(t.Columns))
+		}
+		for i, v := range row {
+			if n, ok := v.(json.Number); ok {
+				if row[i], err = n.Int64(); err != nil {
+					row[i], err = n.Float64()
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := tx.ExecContext(ctx, query, row...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetSequences place les séquences des colonnes id après les identifiants
+// importés, que PostgreSQL n'a pas lui-même attribués.
+func resetSequences(ctx context.Context, tx querier, dumped []tableDump) error {
+	for _, t := range dumped {
+		if len(t.Rows) == 0 || !slices.Contains(t.Columns, "id") {
+			continue
+		}
+		var sequence *string
+		if err := tx.QueryRowContext(ctx, "SELECT pg_get_serial_sequence(?, 'id');", t.Name).Scan(&sequence); err != nil {
+			return err
+		}
+		if sequence == nil {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "SELECT setval(?, MAX(id)) FROM "+t.Name+" HAVING MAX(id) IS NOT NULL;", *sequence); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	stores := dbtest.New(t)
+	alice, _ := stores.Users.Create(ctx, "alice", "alice@example.com", "hash")
+	bob, _ := stores.Users.Create(ctx, "bob", "bob@example.com", "hash")
+	stores.Users.SetRole(ctx, 0, bob, "moderator")
+	stores.Users.SetBanned(ctx, 0, alice, true)
+	postID, _ := stores.Posts.Create(ctx, alice, "exporté", "contenu", "", true)
+	commentID, _ := stores.Comments.Create(ctx, postID, bob, "réponse")
+	stores.Posts.SetVote(ctx, bob, postID, 1)
+	stores.Notifications.Create(ctx, alice, "commentaire", postID, commentID)
+	stores.Sessions.Create(ctx, database.Session{ID: "temporaire", UserID: alice, ExpiresAt: time.Now().Add(time.Hour)})
+	before, _ := stores.Posts.GetByID(ctx, postID)
+
+	var export bytes.Buffer
+	if err := stores.Export(ctx, &export); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(export.String(), "temporaire") {
+		t.Error("sessions exportées")
+	}
+	stores.Close()
+
+	stores = dbtest.New(t)
+	if err := stores.Import(ctx, bytes.NewReader(export.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	u, err := stores.Users.GetByUsername(ctx, "alice")
+	if err != nil || u.ID != alice || u.BannedAt.IsZero() {
+		t.Errorf("alice importée : %+v, %v", u, err)
+	}
+	if u, _ := stores.Users.GetByID(ctx, bob); u.Role != "moderator" {
+		t.Errorf("rôle de bob : %q", u.Role)
+	}
+	after, err := stores.Posts.GetByID(ctx, postID)
+	if err != nil || after.Title != before.Title || after.Likes != 1 || !after.CreatedAt.Equal(before.CreatedAt) {
+		t.Errorf("post importé : %+v, %v ; attendu %+v", after, err, before)
+	}
+	if comments, _ := stores.Comments.ListByPost(ctx, postID); len(comments) != 1 || comments[0].ID != commentID {
+		t.Errorf("commentaires importés : %+v", comments)
+	}
+	if n, _ := stores.Notifications.CountUnread(ctx, alice); n != 1 {
+		t.Errorf("%d notification(s) importée(s)", n)
+	}
+	// Les identifiants attribués ensuite suivent ceux importés.
+	if id, err := stores.Users.Create(ctx, "carol", "carol@example.com", "hash"); err != nil || id <= bob {
+		t.Errorf("Create après import = %d, %v", id, err)
+	}
+
+	if err := stores.Import(ctx, bytes.NewReader(export.Bytes())); err == nil || !strings.Contains(err.Error(), "pas vide") {
+		t.Errorf("import dans une base non vide : %v", err)
+	}
+}
+
+func TestImportRejectsOtherSchemas(t *testing.T) {
+	stores := dbtest.New(t)
+	for name, input := range map[string]string{
+		"autre format":  `{"format": "autre", "version": 1}`,
+		"autre version": `{"format": "forum-export", "version": 1}`,
+		"table inconnue": `{"format": "forum-export", "version": 13, "tables": [
+			{"name": "sessions", "columns": ["session_id"], "rows": [["x"]]}]}`,
+		"colonne inconnue": `{"format": "forum-export", "version": 13, "tables": [
+			{"name": "users", "columns": ["id", "username; DROP TABLE users"], "rows": [[1, "x"]]}]}`,
+	} {
+		if err := stores.Import(context.Background(), strings.NewReader(input)); err == nil {
+			t.Errorf("%s : import accepté", name)
+		}
+	}
+}
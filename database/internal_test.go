@@ -0,0 +1,7 @@
+package database
+
+import "database/sql"
+
+// RawDB expose aux tests la base sous-jacente, pour des vérifications que
+// les dépôts n'offrent pas.
+func (s Stores) RawDB() *sql.DB { return s.db }
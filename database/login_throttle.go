@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Portées du suivi des échecs de connexion.
+const (
+	ThrottleUser       = "user"       // compte existant, clé = ID utilisateur
+	ThrottleIdentifier = "identifier" // identifiant inconnu, clé = identifiant saisi
+	ThrottleIP         = "ip"         // adresse IP du client
+)
+
+// LoginThrottle compte les échecs de connexion consécutifs d'une clé.
+type LoginThrottle struct {
+	Scope         string
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time // zéro si jamais verrouillé
+}
+
+// LockedAccount décrit un compte verrouillé pour la page d'administration.
+type LockedAccount struct {
+	UserID        int
+	Username      string
+	Email         string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// throttleStore implémente ThrottleStore.
+type throttleStore struct {
+	db querier
+}
+
+func (s *throttleStore) Get(ctx context.Context, scope, key string) (LoginThrottle, error) {
+	t := LoginThrottle{Scope: scope, Key: key}
+	query := `SELECT failures, last_failure_at, locked_until FROM login_throttle WHERE scope = ? AND key = ?;`
+	err := s.db.QueryRowContext(ctx, query, scope, key).Scan(&t.Failures, scanTime(&t.LastFailureAt), scanTime(&t.LockedUntil))
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, nil
+	}
+	return t, err
+}
+
+func (s *throttleStore) RecordFailure(ctx context.Context, scope, key string, now time.Time) (LoginThrottle, error) {
+	query := `
+		INSERT INTO login_throttle (scope, key, failures, last_failure_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT(scope, key) DO UPDATE SET failures = login_throttle.failures + 1, last_failure_at = excluded.last_failure_at;
+	`
+	if _, err := s.db.ExecContext(ctx, query, scope, key, dbTime(now)); err != nil {
+		return LoginThrottle{}, err
+	}
+	return s.Get(ctx, scope, key)
+}
+
+func (s *throttleStore) Lock(ctx context.Context, scope, key string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE login_throttle SET locked_until = ? WHERE scope = ? AND key = ?;",
+		dbTime(until), scope, key)
+	return err
+}
+
+func (s *throttleStore) Clear(ctx context.Context, scope, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_throttle WHERE scope = ? AND key = ?;", scope, key)
+	return err
+}
+
+func (s *throttleStore) LockedAccounts(ctx context.Context, now time.Time) ([]LockedAccount, error) {
+	query := `
+		SELECT u.id, u.username, u.email, t.failures, t.last_failure_at, t.locked_until
+		FROM login_throttle t
+		JOIN users u ON t.key = CAST(u.id AS TEXT)
+		WHERE t.scope = ? AND t.locked_until > ?
+		ORDER BY t.locked_until DESC;
+	`
+	rows, err := s.db.QueryContext(ctx, query, ThrottleUser, dbTime(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var accounts []LockedAccount
+	for rows.Next() {
+		var a LockedAccount
+		if err := rows.Scan(&a.UserID, &a.Username, &a.Email, &a.Failures, scanTime(&a.LastFailureAt), scanTime(&a.LockedUntil)); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// loginThrottleRetention est la durée après laquelle des échecs sans verrou
+// actif sont oubliés.
+const loginThrottleRetention = 24 * time.Hour
+
+// purgeLoginThrottle oublie les échecs anciens dont le verrou est levé.
+func purgeLoginThrottle(ctx context.Context, q querier, now time.Time) error {
+	query := `DELETE FROM login_throttle WHERE last_failure_at <= ? AND (locked_until IS NULL OR locked_until <= ?);`
+	_, err := q.ExecContext(ctx, query, dbTime(now.Add(-loginThrottleRetention)), dbTime(now))
+	return err
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// AppliedMigration décrit une migration enregistrée dans schema_migrations.
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// AppliedMigrations renvoie les migrations appliquées à la base ouverte, de
+// la plus ancienne à la plus récente.
+func (s Stores) AppliedMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var applied []AppliedMigration
+	for rows.Next() {
+		var m AppliedMigration
+		if err := rows.Scan(&m.Version, &m.Name, scanTime(&m.AppliedAt)); err != nil {
+			return nil, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, rows.Err()
+}
+
+// Reindex reconstruit les index de la base et met à jour les statistiques
+// dont le planificateur se sert pour les choisir. Le forum n'a pas d'index
+// de recherche plein texte : ce sont ces index SQL qui servent les listes
+// de posts, les fils de commentaires et les recherches de comptes.
+func (s Stores) Reindex(ctx context.Context) error {
+	statements := []string{"REINDEX;", "ANALYZE;"}
+	if s.dialect().name == Postgres {
+		// REINDEX DATABASE exige d'en être propriétaire ; les tables du
+		// forum appartiennent à son rôle.
+		statements = nil
+		for _, table := range tables {
+			statements = append(statements, "REINDEX TABLE "+table+";")
+		}
+		statements = append(statements, "ANALYZE;")
+	}
+	for _, stmt := range statements {
+		if _, err := s.q.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migration décrit une évolution du schéma appliquée une seule fois.
+// Les tables nouvelles restent déclarées dans SQL/database.sql (et
+// SQL/postgres.sql) ; les migrations servent aux changements sur les tables
+// existantes (colonnes).
+type migration struct {
+	version int
+	name    string
+	up      func(tx migrationTx) error
+	// postgres remplace up sur PostgreSQL. nil : la migration est déjà
+	// intégrée à SQL/postgres.sql et seulement enregistrée comme appliquée.
+	postgres func(tx migrationTx) error
+}
+
+// migrationTx est la transaction d'une migration, avec le dialecte de la
+// base qu'elle modifie.
+type migrationTx struct {
+	*sql.Tx
+	dialect *dialect
+}
+
+var migrations = []migration{
+	{1, "totp sur les utilisateurs", func(tx migrationTx) error {
+		if err := addColumn(tx, "users", "totp_secret", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		return addColumn(tx, "users", "totp_enabled", "INTEGER NOT NULL DEFAULT 0")
+	}, nil},
+	{2, "appareil et activité des sessions", func(tx migrationTx) error {
+		columns := [][2]string{
+			{"user_agent", "TEXT NOT NULL DEFAULT ''"},
+			{"ip", "TEXT NOT NULL DEFAULT ''"},
+			{"remember", "INTEGER NOT NULL DEFAULT 0"},
+			{"last_seen_at", "DATETIME"},
+		}
+		for _, c := range columns {
+			if err := addColumn(tx, "sessions", c[0], c[1]); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("UPDATE sessions SET last_seen_at = created_at WHERE last_seen_at IS NULL;"); err != nil {
+			return err
+		}
+		return addColumn(tx, "login_challenges", "remember", "INTEGER NOT NULL DEFAULT 0")
+	}, nil},
+	{3, "comptes OAuth sans mot de passe", func(tx migrationTx) error {
+		// Les anciens callbacks OAuth stockaient la chaîne "oauth" comme hash.
+		_, err := tx.Exec("UPDATE users SET password = '' WHERE password = 'oauth';")
+		return err
+	}, nil},
+	{4, "rôle OIDC des inscriptions en attente", func(tx migrationTx) error {
+		return addColumn(tx, "oauth_pending", "role", "TEXT NOT NULL DEFAULT ''")
+	}, nil},
+	{5, "rôle et modération sur les nouvelles bases", func(tx migrationTx) error {
+		// database.sql déclare users et posts deux fois : sur une base neuve,
+		// seule la première version (sans ces colonnes) est créée.
+		if err := addColumn(tx, "users", "role", "TEXT DEFAULT 'user'"); err != nil {
+			return err
+		}
+		return addColumn(tx, "posts", "moderation_status", "TEXT DEFAULT 'pending'")
+	}, nil},
+	{6, "jeton CSRF des sessions", func(tx migrationTx) error {
+		return addColumn(tx, "sessions", "csrf_token", "TEXT NOT NULL DEFAULT ''")
+	}, nil},
+	{7, "fuseau horaire des utilisateurs", func(tx migrationTx) error {
+		return addColumn(tx, "users", "timezone", "TEXT NOT NULL DEFAULT ''")
+	}, nil},
+	{8, "références absentes à NULL plutôt qu'à 0", func(tx migrationTx) error {
+		// Avec les clés étrangères actives, 0 désignerait un post ou un
+		// commentaire inexistant.
+		for _, c := range [][2]string{
+			{"notifications", "post_id"},
+			{"notifications", "comment_id"},
+			{"likes", "post_id"},
+			{"likes", "comment_id"},
+		} {
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = NULL WHERE %s = 0;", c[0], c[1], c[1])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil},
+	{9, "index des posts par statut de modération", func(tx migrationTx) error {
+		// Sur une base neuve, moderation_status n'existe qu'après la migration 5.
+		_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_posts_status ON posts(moderation_status, created_at);")
+		return err
+	}, nil},
+	{10, "suspension des comptes", func(tx migrationTx) error {
+		return addColumn(tx, "users", "banned_at", "DATETIME")
+	}, func(tx migrationTx) error {
+		return addColumn(tx, "users", "banned_at", "TIMESTAMP")
+	}},
+	{11, "dernier pas TOTP accepté", func(tx migrationTx) error {
+		return addColumn(tx, "users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0")
+	}, nil},
+	{12, "comptes créés par un fournisseur", func(tx migrationTx) error {
+		return addColumn(tx, "oauth_identities", "created_user", "INTEGER NOT NULL DEFAULT 0")
+	}, func(tx migrationTx) error {
+		return addColumn(tx, "oauth_identities", "created_user", "BOOLEAN NOT NULL DEFAULT FALSE")
+	}},
+	{13, "page de retour des connexions en attente du second facteur", func(tx migrationTx) error {
+		return addColumn(tx, "login_challenges", "redirect", "TEXT NOT NULL DEFAULT ''")
+	}, func(tx migrationTx) error {
+		return addColumn(tx, "login_challenges", "redirect", "TEXT NOT NULL DEFAULT ''")
+	}},
+}
+
+// runMigrations applique, dans l'ordre, les migrations pas encore enregistrées
+// dans schema_migrations.
+func runMigrations(db *sql.DB, d *dialect) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	for _, m := range migrations {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = ?;", m.version).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		up := m.up
+		if d.name == Postgres {
+			up = m.postgres
+		}
+		if up != nil {
+			if err := up(migrationTx{tx, d}); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?);", m.version, m.name); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingMigrations renvoie les versions connues qui ne sont pas encore
+// appliquées sur la base.
+func (s Stores) PendingMigrations(ctx context.Context) ([]int, error) {
+	if s.db == nil {
+		return nil, errNoDatabase
+	}
+	applied := map[int]bool{}
+	rows, err := s.db.QueryContext(ctx, "SELECT version FROM schema_migrations;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var pending []int
+	for _, m := range migrations {
+		if !applied[m.version] {
+			pending = append(pending, m.version)
+		}
+	}
+	return pending, nil
+}
+
+// addColumn ajoute une colonne si elle n'existe pas déjà (les bases créées à la
+// main ont parfois reçu les colonnes via ALTER TABLE).
+func addColumn(tx migrationTx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+	return err
+}
+
+func columnExists(tx migrationTx, table, column string) (bool, error) {
+	rows, err := tx.Query(tx.dialect.columns, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Notification représente une notification pour un utilisateur.
+type Notification struct {
+	ID        int
+	UserID    int
+	Message   string
+	PostID    int
+	CommentID int
+	CreatedAt time.Time
+}
+
+// notificationStore implémente NotificationStore sur SQLite.
+type notificationStore struct {
+	db querier
+}
+
+func (s *notificationStore) Create(ctx context.Context, userID int, message string, postID, commentID int) error {
+	query := `INSERT INTO notifications (user_id, message, post_id, comment_id) VALUES (?, ?, ?, ?);`
+	if _, err := s.db.ExecContext(ctx, query, userID, message, nullID(postID), nullID(commentID)); err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	return nil
+}
+
+func (s *notificationStore) ListByUser(ctx context.Context, userID int) ([]Notification, error) {
+	query := `
+		SELECT id, user_id, message, COALESCE(post_id, 0), COALESCE(comment_id, 0), created_at
+		FROM notifications
+		WHERE user_id = ?
+		ORDER BY created_at DESC;
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notifs []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Message, &n.PostID, &n.CommentID, scanTime(&n.CreatedAt)); err != nil {
+			return nil, err
+		}
+		notifs = append(notifs, n)
+	}
+	return notifs, rows.Err()
+}
+
+func (s *notificationStore) CountUnread(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := queryRowPrepared(ctx, s.db, "SELECT COUNT(*) FROM notifications WHERE user_id = ?;", userID).Scan(&n)
+	return n, err
+}
+
+func (s *notificationStore) DeleteByUser(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM notifications WHERE user_id = ?;", userID)
+	return err
+}
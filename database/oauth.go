@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// OAuthIdentity lie un compte chez un fournisseur externe (provider + subject)
+// à un utilisateur du forum.
+type OAuthIdentity struct {
+	ID        int
+	UserID    int
+	Provider  string
+	Subject   string
+	Email     string
+	// CreatedUser indique que le compte a été créé par cette identité : le
+	// fournisseur fait alors foi pour son rôle.
+	CreatedUser bool
+	CreatedAt   time.Time
+}
+
+// PendingOAuth conserve l'identité renvoyée par un fournisseur le temps que
+// le nouvel utilisateur choisisse son nom d'utilisateur.
+type PendingOAuth struct {
+	Token     string
+	Provider  string
+	Subject   string
+	Email     string
+	Name      string
+	Role      string // rôle donné par le fournisseur OIDC, vide sinon
+	ExpiresAt time.Time
+}
+
+// identityStore implémente IdentityStore.
+type identityStore struct {
+	db querier
+}
+
+func (s *identityStore) Get(ctx context.Context, provider, subject string) (OAuthIdentity, error) {
+	var i OAuthIdentity
+	query := `SELECT id, user_id, provider, subject, email, created_user, created_at FROM oauth_identities WHERE provider = ? AND subject = ?;`
+	err := s.db.QueryRowContext(ctx, query, provider, subject).Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedUser, scanTime(&i.CreatedAt))
+	return i, err
+}
+
+func (s *identityStore) ListByUser(ctx context.Context, userID int) ([]OAuthIdentity, error) {
+	query := `SELECT id, user_id, provider, subject, email, created_user, created_at FROM oauth_identities WHERE user_id = ? ORDER BY provider;`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var identities []OAuthIdentity
+	for rows.Next() {
+		var i OAuthIdentity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedUser, scanTime(&i.CreatedAt)); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func (s *identityStore) Link(ctx context.Context, userID int, provider, subject, email string) error {
+	return linkIdentity(ctx, s.db, userID, provider, subject, email, false)
+}
+
+func linkIdentity(ctx context.Context, q querier, userID int, provider, subject, email string, createdUser bool) error {
+	query := `INSERT INTO oauth_identities (user_id, provider, subject, email, created_user) VALUES (?, ?, ?, ?, ?);`
+	if _, err := q.ExecContext(ctx, query, userID, provider, subject, email, createdUser); err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
+
+func (s *identityStore) Unlink(ctx context.Context, userID int, provider string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM oauth_identities WHERE user_id = ? AND provider = ?;", userID, provider)
+	return err
+}
+
+func (s *identityStore) CreateUser(ctx context.Context, username, email, provider, subject string) (int, error) {
+	var id int
+	err := inTx(ctx, s.db, func(tx querier) error {
+		err := tx.QueryRowContext(ctx, `INSERT INTO users (username, email, password, photo) VALUES (?, ?, '', ?) RETURNING id;`, username, email, "profil.png").Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return linkIdentity(ctx, tx, id, provider, subject, email, true)
+	})
+	return id, err
+}
+
+func (s *identityStore) CreatePending(ctx context.Context, p PendingOAuth) error {
+	query := `INSERT INTO oauth_pending (token, provider, subject, email, name, role, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?);`
+	_, err := s.db.ExecContext(ctx, query, p.Token, p.Provider, p.Subject, p.Email, p.Name, p.Role, dbTime(p.ExpiresAt))
+	return err
+}
+
+func (s *identityStore) GetPending(ctx context.Context, token string, now time.Time) (PendingOAuth, error) {
+	var p PendingOAuth
+	query := `SELECT token, provider, subject, email, name, role, expires_at FROM oauth_pending WHERE token = ?;`
+	if err := s.db.QueryRowContext(ctx, query, token).Scan(&p.Token, &p.Provider, &p.Subject, &p.Email, &p.Name, &p.Role, scanTime(&p.ExpiresAt)); err != nil {
+		return p, err
+	}
+	if now.After(p.ExpiresAt) {
+		_ = s.DeletePending(ctx, token)
+		return p, fmt.Errorf("inscription expirée")
+	}
+	return p, nil
+}
+
+func (s *identityStore) DeletePending(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM oauth_pending WHERE token = ?;", token)
+	return err
+}
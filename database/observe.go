@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"forum/metrics"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Pilotes instrumentés : chaque requête est chronométrée pour la métrique
+// forum_db_query_duration_seconds.
+const (
+	sqliteDriverName   = "sqlite3_observed"
+	postgresDriverName = "postgres_observed"
+)
+
+func init() {
+	sql.Register(sqliteDriverName, &observedDriver{})
+	sql.Register(postgresDriverName, &postgresDriver{})
+}
+
+type observedDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *observedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &observedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// observedConn reprend toutes les méthodes de la connexion SQLite et
+// chronomètre les exécutions directes et préparées.
+type observedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *observedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(query, time.Now())
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+func (c *observedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(query, time.Now())
+	return c.SQLiteConn.QueryContext(ctx, query, args)
+}
+
+func (c *observedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &observedStmt{stmt.(*sqlite3.SQLiteStmt), query}, nil
+}
+
+type observedStmt struct {
+	*sqlite3.SQLiteStmt
+	query string
+}
+
+func (s *observedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(s.query, time.Now())
+	return s.SQLiteStmt.ExecContext(ctx, args)
+}
+
+func (s *observedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(s.query, time.Now())
+	return s.SQLiteStmt.QueryContext(ctx, args)
+}
+
+// queryLabels met en cache l'opération et la table de chaque texte SQL.
+var queryLabels sync.Map
+
+var tablePattern = regexp.MustCompile(`(?i)\b(?:from|into|update|table(?: if not exists)?)\s+([a-z_]+)`)
+
+func observeQuery(query string, start time.Time) {
+	labels, ok := queryLabels.Load(query)
+	if !ok {
+		labels = classifyQuery(query)
+		queryLabels.Store(query, labels)
+	}
+	l := labels.([2]string)
+	metrics.ObserveQuery(l[0], l[1], time.Since(start))
+}
+
+// classifyQuery extrait le premier mot-clé (select, insert…) et la première
+// table citée ; le nombre de valeurs reste borné par le schéma.
+func classifyQuery(query string) [2]string {
+	op := "other"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		switch kw := strings.ToLower(fields[0]); kw {
+		case "select", "insert", "update", "delete", "create", "alter", "pragma", "with":
+			op = kw
+		}
+	}
+	table := ""
+	if m := tablePattern.FindStringSubmatch(query); m != nil {
+		table = strings.ToLower(m[1])
+	}
+	return [2]string{op, table}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresDriver est le pilote lib/pq instrumenté comme observedDriver ; il
+// réécrit en plus les « ? » des requêtes communes en $1, $2…
+type postgresDriver struct {
+	pq.Driver
+}
+
+func (d *postgresDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	c := &observedPostgresConn{conn.(pqConn)}
+	// Dates en UTC, comme sur SQLite : CURRENT_TIMESTAMP et les colonnes
+	// TIMESTAMP ne dépendent plus du fuseau du serveur.
+	if _, err := c.pqConn.ExecContext(context.Background(), "SET TIME ZONE 'UTC';", nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// pqConn regroupe les méthodes de la connexion lib/pq, dont le type n'est
+// pas exporté.
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type observedPostgresConn struct {
+	pqConn
+}
+
+func (c *observedPostgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(query, time.Now())
+	return c.pqConn.ExecContext(ctx, rebind(query), args)
+}
+
+func (c *observedPostgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(query, time.Now())
+	return c.pqConn.QueryContext(ctx, rebind(query), args)
+}
+
+func (c *observedPostgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.pqConn.PrepareContext(ctx, rebind(query))
+	if err != nil {
+		return nil, err
+	}
+	return &observedPostgresStmt{stmt.(pqStmt), query}, nil
+}
+
+type pqStmt interface {
+	driver.Stmt
+	driver.StmtExecContext
+	driver.StmtQueryContext
+}
+
+type observedPostgresStmt struct {
+	pqStmt
+	query string
+}
+
+func (s *observedPostgresStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(s.query, time.Now())
+	return s.pqStmt.ExecContext(ctx, args)
+}
+
+func (s *observedPostgresStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(s.query, time.Now())
+	return s.pqStmt.QueryContext(ctx, args)
+}
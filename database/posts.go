@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Post représente un post avec son statut de modération.
+type Post struct {
+	ID              int
+	UserID          int
+	Username        string
+	Title           string
+	Content         string
+	OriginalContent string
+	ImagePath       string
+	CreatedAt       time.Time
+	ModifiedAt      time.Time
+	Likes           int
+	Dislikes        int
+}
+
+// postStore implémente PostStore sur SQLite.
+type postStore struct {
+	db querier
+}
+
+const postSelect = `
+		SELECT p.id, p.user_id, u.username, p.title, p.content, p.original_content, p.image_path, p.created_at, p.modified_at
+		FROM posts p
+		JOIN users u ON p.user_id = u.id`
+
+func (s *postStore) scan(ctx context.Context, row interface{ Scan(...any) error }) (Post, error) {
+	var p Post
+	if err := row.Scan(&p.ID, &p.UserID, &p.Username, &p.Title, &p.Content, &p.OriginalContent, &p.ImagePath, scanTime(&p.CreatedAt), scanTime(&p.ModifiedAt)); err != nil {
+		return p, err
+	}
+	p.Likes, p.Dislikes, _ = countVotes(ctx, s.db, "post_id", p.ID)
+	return p, nil
+}
+
+func (s *postStore) list(ctx context.Context, query string, args ...any) ([]Post, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query posts: %w", err)
+	}
+	defer rows.Close()
+	var posts []Post
+	for rows.Next() {
+		p, err := s.scan(ctx, rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan post row: %w", err)
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return posts, nil
+}
+
+func (s *postStore) Create(ctx context.Context, userID int, title, content, imagePath string, approved bool) (int, error) {
+	status := "pending"
+	if approved {
+		status = "approved"
+	}
+	var id int
+	query := `INSERT INTO posts (user_id, title, content, original_content, image_path, moderation_status) VALUES (?, ?, ?, ?, ?, ?) RETURNING id;`
+	if err := s.db.QueryRowContext(ctx, query, userID, title, content, content, imagePath, status).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to create post: %w", err)
+	}
+	return id, nil
+}
+
+func (s *postStore) GetByID(ctx context.Context, id int) (Post, error) {
+	p, err := s.scan(ctx, s.db.QueryRowContext(ctx, postSelect+" WHERE p.id = ? AND p.moderation_status = 'approved';", id))
+	if err != nil {
+		return p, fmt.Errorf("failed to get post by ID: %w", err)
+	}
+	return p, nil
+}
+
+func (s *postStore) List(ctx context.Context) ([]Post, error) {
+	return s.list(ctx, postSelect+" WHERE p.moderation_status = 'approved' ORDER BY p.created_at DESC;")
+}
+
+func (s *postStore) Recent(ctx context.Context, limit int) ([]Post, error) {
+	return s.list(ctx, postSelect+" WHERE p.moderation_status = 'approved' ORDER BY p.created_at DESC LIMIT ?;", limit)
+}
+
+func (s *postStore) Pending(ctx context.Context) ([]Post, error) {
+	return s.list(ctx, postSelect+" WHERE p.moderation_status = 'pending' ORDER BY p.created_at DESC;")
+}
+
+func (s *postStore) CountPending(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE moderation_status = 'pending';").Scan(&n)
+	return n, err
+}
+
+func (s *postStore) Update(ctx context.Context, id, userID int, title, content, imagePath string) error {
+	var oldContent string
+	var oldOriginal sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT content, original_content FROM posts WHERE id = ? AND user_id = ?;", id, userID).Scan(&oldContent, &oldOriginal)
+	if err != nil {
+		return err
+	}
+	if !oldOriginal.Valid || oldOriginal.String == "" {
+		oldOriginal.String = oldContent
+	}
+	query := "UPDATE posts SET title = ?, content = ?, image_path = ?, modified_at = CURRENT_TIMESTAMP, original_content = ? WHERE id = ? AND user_id = ?;"
+	_, err = s.db.ExecContext(ctx, query, title, content, imagePath, oldOriginal.String, id, userID)
+	return err
+}
+
+func (s *postStore) Delete(ctx context.Context, id, userID int) error {
+	return inTx(ctx, s.db, func(tx querier) error {
+		var n int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE id = ? AND user_id = ?;", id, userID).Scan(&n); err != nil || n == 0 {
+			return err
+		}
+		return deletePost(ctx, tx, id)
+	})
+}
+
+func (s *postStore) AdminDelete(ctx context.Context, id int) error {
+	return inTx(ctx, s.db, func(tx querier) error {
+		return deletePost(ctx, tx, id)
+	})
+}
+
+// deletePost supprime un post et tout ce qui en dépend. Les clés étrangères
+// des bases existantes n'ont pas de ON DELETE CASCADE : les lignes liées
+// sont supprimées explicitement, enfants d'abord. tx doit être une
+// transaction.
+func deletePost(ctx context.Context, tx querier, id int) error {
+	if err := deleteComments(ctx, tx, "post_id = ?", id); err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"DELETE FROM likes WHERE post_id = ?;",
+		"DELETE FROM notifications WHERE post_id = ?;",
+		"DELETE FROM post_categories WHERE post_id = ?;",
+		"DELETE FROM posts WHERE id = ?;",
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postStore) SetModerationStatus(ctx context.Context, id int, status string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE posts SET moderation_status = ? WHERE id = ?;", status, id)
+	return err
+}
+
+func (s *postStore) SetVote(ctx context.Context, userID, postID, value int) error {
+	return setVote(ctx, s.db, "post_id", userID, postID, value)
+}
+
+// setVote enregistre le vote d'un utilisateur sur un post ou un commentaire
+// (column vaut "post_id" ou "comment_id"), en remplaçant son vote précédent.
+func setVote(ctx context.Context, db querier, column string, userID, targetID, value int) error {
+	var id int
+	err := db.QueryRowContext(ctx, "SELECT id FROM likes WHERE user_id = ? AND "+column+" = ?;", userID, targetID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err := db.ExecContext(ctx, "INSERT INTO likes (user_id, "+column+", value) VALUES (?, ?, ?);", userID, targetID, value)
+		return err
+	} else if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "UPDATE likes SET value = ? WHERE id = ?;", value, id)
+	return err
+}
+
+// countVotes compte les likes et dislikes d'un post ou d'un commentaire.
+func countVotes(ctx context.Context, db querier, column string, targetID int) (likes, dislikes int, err error) {
+	query := "SELECT COALESCE(SUM(CASE WHEN value = 1 THEN 1 ELSE 0 END), 0), COALESCE(SUM(CASE WHEN value = -1 THEN 1 ELSE 0 END), 0) FROM likes WHERE " + column + " = ?;"
+	err = queryRowPrepared(ctx, db, query, targetID).Scan(&likes, &dislikes)
+	return likes, dislikes, err
+}
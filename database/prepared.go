@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// statements garde, par base ouverte, les requêtes préparées des chemins les
+// plus fréquents (session de chaque requête, compteurs de votes…) : SQLite
+// n'a plus à les analyser à chaque appel.
+var statements = struct {
+	sync.Mutex
+	byDB map[*sql.DB]map[string]*sql.Stmt
+}{byDB: map[*sql.DB]map[string]*sql.Stmt{}}
+
+// txQuerier est la transaction passée aux dépôts par inTx ; elle garde sa
+// base pour y retrouver les requêtes préparées.
+type txQuerier struct {
+	*sql.Tx
+	db *sql.DB
+}
+
+// prepared renvoie query préparée sur q : depuis le cache de la base, ou
+// rattachée à la transaction en cours. Sur tout autre querier, ou si la
+// préparation échoue, elle renvoie nil et l'appelant exécute la requête
+// directement.
+func prepared(ctx context.Context, q querier, query string) *sql.Stmt {
+	switch q := q.(type) {
+	case *sql.DB:
+		return statement(ctx, q, query)
+	case txQuerier:
+		if stmt := statement(ctx, q.db, query); stmt != nil {
+			return q.StmtContext(ctx, stmt)
+		}
+	}
+	return nil
+}
+
+func statement(ctx context.Context, db *sql.DB, query string) *sql.Stmt {
+	statements.Lock()
+	defer statements.Unlock()
+	cache := statements.byDB[db]
+	if stmt, ok := cache[query]; ok {
+		return stmt
+	}
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+	if cache == nil {
+		cache = map[string]*sql.Stmt{}
+		statements.byDB[db] = cache
+	}
+	cache[query] = stmt
+	return stmt
+}
+
+// queryRowPrepared exécute une requête fréquente renvoyant une ligne.
+func queryRowPrepared(ctx context.Context, q querier, query string, args ...any) *sql.Row {
+	if stmt := prepared(ctx, q, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return q.QueryRowContext(ctx, query, args...)
+}
+
+// closeStatements libère les requêtes préparées d'une base avant sa fermeture.
+func closeStatements(db *sql.DB) {
+	statements.Lock()
+	defer statements.Unlock()
+	for _, stmt := range statements.byDB[db] {
+		stmt.Close()
+	}
+	delete(statements.byDB, db)
+}
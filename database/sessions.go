@@ -0,0 +1,140 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Durées de vie par défaut des sessions (voir SessionPolicy).
+const (
+	DefaultSessionLifetime  = 24 * time.Hour
+	DefaultRememberLifetime = 30 * 24 * time.Hour
+)
+
+// Session représente une session serveur et l'appareil qui l'a ouverte.
+type Session struct {
+	RowID      int64
+	ID         string
+	UserID     int
+	UserAgent  string
+	IP         string
+	Remember   bool
+	CSRFToken  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+// SessionPolicy fixe la durée de vie des sessions : elles glissent à chaque
+// activité, plus longtemps lorsque l'utilisateur a coché « Se souvenir de
+// moi ». Une durée nulle vaut la durée par défaut.
+type SessionPolicy struct {
+	Lifetime         time.Duration
+	RememberLifetime time.Duration
+}
+
+// Expiry calcule l'expiration d'une session active à l'instant now.
+func (p SessionPolicy) Expiry(now time.Time, remember bool) time.Time {
+	if remember {
+		return now.Add(cmp.Or(p.RememberLifetime, DefaultRememberLifetime))
+	}
+	return now.Add(cmp.Or(p.Lifetime, DefaultSessionLifetime))
+}
+
+// sessionStore implémente SessionStore sur SQLite.
+type sessionStore struct {
+	db querier
+}
+
+func (s *sessionStore) Create(ctx context.Context, sess Session) error {
+	query := `INSERT INTO sessions (session_id, user_id, user_agent, ip, remember, csrf_token, last_seen_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+	_, err := s.db.ExecContext(ctx, query, sess.ID, sess.UserID, sess.UserAgent, sess.IP, sess.Remember, sess.CSRFToken, dbTime(sess.LastSeenAt), dbTime(sess.ExpiresAt))
+	return err
+}
+
+func (s *sessionStore) Get(ctx context.Context, id string, now time.Time) (Session, error) {
+	var sess Session
+	query := `SELECT rowid, session_id, user_id, user_agent, ip, remember, csrf_token, created_at, last_seen_at, expires_at FROM sessions WHERE session_id = ?;`
+	err := queryRowPrepared(ctx, s.db, query, id).Scan(&sess.RowID, &sess.ID, &sess.UserID, &sess.UserAgent, &sess.IP, &sess.Remember, &sess.CSRFToken, scanTime(&sess.CreatedAt), scanTime(&sess.LastSeenAt), scanTime(&sess.ExpiresAt))
+	if err != nil {
+		return sess, err
+	}
+	if now.After(sess.ExpiresAt) {
+		_ = s.Delete(ctx, id)
+		return sess, fmt.Errorf("session expirée")
+	}
+	return sess, nil
+}
+
+func (s *sessionStore) Touch(ctx context.Context, id, userAgent, ip string, lastSeen, expiresAt time.Time) error {
+	query := `UPDATE sessions SET user_agent = ?, ip = ?, last_seen_at = ?, expires_at = ? WHERE session_id = ?;`
+	_, err := s.db.ExecContext(ctx, query, userAgent, ip, dbTime(lastSeen), dbTime(expiresAt), id)
+	return err
+}
+
+func (s *sessionStore) SetCSRFToken(ctx context.Context, id, token string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE sessions SET csrf_token = ? WHERE session_id = ?;", token, id)
+	return err
+}
+
+func (s *sessionStore) ListByUser(ctx context.Context, userID int, now time.Time) ([]Session, error) {
+	query := `
+		SELECT rowid, session_id, user_id, user_agent, ip, remember, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen_at DESC;
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, dbTime(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []Session
+	for rows.Next() {
+		var sess Session
+		if err := rows.Scan(&sess.RowID, &sess.ID, &sess.UserID, &sess.UserAgent, &sess.IP, &sess.Remember, scanTime(&sess.CreatedAt), scanTime(&sess.LastSeenAt), scanTime(&sess.ExpiresAt)); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sessionStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE session_id = ?;`, id)
+	return err
+}
+
+func (s *sessionStore) DeleteForUser(ctx context.Context, userID int, rowID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE rowid = ? AND user_id = ?;`, rowID, userID)
+	return err
+}
+
+func (s *sessionStore) DeleteAllForUser(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?;`, userID)
+	return err
+}
+
+func (s *sessionStore) DeleteAll(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM sessions;`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *sessionStore) CountActive(ctx context.Context, now time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sessions WHERE expires_at > ?;", dbTime(now)).Scan(&n)
+	return n, err
+}
+
+func (s *sessionStore) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= ?;`, dbTime(now))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,309 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserStore donne accès aux comptes utilisateurs.
+type UserStore interface {
+	// Create insère un compte avec le rôle "user" ; password est déjà haché.
+	Create(ctx context.Context, username, email, password string) (int, error)
+	// GetByID renvoie le compte complet (rôle et fuseau compris).
+	GetByID(ctx context.Context, id int) (User, error)
+	GetByEmail(ctx context.Context, email string) (User, error)
+	GetByUsername(ctx context.Context, username string) (User, error)
+	List(ctx context.Context) ([]User, error)
+	// ListStaff renvoie les modérateurs et administrateurs.
+	ListStaff(ctx context.Context) ([]User, error)
+	// SetRole change le rôle d'un compte et l'inscrit au journal d'audit ;
+	// actorID vaut 0 pour un changement automatique (démarrage, SSO).
+	SetRole(ctx context.Context, actorID, id int, role string) error
+	// SetBanned suspend un compte, dont les sessions sont révoquées, ou lève
+	// sa suspension ; le changement est inscrit au journal d'audit.
+	SetBanned(ctx context.Context, actorID, id int, banned bool) error
+	// SetPassword remplace le mot de passe (déjà haché) et révoque les
+	// sessions du compte.
+	SetPassword(ctx context.Context, id int, password string) error
+	UpdateProfile(ctx context.Context, id int, username, photo string) error
+	Timezone(ctx context.Context, id int) (string, error)
+	// SetTimezone enregistre le fuseau ; le nom doit avoir été validé.
+	SetTimezone(ctx context.Context, id int, tz string) error
+	// Activity résume l'activité affichée sur le profil.
+	Activity(ctx context.Context, id int) (UserActivity, error)
+}
+
+// PostStore donne accès aux posts et à leurs votes.
+type PostStore interface {
+	// Create insère un post, publié d'emblée si approved, sinon en attente
+	// de modération, et renvoie son identifiant.
+	Create(ctx context.Context, userID int, title, content, imagePath string, approved bool) (int, error)
+	// GetByID renvoie un post publié.
+	GetByID(ctx context.Context, id int) (Post, error)
+	// List renvoie les posts publiés, du plus récent au plus ancien.
+	List(ctx context.Context) ([]Post, error)
+	Recent(ctx context.Context, limit int) ([]Post, error)
+	Pending(ctx context.Context) ([]Post, error)
+	CountPending(ctx context.Context) (int, error)
+	// Update modifie le post de userID en conservant la version d'origine.
+	Update(ctx context.Context, id, userID int, title, content, imagePath string) error
+	// Delete supprime le post s'il appartient à userID, avec ses
+	// commentaires, votes, catégories et notifications.
+	Delete(ctx context.Context, id, userID int) error
+	// AdminDelete supprime le post comme Delete, sans vérifier l'auteur.
+	AdminDelete(ctx context.Context, id int) error
+	SetModerationStatus(ctx context.Context, id int, status string) error
+	// SetVote enregistre un like (1) ou un dislike (-1).
+	SetVote(ctx context.Context, userID, postID, value int) error
+}
+
+// CommentStore donne accès aux commentaires et à leurs votes.
+type CommentStore interface {
+	Create(ctx context.Context, postID, userID int, content string) (int, error)
+	GetByID(ctx context.Context, id int) (Comment, error)
+	// ListByPost renvoie les commentaires d'un post, du plus ancien au plus récent.
+	ListByPost(ctx context.Context, postID int) ([]Comment, error)
+	// Delete supprime le commentaire s'il appartient à userID, avec ses
+	// votes et notifications.
+	Delete(ctx context.Context, id, userID int) error
+	AdminDelete(ctx context.Context, id int) error
+	SetVote(ctx context.Context, userID, commentID, value int) error
+}
+
+// NotificationStore donne accès aux notifications. Une notification lue est
+// supprimée : toutes celles présentes sont non lues.
+type NotificationStore interface {
+	Create(ctx context.Context, userID int, message string, postID, commentID int) error
+	ListByUser(ctx context.Context, userID int) ([]Notification, error)
+	CountUnread(ctx context.Context, userID int) (int, error)
+	DeleteByUser(ctx context.Context, userID int) error
+}
+
+// CategoryStore donne accès aux catégories et à leur rattachement aux posts.
+type CategoryStore interface {
+	// Ensure renvoie l'identifiant de la catégorie name, créée au besoin.
+	Ensure(ctx context.Context, name string) (int, error)
+	AddPost(ctx context.Context, postID, categoryID int) error
+	// ListByPost renvoie les catégories d'un post, par ordre alphabétique.
+	ListByPost(ctx context.Context, postID int) ([]Category, error)
+}
+
+// SessionStore donne accès aux sessions serveur.
+type SessionStore interface {
+	Create(ctx context.Context, s Session) error
+	// Get renvoie une session non expirée à l'instant now (une session
+	// expirée est supprimée).
+	Get(ctx context.Context, id string, now time.Time) (Session, error)
+	// Touch prolonge une session et met à jour l'appareil qui l'utilise.
+	Touch(ctx context.Context, id, userAgent, ip string, lastSeen, expiresAt time.Time) error
+	SetCSRFToken(ctx context.Context, id, token string) error
+	// ListByUser renvoie les sessions actives à l'instant now, la plus
+	// récente d'abord.
+	ListByUser(ctx context.Context, userID int, now time.Time) ([]Session, error)
+	Delete(ctx context.Context, id string) error
+	// DeleteForUser révoque une session d'un utilisateur à partir de son rowid,
+	// pour ne jamais exposer l'identifiant de session dans les pages.
+	DeleteForUser(ctx context.Context, userID int, rowID int64) error
+	DeleteAllForUser(ctx context.Context, userID int) error
+	// DeleteAll supprime toutes les sessions et renvoie leur nombre.
+	DeleteAll(ctx context.Context) (int64, error)
+	CountActive(ctx context.Context, now time.Time) (int, error)
+	// PurgeExpired supprime les sessions expirées à l'instant now et renvoie
+	// leur nombre.
+	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// TwoFactorStore donne accès à la double authentification : secret TOTP,
+// codes de secours et connexions en attente du second facteur.
+type TwoFactorStore interface {
+	// Get renvoie le secret TOTP d'un utilisateur et s'il est activé. Un
+	// secret non vide mais non activé correspond à un enrôlement en cours.
+	Get(ctx context.Context, userID int) (secret string, enabled bool, err error)
+	// SetPendingSecret enregistre un nouveau secret en attente de confirmation.
+	SetPendingSecret(ctx context.Context, userID int, secret string) error
+	// AcceptStep enregistre le pas de temps TOTP d'un code accepté et renvoie
+	// false si un code de ce pas ou d'un pas ultérieur l'a déjà été : un code
+	// ne sert qu'une fois (RFC 6238, §5.2).
+	AcceptStep(ctx context.Context, userID int, step int64) (bool, error)
+	// Enable active la double authentification avec le secret en attente.
+	Enable(ctx context.Context, userID int) error
+	// Disable désactive la double authentification et supprime les codes de
+	// secours.
+	Disable(ctx context.Context, userID int) error
+	// ReplaceRecoveryCodes remplace les codes de secours, stockés hachés.
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codes []string) error
+	// UseRecoveryCode consomme un code de secours s'il est valide et inutilisé.
+	UseRecoveryCode(ctx context.Context, userID int, code string) (bool, error)
+	// CountRecoveryCodes compte les codes de secours encore utilisables.
+	CountRecoveryCodes(ctx context.Context, userID int) (int, error)
+	// CreateChallenge mémorise qu'un utilisateur a fourni un premier facteur
+	// valide, avec son choix « Se souvenir de moi » et sa page de retour.
+	CreateChallenge(ctx context.Context, token string, c LoginChallenge) error
+	// GetChallenge renvoie une connexion en attente non expirée à l'instant
+	// now.
+	GetChallenge(ctx context.Context, token string, now time.Time) (LoginChallenge, error)
+	// RecordChallengeFailure incrémente et renvoie le nombre d'essais ratés.
+	RecordChallengeFailure(ctx context.Context, token string) (int, error)
+	DeleteChallenge(ctx context.Context, token string) error
+}
+
+// IdentityStore donne accès aux comptes externes (OAuth, OpenID Connect) liés
+// aux utilisateurs et aux inscriptions par fournisseur en attente.
+type IdentityStore interface {
+	// Get renvoie le lien du compte externe provider/subject.
+	Get(ctx context.Context, provider, subject string) (OAuthIdentity, error)
+	// ListByUser renvoie les comptes externes d'un utilisateur, par
+	// fournisseur.
+	ListByUser(ctx context.Context, userID int) ([]OAuthIdentity, error)
+	// Link lie un compte externe à un utilisateur existant.
+	Link(ctx context.Context, userID int, provider, subject, email string) error
+	Unlink(ctx context.Context, userID int, provider string) error
+	// CreateUser crée un compte sans mot de passe et son identité externe,
+	// marquée comme ayant créé le compte.
+	CreateUser(ctx context.Context, username, email, provider, subject string) (int, error)
+	CreatePending(ctx context.Context, p PendingOAuth) error
+	// GetPending renvoie une inscription en attente non expirée à l'instant
+	// now.
+	GetPending(ctx context.Context, token string, now time.Time) (PendingOAuth, error)
+	DeletePending(ctx context.Context, token string) error
+}
+
+// ThrottleStore donne accès au suivi des échecs de connexion, par compte,
+// identifiant inconnu ou adresse IP (voir les portées Throttle*).
+type ThrottleStore interface {
+	// Get renvoie le suivi d'une clé (valeur zéro si aucun échec).
+	Get(ctx context.Context, scope, key string) (LoginThrottle, error)
+	// RecordFailure incrémente le compteur d'échecs et renvoie le nouvel état.
+	RecordFailure(ctx context.Context, scope, key string, now time.Time) (LoginThrottle, error)
+	// Lock verrouille une clé jusqu'à until.
+	Lock(ctx context.Context, scope, key string, until time.Time) error
+	// Clear remet à zéro le suivi d'une clé.
+	Clear(ctx context.Context, scope, key string) error
+	// LockedAccounts liste les comptes verrouillés à l'instant now.
+	LockedAccounts(ctx context.Context, now time.Time) ([]LockedAccount, error)
+}
+
+// SettingStore donne accès aux réglages du site modifiables en ligne.
+type SettingStore interface {
+	// Get lit un réglage, ou renvoie def s'il n'a jamais été défini.
+	Get(ctx context.Context, key, def string) (string, error)
+	Set(ctx context.Context, key, value string) error
+}
+
+// CSPReportStore enregistre les violations de CSP signalées par les
+// navigateurs.
+type CSPReportStore interface {
+	Create(ctx context.Context, r CSPReport) error
+}
+
+// Stores regroupe les dépôts passés aux handlers. Ouverts par Open, ils
+// donnent aussi accès aux opérations sur la base entière (sauvegarde,
+// export, migrations…).
+type Stores struct {
+	Users         UserStore
+	Posts         PostStore
+	Comments      CommentStore
+	Notifications NotificationStore
+	Sessions      SessionStore
+	Categories    CategoryStore
+	TwoFactor     TwoFactorStore
+	Identities    IdentityStore
+	Throttle      ThrottleStore
+	Settings      SettingStore
+	CSPReports    CSPReportStore
+
+	db      *sql.DB  // nil pour des dépôts assemblés à la main (tests)
+	q       querier  // base ou transaction des dépôts, nil de même
+	backend *dialect // nil de même : SQLite
+}
+
+func newStores(q querier, d *dialect) Stores {
+	return Stores{
+		Users:         &userStore{q},
+		Posts:         &postStore{q},
+		Comments:      &commentStore{q},
+		Notifications: &notificationStore{q},
+		Sessions:      &sessionStore{q},
+		Categories:    &categoryStore{q},
+		TwoFactor:     &twoFactorStore{q},
+		Identities:    &identityStore{q},
+		Throttle:      &throttleStore{q},
+		Settings:      &settingStore{q},
+		CSPReports:    &cspReportStore{q},
+		q:             q,
+		backend:       d,
+	}
+}
+
+// dialect renvoie le dialecte de la base des dépôts.
+func (s Stores) dialect() *dialect {
+	if s.backend == nil {
+		return dialects[SQLite]
+	}
+	return s.backend
+}
+
+// Backdate change la date de création d'une ligne de users, posts ou
+// comments : les données de démonstration (voir le paquet seed) s'étalent
+// ainsi dans le temps. Sans effet sur des dépôts assemblés à la main.
+func (s Stores) Backdate(ctx context.Context, table string, id int, at time.Time) error {
+	switch table {
+	case "users", "posts", "comments":
+	default:
+		return fmt.Errorf("Backdate : table %q non prise en charge", table)
+	}
+	if s.q == nil {
+		return nil
+	}
+	_, err := s.q.ExecContext(ctx, "UPDATE "+table+" SET created_at = ? WHERE id = ?;", dbTime(at), id)
+	return err
+}
+
+// InTx exécute fn avec des dépôts liés à une même transaction, validée si fn
+// ne renvoie pas d'erreur et annulée sinon. Sans base (dépôts assemblés à la
+// main), fn reçoit simplement s.
+func (s Stores) InTx(ctx context.Context, fn func(tx Stores) error) error {
+	if s.db == nil {
+		return fn(s)
+	}
+	return inTx(ctx, s.db, func(tx querier) error {
+		return fn(newStores(tx, s.backend))
+	})
+}
+
+// querier est satisfaite par *sql.DB et *sql.Tx : un dépôt fonctionne à
+// l'identique dans ou hors transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inTx exécute fn dans une transaction ouverte sur q, ou directement dans
+// celle en cours si q en est déjà une.
+func inTx(ctx context.Context, q querier, fn func(tx querier) error) error {
+	db, ok := q.(*sql.DB)
+	if !ok {
+		return fn(q)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(txQuerier{tx, db}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// nullID renvoie NULL pour l'identifiant 0 (« aucun ») : avec les clés
+// étrangères actives, 0 ne référence aucune ligne.
+func nullID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
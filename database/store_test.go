@@ -0,0 +1,285 @@
+package database_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+)
+
+func TestMain(m *testing.M) {
+	dbtest.Main(m)
+}
+
+// recent vérifie qu'une date écrite par la base est celle de l'instant, en UTC.
+func recent(t *testing.T, what string, at time.Time) {
+	t.Helper()
+	if d := time.Since(at); d < -time.Minute || d > time.Minute || at.Location() != time.UTC {
+		t.Errorf("%s = %v, attendu maintenant en UTC", what, at)
+	}
+}
+
+func TestUserStore(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		id, err := stores.Users.Create(ctx, "alice", "alice@example.com", "hash")
+		if err != nil || id == 0 {
+			t.Fatalf("Create = %d, %v", id, err)
+		}
+		if _, err := stores.Users.Create(ctx, "alice", "autre@example.com", "hash"); err == nil {
+			t.Error("nom d'utilisateur en double accepté")
+		}
+
+		u, err := stores.Users.GetByEmail(ctx, "alice@example.com")
+		if err != nil || u.ID != id || u.Role != "user" || u.Photo != "profil.png" {
+			t.Fatalf("GetByEmail = %+v, %v", u, err)
+		}
+		recent(t, "created_at", u.CreatedAt)
+
+		if err := stores.Users.SetRole(ctx, 0, id, "moderator"); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Users.SetRole(ctx, 0, id, "moderator"); err != nil {
+			t.Fatal(err)
+		}
+		var audits int
+		stores.RawDB().QueryRow("SELECT COUNT(*) FROM audit_log WHERE target_id = ?;", id).Scan(&audits)
+		if audits != 1 {
+			t.Errorf("%d entrée(s) d'audit, attendu 1 (le second changement est sans effet)", audits)
+		}
+		if staff, _ := stores.Users.ListStaff(ctx); len(staff) != 1 || staff[0].ID != id {
+			t.Errorf("ListStaff = %+v", staff)
+		}
+
+		if err := stores.Users.UpdateProfile(ctx, id, "alice2", "a.png"); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Users.SetTimezone(ctx, id, "Europe/Paris"); err != nil {
+			t.Fatal(err)
+		}
+		u, err = stores.Users.GetByUsername(ctx, "alice2")
+		if err != nil || u.Photo != "a.png" || u.Timezone != "Europe/Paris" {
+			t.Fatalf("GetByUsername = %+v, %v", u, err)
+		}
+	})
+}
+
+func TestPostsCommentsAndVotes(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		author, _ := stores.Users.Create(ctx, "auteur", "auteur@example.com", "x")
+		voters := make([]int, 3)
+		for i := range voters {
+			voters[i], _ = stores.Users.Create(ctx, "votant"+strconv.Itoa(i), "votant"+strconv.Itoa(i)+"@example.com", "x")
+		}
+		postID, err := stores.Posts.Create(ctx, author, "publié", "v1", "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Posts.Create(ctx, author, "en attente", "contenu", "", false); err != nil {
+			t.Fatal(err)
+		}
+		if posts, _ := stores.Posts.List(ctx); len(posts) != 1 || posts[0].ID != postID {
+			t.Errorf("List = %+v, attendu le seul post publié", posts)
+		}
+		if n, _ := stores.Posts.CountPending(ctx); n != 1 {
+			t.Errorf("CountPending = %d, attendu 1", n)
+		}
+
+		// Le second vote de voters[0] remplace le premier.
+		for _, v := range []struct{ user, value int }{{voters[0], 1}, {voters[1], 1}, {voters[2], -1}, {voters[0], -1}} {
+			if err := stores.Posts.SetVote(ctx, v.user, postID, v.value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		p, err := stores.Posts.GetByID(ctx, postID)
+		if err != nil || p.Likes != 1 || p.Dislikes != 2 {
+			t.Fatalf("GetByID = %d like(s), %d dislike(s), %v ; attendu 1 et 2", p.Likes, p.Dislikes, err)
+		}
+
+		if err := stores.Posts.Update(ctx, postID, author, "publié", "v2", ""); err != nil {
+			t.Fatal(err)
+		}
+		p, _ = stores.Posts.GetByID(ctx, postID)
+		if p.Content != "v2" || p.OriginalContent != "v1" {
+			t.Errorf("après modification : contenu %q, original %q", p.Content, p.OriginalContent)
+		}
+		recent(t, "modified_at", p.ModifiedAt)
+
+		first, _ := stores.Comments.Create(ctx, postID, voters[0], "premier")
+		second, _ := stores.Comments.Create(ctx, postID, voters[1], "second")
+		stores.Comments.SetVote(ctx, author, second, 1)
+		comments, err := stores.Comments.ListByPost(ctx, postID)
+		if err != nil || len(comments) != 2 || comments[0].ID != first || comments[1].Likes != 1 {
+			t.Fatalf("ListByPost = %+v, %v", comments, err)
+		}
+
+		// Un autre que l'auteur ne supprime rien.
+		stores.Posts.Delete(ctx, postID, voters[0])
+		if _, err := stores.Posts.GetByID(ctx, postID); err != nil {
+			t.Fatalf("post supprimé par un autre que son auteur : %v", err)
+		}
+		if err := stores.Posts.Delete(ctx, postID, author); err != nil {
+			t.Fatal(err)
+		}
+		if comments, _ := stores.Comments.ListByPost(ctx, postID); len(comments) != 0 {
+			t.Errorf("%d commentaire(s) après suppression du post", len(comments))
+		}
+	})
+}
+
+func TestSessionStore(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		userID, _ := stores.Users.Create(ctx, "alice", "alice@example.com", "x")
+		now := time.Now()
+		for _, s := range []database.Session{
+			{ID: "actuelle", UserID: userID, Remember: true, ExpiresAt: now.Add(time.Hour)},
+			{ID: "autre", UserID: userID, ExpiresAt: now.Add(time.Hour)},
+			{ID: "expirée", UserID: userID, ExpiresAt: now.Add(-time.Minute)},
+		} {
+			if err := stores.Sessions.Create(ctx, s); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		s, err := stores.Sessions.Get(ctx, "actuelle", now)
+		if err != nil || s.UserID != userID || !s.Remember {
+			t.Fatalf("Get = %+v, %v", s, err)
+		}
+		recent(t, "created_at", s.CreatedAt)
+		if err := stores.Sessions.Touch(ctx, "actuelle", "navigateur", "192.0.2.1", now, now.Add(2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Sessions.Get(ctx, "expirée", now); err == nil {
+			t.Error("session expirée acceptée")
+		}
+
+		sessions, err := stores.Sessions.ListByUser(ctx, userID, now)
+		if err != nil || len(sessions) != 2 {
+			t.Fatalf("ListByUser = %+v, %v", sessions, err)
+		}
+		var other database.Session
+		for _, s := range sessions {
+			if s.ID == "autre" {
+				other = s
+			} else if s.UserAgent != "navigateur" || s.IP != "192.0.2.1" {
+				t.Errorf("session touchée : %+v", s)
+			}
+		}
+		if err := stores.Sessions.DeleteForUser(ctx, userID, other.RowID); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := stores.Sessions.CountActive(ctx, now); n != 1 {
+			t.Errorf("CountActive = %d après révocation, attendu 1", n)
+		}
+		if n, err := stores.Sessions.DeleteAll(ctx); err != nil || n != 1 {
+			t.Errorf("DeleteAll = %d, %v ; attendu 1", n, err)
+		}
+	})
+}
+
+func TestBanAndPasswordRevokeSessions(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		id, _ := stores.Users.Create(ctx, "alice", "alice@example.com", "ancien")
+		session := func(sid string) {
+			t.Helper()
+			if err := stores.Sessions.Create(ctx, database.Session{ID: sid, UserID: id, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sessions := func() int {
+			list, _ := stores.Sessions.ListByUser(ctx, id, time.Now())
+			return len(list)
+		}
+
+		session("avant-suspension")
+		if err := stores.Users.SetBanned(ctx, 0, id, true); err != nil {
+			t.Fatal(err)
+		}
+		u, _ := stores.Users.GetByID(ctx, id)
+		recent(t, "banned_at", u.BannedAt)
+		if n := sessions(); n != 0 {
+			t.Errorf("%d session(s) après suspension", n)
+		}
+		if err := stores.Users.SetBanned(ctx, 0, id, false); err != nil {
+			t.Fatal(err)
+		}
+		if u, _ := stores.Users.GetByID(ctx, id); !u.BannedAt.IsZero() {
+			t.Errorf("banned_at = %v après levée", u.BannedAt)
+		}
+		var audits int
+		stores.RawDB().QueryRow("SELECT COUNT(*) FROM audit_log WHERE target_id = ? AND action IN ('ban', 'unban');", id).Scan(&audits)
+		if audits != 2 {
+			t.Errorf("%d entrée(s) d'audit, attendu 2", audits)
+		}
+		if err := stores.Users.SetBanned(ctx, 0, id+1, true); err == nil {
+			t.Error("compte inexistant suspendu")
+		}
+
+		session("avant-réinitialisation")
+		if err := stores.Users.SetPassword(ctx, id, "nouveau"); err != nil {
+			t.Fatal(err)
+		}
+		if u, _ := stores.Users.GetByID(ctx, id); u.Password != "nouveau" {
+			t.Errorf("mot de passe = %q", u.Password)
+		}
+		if n := sessions(); n != 0 {
+			t.Errorf("%d session(s) après réinitialisation", n)
+		}
+	})
+}
+
+func TestLoginThrottleAndSettings(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		now := time.Now()
+		userID, _ := stores.Users.Create(ctx, "alice", "alice@example.com", "x")
+		key := strconv.Itoa(userID)
+		// Une clé non numérique ne doit pas gêner la jointure sur les comptes.
+		if _, err := stores.Throttle.RecordFailure(ctx, database.ThrottleIdentifier, "inconnu", now); err != nil {
+			t.Fatal(err)
+		}
+		stores.Throttle.RecordFailure(ctx, database.ThrottleUser, key, now)
+		th, err := stores.Throttle.RecordFailure(ctx, database.ThrottleUser, key, now)
+		if err != nil || th.Failures != 2 {
+			t.Fatalf("RecordFailure = %+v, %v ; attendu 2 échecs", th, err)
+		}
+		if err := stores.Throttle.Lock(ctx, database.ThrottleUser, key, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		locked, err := stores.Throttle.LockedAccounts(ctx, now)
+		if err != nil || len(locked) != 1 || locked[0].UserID != userID {
+			t.Fatalf("LockedAccounts = %+v, %v", locked, err)
+		}
+		stores.Throttle.Clear(ctx, database.ThrottleUser, key)
+		if locked, _ := stores.Throttle.LockedAccounts(ctx, now); len(locked) != 0 {
+			t.Errorf("compte encore verrouillé : %+v", locked)
+		}
+
+		for _, v := range []string{"0", "1"} {
+			if err := stores.Settings.Set(ctx, database.SettingStaff2FARequired, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if v, err := stores.Settings.Get(ctx, database.SettingStaff2FARequired, "0"); err != nil || v != "1" {
+			t.Error("réglage non mis à jour")
+		}
+
+		stores.TwoFactor.SetPendingSecret(ctx, userID, "SECRET")
+		if _, enabled, _ := stores.TwoFactor.Get(ctx, userID); enabled {
+			t.Error("TOTP actif avant confirmation")
+		}
+		stores.TwoFactor.Enable(ctx, userID)
+		if secret, enabled, err := stores.TwoFactor.Get(ctx, userID); err != nil || !enabled || secret != "SECRET" {
+			t.Errorf("Get = %q, %v, %v", secret, enabled, err)
+		}
+		if pending, err := stores.PendingMigrations(ctx); err != nil || len(pending) != 0 {
+			t.Errorf("migrations en attente : %v, %v", pending, err)
+		}
+	})
+}
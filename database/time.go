@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// timeLayout est le format des dates écrites en base. Toutes les dates sont
+// stockées en UTC (CURRENT_TIMESTAMP de SQLite l'est aussi) ; la conversion
+// vers le fuseau du lecteur se fait à l'affichage.
+const timeLayout = "2006-01-02 15:04:05"
+
+// dbTime formate t pour une requête.
+func dbTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// timeLayouts sont les formats acceptés à la lecture : celui de SQLite, et
+// ceux renvoyés pour les colonnes calculées (MAX(created_at)…) ou écrits par
+// d'anciennes versions.
+var timeLayouts = []string{timeLayout, time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02T15:04:05"}
+
+// scanTime renvoie la destination à passer à Scan pour une colonne de date :
+// la valeur est lue en UTC, NULL donne la date zéro et un format inconnu une
+// erreur plutôt qu'une date silencieusement fausse.
+func scanTime(dst *time.Time) sql.Scanner {
+	return timeScanner{dst}
+}
+
+type timeScanner struct {
+	dst *time.Time
+}
+
+func (s timeScanner) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*s.dst = time.Time{}
+		return nil
+	case time.Time:
+		*s.dst = v.UTC()
+		return nil
+	case []byte:
+		return s.parse(string(v))
+	case string:
+		return s.parse(v)
+	}
+	return fmt.Errorf("date : type %T non pris en charge", src)
+}
+
+func (s timeScanner) parse(v string) error {
+	if v == "" {
+		*s.dst = time.Time{}
+		return nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			*s.dst = t.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("date %q illisible", v)
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SettingStaff2FARequired rend la double authentification obligatoire pour
+// les administrateurs et les modérateurs lorsqu'il vaut "1".
+const SettingStaff2FARequired = "staff_2fa_required"
+
+// twoFactorStore implémente TwoFactorStore.
+type twoFactorStore struct {
+	db querier
+}
+
+func (s *twoFactorStore) Get(ctx context.Context, userID int) (string, bool, error) {
+	var secret string
+	var enabled bool
+	err := s.db.QueryRowContext(ctx, "SELECT totp_secret, totp_enabled FROM users WHERE id = ?;", userID).Scan(&secret, &enabled)
+	return secret, enabled, err
+}
+
+func (s *twoFactorStore) SetPendingSecret(ctx context.Context, userID int, secret string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET totp_secret = ?, totp_enabled = ?, totp_last_step = 0 WHERE id = ?;", secret, false, userID)
+	return err
+}
+
+// AcceptStep ne met à jour le dernier pas que s'il est dépassé : deux
+// requêtes présentant le même code ne peuvent pas être acceptées toutes deux.
+func (s *twoFactorStore) AcceptStep(ctx context.Context, userID int, step int64) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?;", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *twoFactorStore) Enable(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET totp_enabled = ? WHERE id = ? AND totp_secret <> '';", true, userID)
+	return err
+}
+
+func (s *twoFactorStore) Disable(ctx context.Context, userID int) error {
+	return inTx(ctx, s.db, func(tx querier) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_secret = '', totp_enabled = ?, totp_last_step = 0 WHERE id = ?;", false, userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?;", userID)
+		return err
+	})
+}
+
+// ReplaceRecoveryCodes ne stocke que les hachés : seuls les codes en clair
+// passés ici les connaissent.
+func (s *twoFactorStore) ReplaceRecoveryCodes(ctx context.Context, userID int, codes []string) error {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("failed to hash recovery code: %w", err)
+		}
+		hashes[i] = string(hash)
+	}
+	return inTx(ctx, s.db, func(tx querier) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?;", userID); err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?);", userID, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *twoFactorStore) UseRecoveryCode(ctx context.Context, userID int, code string) (bool, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, code_hash FROM recovery_codes WHERE user_id = ? AND used_at IS NULL;", userID)
+	if err != nil {
+		return false, err
+	}
+	matchID := 0
+	for rows.Next() {
+		var id int
+		var hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			rows.Close()
+			return false, err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil {
+			matchID = id
+			break
+		}
+	}
+	rows.Close()
+	if matchID == 0 {
+		return false, nil
+	}
+	// Le code n'est consommé que s'il ne l'a pas été entre-temps par une
+	// requête concurrente.
+	res, err := s.db.ExecContext(ctx, "UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL;", matchID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *twoFactorStore) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL;", userID).Scan(&count)
+	return count, err
+}
+
+// LoginChallenge est une connexion dont seul le premier facteur est validé :
+// l'utilisateur, son choix « Se souvenir de moi » et la page où l'envoyer
+// une fois le second facteur vérifié.
+type LoginChallenge struct {
+	UserID    int
+	Remember  bool
+	Redirect  string
+	ExpiresAt time.Time
+}
+
+func (s *twoFactorStore) CreateChallenge(ctx context.Context, token string, c LoginChallenge) error {
+	query := `INSERT INTO login_challenges (token, user_id, remember, redirect, expires_at) VALUES (?, ?, ?, ?, ?);`
+	_, err := s.db.ExecContext(ctx, query, token, c.UserID, c.Remember, c.Redirect, dbTime(c.ExpiresAt))
+	return err
+}
+
+func (s *twoFactorStore) GetChallenge(ctx context.Context, token string, now time.Time) (LoginChallenge, error) {
+	var c LoginChallenge
+	err := s.db.QueryRowContext(ctx, `SELECT user_id, remember, redirect, expires_at FROM login_challenges WHERE token = ?;`, token).
+		Scan(&c.UserID, &c.Remember, &c.Redirect, scanTime(&c.ExpiresAt))
+	if err != nil {
+		return LoginChallenge{}, err
+	}
+	if now.After(c.ExpiresAt) {
+		_ = s.DeleteChallenge(ctx, token)
+		return LoginChallenge{}, fmt.Errorf("connexion expirée")
+	}
+	return c, nil
+}
+
+func (s *twoFactorStore) RecordChallengeFailure(ctx context.Context, token string) (int, error) {
+	if _, err := s.db.ExecContext(ctx, `UPDATE login_challenges SET attempts = attempts + 1 WHERE token = ?;`, token); err != nil {
+		return 0, err
+	}
+	var attempts int
+	err := s.db.QueryRowContext(ctx, `SELECT attempts FROM login_challenges WHERE token = ?;`, token).Scan(&attempts)
+	return attempts, err
+}
+
+func (s *twoFactorStore) DeleteChallenge(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_challenges WHERE token = ?;`, token)
+	return err
+}
+
+// settingStore implémente SettingStore.
+type settingStore struct {
+	db querier
+}
+
+func (s *settingStore) Get(ctx context.Context, key, def string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = ?;", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return def, nil
+	}
+	return value, err
+}
+
+func (s *settingStore) Set(ctx context.Context, key, value string) error {
+	query := `INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value;`
+	_, err := s.db.ExecContext(ctx, query, key, value)
+	return err
+}
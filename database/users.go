@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// User représente un utilisateur avec son rôle.
+type User struct {
+	ID        int
+	Username  string
+	Email     string
+	Password  string
+	CreatedAt time.Time
+	Photo     string
+	Role      string    // "user", "moderator" ou "admin"
+	Timezone  string    // fuseau IANA choisi, vide pour celui du forum
+	BannedAt  time.Time // date de la suspension, zéro si le compte est actif
+}
+
+// UserActivity résume l'activité d'un utilisateur ; une date zéro signifie
+// « jamais ».
+type UserActivity struct {
+	PostsLiked     int
+	Comments       int
+	LastPost       time.Time
+	LastActivity   time.Time // dernier commentaire ou like
+	LastConnection time.Time // dernière activité sur l'une de ses sessions
+}
+
+// userStore implémente UserStore sur SQLite.
+type userStore struct {
+	db querier
+}
+
+const userColumns = "id, username, email, password, created_at, photo, role, timezone, banned_at"
+
+func scanUser(row interface{ Scan(...any) error }, u *User) error {
+	return row.Scan(&u.ID, &u.Username, &u.Email, &u.Password, scanTime(&u.CreatedAt), &u.Photo, &u.Role, &u.Timezone, scanTime(&u.BannedAt))
+}
+
+func (s *userStore) Create(ctx context.Context, username, email, password string) (int, error) {
+	var id int
+	query := `INSERT INTO users (username, email, password, photo) VALUES (?, ?, ?, ?) RETURNING id;`
+	if err := s.db.QueryRowContext(ctx, query, username, email, password, "profil.png").Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+	return id, nil
+}
+
+func (s *userStore) GetByID(ctx context.Context, id int) (User, error) {
+	var u User
+	err := scanUser(queryRowPrepared(ctx, s.db, "SELECT "+userColumns+" FROM users WHERE id = ?;", id), &u)
+	return u, err
+}
+
+func (s *userStore) GetByEmail(ctx context.Context, email string) (User, error) {
+	var u User
+	if err := scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?;", email), &u); err != nil {
+		return u, fmt.Errorf("failed to get user by email: %w", err)
+	}
+	return u, nil
+}
+
+func (s *userStore) GetByUsername(ctx context.Context, username string) (User, error) {
+	var u User
+	if err := scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE username = ?;", username), &u); err != nil {
+		return u, fmt.Errorf("failed to get user by username: %w", err)
+	}
+	return u, nil
+}
+
+func (s *userStore) List(ctx context.Context) ([]User, error) {
+	return s.list(ctx, "SELECT "+userColumns+" FROM users;")
+}
+
+func (s *userStore) ListStaff(ctx context.Context) ([]User, error) {
+	return s.list(ctx, "SELECT "+userColumns+" FROM users WHERE role = 'admin' OR role = 'moderator';")
+}
+
+func (s *userStore) list(ctx context.Context, query string, args ...any) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := scanUser(rows, &u); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *userStore) SetRole(ctx context.Context, actorID, id int, role string) error {
+	return inTx(ctx, s.db, func(tx querier) error {
+		var previous string
+		if err := tx.QueryRowContext(ctx, "SELECT role FROM users WHERE id = ?;", id).Scan(&previous); err != nil {
+			return err
+		}
+		if previous == role {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ?;", role, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO audit_log (actor_id, action, target_id, detail) VALUES (?, 'role', ?, ?);`,
+			nullID(actorID), id, previous+" -> "+role)
+		return err
+	})
+}
+
+func (s *userStore) SetBanned(ctx context.Context, actorID, id int, banned bool) error {
+	return inTx(ctx, s.db, func(tx querier) error {
+		var previous time.Time
+		if err := tx.QueryRowContext(ctx, "SELECT banned_at FROM users WHERE id = ?;", id).Scan(scanTime(&previous)); err != nil {
+			return err
+		}
+		if !previous.IsZero() == banned {
+			return nil
+		}
+		var at any // NULL : suspension levée
+		action := "unban"
+		if banned {
+			at, action = dbTime(time.Now()), "ban"
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET banned_at = ? WHERE id = ?;", at, id); err != nil {
+			return err
+		}
+		if banned {
+			if err := revokeLogins(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO audit_log (actor_id, action, target_id) VALUES (?, ?, ?);`,
+			nullID(actorID), action, id)
+		return err
+	})
+}
+
+func (s *userStore) SetPassword(ctx context.Context, id int, password string) error {
+	return inTx(ctx, s.db, func(tx querier) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET password = ? WHERE id = ?;", password, id); err != nil {
+			return err
+		}
+		return revokeLogins(ctx, tx, id)
+	})
+}
+
+// revokeLogins supprime les sessions et les connexions 2FA en cours d'un
+// utilisateur.
+func revokeLogins(ctx context.Context, tx querier, id int) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = ?;", id); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM login_challenges WHERE user_id = ?;", id)
+	return err
+}
+
+func (s *userStore) UpdateProfile(ctx context.Context, id int, username, photo string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET username = ?, photo = ? WHERE id = ?;", username, photo, id)
+	return err
+}
+
+func (s *userStore) Timezone(ctx context.Context, id int) (string, error) {
+	var tz string
+	err := s.db.QueryRowContext(ctx, "SELECT timezone FROM users WHERE id = ?;", id).Scan(&tz)
+	return tz, err
+}
+
+func (s *userStore) SetTimezone(ctx context.Context, id int, tz string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET timezone = ? WHERE id = ?;", tz, id)
+	return err
+}
+
+func (s *userStore) Activity(ctx context.Context, id int) (UserActivity, error) {
+	var a UserActivity
+	var lastComment, lastLike time.Time
+	queries := []struct {
+		query string
+		dest  any
+	}{
+		{"SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id IS NOT NULL AND value = 1;", &a.PostsLiked},
+		{"SELECT COUNT(*) FROM comments WHERE user_id = ?;", &a.Comments},
+		{"SELECT MAX(created_at) FROM posts WHERE user_id = ?;", scanTime(&a.LastPost)},
+		{"SELECT MAX(created_at) FROM comments WHERE user_id = ?;", scanTime(&lastComment)},
+		{"SELECT MAX(created_at) FROM likes WHERE user_id = ?;", scanTime(&lastLike)},
+		{"SELECT MAX(last_seen_at) FROM sessions WHERE user_id = ?;", scanTime(&a.LastConnection)},
+	}
+	for _, q := range queries {
+		if err := s.db.QueryRowContext(ctx, q.query, id).Scan(q.dest); err != nil {
+			return a, err
+		}
+	}
+	a.LastActivity = lastComment
+	if lastLike.After(lastComment) {
+		a.LastActivity = lastLike
+	}
+	return a, nil
+}
@@ -2,13 +2,11 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 )
 
-const TMDBAPIKey = "712f38fb8872be0ae97293108b1d160a"
-
 type Movie struct {
 	Title      string `json:"title"`
 	Overview   string `json:"overview"`
@@ -19,32 +17,37 @@ type TmdbResponse struct {
 	Results []Movie `json:"results"`
 }
 
-func TmdbHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Handler TmdbHandler appelé")
+func (a *APIs) TmdbHandler(w http.ResponseWriter, r *http.Request) error {
+	if a.Config.TMDBKey == "" {
+		return StatusError(http.StatusServiceUnavailable, "TMDB_API_KEY non défini", nil)
+	}
 
-	url := fmt.Sprintf("https://api.themoviedb.org/3/movie/popular?api_key=%s&language=fr-FR", TMDBAPIKey)
-	resp, err := http.Get(url)
+	params := url.Values{}
+	params.Add("api_key", a.Config.TMDBKey.Value())
+	params.Add("language", "fr-FR")
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, a.Config.TMDBURL+"/movie/popular?"+params.Encode(), nil)
+	if err != nil {
+		return Internal(err, "Erreur lors de la requête à TMDb")
+	}
+	resp, err := a.do("tmdb", req)
 	if err != nil {
-		http.Error(w, "Erreur lors de la requête à TMDb", http.StatusInternalServerError)
-		fmt.Println("Erreur requête TMDb:", err)
-		return
+		return StatusError(http.StatusBadGateway, "Erreur lors de la requête à TMDb", upstreamError(err))
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		http.Error(w, "Erreur lecture du body TMDb", http.StatusInternalServerError)
-		fmt.Println("Erreur lecture body:", err)
-		return
+		return StatusError(http.StatusBadGateway, "Erreur lecture du body TMDb", err)
 	}
 
 	var tmdbResp TmdbResponse
 	if err := json.Unmarshal(body, &tmdbResp); err != nil {
-		http.Error(w, "Erreur lors du décodage JSON TMDb", http.StatusInternalServerError)
-		fmt.Println("Erreur JSON:", err)
-		return
+		return StatusError(http.StatusBadGateway, "Erreur lors du décodage JSON TMDb", err)
 	}
 
 
-	renderTemplate(w, r, "API.html", tmdbResp)
+	return a.Forum.renderTemplate(w, r, "API.html", struct {
+		Page
+		TmdbResponse
+	}{a.Forum.newPage(r), tmdbResp})
 }
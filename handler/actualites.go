@@ -2,11 +2,8 @@ package handler
 
 import (
 	"encoding/json"
-	"html/template"
-	"log"
 	"net/http"
 	"net/url"
-	"os"
 )
 
 // Structures pour parser la réponse de NewsAPI
@@ -30,56 +27,39 @@ type Article struct {
 }
 
 // ActualitesHandler interroge NewsAPI et affiche le template actualites.html
-func ActualitesHandler(w http.ResponseWriter, r *http.Request) {
-	// Récupération de la clé API depuis les variables d'environnement
-	apiKey := os.Getenv("NEWSAPI_KEY")
-	if apiKey == "" {
-		http.Error(w, "NEWSAPI_KEY non défini", http.StatusInternalServerError)
-		return
+func (a *APIs) ActualitesHandler(w http.ResponseWriter, r *http.Request) error {
+	if a.Config.NewsAPIKey == "" {
+		return StatusError(http.StatusServiceUnavailable, "NEWSAPI_KEY non défini", nil)
 	}
-	log.Println("Clé NewsAPI =", apiKey)
 
 	// Construction de la requête à NewsAPI avec filtrage sur les mots-clés et en français
-	baseURL := "https://newsapi.org/v2/everything"
 	// La requête recherche des actualités contenant "netflix", "séries", "cinéma" ou "films"
 	q := "netflix OR séries OR cinéma OR films"
 	params := url.Values{}
 	params.Add("q", q)
 	params.Add("language", "fr")
-	params.Add("apiKey", apiKey)
 
-	apiURL := baseURL + "?" + params.Encode()
-	log.Println("[NewsAPI] Requête :", apiURL)
-
-	// Requête HTTP vers NewsAPI
-	resp, err := http.Get(apiURL)
+	// Requête HTTP vers NewsAPI ; la clé passe en en-tête pour ne jamais
+	// apparaître dans une URL journalisée.
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, a.Config.NewsAPIURL+"/everything?"+params.Encode(), nil)
+	if err != nil {
+		return Internal(err, "Erreur lors de la récupération des actualités")
+	}
+	req.Header.Set("X-Api-Key", a.Config.NewsAPIKey.Value())
+	resp, err := a.do("newsapi", req)
 	if err != nil {
-		log.Println("Erreur lors de la requête vers NewsAPI:", err)
-		http.Error(w, "Erreur lors de la récupération des actualités", http.StatusInternalServerError)
-		return
+		return StatusError(http.StatusBadGateway, "Erreur lors de la récupération des actualités", upstreamError(err))
 	}
 	defer resp.Body.Close()
 
 	var newsResp NewsAPIResponse
 	err = json.NewDecoder(resp.Body).Decode(&newsResp)
 	if err != nil {
-		log.Println("Erreur lors du décodage JSON:", err)
-		http.Error(w, "Erreur lors du traitement des données", http.StatusInternalServerError)
-		return
-	}
-
-	// Chargement et exécution du template
-	tmpl, err := template.ParseFiles("templates/actualites.html")
-	if err != nil {
-		log.Println("Erreur lors du parsing du template:", err)
-		http.Error(w, "Erreur lors du rendu de la page", http.StatusInternalServerError)
-		return
+		return StatusError(http.StatusBadGateway, "Erreur lors du traitement des données", err)
 	}
 
-	err = tmpl.Execute(w, newsResp)
-	if err != nil {
-		log.Println("Erreur lors de l'exécution du template:", err)
-		http.Error(w, "Erreur lors de l'affichage des actualités", http.StatusInternalServerError)
-		return
-	}
+	return a.Forum.renderTemplate(w, r, "actualites.html", struct {
+		Page
+		NewsAPIResponse
+	}{a.Forum.newPage(r), newsResp})
 }
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"forum/backup"
+	"forum/database"
+)
+
+// AdminBackupHandler télécharge une sauvegarde à chaud de la base et des
+// images envoyées. L'archive est d'abord écrite dans un fichier temporaire :
+// un échec donne une page d'erreur plutôt qu'un téléchargement tronqué.
+func (f *Forum) AdminBackupHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		return MethodNotAllowed()
+	}
+	adminID, ok := currentUserID(r)
+	if !ok {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
+	admin, err := f.Users.GetByID(ctx, adminID)
+	if err != nil || admin.Role != "admin" {
+		return Forbidden("Accès réservé aux administrateurs")
+	}
+
+	tmp, err := os.CreateTemp("", "forum-backup-*.tar.gz")
+	if err != nil {
+		return Internal(err, "Erreur lors de la sauvegarde")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := backup.Write(ctx, f.Stores, tmp, UploadDir); err != nil {
+		if errors.Is(err, database.ErrBackupUnsupported) {
+			return Validation("Sauvegarde indisponible avec PostgreSQL : utiliser pg_dump")
+		}
+		return Internal(err, "Erreur lors de la sauvegarde")
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return Internal(err, "Erreur lors de la sauvegarde")
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return Internal(err, "Erreur lors de la sauvegarde")
+	}
+	slog.InfoContext(ctx, "sauvegarde téléchargée", "admin", admin.Username, "bytes", size)
+
+	name := "forum-" + f.now().UTC().Format("20060102-150405") + ".tar.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Content-Length", fmt.Sprint(size))
+	w.Header().Set("Cache-Control", "no-store")
+	// Les en-têtes sont partis : une coupure ne peut plus qu'être journalisée.
+	if _, err := io.Copy(w, tmp); err != nil {
+		slog.WarnContext(ctx, "envoi de la sauvegarde interrompu", "err", err)
+	}
+	return nil
+}
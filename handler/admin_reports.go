@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"html/template"
 	"net/http"
 	"strconv"
 
@@ -9,80 +8,63 @@ import (
 )
 
 // AdminReportsHandler affiche la liste des notifications (reports) pour l'administrateur.
-func AdminReportsHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
+func (f *Forum) AdminReportsHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	adminID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	adminID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	admin, err := database.GetUserWithRole(adminID)
+	admin, err := f.Users.GetByID(ctx, adminID)
 	if err != nil || admin.Role != "admin" {
-		http.Error(w, "Accès réservé aux administrateurs", http.StatusForbidden)
-		return
+		return Forbidden("Accès réservé aux administrateurs")
 	}
 	// Récupérer toutes les notifications de l'admin (pour simplifier, on n'effectue pas de filtrage spécifique)
-	notifs, err := database.GetNotificationsByUserID(adminID)
-	if err != nil {
-		http.Error(w, "Erreur lors de la récupération des notifications", http.StatusInternalServerError)
-		return
-	}
-	t, err := template.ParseFiles("templates/admin_reports.html")
+	notifs, err := f.Notifications.ListByUser(ctx, adminID)
 	if err != nil {
-		http.Error(w, "Erreur lors du chargement du template", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la récupération des notifications")
 	}
 	data := struct {
+		Page
 		Notifications []database.Notification
 		Admin         database.User
 	}{
+		Page:          f.newPage(r),
 		Notifications: notifs,
 		Admin:         admin,
 	}
-	t.Execute(w, data)
+	return f.renderTemplate(w, r, "admin_reports.html", data)
 }
 
 // RespondReportHandler permet à l'administrateur de répondre à un report.
-func RespondReportHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	adminID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+func (f *Forum) RespondReportHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	adminID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	admin, err := database.GetUserWithRole(adminID)
+	admin, err := f.Users.GetByID(ctx, adminID)
 	if err != nil || admin.Role != "admin" {
-		http.Error(w, "Accès réservé aux administrateurs", http.StatusForbidden)
-		return
+		return Forbidden("Accès réservé aux administrateurs")
 	}
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
+		return MethodNotAllowed()
 	}
 	notifIDStr := r.FormValue("notif_id")
 	if notifIDStr == "" {
-		http.Error(w, "ID de notification manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de notification manquant")
 	}
 	_, err = strconv.Atoi(notifIDStr)
 	if err != nil {
-		http.Error(w, "ID de notification invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de notification invalide")
 	}
 	response := r.FormValue("response")
 	if response == "" {
-		http.Error(w, "Réponse vide", http.StatusBadRequest)
-		return
+		return Validation("Réponse vide")
 	}
 	// Pour ce simple système, nous créons une notification de confirmation pour l'administrateur.
-	_ = database.CreateNotification(adminID, "Votre réponse au report ("+notifIDStr+"): "+response, 0, 0)
+	_ = f.Notifications.Create(ctx, adminID, "Votre réponse au report ("+notifIDStr+"): "+response, 0, 0)
 	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+	return nil
 }
@@ -1,8 +1,6 @@
 package handler
 
 import (
-	"fmt"
-	"html/template"
 	"net/http"
 	"strconv"
 
@@ -10,79 +8,58 @@ import (
 )
 
 type AdminUsersData struct {
+	Page
 	Users []database.User
 	Admin database.User
 }
 
 // AdminUsersHandler affiche la liste de tous les utilisateurs avec
 // des boutons pour promouvoir/démouvoir.
-func AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
+func (f *Forum) AdminUsersHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	adminID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	adminID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	admin, err := database.GetUserWithRole(adminID)
+	admin, err := f.Users.GetByID(ctx, adminID)
 	if err != nil || admin.Role != "admin" {
-		http.Error(w, "Accès réservé aux administrateurs", http.StatusForbidden)
-		return
+		return Forbidden("Accès réservé aux administrateurs")
 	}
 
-	users, err := getAllUsers()
+	users, err := f.Users.List(ctx)
 	if err != nil {
-		http.Error(w, "Erreur lors de la récupération des utilisateurs", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la récupération des utilisateurs")
 	}
 
-	t, err := template.ParseFiles("templates/admin_users.html")
-	if err != nil {
-		http.Error(w, "Erreur lors du chargement du template", http.StatusInternalServerError)
-		return
-	}
-	data := AdminUsersData{Users: users, Admin: admin}
-	if err := t.Execute(w, data); err != nil {
-		fmt.Println("Erreur template admin_users:", err)
-		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
-	}
+	data := AdminUsersData{Page: f.newPage(r), Users: users, Admin: admin}
+	return f.renderTemplate(w, r, "admin_users.html", data)
 }
 
 // AdminUsersUpdateHandler traite la promotion ou la rétrogradation.
-func AdminUsersUpdateHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) AdminUsersUpdateHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
+		return MethodNotAllowed()
 	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
+	adminID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	adminID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	admin, err := database.GetUserWithRole(adminID)
+	admin, err := f.Users.GetByID(ctx, adminID)
 	if err != nil || admin.Role != "admin" {
-		http.Error(w, "Accès réservé aux administrateurs", http.StatusForbidden)
-		return
+		return Forbidden("Accès réservé aux administrateurs")
 	}
 
 	targetIDStr := r.FormValue("user_id")
 	action := r.FormValue("action") // "promote" ou "demote"
 	if targetIDStr == "" || (action != "promote" && action != "demote") {
-		http.Error(w, "Données invalides", http.StatusBadRequest)
-		return
+		return Validation("Données invalides")
 	}
 	targetID, err := strconv.Atoi(targetIDStr)
 	if err != nil {
-		http.Error(w, "ID utilisateur invalide", http.StatusBadRequest)
-		return
+		return Validation("ID utilisateur invalide")
 	}
 
 	var newRole string
@@ -91,38 +68,9 @@ func AdminUsersUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	} else {
 		newRole = "user"
 	}
-	if err := database.UpdateUserRole(targetID, newRole); err != nil {
-		http.Error(w, "Erreur lors de la mise à jour du rôle", http.StatusInternalServerError)
-		return
+	if err := f.Users.SetRole(ctx, adminID, targetID, newRole); err != nil {
+		return Internal(err, "Erreur lors de la mise à jour du rôle")
 	}
 	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
-}
-
-// getAllUsers récupère tous les utilisateurs en base.
-func getAllUsers() ([]database.User, error) {
-	rows, err := database.DB.Query(
-		"SELECT id, username, email, password, created_at, photo, role FROM users",
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []database.User
-	for rows.Next() {
-		var u database.User
-		if err := rows.Scan(
-			&u.ID,
-			&u.Username,
-			&u.Email,
-			&u.Password,
-			&u.CreatedAt,
-			&u.Photo,
-			&u.Role,
-		); err != nil {
-			return nil, err
-		}
-		users = append(users, u)
-	}
-	return users, rows.Err()
+	return nil
 }
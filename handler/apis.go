@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"forum/config"
+	"forum/metrics"
+)
+
+// APIs sert les pages qui interrogent des services externes (TMDB, NewsAPI,
+// Gemini). Clés et URLs viennent de la configuration, jamais de l'environnement.
+type APIs struct {
+	Config config.APIs
+	Client *http.Client
+	Forum  *Forum // fournit la barre de navigation des pages
+}
+
+// NewAPIs crée les handlers des services externes.
+func NewAPIs(cfg config.APIs, forum *Forum) *APIs {
+	return &APIs{Config: cfg, Client: &http.Client{Timeout: 15 * time.Second}, Forum: forum}
+}
+
+// do envoie une requête à un service externe et mesure son résultat.
+func (a *APIs) do(service string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := a.Client.Do(req)
+	metrics.ObserveUpstream(service, metrics.UpstreamResult(resp, err), time.Since(start))
+	return resp, err
+}
+
+// upstreamError retire l'URL d'une erreur du client HTTP : elle peut
+// contenir une clé d'API en paramètre.
+func upstreamError(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		base, _, _ := strings.Cut(ue.URL, "?")
+		return fmt.Errorf("%s %s: %w", ue.Op, base, ue.Err)
+	}
+	return err
+}
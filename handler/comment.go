@@ -1,101 +1,98 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"forum/database"
 )
 
-func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
+func (f *Forum) AddCommentHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
+		return MethodNotAllowed()
 	}
 	postIDStr := r.FormValue("post_id")
 	if postIDStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
-		http.Error(w, "ID de post invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de post invalide")
 	}
 	content := r.FormValue("content")
 	if content == "" {
-		http.Error(w, "Contenu du commentaire requis", http.StatusBadRequest)
-		return
+		return Validation("Contenu du commentaire requis")
 	}
-	err = database.CreateComment(postID, userID, content)
-	if err != nil {
-		http.Error(w, "Erreur lors de l'ajout du commentaire: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	post, err := database.GetPostByID(postID)
-	if err == nil {
-		if post.UserID != userID {
-			message := "Quelqu'un a commenté votre post."
-			_ = database.CreateNotification(post.UserID, message, postID, 0)
+	// Le commentaire et la notification de l'auteur sont enregistrés ensemble.
+	err = f.InTx(ctx, func(tx database.Stores) error {
+		post, err := tx.Posts.GetByID(ctx, postID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Comments.Create(ctx, postID, userID, content); err != nil {
+			return err
 		}
+		if post.UserID == userID {
+			return nil
+		}
+		return tx.Notifications.Create(ctx, post.UserID, "Quelqu'un a commenté votre post.", postID, 0)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound("Post introuvable")
+	} else if err != nil {
+		return Internal(err, "Erreur lors de l'ajout du commentaire")
 	}
 	http.Redirect(w, r, "/post?id="+strconv.Itoa(postID), http.StatusSeeOther)
+	return nil
 }
 
-func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+func (f *Forum) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		return MethodNotAllowed()
 	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	idStr := r.URL.Query().Get("id")
+	idStr := r.FormValue("id")
 	if idStr == "" {
-		http.Error(w, "ID de commentaire manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de commentaire manquant")
 	}
 	commentID, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "ID de commentaire invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de commentaire invalide")
 	}
-	postIDStr := r.URL.Query().Get("post_id")
+	postIDStr := r.FormValue("post_id")
 	if postIDStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 
 	// Récupérer les informations sur l'utilisateur (incluant le rôle)
-	user, err := database.GetUserWithRole(userID)
+	user, err := f.Users.GetByID(ctx, userID)
 	if err != nil {
-		http.Error(w, "Utilisateur non trouvé", http.StatusUnauthorized)
-		return
+		return StatusError(http.StatusUnauthorized, "Utilisateur non trouvé", nil)
 	}
 
 	// Si l'utilisateur est admin ou modérateur, il peut supprimer n'importe quel commentaire
 	if user.Role == "admin" || user.Role == "moderator" {
-		err = database.AdminDeleteComment(commentID)
+		err = f.Comments.AdminDelete(ctx, commentID)
 	} else {
-		err = database.DeleteComment(commentID, userID)
+		err = f.Comments.Delete(ctx, commentID, userID)
 	}
 
 	if err != nil {
-		http.Error(w, "Erreur lors de la suppression du commentaire: "+err.Error(), http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la suppression du commentaire")
 	}
 	http.Redirect(w, r, "/post?id="+postIDStr, http.StatusSeeOther)
+	return nil
 }
@@ -1,78 +1,80 @@
 package handler
 
 import (
-	"html/template"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"forum/database"
-	"github.com/google/uuid"
+	"forum/middleware"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func ConnexionHandler(w http.ResponseWriter, r *http.Request) {
+// connexionPage alimente connexion.html.
+type connexionPage struct {
+	Page
+	Error string
+	SSO   []ssoLink
+}
+
+// renderConnexionError réaffiche le formulaire de connexion avec un message.
+func (f *Forum) renderConnexionError(w http.ResponseWriter, r *http.Request, status int, msg string) error {
+	return f.renderFormError(w, r, status, msg, "connexion.html", connexionPage{Page: f.newPage(r), Error: msg, SSO: f.OAuth.ssoLinks()})
+}
+
+func (f *Forum) ConnexionHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	switch r.Method {
 	case http.MethodGet:
-		t, err := template.ParseFiles("templates/connexion.html")
-		if err != nil {
-			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
-			return
-		}
-		_ = t.Execute(w, nil)
+		return f.renderTemplate(w, r, "connexion.html", connexionPage{Page: f.newPage(r), SSO: f.OAuth.ssoLinks()})
 
 	case http.MethodPost:
-		identifier := r.FormValue("identifier")
+		identifier := strings.TrimSpace(r.FormValue("identifier"))
 		password := r.FormValue("password")
 		if identifier == "" || password == "" {
-			http.Error(w, "Tous les champs requis", http.StatusBadRequest)
-			return
+			return f.renderConnexionError(w, r, http.StatusBadRequest, "Tous les champs requis")
 		}
 		var user database.User
 		var err error
 		if strings.Contains(identifier, "@") {
-			user, err = database.GetUserByEmail(identifier)
+			user, err = f.Users.GetByEmail(ctx, identifier)
 		} else {
-			user, err = database.GetUserByUsername(identifier)
+			user, err = f.Users.GetByUsername(ctx, identifier)
+		}
+		found := err == nil
+		account := &user
+		if !found {
+			account = nil
 		}
+		guard, err := newLoginGuard(ctx, f.Throttle, identifier, account, middleware.ClientIP(r))
 		if err != nil {
-			http.Error(w, "Utilisateur introuvable", http.StatusUnauthorized)
-			return
+			return f.renderConnexionError(w, r, http.StatusInternalServerError, "Erreur interne du serveur")
 		}
-		if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-			http.Error(w, "Identifiants invalides", http.StatusUnauthorized)
-			return
+		now := f.now()
+		if wait := guard.wait(now); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			return f.renderConnexionError(w, r, http.StatusTooManyRequests,
+				"Trop de tentatives de connexion. Réessayez dans "+formatWait(wait)+".")
 		}
 
-		// --- Création de la session ---
-		sessionID := uuid.NewString()
-		expiry := time.Now().Add(24 * time.Hour)
-		if err := database.CreateSession(sessionID, user.ID, expiry); err != nil {
-			http.Error(w, "Erreur création session", http.StatusInternalServerError)
-			return
+		// Les comptes créés via OAuth n'ont pas de mot de passe ; on compare
+		// quand même à un hash factice pour ne pas révéler quels comptes existent.
+		hash := dummyPasswordHash
+		if found && user.Password != "" {
+			hash = []byte(user.Password)
+		}
+		err = bcrypt.CompareHashAndPassword(hash, []byte(password))
+		if !found || user.Password == "" || err != nil {
+			if until, locked := guard.fail(ctx, now); locked {
+				f.notifyLockout(ctx, guard.userID, guard.ip.Key, until)
+			}
+			return f.renderConnexionError(w, r, http.StatusUnauthorized, errLoginFailed)
 		}
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_id",
-			Value:    sessionID,
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   true,
-			SameSite: http.SameSiteLaxMode,
-			Expires:  expiry,
-		})
-
-		// Cookie user_id pour compatibilité
-		http.SetCookie(w, &http.Cookie{
-			Name:     "user_id",
-			Value:    strconv.Itoa(user.ID),
-			Path:     "/",
-			HttpOnly: true,
-		})
 
-		http.Redirect(w, r, "/index", http.StatusSeeOther)
+		guard.succeed(ctx)
+		return f.completeLogin(w, r, user.ID, r.FormValue("remember") == "on", "/index")
 
 	default:
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
+		return MethodNotAllowed()
 	}
 }
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"forum/database"
+)
+
+// maxCSPReportSize borne la taille d'un rapport accepté.
+const maxCSPReportSize = 64 << 10
+
+// cspReportBody est le format historique (report-uri, application/csp-report).
+type cspReportBody struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIBody est le format de l'API Reporting (application/reports+json).
+type reportingAPIBody []struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURL         string `json:"blockedURL"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+	} `json:"body"`
+}
+
+// CSPReportHandler enregistre les violations de CSP remontées par les navigateurs.
+func (f *Forum) CSPReportHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return MethodNotAllowed()
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCSPReportSize))
+	if err != nil {
+		return Validation("Rapport illisible")
+	}
+
+	var reports []database.CSPReport
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/reports+json") {
+		var batch reportingAPIBody
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return Validation("Rapport invalide")
+		}
+		for _, rep := range batch {
+			if rep.Type != "csp-violation" {
+				continue
+			}
+			reports = append(reports, database.CSPReport{
+				DocumentURI:       rep.Body.DocumentURL,
+				ViolatedDirective: rep.Body.EffectiveDirective,
+				BlockedURI:        rep.Body.BlockedURL,
+				SourceFile:        rep.Body.SourceFile,
+				LineNumber:        rep.Body.LineNumber,
+			})
+		}
+	} else {
+		var single cspReportBody
+		if err := json.Unmarshal(body, &single); err != nil {
+			return Validation("Rapport invalide")
+		}
+		directive := single.Report.EffectiveDirective
+		if directive == "" {
+			directive = single.Report.ViolatedDirective
+		}
+		reports = append(reports, database.CSPReport{
+			DocumentURI:       single.Report.DocumentURI,
+			ViolatedDirective: directive,
+			BlockedURI:        single.Report.BlockedURI,
+			SourceFile:        single.Report.SourceFile,
+			LineNumber:        single.Report.LineNumber,
+		})
+	}
+
+	for _, rep := range reports {
+		rep.DocumentURI = truncate(rep.DocumentURI, 512)
+		rep.ViolatedDirective = truncate(rep.ViolatedDirective, 128)
+		rep.BlockedURI = truncate(rep.BlockedURI, 512)
+		rep.SourceFile = truncate(rep.SourceFile, 512)
+		rep.UserAgent = truncate(r.UserAgent(), 256)
+		if err := f.CSPReports.Create(r.Context(), rep); err != nil {
+			slog.ErrorContext(r.Context(), "enregistrement du rapport CSP", "err", err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"forum/database"
+	"forum/database/dbtest"
+)
+
+// recordedReports garde les rapports CSP au lieu de les écrire en base.
+type recordedReports struct{ reports []database.CSPReport }
+
+func (s *recordedReports) Create(_ context.Context, r database.CSPReport) error {
+	s.reports = append(s.reports, r)
+	return nil
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	f := NewForum(dbtest.New(t))
+	store := &recordedReports{}
+	f.CSPReports = store
+	send := func(method, contentType, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/csp-report", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("User-Agent", "navigateur")
+		w := httptest.NewRecorder()
+		HandlerFunc(f.CSPReportHandler).ServeHTTP(w, r)
+		return w
+	}
+
+	w := send(http.MethodPost, "application/csp-report", `{"csp-report": {"document-uri": "https://forum.test/index", "violated-directive": "script-src", "blocked-uri": "inline", "line-number": 12}}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("format report-uri : statut %d", w.Code)
+	}
+	w = send(http.MethodPost, "application/reports+json", `[
+		{"type": "csp-violation", "body": {"documentURL": "https://forum.test/profil", "effectiveDirective": "img-src", "blockedURL": "https://ailleurs.test/x.png"}},
+		{"type": "deprecation", "body": {}}
+	]`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("format Reporting API : statut %d", w.Code)
+	}
+	want := []database.CSPReport{
+		{DocumentURI: "https://forum.test/index", ViolatedDirective: "script-src", BlockedURI: "inline", LineNumber: 12, UserAgent: "navigateur"},
+		{DocumentURI: "https://forum.test/profil", ViolatedDirective: "img-src", BlockedURI: "https://ailleurs.test/x.png", UserAgent: "navigateur"},
+	}
+	if len(store.reports) != len(want) {
+		t.Fatalf("%d rapport(s) enregistré(s), attendu %d : %+v", len(store.reports), len(want), store.reports)
+	}
+	for i := range want {
+		if store.reports[i] != want[i] {
+			t.Errorf("rapport %d : %+v, attendu %+v", i, store.reports[i], want[i])
+		}
+	}
+
+	// Un champ trop long est tronqué avant l'enregistrement.
+	send(http.MethodPost, "application/csp-report", `{"csp-report": {"document-uri": "`+strings.Repeat("a", 2000)+`"}}`)
+	if n := len(store.reports[len(store.reports)-1].DocumentURI); n != 512 {
+		t.Errorf("document-uri de %d caractères, attendu 512", n)
+	}
+
+	if w := send(http.MethodPost, "application/csp-report", "pas du JSON"); w.Code != http.StatusBadRequest {
+		t.Errorf("rapport invalide : statut %d, attendu %d", w.Code, http.StatusBadRequest)
+	}
+	if w := send(http.MethodGet, "", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET : statut %d, attendu %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
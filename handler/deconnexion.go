@@ -3,30 +3,23 @@ package handler
 import (
 	"net/http"
 
-	"forum/database"
+	"forum/middleware"
 )
 
-func DeconnexionHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) DeconnexionHandler(w http.ResponseWriter, r *http.Request) error {
+	// POST seulement : le jeton CSRF empêche un autre site de déconnecter
+	// le visiteur.
+	if r.Method != http.MethodPost {
+		return MethodNotAllowed()
+	}
+	ctx := r.Context()
 	// Supprimer la session côté serveur
-	if cookie, err := r.Cookie("session_id"); err == nil {
-		_ = database.DeleteSession(cookie.Value)
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_id",
-			Value:    "",
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   true,
-			SameSite: http.SameSiteLaxMode,
-			MaxAge:   -1,
-		})
+	if cookie, err := r.Cookie(middleware.SessionCookie); err == nil {
+		_ = f.Sessions.Delete(ctx, cookie.Value)
+		middleware.ClearSessionCookie(w)
 	}
-	// Supprimer cookie user_id
-	http.SetCookie(w, &http.Cookie{
-		Name:     "user_id",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   -1,
-	})
+	// Supprimer l'ancien cookie user_id
+	clearLegacyUserCookie(w)
 	http.Redirect(w, r, "/index", http.StatusSeeOther)
+	return nil
 }
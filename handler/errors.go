@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"forum/logging"
+)
+
+// Error est une erreur destinée au client : Message est affiché tel quel,
+// Err (la cause interne, SQL comprise) n'est que journalisée.
+type Error struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// NotFound signale une ressource absente (404).
+func NotFound(msg string) error {
+	return &Error{Status: http.StatusNotFound, Message: msg}
+}
+
+// Forbidden signale une action non autorisée pour l'utilisateur (403).
+func Forbidden(msg string) error {
+	return &Error{Status: http.StatusForbidden, Message: msg}
+}
+
+// Validation signale une saisie ou un paramètre invalide (400).
+func Validation(msg string) error {
+	return &Error{Status: http.StatusBadRequest, Message: msg}
+}
+
+// MethodNotAllowed signale une méthode HTTP non prise en charge (405).
+func MethodNotAllowed() error {
+	return &Error{Status: http.StatusMethodNotAllowed, Message: "Méthode non supportée"}
+}
+
+// Internal enveloppe une erreur du serveur (500) : msg est montré à
+// l'utilisateur, err est journalisée avec l'identifiant de requête.
+func Internal(err error, msg string) error {
+	return &Error{Status: http.StatusInternalServerError, Message: msg, Err: err}
+}
+
+// StatusError construit une erreur pour un autre code HTTP (401, 502, 503…).
+func StatusError(status int, msg string, err error) error {
+	return &Error{Status: status, Message: msg, Err: err}
+}
+
+// lookupError distingue « introuvable » (sql.ErrNoRows) d'une panne de base.
+func lookupError(err error, notFound string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound(notFound)
+	}
+	return Internal(err, "Erreur interne du serveur")
+}
+
+// HandlerFunc est un handler qui renvoie son erreur au lieu de l'écrire :
+// ServeHTTP la transmet à RenderError.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (h HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h(w, r); err != nil {
+		RenderError(w, r, err)
+	}
+}
+
+// Handle sert h en affichant ses erreurs avec les pages et le fuseau du
+// forum (voir Forum.RenderError).
+func (f *Forum) Handle(h HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h(w, r); err != nil {
+			f.RenderError(w, r, err)
+		}
+	})
+}
+
+// errorTitles donne l'intitulé des pages d'erreur.
+var errorTitles = map[int]string{
+	http.StatusBadRequest:            "Requête invalide",
+	http.StatusUnauthorized:          "Connexion requise",
+	http.StatusForbidden:             "Accès refusé",
+	http.StatusNotFound:              "Page introuvable",
+	http.StatusMethodNotAllowed:      "Méthode non autorisée",
+	http.StatusConflict:              "Conflit",
+	http.StatusRequestEntityTooLarge: "Contenu trop volumineux",
+	http.StatusTooManyRequests:       "Trop de requêtes",
+	http.StatusInternalServerError:   "Erreur interne",
+	http.StatusBadGateway:            "Service externe indisponible",
+	http.StatusServiceUnavailable:    "Service indisponible",
+}
+
+// errorPage alimente templates/error.html.
+type errorPage struct {
+	Page
+	Status    int
+	Title     string
+	Message   string
+	RequestID string
+}
+
+// RenderError répond avec une page d'erreur HTML, ou du JSON si le client
+// l'attend. Les erreurs non typées deviennent des erreurs internes : leur
+// texte n'est jamais envoyé au client. Hors d'un Forum, la page est celle de
+// ./templates, en UTC.
+func RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	renderError(w, r, err, defaultTemplates, time.UTC, time.Now())
+}
+
+// RenderError affiche err avec les pages, dans le fuseau et à l'heure du
+// forum.
+func (f *Forum) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	renderError(w, r, err, f.templates(), f.location(), f.now())
+}
+
+func renderError(w http.ResponseWriter, r *http.Request, err error, templates *Templates, loc *time.Location, now time.Time) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Status: http.StatusInternalServerError, Message: "Erreur interne du serveur", Err: err}
+	}
+	if e.Status >= 500 {
+		slog.ErrorContext(r.Context(), e.Message, "status", e.Status, "path", r.URL.Path, "err", e.Err)
+	} else if e.Err != nil {
+		slog.WarnContext(r.Context(), e.Message, "status", e.Status, "path", r.URL.Path, "err", e.Err)
+	}
+
+	page := errorPage{
+		Page:      requestPage(r),
+		Status:    e.Status,
+		Title:     errorTitles[e.Status],
+		Message:   e.Message,
+		RequestID: logging.RequestID(r.Context()),
+	}
+	if page.Title == "" {
+		page.Title = http.StatusText(e.Status)
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(e.Status)
+		json.NewEncoder(w).Encode(struct {
+			Error     string `json:"error"`
+			Status    int    `json:"status"`
+			RequestID string `json:"request_id,omitempty"`
+		}{page.Message, page.Status, page.RequestID})
+		return
+	}
+
+	t, terr := templates.Lookup(r, "error.html", loc, now)
+	if terr != nil {
+		slog.ErrorContext(r.Context(), "parsing du template", "template", "error.html", "err", terr)
+		http.Error(w, page.Message, page.Status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(e.Status)
+	_ = t.Execute(w, page)
+}
+
+// wantsJSON indique si le client attend du JSON : appel d'API, requête fetch
+// envoyant du JSON, ou en-tête Accept qui préfère JSON à HTML.
+func wantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
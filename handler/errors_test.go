@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/database/dbtest"
+)
+
+func TestRenderErrorNegotiation(t *testing.T) {
+	f := NewForum(dbtest.New(t))
+	tests := []struct {
+		name    string
+		path    string
+		header  http.Header
+		err     error
+		status  int
+		json    bool
+		message string
+	}{
+		{"navigateur", "/post", http.Header{"Accept": {"text/html,application/xhtml+xml,*/*;q=0.8"}}, NotFound("Post introuvable"), http.StatusNotFound, false, "Post introuvable"},
+		{"sans Accept", "/post", nil, Validation("ID de post invalide"), http.StatusBadRequest, false, "ID de post invalide"},
+		{"Accept JSON", "/post", http.Header{"Accept": {"application/json"}}, Forbidden("Accès refusé"), http.StatusForbidden, true, "Accès refusé"},
+		{"HTML préféré à JSON", "/post", http.Header{"Accept": {"text/html, application/json"}}, NotFound("Post introuvable"), http.StatusNotFound, false, "Post introuvable"},
+		{"requête fetch en JSON", "/comment", http.Header{"Content-Type": {"application/json"}}, Validation("Commentaire vide"), http.StatusBadRequest, true, "Commentaire vide"},
+		{"API", "/api/notifications", nil, StatusError(http.StatusUnauthorized, "Connexion requise", nil), http.StatusUnauthorized, true, "Connexion requise"},
+		{"erreur non typée", "/api/notifications", nil, errors.New("pq: mot de passe en clair"), http.StatusInternalServerError, true, "Erreur interne du serveur"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+			f.RenderError(w, r, tt.err)
+			res := w.Result()
+			if res.StatusCode != tt.status {
+				t.Fatalf("statut %d, attendu %d", res.StatusCode, tt.status)
+			}
+			if res.Header.Get("Cache-Control") != "no-store" {
+				t.Errorf("Cache-Control %q, attendu no-store", res.Header.Get("Cache-Control"))
+			}
+			contentType := res.Header.Get("Content-Type")
+			if !tt.json {
+				if !strings.HasPrefix(contentType, "text/html") || !strings.Contains(w.Body.String(), tt.message) {
+					t.Fatalf("page HTML attendue : %q, corps %q", contentType, w.Body.String())
+				}
+				return
+			}
+			var body struct {
+				Error  string `json:"error"`
+				Status int    `json:"status"`
+			}
+			if !strings.HasPrefix(contentType, "application/json") {
+				t.Fatalf("Content-Type %q, attendu du JSON", contentType)
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != tt.message || body.Status != tt.status {
+				t.Errorf("corps %+v, attendu %q et %d", body, tt.message, tt.status)
+			}
+			if strings.Contains(w.Body.String(), "pq:") {
+				t.Errorf("cause interne envoyée au client : %s", w.Body.String())
+			}
+		})
+	}
+}
+
+// TestFormErrorHeaders vérifie qu'un formulaire réaffiché avec une erreur
+// porte ses en-têtes avec son statut, et qu'un client JSON reçoit l'erreur
+// en JSON.
+func TestFormErrorHeaders(t *testing.T) {
+	stores := dbtest.New(t)
+	clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	login := loginForum(t, stores, clk)
+	createLoginUser(t, stores, "alice")
+
+	w := login("alice", "mauvais")
+	res := w.Result()
+	if res.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("formulaire : statut %d, Content-Type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	f := NewForum(stores)
+	r := newFormRequest(http.MethodPost, "/connexion", url.Values{"identifier": {"alice"}})
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	f.Handle(f.ConnexionHandler).ServeHTTP(w, r)
+	res = w.Result()
+	var body struct {
+		Error string `json:"error"`
+	}
+	if res.StatusCode != http.StatusBadRequest || !strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") {
+		t.Fatalf("client JSON : statut %d, Content-Type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error != "Tous les champs requis" {
+		t.Errorf("corps %q, %v", w.Body.String(), err)
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"time"
+
+	"forum/database"
+)
+
+// Forum sert les pages du forum à partir des stores de la base. Les stores
+// sont injectés, ce qui permet de tester les handlers sur une base jetable ;
+// Now remplace l'horloge (durée des sessions, limitation des connexions…).
+type Forum struct {
+	database.Stores
+	Now func() time.Time
+	// Location est le fuseau des visiteurs et des comptes sans préférence
+	// (server.timezone) ; UTC si nil.
+	Location *time.Location
+	// SessionPolicy fixe la durée de vie des sessions ouvertes.
+	SessionPolicy database.SessionPolicy
+	// Templates affiche les pages ; sans lui, celles de ./templates.
+	Templates *Templates
+	// OAuth donne les fournisseurs de connexion externes ; aucun si nil.
+	OAuth *OAuth
+}
+
+// NewForum crée les handlers du forum.
+func NewForum(stores database.Stores) *Forum {
+	return &Forum{Stores: stores}
+}
+
+// now renvoie l'heure de Now, ou l'heure courante.
+func (f *Forum) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return time.Now()
+}
+
+// location renvoie le fuseau par défaut du forum.
+func (f *Forum) location() *time.Location {
+	if f.Location != nil {
+		return f.Location
+	}
+	return time.UTC
+}
+
+// templates renvoie les pages du forum.
+func (f *Forum) templates() *Templates {
+	if f.Templates != nil {
+		return f.Templates
+	}
+	return defaultTemplates
+}
@@ -4,9 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 )
 
 // ChatRequest reçu du client
@@ -20,24 +19,21 @@ type ChatResponse struct {
 }
 
 // GeminiChatPage sert la page HTML
-func GeminiChatPage(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "templates/gemini_chat.html")
+func (f *Forum) GeminiChatPage(w http.ResponseWriter, r *http.Request) error {
+	return f.renderTemplate(w, r, "gemini_chat.html", f.newPage(r))
 }
 
 // GeminiChatAPI reçoit un message et appelle l’API REST Gemini 1.5 Flash
-func GeminiChatAPI(w http.ResponseWriter, r *http.Request) {
+func (a *APIs) GeminiChatAPI(w http.ResponseWriter, r *http.Request) error {
 	// 1) Lire la requête
 	var req ChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "JSON invalide", http.StatusBadRequest)
-		return
+		return Validation("JSON invalide")
 	}
 
-	// 2) Ta clé depuis .env
-	apiKey := os.Getenv("GOOGLE_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GOOGLE_API_KEY manquante", http.StatusInternalServerError)
-		return
+	// 2) La clé vient de la configuration
+	if a.Config.GeminiKey == "" {
+		return StatusError(http.StatusServiceUnavailable, "GOOGLE_API_KEY manquante", nil)
 	}
 
 	// 3) Construire le payload pour v1 (gemini-1.5-flash)
@@ -58,26 +54,27 @@ func GeminiChatAPI(w http.ResponseWriter, r *http.Request) {
 
 	b, err := json.Marshal(payload)
 	if err != nil {
-		http.Error(w, "Erreur JSON interne", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur JSON interne")
 	}
 
 	// 4) Appeler le bon endpoint v1 pour gemini-1.5-flash
-	url := "https://generativelanguage.googleapis.com/v1/models/gemini-1.5-flash:generateContent?key=" + apiKey
-	resp, err := http.Post(url, "application/json", bytes.NewReader(b))
+	upstream, err := http.NewRequestWithContext(r.Context(), http.MethodPost, a.Config.GeminiURL+"/models/gemini-1.5-flash:generateContent", bytes.NewReader(b))
 	if err != nil {
-		log.Println("Erreur réseau Gemini :", err)
-		http.Error(w, "Erreur réseau Gemini", http.StatusBadGateway)
-		return
+		return Internal(err, "Erreur JSON interne")
+	}
+	upstream.Header.Set("Content-Type", "application/json")
+	upstream.Header.Set("x-goog-api-key", a.Config.GeminiKey.Value())
+	resp, err := a.do("gemini", upstream)
+	if err != nil {
+		return StatusError(http.StatusBadGateway, "Erreur réseau Gemini", upstreamError(err))
 	}
 	defer resp.Body.Close()
 
 	// 5) En cas d’erreur HTTP, renvoyer le corps pour debug
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Gemini %s\n%s\n", resp.Status, string(body))
-		http.Error(w, "Gemini a renvoyé "+resp.Status+": "+string(body), http.StatusBadGateway)
-		return
+		slog.ErrorContext(r.Context(), "réponse Gemini", "status", resp.Status, "body", truncate(string(body), 1024))
+		return StatusError(http.StatusBadGateway, "Gemini a renvoyé "+resp.Status, nil)
 	}
 
 	// 6) Parser la réponse
@@ -91,8 +88,7 @@ func GeminiChatAPI(w http.ResponseWriter, r *http.Request) {
 		} `json:"candidates"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		http.Error(w, "Réponse Gemini invalide", http.StatusInternalServerError)
-		return
+		return StatusError(http.StatusBadGateway, "Réponse Gemini invalide", err)
 	}
 
 	// 7) Extraire et renvoyer
@@ -102,4 +98,5 @@ func GeminiChatAPI(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ChatResponse{Reply: reply})
+	return nil
 }
@@ -1,90 +1,78 @@
 package handler
 
 import (
-	"html/template"
+	"bytes"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strconv"
-	"strings"
+	"time"
 
 	"forum/database"
 )
 
-// renderTemplate reste inchangé
-func renderTemplate(w http.ResponseWriter, r *http.Request, templateName string, data interface{}) {
-	templatePath := filepath.Join("templates", templateName)
-	if _, err := os.Stat(templatePath); os.IsNotExist(err) {
-		http.Error(w, "Template "+templateName+" introuvable", http.StatusNotFound)
-		return
-	}
-	tmpl, err := template.ParseFiles(templatePath)
-	if err != nil {
-		http.Error(w, "Erreur chargement template: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err := tmpl.Execute(w, data); err != nil {
-		http.Error(w, "Erreur exécution template: "+err.Error(), http.StatusInternalServerError)
-	}
+// located est satisfaite par les données qui intègrent Page : les dates sont
+// alors affichées dans le fuseau du lecteur plutôt que dans celui du forum.
+type located interface {
+	location() *time.Location
 }
 
-// IndexHandler gère deux checks séparés : user_id puis session_id
-func IndexHandler(w http.ResponseWriter, r *http.Request) {
-	type IndexData struct {
-		IsLoggedIn  bool
-		PhotoURL    string
-		RecentPosts []database.Post
-	}
-	data := IndexData{
-		IsLoggedIn:  false,
-		PhotoURL:    "/static/images/profil/profil.png", // avatar par défaut
-		RecentPosts: nil,
-	}
+// renderTemplate affiche templates/<templateName> ; les erreurs sont
+// renvoyées au handler appelant.
+func (f *Forum) renderTemplate(w http.ResponseWriter, r *http.Request, templateName string, data interface{}) error {
+	return f.renderTemplateStatus(w, r, http.StatusOK, templateName, data)
+}
 
-	// 1) On teste toujours d'abord le cookie user_id (fallback)
-	if c, err := r.Cookie("user_id"); err == nil && c.Value != "" {
-		if uid, err2 := strconv.Atoi(c.Value); err2 == nil {
-			if u, err3 := database.GetUserByID(uid); err3 == nil && u.Photo != "" {
-				data.IsLoggedIn = true
-				if strings.HasPrefix(u.Photo, "http") {
-					data.PhotoURL = u.Photo
-				} else {
-					data.PhotoURL = "/static/images/profil/" + u.Photo
-				}
-			}
-		}
+// renderFormError réaffiche un formulaire avec le statut d'erreur status ;
+// un client qui attend du JSON reçoit plutôt msg, comme de RenderError.
+func (f *Forum) renderFormError(w http.ResponseWriter, r *http.Request, status int, msg, templateName string, data interface{}) error {
+	if wantsJSON(r) {
+		return StatusError(status, msg, nil)
 	}
+	return f.renderTemplateStatus(w, r, status, templateName, data)
+}
 
-	// 2) Puis on teste la session (elle écrasera user_id si valide)
-	if sc, err := r.Cookie("session_id"); err == nil {
-		if uid, err2 := database.GetUserIDBySession(sc.Value); err2 == nil {
-			if u, err3 := database.GetUserByID(uid); err3 == nil && u.Photo != "" {
-				data.IsLoggedIn = true
-				if strings.HasPrefix(u.Photo, "http") {
-					data.PhotoURL = u.Photo
-				} else {
-					data.PhotoURL = "/static/images/profil/" + u.Photo
-				}
-			}
-		}
+// renderTemplateStatus affiche la page avec le statut status, écrit une fois
+// la page rendue et ses en-têtes posés.
+func (f *Forum) renderTemplateStatus(w http.ResponseWriter, r *http.Request, status int, templateName string, data interface{}) error {
+	loc := f.location()
+	if l, ok := data.(located); ok && l.location() != nil {
+		loc = l.location()
+	}
+	tmpl, err := f.templates().Lookup(r, templateName, loc, f.now())
+	if err != nil {
+		return Internal(err, "Erreur interne du serveur")
+	}
+	// Rendu en mémoire : une erreur en cours d'exécution donne une page
+	// d'erreur complète plutôt qu'une page tronquée.
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return Internal(err, "Erreur lors de l'affichage de la page")
 	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+	return nil
+}
 
-	// 3) Récupérer les 3 derniers posts
-	if posts, err := database.GetRecentPosts(3); err == nil {
+// IndexHandler affiche l'accueil et les derniers posts publiés.
+func (f *Forum) IndexHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	data := struct {
+		Page
+		RecentPosts []database.Post
+	}{Page: f.newPage(r)}
+	if posts, err := f.Posts.Recent(ctx, 3); err == nil {
 		data.RecentPosts = posts
 	}
-
-	renderTemplate(w, r, "index.html", data)
+	return f.renderTemplate(w, r, "index.html", data)
 }
 
-func TheoriesSpoilersHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, r, "theoriesSpoilers.html", nil)
+func (f *Forum) TheoriesSpoilersHandler(w http.ResponseWriter, r *http.Request) error {
+	return f.renderTemplate(w, r, "theoriesSpoilers.html", f.newPage(r))
 }
 
-func RedirectToIndex(w http.ResponseWriter, r *http.Request) {
+func RedirectToIndex(w http.ResponseWriter, r *http.Request) error {
 	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
+		return NotFound("Cette page n'existe pas.")
 	}
 	http.Redirect(w, r, "/index", http.StatusSeeOther)
+	return nil
 }
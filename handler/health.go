@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"forum/database"
+)
+
+// healthTimeout borne la durée d'une sonde pour ne pas bloquer l'orchestrateur.
+const healthTimeout = 2 * time.Second
+
+// Health sert les sondes /healthz (le processus et la base répondent) et
+// /readyz (prêt à recevoir du trafic : base à jour et pas d'arrêt en cours).
+type Health struct {
+	Stores   database.Stores
+	draining atomic.Bool
+}
+
+// Drain bascule /readyz en 503 pendant l'arrêt, pour que le répartiteur de
+// charge cesse d'envoyer des requêtes avant la fermeture des connexions.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Healthz vérifie que la base SQLite répond.
+func (h *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+	checks := map[string]string{"database": checkResult(ctx, h.Stores.Ping(ctx))}
+	writeHealth(w, checks)
+}
+
+// Readyz vérifie en plus que toutes les migrations sont appliquées.
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+	checks := map[string]string{"database": checkResult(ctx, h.Stores.Ping(ctx))}
+	pending, err := h.Stores.PendingMigrations(ctx)
+	switch {
+	case err != nil:
+		checks["migrations"] = checkResult(ctx, err)
+	case len(pending) > 0:
+		checks["migrations"] = fmt.Sprintf("en attente : %v", pending)
+	default:
+		checks["migrations"] = "ok"
+	}
+	if h.draining.Load() {
+		checks["server"] = "arrêt en cours"
+	}
+	writeHealth(w, checks)
+}
+
+// checkResult journalise l'erreur éventuelle sans l'exposer dans la réponse.
+func checkResult(ctx context.Context, err error) string {
+	if err != nil {
+		slog.ErrorContext(ctx, "sonde de santé", "err", err)
+		return "erreur"
+	}
+	return "ok"
+}
+
+// writeHealth répond 200 si tous les contrôles sont « ok », 503 sinon.
+func writeHealth(w http.ResponseWriter, checks map[string]string) {
+	status, code := "ok", http.StatusOK
+	for _, result := range checks {
+		if result != "ok" {
+			status, code = "indisponible", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
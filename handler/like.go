@@ -1,166 +1,166 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"forum/database"
 )
 
-func LikePostHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) LikePostHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
+		return MethodNotAllowed()
 	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 	postIDStr := r.FormValue("post_id")
 	if postIDStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
-		http.Error(w, "ID de post invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de post invalide")
 	}
-	err = database.SetPostLike(userID, postID, 1)
-	if err != nil {
-		http.Error(w, "Erreur lors du like", http.StatusInternalServerError)
-		return
-	}
-	post, err := database.GetPostByID(postID)
-	if err == nil && post.UserID != userID {
-		database.CreateNotification(post.UserID, "Quelqu'un a liké votre post", postID, 0)
+	err = f.votePost(ctx, userID, postID, 1, "Quelqu'un a liké votre post")
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound("Post introuvable")
+	} else if err != nil {
+		return Internal(err, "Erreur lors du like")
 	}
 	http.Redirect(w, r, "/post?id="+strconv.Itoa(postID), http.StatusSeeOther)
+	return nil
 }
 
-func DislikePostHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) DislikePostHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
+		return MethodNotAllowed()
 	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 	postIDStr := r.FormValue("post_id")
 	if postIDStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
-		http.Error(w, "ID de post invalide", http.StatusBadRequest)
-		return
-	}
-	err = database.SetPostLike(userID, postID, -1)
-	if err != nil {
-		http.Error(w, "Erreur lors du dislike", http.StatusInternalServerError)
-		return
+		return Validation("ID de post invalide")
 	}
-	post, err := database.GetPostByID(postID)
-	if err == nil && post.UserID != userID {
-		database.CreateNotification(post.UserID, "Quelqu'un a disliké votre post", postID, 0)
+	err = f.votePost(ctx, userID, postID, -1, "Quelqu'un a disliké votre post")
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound("Post introuvable")
+	} else if err != nil {
+		return Internal(err, "Erreur lors du dislike")
 	}
 	http.Redirect(w, r, "/post?id="+strconv.Itoa(postID), http.StatusSeeOther)
+	return nil
 }
 
-func LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) LikeCommentHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
+		return MethodNotAllowed()
 	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 	commentIDStr := r.FormValue("comment_id")
 	if commentIDStr == "" {
-		http.Error(w, "ID de commentaire manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de commentaire manquant")
 	}
 	commentID, err := strconv.Atoi(commentIDStr)
 	if err != nil {
-		http.Error(w, "ID de commentaire invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de commentaire invalide")
 	}
-	err = database.SetCommentLike(userID, commentID, 1)
-	if err != nil {
-		http.Error(w, "Erreur lors du like du commentaire", http.StatusInternalServerError)
-		return
-	}
-	comment, err := database.GetCommentByID(commentID)
-	if err == nil && comment.UserID != userID {
-		database.CreateNotification(comment.UserID, "Quelqu'un a liké votre commentaire", comment.PostID, commentID)
+	err = f.voteComment(ctx, userID, commentID, 1, "Quelqu'un a liké votre commentaire")
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound("Commentaire introuvable")
+	} else if err != nil {
+		return Internal(err, "Erreur lors du like du commentaire")
 	}
 	postIDStr := r.FormValue("post_id")
 	if postIDStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 	http.Redirect(w, r, "/post?id="+postIDStr, http.StatusSeeOther)
+	return nil
 }
 
-func DislikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) DislikeCommentHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
-	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return MethodNotAllowed()
 	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 	commentIDStr := r.FormValue("comment_id")
 	if commentIDStr == "" {
-		http.Error(w, "ID de commentaire manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de commentaire manquant")
 	}
 	commentID, err := strconv.Atoi(commentIDStr)
 	if err != nil {
-		http.Error(w, "ID de commentaire invalide", http.StatusBadRequest)
-		return
-	}
-	err = database.SetCommentLike(userID, commentID, -1)
-	if err != nil {
-		http.Error(w, "Erreur lors du dislike du commentaire", http.StatusInternalServerError)
-		return
+		return Validation("ID de commentaire invalide")
 	}
-	comment, err := database.GetCommentByID(commentID)
-	if err == nil && comment.UserID != userID {
-		database.CreateNotification(comment.UserID, "Quelqu'un a disliké votre commentaire", comment.PostID, commentID)
+	err = f.voteComment(ctx, userID, commentID, -1, "Quelqu'un a disliké votre commentaire")
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound("Commentaire introuvable")
+	} else if err != nil {
+		return Internal(err, "Erreur lors du dislike du commentaire")
 	}
 	postIDStr := r.FormValue("post_id")
 	if postIDStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 	http.Redirect(w, r, "/post?id="+postIDStr, http.StatusSeeOther)
-}
\ No newline at end of file
+	return nil
+}
+
+// votePost enregistre le vote et prévient l'auteur du post dans une même
+// transaction. Un post inexistant ou non publié donne sql.ErrNoRows.
+func (f *Forum) votePost(ctx context.Context, userID, postID, value int, msg string) error {
+	return f.InTx(ctx, func(tx database.Stores) error {
+		post, err := tx.Posts.GetByID(ctx, postID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Posts.SetVote(ctx, userID, postID, value); err != nil {
+			return err
+		}
+		if post.UserID == userID {
+			return nil
+		}
+		return tx.Notifications.Create(ctx, post.UserID, msg, postID, 0)
+	})
+}
+
+// voteComment fait de même pour un commentaire.
+func (f *Forum) voteComment(ctx context.Context, userID, commentID, value int, msg string) error {
+	return f.InTx(ctx, func(tx database.Stores) error {
+		comment, err := tx.Comments.GetByID(ctx, commentID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Comments.SetVote(ctx, userID, commentID, value); err != nil {
+			return err
+		}
+		if comment.UserID == userID {
+			return nil
+		}
+		return tx.Notifications.Create(ctx, comment.UserID, msg, comment.PostID, commentID)
+	})
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Protection contre le brute force : au-delà de loginFreeAttempts échecs sur
+// un compte, chaque nouvelle tentative attend 1 s, 2 s, 4 s… (plafonné à
+// loginMaxBackoff). Tous les accountLockThreshold (ou ipLockThreshold) échecs,
+// le compte (ou l'adresse) est verrouillé pour une durée qui double à chaque
+// verrou (15 min, 30 min… jusqu'à loginMaxLock). Une adresse n'est jamais
+// ralentie avant son verrou : elle peut être partagée (NAT, proxy) et
+// quelques échecs d'un visiteur ne doivent pas bloquer les autres.
+const (
+	loginFreeAttempts    = 3
+	loginMaxBackoff      = 5 * time.Minute
+	accountLockThreshold = 10
+	ipLockThreshold      = 50
+	loginLockDuration    = 15 * time.Minute
+	loginMaxLock         = 24 * time.Hour
+)
+
+// errLoginFailed est le seul message renvoyé en cas d'échec, que le compte
+// existe ou non.
+const errLoginFailed = "Identifiants invalides"
+
+// dummyPasswordHash sert à garder un temps de réponse constant quand le compte
+// n'existe pas ou n'a pas de mot de passe.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("cineforum-dummy-password"), bcrypt.DefaultCost)
+
+// loginGuard regroupe les clés suivies pour une tentative de connexion.
+type loginGuard struct {
+	store   database.ThrottleStore
+	userID  int // 0 si l'identifiant ne correspond à aucun compte
+	account database.LoginThrottle
+	ip      database.LoginThrottle
+}
+
+func newLoginGuard(ctx context.Context, store database.ThrottleStore, identifier string, user *database.User, ip string) (*loginGuard, error) {
+	g := &loginGuard{store: store}
+	scope, key := database.ThrottleIdentifier, strings.ToLower(identifier)
+	if user != nil {
+		g.userID = user.ID
+		scope, key = database.ThrottleUser, strconv.Itoa(user.ID)
+	}
+	var err error
+	if g.account, err = store.Get(ctx, scope, key); err != nil {
+		return nil, err
+	}
+	if g.ip, err = store.Get(ctx, database.ThrottleIP, ip); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// wait renvoie le temps restant avant qu'une nouvelle tentative soit examinée :
+// attente progressive ou verrou du compte, verrou seul pour l'adresse.
+func (g *loginGuard) wait(now time.Time) time.Duration {
+	return max(throttleWait(g.account, now, true), throttleWait(g.ip, now, false))
+}
+
+func throttleWait(t database.LoginThrottle, now time.Time, backoff bool) time.Duration {
+	var until time.Time
+	if t.LockedUntil.After(now) {
+		until = t.LockedUntil
+	}
+	if backoff && t.Failures > loginFreeAttempts {
+		shift := min(t.Failures-loginFreeAttempts-1, 20)
+		backoff := min(time.Second<<shift, loginMaxBackoff)
+		if next := t.LastFailureAt.Add(backoff); next.After(until) {
+			until = next
+		}
+	}
+	if until.After(now) {
+		return until.Sub(now)
+	}
+	return 0
+}
+
+// fail enregistre l'échec pour le compte et l'IP et verrouille si nécessaire.
+// Il renvoie la fin du verrou posé sur un compte existant, dont le titulaire
+// doit être prévenu.
+func (g *loginGuard) fail(ctx context.Context, now time.Time) (lockedUntil time.Time, locked bool) {
+	if t, err := g.store.RecordFailure(ctx, g.account.Scope, g.account.Key, now); err == nil {
+		if until, ok := lockFor(t, accountLockThreshold, now); ok {
+			if err := g.store.Lock(ctx, t.Scope, t.Key, until); err == nil && g.userID != 0 {
+				lockedUntil, locked = until, true
+			}
+		}
+	}
+	if t, err := g.store.RecordFailure(ctx, g.ip.Scope, g.ip.Key, now); err == nil {
+		if until, locked := lockFor(t, ipLockThreshold, now); locked {
+			_ = g.store.Lock(ctx, t.Scope, t.Key, until)
+			slog.WarnContext(ctx, "adresse bloquée après des échecs de connexion", "ip", t.Key, "until", until, "failures", t.Failures)
+		}
+	}
+	return lockedUntil, locked
+}
+
+// succeed efface les échecs du compte. Ceux de l'IP sont gardés jusqu'à la
+// purge du suivi : sinon, un attaquant effacerait son compteur en se
+// connectant à son propre compte entre deux essais.
+func (g *loginGuard) succeed(ctx context.Context) {
+	_ = g.store.Clear(ctx, g.account.Scope, g.account.Key)
+}
+
+func lockFor(t database.LoginThrottle, threshold int, now time.Time) (time.Time, bool) {
+	if t.Failures < threshold || t.Failures%threshold != 0 {
+		return time.Time{}, false
+	}
+	shift := min(t.Failures/threshold-1, 10)
+	return now.Add(min(loginLockDuration<<shift, loginMaxLock)), true
+}
+
+func (f *Forum) notifyLockout(ctx context.Context, userID int, ip string, until time.Time) {
+	msg := fmt.Sprintf("🔒 Votre compte est verrouillé jusqu'à %s après plusieurs tentatives de connexion échouées (adresse %s). "+
+		"Si ce n'était pas vous, changez votre mot de passe.", until.In(f.userLocation(ctx, userID)).Format("02/01/2006 15:04"), ip)
+	if err := f.Notifications.Create(ctx, userID, msg, 0, 0); err != nil {
+		slog.ErrorContext(ctx, "notification de verrouillage", "err", err)
+	}
+}
+
+// formatWait arrondit une attente pour l'afficher à l'utilisateur.
+func formatWait(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d s", int(d.Seconds())+1)
+	}
+	return fmt.Sprintf("%d min", int(d.Minutes())+1)
+}
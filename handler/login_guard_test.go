@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+	"forum/middleware"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loginForum renvoie un forum à l'horloge clk et une fonction qui tente une
+// connexion depuis la même adresse.
+func loginForum(t *testing.T, stores database.Stores, clk *clock) func(identifier, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	f := NewForum(stores)
+	f.Now = clk.now
+	return func(identifier, password string) *httptest.ResponseRecorder {
+		r := newFormRequest(http.MethodPost, "/connexion", url.Values{"identifier": {identifier}, "password": {password}})
+		w := httptest.NewRecorder()
+		HandlerFunc(f.ConnexionHandler).ServeHTTP(w, r)
+		return w
+	}
+}
+
+// createLoginUser crée un compte au mot de passe "secret".
+func createLoginUser(t *testing.T, stores database.Stores, username string) int {
+	t.Helper()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	id, err := stores.Users.Create(context.Background(), username, username+"@example.com", string(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// clientIP est l'adresse des requêtes de newFormRequest.
+func clientIP() string {
+	return middleware.ClientIP(httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestLoginBackoff(t *testing.T) {
+	stores := dbtest.New(t)
+	clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	login := loginForum(t, stores, clk)
+	createLoginUser(t, stores, "alice")
+
+	// Les premiers échecs ne ralentissent pas ; le suivant impose 1 s.
+	for i := 0; i <= loginFreeAttempts; i++ {
+		if w := login("alice", "faux"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("échec %d : statut %d, attendu %d", i+1, w.Code, http.StatusUnauthorized)
+		}
+	}
+	w := login("alice", "secret")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("pendant l'attente : statut %d, Retry-After %q ; attendu %d et 2", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+
+	// L'attente double à chaque nouvel échec.
+	clk.t = clk.t.Add(time.Second)
+	if w := login("alice", "faux"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("après 1 s : statut %d, attendu %d", w.Code, http.StatusUnauthorized)
+	}
+	clk.t = clk.t.Add(time.Second)
+	if w := login("alice", "secret"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("1 s après le 5e échec : statut %d, attendu %d", w.Code, http.StatusTooManyRequests)
+	}
+	clk.t = clk.t.Add(time.Second)
+	if w := login("alice", "secret"); w.Code != http.StatusSeeOther {
+		t.Fatalf("2 s après le 5e échec : statut %d, attendu %d", w.Code, http.StatusSeeOther)
+	}
+}
+
+func TestLoginLockoutNotifiesOwner(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+		login := loginForum(t, stores, clk)
+		userID := createLoginUser(t, stores, "alice")
+		key := strconv.Itoa(userID)
+		// Échecs anciens : plus d'attente en cours, le prochain atteint le seuil.
+		for i := 0; i < accountLockThreshold-1; i++ {
+			stores.Throttle.RecordFailure(ctx, database.ThrottleUser, key, clk.t.Add(-time.Hour))
+		}
+
+		if w := login("alice@example.com", "faux"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("échec au seuil : statut %d, attendu %d", w.Code, http.StatusUnauthorized)
+		}
+		notifs, _ := stores.Notifications.ListByUser(ctx, userID)
+		if len(notifs) != 1 || !strings.Contains(notifs[0].Message, clientIP()) {
+			t.Fatalf("notifications : %+v ; attendu un avertissement citant %s", notifs, clientIP())
+		}
+
+		// Le bon mot de passe n'ouvre pas un compte verrouillé.
+		clk.t = clk.t.Add(loginLockDuration - time.Minute)
+		if w := login("alice", "secret"); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("compte verrouillé : statut %d, attendu %d", w.Code, http.StatusTooManyRequests)
+		}
+		clk.t = clk.t.Add(time.Minute)
+		if w := login("alice", "secret"); w.Code != http.StatusSeeOther {
+			t.Fatalf("verrou levé : statut %d, attendu %d", w.Code, http.StatusSeeOther)
+		}
+		if th, _ := stores.Throttle.Get(ctx, database.ThrottleUser, key); th.Failures != 0 {
+			t.Errorf("%d échec(s) encore suivis après la connexion", th.Failures)
+		}
+	})
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	stores := dbtest.New(t)
+	ctx := context.Background()
+	clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	login := loginForum(t, stores, clk)
+	aliceID := createLoginUser(t, stores, "alice")
+	for i := 0; i < ipLockThreshold-1; i++ {
+		stores.Throttle.RecordFailure(ctx, database.ThrottleIP, clientIP(), clk.t.Add(-time.Hour))
+	}
+
+	if w := login("inconnu", "faux"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("échec au seuil : statut %d, attendu %d", w.Code, http.StatusUnauthorized)
+	}
+	// Le verrou vise l'adresse : les autres comptes sont refusés aussi.
+	clk.t = clk.t.Add(loginMaxBackoff)
+	if w := login("alice", "secret"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("adresse verrouillée : statut %d, attendu %d", w.Code, http.StatusTooManyRequests)
+	}
+	if notifs, _ := stores.Notifications.ListByUser(ctx, aliceID); len(notifs) != 0 {
+		t.Errorf("notification pour un verrou d'adresse : %+v", notifs)
+	}
+}
+
+// TestLoginSuccessKeepsIPFailures vérifie qu'un attaquant ne peut pas effacer
+// le suivi de son adresse en se connectant à son propre compte.
+func TestLoginSuccessKeepsIPFailures(t *testing.T) {
+	stores := dbtest.New(t)
+	ctx := context.Background()
+	clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	login := loginForum(t, stores, clk)
+	createLoginUser(t, stores, "alice")
+	createLoginUser(t, stores, "mallory")
+
+	for i := 0; i <= loginFreeAttempts; i++ {
+		login("alice", "faux")
+		clk.t = clk.t.Add(loginMaxBackoff)
+	}
+	if w := login("mallory", "secret"); w.Code != http.StatusSeeOther {
+		t.Fatalf("connexion de l'attaquant : statut %d, attendu %d", w.Code, http.StatusSeeOther)
+	}
+	th, err := stores.Throttle.Get(ctx, database.ThrottleIP, clientIP())
+	if err != nil || th.Failures != loginFreeAttempts+1 {
+		t.Fatalf("échecs de l'adresse après une connexion réussie : %d, %v ; attendu %d", th.Failures, err, loginFreeAttempts+1)
+	}
+	// Les échecs suivants de l'adresse continuent de compter vers son verrou.
+	login("alice", "faux")
+	if th, _ := stores.Throttle.Get(ctx, database.ThrottleIP, clientIP()); th.Failures != loginFreeAttempts+2 {
+		t.Fatalf("échecs de l'adresse : %d, attendu %d", th.Failures, loginFreeAttempts+2)
+	}
+}
+
+// TestLoginIPFailuresDoNotSlowOthers vérifie que les échecs d'un visiteur ne
+// ralentissent pas les autres comptes derrière la même adresse (NAT, proxy)
+// tant que l'adresse n'est pas verrouillée.
+func TestLoginIPFailuresDoNotSlowOthers(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+		login := loginForum(t, stores, clk)
+		createLoginUser(t, stores, "alice")
+		createLoginUser(t, stores, "bob")
+
+		for i := 0; i <= loginFreeAttempts; i++ {
+			login("inconnu", "faux")
+		}
+		if w := login("alice", "faux"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("autre compte après %d échecs de l'adresse : statut %d, attendu %d", loginFreeAttempts+1, w.Code, http.StatusUnauthorized)
+		}
+		if w := login("bob", "secret"); w.Code != http.StatusSeeOther {
+			t.Fatalf("bons identifiants après les échecs de l'adresse : statut %d, attendu %d", w.Code, http.StatusSeeOther)
+		}
+	})
+}
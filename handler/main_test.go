@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"forum/database/dbtest"
+)
+
+// TestMain place les tests à la racine du dépôt, où les templates sont lus
+// par chemin relatif.
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		log.Fatal(err)
+	}
+	dbtest.Main(m)
+}
@@ -2,200 +2,156 @@ package handler
 
 import (
 	"forum/database"
-	"html/template"
 	"net/http"
 	"strconv"
 )
 
 // ModerationDashboardHandler affiche la liste des posts en attente de modération.
-func ModerationDashboardHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+func (f *Forum) ModerationDashboardHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	user, err := database.GetUserWithRole(userID)
+	user, err := f.Users.GetByID(ctx, userID)
 	if err != nil {
-		http.Error(w, "Utilisateur non trouvé", http.StatusUnauthorized)
-		return
+		return StatusError(http.StatusUnauthorized, "Utilisateur non trouvé", nil)
 	}
 	if user.Role != "moderator" && user.Role != "admin" {
-		http.Error(w, "Accès refusé", http.StatusForbidden)
-		return
-	}
-	pendingPosts, err := database.GetPendingPosts()
-	if err != nil {
-		http.Error(w, "Erreur lors de la récupération des posts en attente", http.StatusInternalServerError)
-		return
+		return Forbidden("Accès refusé")
 	}
-	t, err := template.ParseFiles("templates/moderation.html")
+	pendingPosts, err := f.Posts.Pending(ctx)
 	if err != nil {
-		http.Error(w, "Erreur lors du chargement du template", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la récupération des posts en attente")
 	}
 	data := struct {
+		Page
 		PendingPosts []database.Post
-		User         database.User
-	}{
-		PendingPosts: pendingPosts,
-		User:         user,
-	}
-	t.Execute(w, data)
+	}{f.newPage(r), pendingPosts}
+	return f.renderTemplate(w, r, "moderation.html", data)
 }
 
 // ApprovePostHandler permet à un modérateur d'approuver un post.
-func ApprovePostHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) ApprovePostHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
-	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return MethodNotAllowed()
 	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	user, err := database.GetUserWithRole(userID)
+	user, err := f.Users.GetByID(ctx, userID)
 	if err != nil || (user.Role != "moderator" && user.Role != "admin") {
-		http.Error(w, "Accès refusé", http.StatusForbidden)
-		return
+		return Forbidden("Accès refusé")
 	}
 	postIDStr := r.FormValue("post_id")
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
-		http.Error(w, "ID de post invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de post invalide")
 	}
-	err = database.SetPostModerationStatus(postID, "approved")
+	err = f.Posts.SetModerationStatus(ctx, postID, "approved")
 	if err != nil {
-		http.Error(w, "Erreur lors de l'approbation du post", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de l'approbation du post")
 	}
 	// Envoi de la notification à l'auteur
-	post, err := database.GetPostByID(postID)
+	post, err := f.Posts.GetByID(ctx, postID)
 	if err == nil {
 		msg := "Votre post \"" + post.Title + "\" a été approuvé."
-		_ = database.CreateNotification(post.UserID, msg, post.ID, 0)
+		_ = f.Notifications.Create(ctx, post.UserID, msg, post.ID, 0)
 	}
 	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+	return nil
 }
 
 // RejectPostHandler permet à un modérateur de rejeter un post.
-func RejectPostHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) RejectPostHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
+		return MethodNotAllowed()
 	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	user, err := database.GetUserWithRole(userID)
+	user, err := f.Users.GetByID(ctx, userID)
 	if err != nil || (user.Role != "moderator" && user.Role != "admin") {
-		http.Error(w, "Accès refusé", http.StatusForbidden)
-		return
+		return Forbidden("Accès refusé")
 	}
 	postIDStr := r.FormValue("post_id")
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
-		http.Error(w, "ID de post invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de post invalide")
 	}
-	err = database.SetPostModerationStatus(postID, "rejected")
+	err = f.Posts.SetModerationStatus(ctx, postID, "rejected")
 	if err != nil {
-		http.Error(w, "Erreur lors du rejet du post", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors du rejet du post")
 	}
 	// Envoi de la notification à l'auteur pour indiquer que son post a été rejeté.
-	post, err := database.GetPostByID(postID)
+	post, err := f.Posts.GetByID(ctx, postID)
 	if err == nil {
 		msg := "Votre post \"" + post.Title + "\" a été rejeté."
-		_ = database.CreateNotification(post.UserID, msg, post.ID, 0)
+		_ = f.Notifications.Create(ctx, post.UserID, msg, post.ID, 0)
 	}
 	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+	return nil
 }
 
 // PromoteUserHandler permet à un administrateur de promouvoir un utilisateur en modérateur.
-func PromoteUserHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) PromoteUserHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
+		return MethodNotAllowed()
 	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
+	adminID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	adminID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	admin, err := database.GetUserWithRole(adminID)
+	admin, err := f.Users.GetByID(ctx, adminID)
 	if err != nil || admin.Role != "admin" {
-		http.Error(w, "Accès réservé aux administrateurs", http.StatusForbidden)
-		return
+		return Forbidden("Accès réservé aux administrateurs")
 	}
 	targetUserIDStr := r.FormValue("user_id")
 	targetUserID, err := strconv.Atoi(targetUserIDStr)
 	if err != nil {
-		http.Error(w, "ID d'utilisateur invalide", http.StatusBadRequest)
-		return
+		return Validation("ID d'utilisateur invalide")
 	}
-	err = database.UpdateUserRole(targetUserID, "moderator")
+	err = f.Users.SetRole(ctx, adminID, targetUserID, "moderator")
 	if err != nil {
-		http.Error(w, "Erreur lors de la promotion de l'utilisateur", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la promotion de l'utilisateur")
 	}
 	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+	return nil
 }
 
 // DemoteUserHandler permet à un administrateur de rétrograder un modérateur vers un utilisateur classique.
-func DemoteUserHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) DemoteUserHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
+		return MethodNotAllowed()
 	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	adminID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+	adminID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	admin, err := database.GetUserWithRole(adminID)
+	admin, err := f.Users.GetByID(ctx, adminID)
 	if err != nil || admin.Role != "admin" {
-		http.Error(w, "Accès réservé aux administrateurs", http.StatusForbidden)
-		return
+		return Forbidden("Accès réservé aux administrateurs")
 	}
 	targetUserIDStr := r.FormValue("user_id")
 	targetUserID, err := strconv.Atoi(targetUserIDStr)
 	if err != nil {
-		http.Error(w, "ID d'utilisateur invalide", http.StatusBadRequest)
-		return
+		return Validation("ID d'utilisateur invalide")
 	}
-	err = database.UpdateUserRole(targetUserID, "user")
+	err = f.Users.SetRole(ctx, adminID, targetUserID, "user")
 	if err != nil {
-		http.Error(w, "Erreur lors de la rétrogradation de l'utilisateur", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la rétrogradation de l'utilisateur")
 	}
 	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+	return nil
 }
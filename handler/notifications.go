@@ -2,33 +2,24 @@ package handler
 
 import (
 	"encoding/json"
-	"forum/database"
-	"html/template"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"time"
 )
 
-func NotificationsHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
-		http.Error(w, "Non autorisé", http.StatusUnauthorized)
-		return
+func (f *Forum) NotificationsHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	userID, ok := currentUserID(r)
+	if !ok {
+		return StatusError(http.StatusUnauthorized, "Non autorisé", nil)
 	}
-	userID, err := strconv.Atoi(cookie.Value)
+	notifs, err := f.Notifications.ListByUser(ctx, userID)
 	if err != nil {
-		http.Error(w, "Cookie invalide", http.StatusBadRequest)
-		return
-	}
-	notifs, err := database.GetNotificationsByUserID(userID)
-	if err != nil {
-		http.Error(w, "Erreur lors de la récupération des notifications", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la récupération des notifications")
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(notifs)
+	return nil
 }
 
 type NotificationView struct {
@@ -37,31 +28,22 @@ type NotificationView struct {
 	CreatedAt time.Time
 }
 
-func NotificationsPageHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+func (f *Forum) NotificationsPageHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	notifs, err := database.GetNotificationsByUserID(userID)
+	notifs, err := f.Notifications.ListByUser(ctx, userID)
 	if err != nil {
-		http.Error(w, "Erreur lors de la récupération des notifications", http.StatusInternalServerError)
-		return
-	}
-	loc, err := time.LoadLocation("Europe/Paris")
-	if err != nil {
-		loc = time.UTC
+		return Internal(err, "Erreur lors de la récupération des notifications")
 	}
 	var views []NotificationView
 	for _, n := range notifs {
 		nv := NotificationView{}
 		if n.CommentID != 0 {
-			comment, err := database.GetCommentByID(n.CommentID)
+			comment, err := f.Comments.GetByID(ctx, n.CommentID)
 			if err == nil {
 				nv.Message = "Quelqu'un a liké votre commentaire"
 				if comment.UserID != 0 {
@@ -73,47 +55,33 @@ func NotificationsPageHandler(w http.ResponseWriter, r *http.Request) {
 			nv.PostLink = "/post?id=" + strconv.Itoa(n.PostID)
 		} else {
 			nv.Message = n.Message
-			nv.PostLink = "/post?id=" + strconv.Itoa(n.PostID)
+			if n.PostID != 0 {
+				nv.PostLink = "/post?id=" + strconv.Itoa(n.PostID)
+			}
 		}
-		nv.CreatedAt = n.CreatedAt.In(loc)
+		nv.CreatedAt = n.CreatedAt
 		views = append(views, nv)
 	}
-	templatePath := filepath.Join("templates", "notifications.html")
-	if _, err := os.Stat(templatePath); os.IsNotExist(err) {
-		http.Error(w, "Template introuvable", http.StatusNotFound)
-		return
-	}
-	tmpl, err := template.ParseFiles(templatePath)
-	if err != nil {
-		http.Error(w, "Erreur lors du chargement du template", http.StatusInternalServerError)
-		return
-	}
-	err = tmpl.Execute(w, views)
-	if err != nil {
-		http.Error(w, "Erreur lors de l'exécution du template", http.StatusInternalServerError)
-		return
-	}
+	data := struct {
+		Page
+		Notifications []NotificationView
+	}{f.newPage(r), views}
+	return f.renderTemplate(w, r, "notifications.html", data)
 }
 
-func MarkNotificationsAsReadHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) MarkNotificationsAsReadHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
-		return
-	}
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
-		http.Error(w, "Non autorisé", http.StatusUnauthorized)
-		return
+		return MethodNotAllowed()
 	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Error(w, "Cookie invalide", http.StatusBadRequest)
-		return
+	userID, ok := currentUserID(r)
+	if !ok {
+		return StatusError(http.StatusUnauthorized, "Non autorisé", nil)
 	}
-	err = database.DeleteNotificationsByUserID(userID)
+	err := f.Notifications.DeleteByUser(ctx, userID)
 	if err != nil {
-		http.Error(w, "Erreur lors de la suppression des notifications", http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la suppression des notifications")
 	}
 	http.Redirect(w, r, "/notifications-page", http.StatusSeeOther)
-}
\ No newline at end of file
+	return nil
+}
@@ -1,163 +1,382 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"forum/database"
 	"github.com/google/uuid"
-	"github.com/markbates/goth/gothic"
 )
 
-func GoogleAuthHandler(w http.ResponseWriter, r *http.Request) {
-	r.URL.RawQuery = "provider=google"
-	gothic.BeginAuthHandler(w, r)
+const (
+	oauthIntentCookie  = "oauth_intent"
+	oauthSignupCookie  = "oauth_signup"
+	oauthSignupTimeout = 15 * time.Minute
+)
+
+// providerLabels donne le nom affiché des fournisseurs connus.
+var providerLabels = map[string]string{
+	"google":   "Google",
+	"facebook": "Facebook",
+	"github":   "GitHub",
+	"twitter":  "Twitter",
 }
 
-func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	user, err := gothic.CompleteUserAuth(w, r)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusTemporaryRedirect)
-		return
+func providerLabel(name string) string {
+	if label, ok := providerLabels[name]; ok {
+		return label
 	}
-	dbUser, err := database.GetUserByEmail(user.Email)
-	if err != nil {
-		_ = database.CreateUser(user.Name, user.Email, "oauth")
-		dbUser, _ = database.GetUserByEmail(user.Email)
+	return name
+}
+
+// OAuthBeginHandler redirige vers le fournisseur /auth/{provider}. Avec
+// ?link=1, le compte obtenu sera lié à l'utilisateur connecté.
+func (f *Forum) OAuthBeginHandler(w http.ResponseWriter, r *http.Request) error {
+	p, ok := f.OAuth.provider(r.PathValue("provider"))
+	if !ok {
+		return NotFound("Fournisseur de connexion inconnu")
+	}
+	intent := ""
+	if r.URL.Query().Get("link") == "1" {
+		intent = "link"
 	}
-	// Création session
-	sessionID := uuid.NewString()
-	expiry := time.Now().Add(24 * time.Hour)
-	_ = database.CreateSession(sessionID, dbUser.ID, expiry)
 	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Path:     "/",
+		Name:     oauthIntentCookie,
+		Value:    intent,
+		Path:     "/auth",
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteLaxMode,
-		Expires:  expiry,
-	})
-	// Compatibilité user_id
-	http.SetCookie(w, &http.Cookie{
-		Name:     "user_id",
-		Value:    strconv.Itoa(dbUser.ID),
-		Path:     "/",
-		HttpOnly: true,
+		MaxAge:   600,
 	})
-	http.Redirect(w, r, "/profil", http.StatusTemporaryRedirect)
+	authURL, err := f.OAuth.beginAuth(w, r, p)
+	if err != nil {
+		return StatusError(http.StatusBadGateway, "Connexion impossible chez "+f.OAuth.label(p.Name()), err)
+	}
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+	return nil
 }
 
-// Même logique pour Facebook, Github et Twitter :
+// OAuthCallbackHandler termine l'authentification /auth/{provider}/callback
+// pour tous les fournisseurs.
+func (f *Forum) OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	provider := r.PathValue("provider")
+	p, ok := f.OAuth.provider(provider)
+	if !ok {
+		return NotFound("Fournisseur de connexion inconnu")
+	}
+	gu, err := f.OAuth.completeAuth(w, r, p)
+	if err != nil || gu.UserID == "" {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
 
-func FacebookAuthHandler(w http.ResponseWriter, r *http.Request) {
-	r.URL.RawQuery = "provider=facebook"
-	gothic.BeginAuthHandler(w, r)
-}
+	linking := false
+	if c, err := r.Cookie(oauthIntentCookie); err == nil && c.Value == "link" {
+		linking = true
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthIntentCookie, Path: "/auth", MaxAge: -1})
+	role := f.OAuth.mappedRole(provider, gu.RawData)
 
-func FacebookCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	user, err := gothic.CompleteUserAuth(w, r)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusTemporaryRedirect)
-		return
+	identity, err := f.Identities.Get(ctx, provider, gu.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Internal(err, "Erreur interne du serveur")
 	}
-	dbUser, err := database.GetUserByEmail(user.Email)
-	if err != nil {
-		_ = database.CreateUser(user.Name, user.Email, "oauth")
-		dbUser, _ = database.GetUserByEmail(user.Email)
+	known := err == nil
+	ownerID := identity.UserID
+
+	// Liaison depuis le profil
+	if linking {
+		userID, ok := currentUserID(r)
+		if !ok {
+			http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+			return nil
+		}
+		if known && ownerID != userID {
+			return StatusError(http.StatusConflict, "Ce compte "+f.OAuth.label(provider)+" est déjà lié à un autre utilisateur", nil)
+		}
+		// Le rôle d'un compte lié reste celui du forum : le fournisseur ne
+		// gère que les comptes qu'il a créés.
+		if !known {
+			if err := f.Identities.Link(ctx, userID, provider, gu.UserID, gu.Email); err != nil {
+				return StatusError(http.StatusConflict, "Un compte "+f.OAuth.label(provider)+" est déjà lié à votre profil", nil)
+			}
+		}
+		http.Redirect(w, r, "/profil/comptes", http.StatusSeeOther)
+		return nil
+	}
+
+	if known {
+		if identity.CreatedUser {
+			if err := f.applyMappedRole(ctx, ownerID, role); err != nil {
+				return Internal(err, "Erreur lors de la mise à jour du rôle")
+			}
+		}
+		return f.completeLogin(w, r, ownerID, false, "/profil")
+	}
+
+	// Identité inconnue : on ne rattache jamais automatiquement un compte
+	// protégé par mot de passe sur la seule foi de l'email du fournisseur.
+	if gu.Email != "" {
+		if existing, err := f.Users.GetByEmail(ctx, gu.Email); err == nil {
+			identities, _ := f.Identities.ListByUser(ctx, existing.ID)
+			if existing.Password == "" && len(identities) == 0 && emailVerified(gu.RawData) {
+				// Compte créé par l'ancien callback OAuth, accessible uniquement
+				// via cet email : on le rattache pour ne pas en perdre l'accès,
+				// à condition que le fournisseur garantisse l'adresse.
+				if err := f.Identities.Link(ctx, existing.ID, provider, gu.UserID, gu.Email); err != nil {
+					return Internal(err, "Erreur lors de la liaison du compte")
+				}
+				return f.completeLogin(w, r, existing.ID, false, "/profil")
+			}
+			return f.renderConnexionError(w, r, http.StatusConflict, "Un compte existe déjà avec l'adresse "+gu.Email+
+				". Connectez-vous avec votre mot de passe puis liez "+f.OAuth.label(provider)+" depuis votre profil.")
+		}
+	}
+
+	// Nouvel utilisateur : choix du nom d'utilisateur avant création du compte.
+	pending := database.PendingOAuth{
+		Token:     uuid.NewString(),
+		Provider:  provider,
+		Subject:   gu.UserID,
+		Email:     gu.Email,
+		Name:      firstNonEmpty(gu.NickName, gu.Name, gu.FirstName),
+		Role:      role,
+		ExpiresAt: f.now().Add(oauthSignupTimeout),
+	}
+	if err := f.Identities.CreatePending(ctx, pending); err != nil {
+		return Internal(err, "Erreur interne du serveur")
 	}
-	sessionID := uuid.NewString()
-	expiry := time.Now().Add(24 * time.Hour)
-	_ = database.CreateSession(sessionID, dbUser.ID, expiry)
 	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Path:     "/",
+		Name:     oauthSignupCookie,
+		Value:    pending.Token,
+		Path:     "/inscription/oauth",
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteLaxMode,
-		Expires:  expiry,
+		Expires:  pending.ExpiresAt,
 	})
-	http.SetCookie(w, &http.Cookie{
-		Name:     "user_id",
-		Value:    strconv.Itoa(dbUser.ID),
-		Path:     "/",
-		HttpOnly: true,
-	})
-	http.Redirect(w, r, "/profil", http.StatusTemporaryRedirect)
+	http.Redirect(w, r, "/inscription/oauth", http.StatusSeeOther)
+	return nil
 }
 
-func GithubAuthHandler(w http.ResponseWriter, r *http.Request) {
-	r.URL.RawQuery = "provider=github"
-	gothic.BeginAuthHandler(w, r)
+// OAuthUsernameHandler demande un nom d'utilisateur (et un email si le
+// fournisseur n'en a pas transmis) avant de créer le compte OAuth.
+func (f *Forum) OAuthUsernameHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	c, err := r.Cookie(oauthSignupCookie)
+	if err != nil || c.Value == "" {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
+	pending, err := f.Identities.GetPending(ctx, c.Value, f.now())
+	if err != nil {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
+
+	data := struct {
+		Page
+		Provider   string
+		Username   string
+		Email      string
+		NeedsEmail bool
+		Error      string
+	}{
+		Page:       f.newPage(r),
+		Provider:   f.OAuth.label(pending.Provider),
+		Username:   f.suggestUsername(ctx, pending.Name),
+		Email:      pending.Email,
+		NeedsEmail: pending.Email == "",
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return f.renderTemplate(w, r, "oauth_username.html", data)
+
+	case http.MethodPost:
+		data.Username = strings.TrimSpace(r.FormValue("username"))
+		email := pending.Email
+		if data.NeedsEmail {
+			email = strings.TrimSpace(r.FormValue("email"))
+			data.Email = email
+		}
+		switch {
+		case !validUsername(data.Username):
+			data.Error = "Le nom d'utilisateur doit faire entre 3 et 30 caractères (lettres, chiffres, - _ .)"
+		case f.usernameTaken(ctx, data.Username):
+			data.Error = "Ce nom d'utilisateur est déjà pris"
+		case email == "" || !strings.Contains(email, "@"):
+			data.Error = "Une adresse email valide est requise"
+		case f.emailTaken(ctx, email):
+			data.Error = "Cette adresse email est déjà utilisée par un autre compte"
+		}
+		if data.Error != "" {
+			return f.renderFormError(w, r, http.StatusBadRequest, data.Error, "oauth_username.html", data)
+		}
+		userID, err := f.Identities.CreateUser(ctx, data.Username, email, pending.Provider, pending.Subject)
+		if err != nil {
+			return Internal(err, "Erreur lors de la création de l'utilisateur")
+		}
+		if err := f.applyMappedRole(ctx, userID, pending.Role); err != nil {
+			return Internal(err, "Erreur lors de la mise à jour du rôle")
+		}
+		_ = f.Identities.DeletePending(ctx, pending.Token)
+		http.SetCookie(w, &http.Cookie{Name: oauthSignupCookie, Path: "/inscription/oauth", MaxAge: -1})
+		return f.completeLogin(w, r, userID, false, "/profil")
+
+	default:
+		return MethodNotAllowed()
+	}
 }
 
-func GithubCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	user, err := gothic.CompleteUserAuth(w, r)
+// LinkedAccount décrit un fournisseur dans la page /profil/comptes.
+type LinkedAccount struct {
+	Provider string
+	Label    string
+	Linked   bool
+	Email    string
+	LinkedAt time.Time
+}
+
+// LinkedAccountsHandler liste les fournisseurs configurés et permet de lier
+// ou de délier un compte externe.
+func (f *Forum) LinkedAccountsHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
+	user, err := f.Users.GetByID(ctx, userID)
 	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusTemporaryRedirect)
-		return
+		return StatusError(http.StatusUnauthorized, "Utilisateur non trouvé", nil)
 	}
-	dbUser, err := database.GetUserByEmail(user.Email)
+	identities, err := f.Identities.ListByUser(ctx, userID)
 	if err != nil {
-		_ = database.CreateUser(user.Name, user.Email, "oauth")
-		dbUser, _ = database.GetUserByEmail(user.Email)
+		return Internal(err, "Erreur lors de la récupération des comptes liés")
 	}
-	sessionID := uuid.NewString()
-	expiry := time.Now().Add(24 * time.Hour)
-	_ = database.CreateSession(sessionID, dbUser.ID, expiry)
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-		Expires:  expiry,
-	})
-	http.SetCookie(w, &http.Cookie{
-		Name:     "user_id",
-		Value:    strconv.Itoa(dbUser.ID),
-		Path:     "/",
-		HttpOnly: true,
-	})
-	http.Redirect(w, r, "/profil", http.StatusTemporaryRedirect)
+
+	switch r.Method {
+	case http.MethodGet:
+		linked := make(map[string]database.OAuthIdentity, len(identities))
+		for _, i := range identities {
+			linked[i.Provider] = i
+		}
+		var accounts []LinkedAccount
+		for _, name := range f.OAuth.names() {
+			a := LinkedAccount{Provider: name, Label: f.OAuth.label(name)}
+			if i, ok := linked[name]; ok {
+				a.Linked, a.Email, a.LinkedAt = true, i.Email, i.CreatedAt
+			}
+			accounts = append(accounts, a)
+		}
+		sort.Slice(accounts, func(i, j int) bool { return accounts[i].Label < accounts[j].Label })
+		data := struct {
+			Page
+			Accounts    []LinkedAccount
+			HasPassword bool
+		}{f.newPage(r), accounts, user.Password != ""}
+		return f.renderTemplate(w, r, "linked_accounts.html", data)
+
+	case http.MethodPost:
+		provider := r.FormValue("provider")
+		if user.Password == "" && len(identities) <= 1 {
+			return Validation("Impossible de retirer votre seule méthode de connexion")
+		}
+		if err := f.Identities.Unlink(ctx, userID, provider); err != nil {
+			return Internal(err, "Erreur lors de la suppression du lien")
+		}
+		http.Redirect(w, r, "/profil/comptes", http.StatusSeeOther)
+
+	default:
+		return MethodNotAllowed()
+	}
+	return nil
 }
 
-func TwitterAuthHandler(w http.ResponseWriter, r *http.Request) {
-	r.URL.RawQuery = "provider=twitter"
-	gothic.BeginAuthHandler(w, r)
+// emailVerified indique si le fournisseur atteste que l'adresse transmise
+// appartient à l'utilisateur : claim email_verified d'OpenID Connect, ou
+// verified_email de l'ancienne API de Google. Sans cette attestation,
+// n'importe qui pourrait déclarer l'adresse d'un autre.
+func emailVerified(claims map[string]interface{}) bool {
+	for _, name := range []string{"email_verified", "verified_email"} {
+		switch v := claims[name].(type) {
+		case bool:
+			if v {
+				return true
+			}
+		case string:
+			if strings.EqualFold(v, "true") {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func TwitterCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	user, err := gothic.CompleteUserAuth(w, r)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusTemporaryRedirect)
-		return
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
 	}
-	dbUser, err := database.GetUserByEmail(user.Email)
-	if err != nil {
-		_ = database.CreateUser(user.Name, user.Email, "oauth")
-		dbUser, _ = database.GetUserByEmail(user.Email)
+	return ""
+}
+
+func validUsername(username string) bool {
+	if n := utf8.RuneCountInString(username); n < 3 || n > 30 {
+		return false
 	}
-	sessionID := uuid.NewString()
-	expiry := time.Now().Add(24 * time.Hour)
-	_ = database.CreateSession(sessionID, dbUser.ID, expiry)
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-		Expires:  expiry,
-	})
-	http.SetCookie(w, &http.Cookie{
-		Name:     "user_id",
-		Value:    strconv.Itoa(dbUser.ID),
-		Path:     "/",
-		HttpOnly: true,
-	})
-	http.Redirect(w, r, "/profil", http.StatusTemporaryRedirect)
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Forum) usernameTaken(ctx context.Context, username string) bool {
+	_, err := f.Users.GetByUsername(ctx, username)
+	return err == nil
+}
+
+func (f *Forum) emailTaken(ctx context.Context, email string) bool {
+	_, err := f.Users.GetByEmail(ctx, email)
+	return err == nil
+}
+
+// suggestUsername propose un nom d'utilisateur libre dérivé du nom affiché
+// par le fournisseur.
+func (f *Forum) suggestUsername(ctx context.Context, name string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('_')
+		}
+	}
+	base := []rune(b.String())
+	if len(base) > 25 {
+		base = base[:25]
+	}
+	if len(base) < 3 {
+		return ""
+	}
+	candidate := string(base)
+	for i := 2; f.usernameTaken(ctx, candidate) && i < 100; i++ {
+		candidate = string(base) + strconv.Itoa(i)
+	}
+	return candidate
 }
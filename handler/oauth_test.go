@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+	"forum/middleware"
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth/providers/github"
+)
+
+func TestOAuthUsernameChooser(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+		f := NewForum(stores)
+		f.Now = clk.now
+		createLoginUser(t, stores, "bob")
+		pending := database.PendingOAuth{Token: "inscription", Provider: "github", Subject: "gh-1", Name: "Alice Martin", ExpiresAt: clk.t.Add(oauthSignupTimeout)}
+		if err := stores.Identities.CreatePending(ctx, pending); err != nil {
+			t.Fatal(err)
+		}
+		do := func(r *http.Request, token string) *httptest.ResponseRecorder {
+			if token != "" {
+				r.AddCookie(&http.Cookie{Name: oauthSignupCookie, Value: token})
+			}
+			w := httptest.NewRecorder()
+			HandlerFunc(f.OAuthUsernameHandler).ServeHTTP(w, r)
+			return w
+		}
+		post := func(form url.Values) *httptest.ResponseRecorder {
+			return do(newFormRequest(http.MethodPost, "/inscription/oauth", form), pending.Token)
+		}
+		toLogin := func(w *httptest.ResponseRecorder) bool {
+			return w.Code == http.StatusSeeOther && w.Header().Get("Location") == "/connexion"
+		}
+
+		if w := do(httptest.NewRequest(http.MethodGet, "/inscription/oauth", nil), ""); !toLogin(w) {
+			t.Fatalf("sans inscription en attente : statut %d vers %q", w.Code, w.Header().Get("Location"))
+		}
+		if w := do(httptest.NewRequest(http.MethodGet, "/inscription/oauth", nil), pending.Token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `value="Alice_Martin"`) {
+			t.Fatalf("formulaire : statut %d, attendu le pseudo suggéré", w.Code)
+		}
+
+		rejected := []struct {
+			name string
+			form url.Values
+		}{
+			{"pseudo invalide", url.Values{"username": {"a"}, "email": {"alice@example.com"}}},
+			{"pseudo pris", url.Values{"username": {"bob"}, "email": {"alice@example.com"}}},
+			{"email manquant", url.Values{"username": {"alice"}}},
+			{"email d'un autre compte", url.Values{"username": {"alice"}, "email": {"bob@example.com"}}},
+		}
+		for _, tt := range rejected {
+			if w := post(tt.form); w.Code != http.StatusBadRequest {
+				t.Errorf("%s : statut %d, attendu %d", tt.name, w.Code, http.StatusBadRequest)
+			}
+		}
+		if _, err := stores.Users.GetByUsername(ctx, "alice"); err == nil {
+			t.Fatal("compte créé malgré un formulaire refusé")
+		}
+
+		w := post(url.Values{"username": {"alice"}, "email": {"alice@example.com"}})
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/profil" || sessionCookie(w) == nil {
+			t.Fatalf("inscription : statut %d vers %q", w.Code, w.Header().Get("Location"))
+		}
+		user, err := stores.Users.GetByUsername(ctx, "alice")
+		if err != nil || user.Password != "" {
+			t.Fatalf("compte %+v, %v ; attendu un compte sans mot de passe", user, err)
+		}
+		if identity, err := stores.Identities.Get(ctx, "github", "gh-1"); err != nil || identity.UserID != user.ID || !identity.CreatedUser {
+			t.Fatalf("identité %+v, %v", identity, err)
+		}
+		// L'inscription en attente ne sert qu'une fois.
+		if w := post(url.Values{"username": {"alice2"}, "email": {"alice2@example.com"}}); !toLogin(w) {
+			t.Fatalf("inscription rejouée : statut %d vers %q", w.Code, w.Header().Get("Location"))
+		}
+
+		expired := database.PendingOAuth{Token: "expirée", Provider: "github", Subject: "gh-2", Email: "carol@example.com", ExpiresAt: clk.t.Add(oauthSignupTimeout)}
+		if err := stores.Identities.CreatePending(ctx, expired); err != nil {
+			t.Fatal(err)
+		}
+		clk.t = clk.t.Add(oauthSignupTimeout + time.Second)
+		if w := do(newFormRequest(http.MethodPost, "/inscription/oauth", url.Values{"username": {"carol"}}), expired.Token); !toLogin(w) {
+			t.Fatalf("inscription expirée : statut %d vers %q", w.Code, w.Header().Get("Location"))
+		}
+	})
+}
+
+// TestPasswordLoginRefusedWithoutPassword vérifie qu'un compte créé par un
+// fournisseur n'accepte aucun mot de passe.
+func TestPasswordLoginRefusedWithoutPassword(t *testing.T) {
+	stores := dbtest.New(t)
+	clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	login := loginForum(t, stores, clk)
+	if _, err := stores.Identities.CreateUser(context.Background(), "alice", "alice@example.com", "github", "gh-1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, password := range []string{"oauth", "x"} {
+		if w := login("alice", password); w.Code != http.StatusUnauthorized || sessionCookie(w) != nil {
+			t.Errorf("mot de passe %q : statut %d, attendu %d sans session", password, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestLinkedAccountsUnlink(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		f := NewForum(stores)
+		f.OAuth = NewOAuth(sessions.NewCookieStore([]byte("test-secret")))
+		f.OAuth.Use(github.New("cle", "secret", "https://forum.example/auth/github/callback"))
+		h := middleware.Sessions{Store: stores.Sessions}.Load(HandlerFunc(f.LinkedAccountsHandler))
+		do := func(r *http.Request, userID int) *httptest.ResponseRecorder {
+			r.AddCookie(signIn(t, stores, userID))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w
+		}
+		unlink := func(userID int) *httptest.ResponseRecorder {
+			return do(newFormRequest(http.MethodPost, "/profil/comptes", url.Values{"provider": {"github"}}), userID)
+		}
+		linked := func(userID int) bool {
+			identities, _ := stores.Identities.ListByUser(ctx, userID)
+			return len(identities) == 1
+		}
+
+		// Compte sans mot de passe : son seul fournisseur ne peut pas être retiré.
+		aliceID, err := stores.Identities.CreateUser(ctx, "alice", "alice@example.com", "github", "gh-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := do(httptest.NewRequest(http.MethodGet, "/profil/comptes", nil), aliceID); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "GitHub") {
+			t.Fatalf("liste : statut %d, attendu le fournisseur GitHub", w.Code)
+		}
+		if w := unlink(aliceID); w.Code != http.StatusBadRequest || !linked(aliceID) {
+			t.Fatalf("retrait de la seule méthode de connexion : statut %d, lié %v", w.Code, linked(aliceID))
+		}
+
+		bobID := createLoginUser(t, stores, "bob")
+		if err := stores.Identities.Link(ctx, bobID, "github", "gh-2", "bob@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if w := unlink(bobID); w.Code != http.StatusSeeOther || linked(bobID) {
+			t.Fatalf("retrait avec un mot de passe : statut %d, lié %v", w.Code, linked(bobID))
+		}
+	})
+}
+
+// TestOAuthDoesNotClaimPasswordAccount vérifie qu'un fournisseur ne donne pas
+// accès à un compte protégé par mot de passe sur la seule foi de son email,
+// mais rattache un ancien compte OAuth qui n'a pas d'autre accès lorsque le
+// fournisseur atteste l'adresse.
+func TestOAuthDoesNotClaimPasswordAccount(t *testing.T) {
+	forum, idp, stores := setupOIDCForum(t)
+	ctx := context.Background()
+	aliceID := createLoginUser(t, stores, "alice")
+	idp.claims = map[string]interface{}{"sub": "alice-42", "email": "alice@example.com"}
+
+	res, err := newBrowser(t, forum).Get(forum.URL + "/auth/corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, res)
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("email d'un compte à mot de passe : statut %d, attendu %d", res.StatusCode, http.StatusConflict)
+	}
+	if _, err := stores.Identities.Get(ctx, "corp", "alice-42"); err == nil {
+		t.Fatal("identité rattachée au compte d'alice")
+	}
+	if identities, _ := stores.Identities.ListByUser(ctx, aliceID); len(identities) != 0 {
+		t.Fatalf("comptes liés à alice : %+v", identities)
+	}
+
+	legacyID, err := stores.Users.Create(ctx, "ancien", "ancien@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Adresse non vérifiée : l'ancien compte n'est pas rattaché.
+	idp.claims = map[string]interface{}{"sub": "imposteur", "email": "ancien@example.com", "email_verified": false}
+	res, err = newBrowser(t, forum).Get(forum.URL + "/auth/corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, res)
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("email non vérifié : statut %d, attendu %d", res.StatusCode, http.StatusConflict)
+	}
+	if identities, _ := stores.Identities.ListByUser(ctx, legacyID); len(identities) != 0 {
+		t.Fatalf("ancien compte rattaché sans email vérifié : %+v", identities)
+	}
+
+	idp.claims = map[string]interface{}{"sub": "ancien-1", "email": "ancien@example.com", "email_verified": true}
+	res, err = newBrowser(t, forum).Get(forum.URL + "/auth/corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, res)
+	if identity, err := stores.Identities.Get(ctx, "corp", "ancien-1"); err != nil || identity.UserID != legacyID {
+		t.Fatalf("ancien compte OAuth : identité %+v, %v", identity, err)
+	}
+}
+
+// TestOAuthCallbackRejectsForgedState vérifie qu'un retour du fournisseur
+// n'est accepté qu'avec l'état de la connexion ouverte par ce navigateur.
+func TestOAuthCallbackRejectsForgedState(t *testing.T) {
+	forum, idp, stores := setupOIDCForum(t)
+	idp.claims = map[string]interface{}{"sub": "mallory", "email": "mallory@example.com"}
+	browser := newBrowser(t, forum)
+	browser.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	for _, tt := range []struct {
+		name  string
+		begin bool
+	}{
+		{"sans connexion en cours", false},
+		{"état falsifié", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.begin {
+				res, err := browser.Get(forum.URL + "/auth/corp")
+				if err != nil {
+					t.Fatal(err)
+				}
+				readBody(t, res)
+				if res.StatusCode != http.StatusTemporaryRedirect {
+					t.Fatalf("début de connexion : statut %d", res.StatusCode)
+				}
+			}
+			res, err := browser.Get(forum.URL + "/auth/corp/callback?code=code-ok&state=falsifie")
+			if err != nil {
+				t.Fatal(err)
+			}
+			readBody(t, res)
+			if res.StatusCode != http.StatusSeeOther || res.Header.Get("Location") != "/connexion" {
+				t.Fatalf("retour : statut %d vers %q, attendu /connexion", res.StatusCode, res.Header.Get("Location"))
+			}
+			if _, err := stores.Identities.Get(context.Background(), "corp", "mallory"); err == nil {
+				t.Fatal("identité enregistrée")
+			}
+		})
+	}
+}
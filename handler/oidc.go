@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/markbates/goth/providers/openidConnect"
+)
+
+// OIDCConfig décrit un fournisseur OpenID Connect générique (Keycloak,
+// Authentik, Dex…) déclaré dans la configuration.
+type OIDCConfig struct {
+	Name          string // identifiant dans les URLs /auth/{Name}
+	Label         string // nom affiché sur les boutons
+	Issuer        string // URL de l'émetteur, sans /.well-known/openid-configuration
+	ClientID      string
+	ClientSecret  string
+	Scopes        []string
+	UsernameClaim string            // claim proposé comme nom d'utilisateur
+	RoleClaim     string            // claim (texte ou liste) portant les groupes
+	RoleMapping   map[string]string // valeur du claim -> rôle du forum
+}
+
+// rolePriority ordonne les rôles du forum, du moins au plus privilégié.
+var rolePriority = map[string]int{"user": 0, "moderator": 1, "admin": 2}
+
+// RegisterOIDC découvre l'émetteur et ajoute le fournisseur.
+func (o *OAuth) RegisterOIDC(cfg OIDCConfig, baseURL string) error {
+	if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" {
+		return fmt.Errorf("oidc: nom, émetteur et client_id sont obligatoires")
+	}
+	for value, role := range cfg.RoleMapping {
+		if _, ok := rolePriority[role]; !ok {
+			return fmt.Errorf("oidc: rôle %q inconnu pour %q", role, value)
+		}
+	}
+	discovery := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	callback := baseURL + "/auth/" + cfg.Name + "/callback"
+	p, err := openidConnect.New(cfg.ClientID, cfg.ClientSecret, callback, discovery, cfg.Scopes...)
+	if err != nil {
+		return fmt.Errorf("oidc: découverte de %s: %w", cfg.Issuer, err)
+	}
+	p.SetName(cfg.Name)
+	if cfg.UsernameClaim != "" {
+		p.NickNameClaims = append([]string{cfg.UsernameClaim}, p.NickNameClaims...)
+	}
+	o.Use(p)
+
+	if cfg.Label == "" {
+		cfg.Label = cfg.Name
+	}
+	o.oidc[cfg.Name] = cfg
+	return nil
+}
+
+// ssoLink décrit un bouton de connexion vers un fournisseur OIDC.
+type ssoLink struct {
+	Provider string
+	Label    string
+}
+
+func (o *OAuth) ssoLinks() []ssoLink {
+	if o == nil {
+		return nil
+	}
+	links := make([]ssoLink, 0, len(o.oidc))
+	for name, cfg := range o.oidc {
+		links = append(links, ssoLink{Provider: name, Label: cfg.Label})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Label < links[j].Label })
+	return links
+}
+
+// mappedRole calcule le rôle accordé par les claims du fournisseur. Une
+// chaîne vide signifie que le fournisseur ne gère pas les rôles ; sinon le
+// fournisseur fait foi pour les comptes qu'il a créés et un utilisateur sans
+// groupe reconnu redevient "user". Les comptes liés depuis le profil gardent
+// le rôle attribué sur le forum.
+func (o *OAuth) mappedRole(provider string, claims map[string]interface{}) string {
+	if o == nil {
+		return ""
+	}
+	cfg, ok := o.oidc[provider]
+	if !ok || cfg.RoleClaim == "" || len(cfg.RoleMapping) == 0 {
+		return ""
+	}
+	var values []string
+	switch v := claims[cfg.RoleClaim].(type) {
+	case string:
+		values = strings.Fields(v)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	role := "user"
+	for _, value := range values {
+		if r, ok := cfg.RoleMapping[value]; ok && rolePriority[r] > rolePriority[role] {
+			role = r
+		}
+	}
+	return role
+}
+
+// applyMappedRole aligne le rôle de l'utilisateur sur celui donné par le
+// fournisseur, s'il en donne un.
+func (f *Forum) applyMappedRole(ctx context.Context, userID int, role string) error {
+	if role == "" {
+		return nil
+	}
+	user, err := f.Users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Role == role {
+		return nil
+	}
+	return f.Users.SetRole(ctx, 0, userID, role)
+}
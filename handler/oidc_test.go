@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+	"forum/middleware"
+	"github.com/gorilla/sessions"
+)
+
+// oidcStandIn est un fournisseur OpenID Connect minimal : découverte,
+// autorisation immédiate et jeton d'identité contenant les claims courants.
+type oidcStandIn struct {
+	*httptest.Server
+	clientID string
+	claims   map[string]interface{}
+}
+
+func newOIDCStandIn(t *testing.T, clientID string) *oidcStandIn {
+	t.Helper()
+	idp := &oidcStandIn{clientID: clientID}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != idp.clientID || !strings.Contains(q.Get("scope"), "openid") {
+			http.Error(w, "invalid_request", http.StatusBadRequest)
+			return
+		}
+		back := q.Get("redirect_uri") + "?" + url.Values{"code": {"code-ok"}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, back, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok {
+			id, secret = r.FormValue("client_id"), r.FormValue("client_secret")
+		}
+		if id != idp.clientID || secret != "secret" || r.FormValue("code") != "code-ok" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims := map[string]interface{}{
+			"iss": idp.URL,
+			"aud": idp.clientID,
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"iat": time.Now().Unix(),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     unsignedJWT(t, claims),
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func unsignedJWT(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(payload) + ".sig"
+}
+
+// setupOIDCForum démarre le forum (base temporaire) avec le fournisseur
+// "corp" branché sur le stand-in.
+func setupOIDCForum(t *testing.T) (*httptest.Server, *oidcStandIn, database.Stores) {
+	t.Helper()
+	stores := dbtest.New(t)
+	f := NewForum(stores)
+	f.OAuth = NewOAuth(sessions.NewCookieStore([]byte("test-secret")))
+
+	mux := http.NewServeMux()
+	mux.Handle("/auth/{provider}", HandlerFunc(f.OAuthBeginHandler))
+	mux.Handle("/auth/{provider}/callback", HandlerFunc(f.OAuthCallbackHandler))
+	mux.Handle("/inscription/oauth", HandlerFunc(f.OAuthUsernameHandler))
+	mux.HandleFunc("/profil", func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(r)
+		if !ok {
+			http.Error(w, "non connecté", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "user:%d", userID)
+	})
+	forum := httptest.NewTLSServer(middleware.Sessions{Store: stores.Sessions}.Load(mux))
+	t.Cleanup(forum.Close)
+
+	idp := newOIDCStandIn(t, "forum")
+	err := f.OAuth.RegisterOIDC(OIDCConfig{
+		Name:          "corp",
+		Label:         "Corp SSO",
+		Issuer:        idp.URL,
+		ClientID:      "forum",
+		ClientSecret:  "secret",
+		Scopes:        []string{"email", "profile"},
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		RoleMapping:   map[string]string{"forum-admins": "admin", "forum-modos": "moderator"},
+	}, forum.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return forum, idp, stores
+}
+
+func newBrowser(t *testing.T, forum *httptest.Server) *http.Client {
+	t.Helper()
+	jar, _ := cookiejar.New(nil)
+	c := forum.Client()
+	c.Jar = jar
+	return c
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	forum, idp, stores := setupOIDCForum(t)
+	idp.claims = map[string]interface{}{
+		"sub":                "alice-42",
+		"email":              "alice@corp.example",
+		"preferred_username": "alice",
+		"groups":             []string{"staff", "forum-modos"},
+	}
+
+	// Première connexion : le fournisseur renvoie vers le choix du pseudo.
+	browser := newBrowser(t, forum)
+	res, err := browser.Get(forum.URL + "/auth/corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := readBody(t, res)
+	if res.Request.URL.Path != "/inscription/oauth" {
+		t.Fatalf("arrivée sur %s, attendu /inscription/oauth", res.Request.URL.Path)
+	}
+	if !strings.Contains(body, `value="alice"`) {
+		t.Fatalf("pseudo issu du claim preferred_username absent du formulaire")
+	}
+
+	res, err = browser.PostForm(forum.URL+"/inscription/oauth", url.Values{"username": {"alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = readBody(t, res)
+	user, err := stores.Users.GetByUsername(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("compte non créé: %v", err)
+	}
+	if body != fmt.Sprintf("user:%d", user.ID) {
+		t.Fatalf("session non ouverte après inscription: %q", body)
+	}
+	if user, _ = stores.Users.GetByID(context.Background(), user.ID); user.Role != "moderator" {
+		t.Fatalf("rôle %q, attendu moderator", user.Role)
+	}
+
+	tests := []struct {
+		name   string
+		groups []string
+		role   string
+	}{
+		{"promotion par groupe", []string{"forum-admins", "forum-modos"}, "admin"},
+		{"groupe retiré", []string{"staff"}, "user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.claims["groups"] = tt.groups
+			res, err := newBrowser(t, forum).Get(forum.URL + "/auth/corp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body := readBody(t, res); body != fmt.Sprintf("user:%d", user.ID) {
+				t.Fatalf("reconnexion: %q", body)
+			}
+			got, _ := stores.Users.GetByID(context.Background(), user.ID)
+			if got.Role != tt.role {
+				t.Fatalf("rôle %q, attendu %q", got.Role, tt.role)
+			}
+		})
+	}
+}
+
+func TestOIDCRejectsWrongAudience(t *testing.T) {
+	forum, idp, stores := setupOIDCForum(t)
+	idp.claims = map[string]interface{}{"sub": "mallory", "aud": "autre-client"}
+
+	res, err := newBrowser(t, forum).Get(forum.URL + "/auth/corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, res)
+	if res.Request.URL.Path != "/connexion" {
+		t.Fatalf("arrivée sur %s, attendu /connexion", res.Request.URL.Path)
+	}
+	if _, err := stores.Identities.Get(context.Background(), "corp", "mallory"); err == nil {
+		t.Fatal("identité enregistrée malgré une audience invalide")
+	}
+}
+
+// TestOIDCLinkKeepsRole vérifie qu'un compte du forum lié au fournisseur
+// garde son rôle, à la liaison comme aux connexions suivantes.
+func TestOIDCLinkKeepsRole(t *testing.T) {
+	forum, idp, stores := setupOIDCForum(t)
+	ctx := context.Background()
+	adminID, _ := stores.Users.Create(ctx, "root", "root@example.com", "x")
+	if err := stores.Users.SetRole(ctx, 0, adminID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	idp.claims = map[string]interface{}{"sub": "root-1", "email": "root@corp.example", "groups": []string{"staff"}}
+
+	browser := newBrowser(t, forum)
+	u, _ := url.Parse(forum.URL)
+	browser.Jar.SetCookies(u, []*http.Cookie{signIn(t, stores, adminID)})
+	res, err := browser.Get(forum.URL + "/auth/corp?link=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, res)
+	if res.Request.URL.Path != "/profil/comptes" {
+		t.Fatalf("arrivée sur %s, attendu /profil/comptes", res.Request.URL.Path)
+	}
+	if identity, err := stores.Identities.Get(ctx, "corp", "root-1"); err != nil || identity.UserID != adminID || identity.CreatedUser {
+		t.Fatalf("identité liée : %+v, %v", identity, err)
+	}
+	if user, _ := stores.Users.GetByID(ctx, adminID); user.Role != "admin" {
+		t.Fatalf("rôle %q après la liaison, attendu admin", user.Role)
+	}
+
+	res, err = newBrowser(t, forum).Get(forum.URL + "/auth/corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, res); body != fmt.Sprintf("user:%d", adminID) {
+		t.Fatalf("connexion par le fournisseur : %q", body)
+	}
+	if user, _ := stores.Users.GetByID(ctx, adminID); user.Role != "admin" {
+		t.Fatalf("rôle %q après la connexion, attendu admin", user.Role)
+	}
+}
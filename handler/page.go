@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"forum/database"
+	"forum/middleware"
+)
+
+// Page porte les données communes aux pages bâties sur la mise en page :
+// utilisateur connecté, notifications non lues, jeton CSRF et fuseau du
+// lecteur. Les handlers l'intègrent à leur propre structure pour que la barre
+// de navigation y ait accès.
+type Page struct {
+	User      *database.User
+	SignedIn  bool // session ouverte, même si User n'a pas pu être chargé
+	Unread    int
+	CSRFToken string
+	loc       *time.Location
+}
+
+// requestPage remplit Page sans interroger la base : jeton CSRF et état de
+// la session seulement. Les pages d'erreur s'en contentent.
+func requestPage(r *http.Request) Page {
+	_, signedIn := currentUserID(r)
+	return Page{CSRFToken: middleware.CSRFToken(r), SignedIn: signedIn}
+}
+
+// newPage remplit Page pour la requête en cours.
+func (f *Forum) newPage(r *http.Request) Page {
+	ctx := r.Context()
+	p := requestPage(r)
+	p.loc = f.location()
+	userID, ok := currentUserID(r)
+	if !ok {
+		return p
+	}
+	if user, err := f.Users.GetByID(ctx, userID); err == nil {
+		p.User = &user
+		p.loc = f.loadLocation(user.Timezone)
+		p.Unread, _ = f.Notifications.CountUnread(ctx, userID)
+	}
+	return p
+}
+
+// location renvoie le fuseau dans lequel afficher les dates de la page, ou
+// nil pour celui du forum.
+func (p Page) location() *time.Location {
+	return p.loc
+}
+
+// IsStaff indique si l'utilisateur connecté est modérateur ou administrateur.
+func (p Page) IsStaff() bool {
+	return p.User != nil && (p.User.Role == "moderator" || p.User.Role == "admin")
+}
+
+// IsAdmin indique si l'utilisateur connecté est administrateur.
+func (p Page) IsAdmin() bool {
+	return p.User != nil && p.User.Role == "admin"
+}
@@ -2,7 +2,6 @@ package handler
 
 import (
 	"fmt"
-	"html/template"
 	"io"
 	"net/http"
 	"os"
@@ -12,142 +11,123 @@ import (
 	"forum/database"
 )
 
-func NewPostHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+// UploadDir reçoit les images jointes aux posts ; elles sont servies sous
+// /static/uploads/ et incluses dans les sauvegardes.
+var UploadDir = filepath.Join("static", "uploads")
+
+func (f *Forum) NewPostHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 	switch r.Method {
 	case http.MethodGet:
-		t, err := template.ParseFiles(filepath.Join("templates", "new_post.html"))
-		if err != nil {
-			http.Error(w, "Erreur interne du serveur (template)", http.StatusInternalServerError)
-			return
-		}
-		t.Execute(w, nil)
+		return f.renderTemplate(w, r, "new_post.html", f.newPage(r))
 	case http.MethodPost:
 		if err := r.ParseMultipartForm(10 << 20); err != nil {
-			http.Error(w, "Erreur lors du traitement du formulaire", http.StatusBadRequest)
-			return
+			return Validation("Erreur lors du traitement du formulaire")
 		}
 		title := r.FormValue("title")
 		content := r.FormValue("content")
 		if title == "" || content == "" {
-			http.Error(w, "Tous les champs sont requis", http.StatusBadRequest)
-			return
+			return Validation("Tous les champs sont requis")
 		}
 		var imagePath string
 		if file, fileHeader, err := r.FormFile("image"); err == nil {
 			defer file.Close()
-			uploadDir := filepath.Join("static", "uploads")
-			if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-				os.MkdirAll(uploadDir, os.ModePerm)
+			if _, err := os.Stat(UploadDir); os.IsNotExist(err) {
+				os.MkdirAll(UploadDir, os.ModePerm)
 			}
-			imagePath = filepath.Join("static", "uploads", fileHeader.Filename)
+			imagePath = filepath.Join(UploadDir, fileHeader.Filename)
 			dst, err := os.Create(imagePath)
 			if err != nil {
-				http.Error(w, "Erreur lors de l'enregistrement de l'image", http.StatusInternalServerError)
-				return
+				return Internal(err, "Erreur lors de l'enregistrement de l'image")
 			}
 			defer dst.Close()
 			if _, err := io.Copy(dst, file); err != nil {
-				http.Error(w, "Erreur lors de l'enregistrement de l'image", http.StatusInternalServerError)
-				return
+				return Internal(err, "Erreur lors de l'enregistrement de l'image")
 			}
 		}
-		if err := database.CreatePost(userID, title, content, imagePath); err != nil {
-			http.Error(w, fmt.Sprintf("Erreur lors de la création du post: %v", err), http.StatusInternalServerError)
-			return
+		user, err := f.Users.GetByID(ctx, userID)
+		if err != nil {
+			return StatusError(http.StatusUnauthorized, "Utilisateur non trouvé", nil)
 		}
-
-		// Notifications
-		if user, errUser := database.GetUserWithRole(userID); errUser == nil {
-			if lastPost, errLast := database.GetLastPostForUser(userID); errLast == nil {
-				if user.Role == "admin" || user.Role == "moderator" {
-					msg := fmt.Sprintf("Votre post \"%s\" a bien été publié.", title)
-					_ = database.CreateNotification(userID, msg, lastPost.ID, 0)
-				} else {
-					msg := fmt.Sprintf("Votre post \"%s\" a été soumis à vérification.", title)
-					_ = database.CreateNotification(userID, msg, lastPost.ID, 0)
-					if mods, errMods := database.GetModeratorsAndAdmins(); errMods == nil {
-						for _, mod := range mods {
-							msgMod := fmt.Sprintf("Nouveau post \"%s\" en attente de vérification.", title)
-							_ = database.CreateNotification(mod.ID, msgMod, lastPost.ID, 0)
-						}
-					}
+		// Les posts du staff sont publiés directement, les autres attendent
+		// la modération.
+		staff := user.Role == "admin" || user.Role == "moderator"
+		// Le post et ses notifications sont enregistrés ensemble.
+		err = f.InTx(ctx, func(tx database.Stores) error {
+			postID, err := tx.Posts.Create(ctx, userID, title, content, imagePath, staff)
+			if err != nil {
+				return err
+			}
+			if staff {
+				msg := fmt.Sprintf("Votre post \"%s\" a bien été publié.", title)
+				return tx.Notifications.Create(ctx, userID, msg, postID, 0)
+			}
+			msg := fmt.Sprintf("Votre post \"%s\" a été soumis à vérification.", title)
+			if err := tx.Notifications.Create(ctx, userID, msg, postID, 0); err != nil {
+				return err
+			}
+			mods, err := tx.Users.ListStaff(ctx)
+			if err != nil {
+				return err
+			}
+			for _, mod := range mods {
+				msgMod := fmt.Sprintf("Nouveau post \"%s\" en attente de vérification.", title)
+				if err := tx.Notifications.Create(ctx, mod.ID, msgMod, postID, 0); err != nil {
+					return err
 				}
 			}
+			return nil
+		})
+		if err != nil {
+			return Internal(err, "Erreur lors de la création du post")
 		}
 
 		http.Redirect(w, r, "/posts", http.StatusSeeOther)
 	default:
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
+		return MethodNotAllowed()
 	}
+	return nil
 }
 
-func PostsHandler(w http.ResponseWriter, r *http.Request) {
-	posts, err := database.GetAllPosts()
+func (f *Forum) PostsHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	posts, err := f.Posts.List(ctx)
 	if err != nil {
-		http.Error(w, "Erreur lors de la récupération des posts: "+err.Error(), http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la récupération des posts")
 	}
 	data := struct {
+		Page
 		Posts []database.Post
-	}{Posts: posts}
-	t, err := template.ParseFiles(filepath.Join("templates", "posts.html"))
-	if err != nil {
-		http.Error(w, "Erreur interne du serveur (template): "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err := t.Execute(w, data); err != nil {
-		http.Error(w, "Erreur lors de l'affichage des posts: "+err.Error(), http.StatusInternalServerError)
-	}
+	}{f.newPage(r), posts}
+	return f.renderTemplate(w, r, "posts.html", data)
 }
 
-func PostDetailHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) PostDetailHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	idStr := r.URL.Query().Get("id")
 	if idStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "ID de post invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de post invalide")
 	}
-	post, err := database.GetPostByID(id)
+	post, err := f.Posts.GetByID(ctx, id)
 	if err != nil {
-		http.Error(w, "Post introuvable: "+err.Error(), http.StatusNotFound)
-		return
+		return lookupError(err, "Post introuvable")
 	}
 
-	var editable bool
-	userPhoto := "profil.png"
-	if cookie, err := r.Cookie("user_id"); err == nil {
-		if uid, errConv := strconv.Atoi(cookie.Value); errConv == nil {
-			if uwr, errUwr := database.GetUserWithRole(uid); errUwr == nil {
-				if uid == post.UserID || uwr.Role == "admin" || uwr.Role == "moderator" {
-					editable = true
-				}
-				if uwr.Photo != "" {
-					userPhoto = uwr.Photo
-				}
-			} else if u, errU := database.GetUserByID(uid); errU == nil && u.Photo != "" {
-				userPhoto = u.Photo
-			}
-		}
-	}
+	page := f.newPage(r)
+	editable := page.User != nil && (page.User.ID == post.UserID || page.IsStaff())
 
-	comments, err := database.GetCommentsByPostID(post.ID)
+	comments, err := f.Comments.ListByPost(ctx, post.ID)
 	if err != nil {
-		http.Error(w, "Erreur lors de la récupération des commentaires: "+err.Error(), http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la récupération des commentaires")
 	}
 
 	modified := false
@@ -155,156 +135,137 @@ func PostDetailHandler(w http.ResponseWriter, r *http.Request) {
 		modified = true
 	}
 
-	data := struct {
-		Post      database.Post
-		Editable  bool
-		Comments  []database.Comment
-		UserPhoto string
-		Modified  bool
-	}{
-		Post:      post,
-		Editable:  editable,
-		Comments:  comments,
-		UserPhoto: userPhoto,
-		Modified:  modified,
+	// Auteur : seuls le nom et la photo sont affichés.
+	author := database.User{ID: post.UserID, Username: post.Username}
+	if u, err := f.Users.GetByID(ctx, post.UserID); err == nil {
+		author = u
 	}
 
-	t, err := template.ParseFiles(filepath.Join("templates", "post_detail.html"))
-	if err != nil {
-		http.Error(w, "Erreur interne du serveur (template): "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err := t.Execute(w, data); err != nil {
-		http.Error(w, "Erreur lors de l'affichage du post: "+err.Error(), http.StatusInternalServerError)
+	data := struct {
+		Page
+		Post     database.Post
+		Author   database.User
+		Editable bool
+		Comments []database.Comment
+		Modified bool
+	}{
+		Page:     page,
+		Post:     post,
+		Author:   author,
+		Editable: editable,
+		Comments: comments,
+		Modified: modified,
 	}
+	return f.renderTemplate(w, r, "post_detail.html", data)
 }
 
-func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+func (f *Forum) DeletePostHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		return MethodNotAllowed()
 	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
-	idStr := r.URL.Query().Get("id")
+	idStr := r.FormValue("id")
 	if idStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 	postID, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "ID de post invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de post invalide")
 	}
 
-	user, err := database.GetUserWithRole(userID)
+	user, err := f.Users.GetByID(ctx, userID)
 	if err != nil {
-		http.Error(w, "Utilisateur non trouvé", http.StatusUnauthorized)
-		return
+		return StatusError(http.StatusUnauthorized, "Utilisateur non trouvé", nil)
 	}
 
 	if user.Role == "admin" || user.Role == "moderator" {
-		err = database.AdminDeletePost(postID)
+		err = f.Posts.AdminDelete(ctx, postID)
 	} else {
-		err = database.DeletePost(postID, userID)
+		err = f.Posts.Delete(ctx, postID, userID)
 	}
 
 	if err != nil {
-		http.Error(w, "Erreur lors de la suppression du post: "+err.Error(), http.StatusInternalServerError)
-		return
+		return Internal(err, "Erreur lors de la suppression du post")
 	}
 	http.Redirect(w, r, "/posts", http.StatusSeeOther)
+	return nil
 }
 
-func EditPostHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
+func (f *Forum) EditPostHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 	idStr := r.URL.Query().Get("id")
 	if idStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 	postID, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "ID de post invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de post invalide")
 	}
 	if r.Method == http.MethodGet {
-		post, err := database.GetPostByID(postID)
+		post, err := f.Posts.GetByID(ctx, postID)
 		if err != nil {
-			http.Error(w, "Post introuvable: "+err.Error(), http.StatusNotFound)
-			return
+			return lookupError(err, "Post introuvable")
 		}
 		if post.UserID != userID {
-			http.Error(w, "Non autorisé", http.StatusForbidden)
-			return
-		}
-		t, err := template.ParseFiles(filepath.Join("templates", "edit_post.html"))
-		if err != nil {
-			http.Error(w, "Erreur interne du serveur (template)", http.StatusInternalServerError)
-			return
+			return Forbidden("Non autorisé")
 		}
-		t.Execute(w, post)
+		data := struct {
+			Page
+			Post database.Post
+		}{f.newPage(r), post}
+		return f.renderTemplate(w, r, "edit_post.html", data)
 	} else if r.Method == http.MethodPost {
 		if err := r.ParseMultipartForm(10 << 20); err != nil {
-			http.Error(w, "Erreur lors du traitement du formulaire", http.StatusBadRequest)
-			return
+			return Validation("Erreur lors du traitement du formulaire")
 		}
 		title := r.FormValue("title")
 		if title == "" {
-			existingPost, err := database.GetPostByID(postID)
+			existingPost, err := f.Posts.GetByID(ctx, postID)
 			if err != nil {
-				http.Error(w, "Erreur lors de la récupération du titre existant", http.StatusInternalServerError)
-				return
+				return Internal(err, "Erreur lors de la récupération du titre existant")
 			}
 			title = existingPost.Title
 		}
 		content := r.FormValue("content")
 		if content == "" {
-			http.Error(w, "Tous les champs sont requis", http.StatusBadRequest)
-			return
+			return Validation("Tous les champs sont requis")
 		}
 		var imagePath string
 		if file, fileHeader, err := r.FormFile("image"); err == nil {
 			defer file.Close()
-			uploadDir := filepath.Join("static", "uploads")
-			if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-				os.MkdirAll(uploadDir, os.ModePerm)
+			if _, err := os.Stat(UploadDir); os.IsNotExist(err) {
+				os.MkdirAll(UploadDir, os.ModePerm)
 			}
-			imagePath = filepath.Join("static", "uploads", fileHeader.Filename)
+			imagePath = filepath.Join(UploadDir, fileHeader.Filename)
 			dst, err := os.Create(imagePath)
 			if err != nil {
-				http.Error(w, "Erreur lors de l'enregistrement de l'image", http.StatusInternalServerError)
-				return
+				return Internal(err, "Erreur lors de l'enregistrement de l'image")
 			}
 			defer dst.Close()
 			if _, err := io.Copy(dst, file); err != nil {
-				http.Error(w, "Erreur lors de l'enregistrement de l'image", http.StatusInternalServerError)
-				return
+				return Internal(err, "Erreur lors de l'enregistrement de l'image")
 			}
 		} else {
-			if existingPost, err := database.GetPostByID(postID); err == nil {
+			if existingPost, err := f.Posts.GetByID(ctx, postID); err == nil {
 				imagePath = existingPost.ImagePath
 			}
 		}
-		if err := database.UpdatePost(postID, userID, title, content, imagePath); err != nil {
-			http.Error(w, "Erreur lors de la mise à jour du post: "+err.Error(), http.StatusInternalServerError)
-			return
+		if err := f.Posts.Update(ctx, postID, userID, title, content, imagePath); err != nil {
+			return Internal(err, "Erreur lors de la mise à jour du post")
 		}
 		http.Redirect(w, r, "/post?id="+strconv.Itoa(postID), http.StatusSeeOther)
 	} else {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
+		return MethodNotAllowed()
 	}
+	return nil
 }
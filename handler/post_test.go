@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+	"forum/middleware"
+)
+
+// signIn ouvre une session pour userID et renvoie son cookie.
+func signIn(t *testing.T, stores database.Stores, userID int) *http.Cookie {
+	t.Helper()
+	s := database.Session{ID: middleware.NewCSRFToken(), UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := stores.Sessions.Create(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: middleware.SessionCookie, Value: s.ID}
+}
+
+func newPostRequest(t *testing.T, title, content string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", title)
+	mw.WriteField("content", content)
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/nouveau-post", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestNewPostModeration(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		f := NewForum(stores)
+		h := middleware.Sessions{Store: stores.Sessions}.Load(HandlerFunc(f.NewPostHandler))
+
+		authorID, err := stores.Users.Create(ctx, "auteur", "auteur@example.com", "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		modID, _ := stores.Users.Create(ctx, "modo", "modo@example.com", "x")
+		if err := stores.Users.SetRole(ctx, 0, modID, "moderator"); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name      string
+			userID    int
+			published bool
+			modNotifs int // notifications reçues par le modérateur
+		}{
+			{"utilisateur : en attente", authorID, false, 1},
+			{"modérateur : publié", modID, true, 1},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := newPostRequest(t, tt.name, "contenu")
+				r.AddCookie(signIn(t, stores, tt.userID))
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				if w.Code != http.StatusSeeOther {
+					t.Fatalf("statut %d, attendu %d", w.Code, http.StatusSeeOther)
+				}
+
+				posts, _ := stores.Posts.List(ctx)
+				published := false
+				for _, p := range posts {
+					published = published || p.Title == tt.name
+				}
+				if published != tt.published {
+					t.Fatalf("publié = %v, attendu %v", published, tt.published)
+				}
+				notifs, _ := stores.Notifications.ListByUser(ctx, modID)
+				staffNotifs := 0
+				for _, n := range notifs {
+					if n.Message == `Nouveau post "`+tt.name+`" en attente de vérification.` || n.Message == `Votre post "`+tt.name+`" a bien été publié.` {
+						staffNotifs++
+					}
+				}
+				if staffNotifs != tt.modNotifs {
+					t.Fatalf("%d notifications pour le modérateur, attendu %d", staffNotifs, tt.modNotifs)
+				}
+			})
+		}
+	})
+}
+
+func TestNewPostRequiresSession(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		f := NewForum(stores)
+		w := httptest.NewRecorder()
+		HandlerFunc(f.NewPostHandler).ServeHTTP(w, newPostRequest(t, "titre", "contenu"))
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/connexion" {
+			t.Fatalf("statut %d vers %q, attendu une redirection vers /connexion", w.Code, w.Header().Get("Location"))
+		}
+		if n, _ := stores.Posts.CountPending(context.Background()); n != 0 {
+			t.Fatalf("%d posts créés sans session", n)
+		}
+	})
+}
@@ -3,34 +3,32 @@
 package handler
 
 import (
-	"fmt"
-	"html/template"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
 
 	"forum/database"
 )
 
 type ProfileData struct {
-	database.User
+	Page
+	Profile            database.User // compte affiché, pas forcément celui du lecteur
+	Own                bool          // le lecteur consulte son propre profil
 	PostsLiked         int
 	CommentsCount      int
-	LastPostDate       string
-	LastActivityDate   string
-	LastConnectionDate string
+	LastPostDate       time.Time // date zéro : aucun post
+	LastActivityDate   time.Time
+	LastConnectionDate time.Time
 }
 
-func ProfilHandler(w http.ResponseWriter, r *http.Request) {
+func (f *Forum) ProfilHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
 	// Connexion obligatoire
-	cookie, err := r.Cookie("user_id")
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	connectedID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
+	connectedID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 
 	// Choix du profil à afficher
@@ -39,119 +37,55 @@ func ProfilHandler(w http.ResponseWriter, r *http.Request) {
 		if pid, err := strconv.Atoi(idParam); err == nil {
 			profileID = pid
 		} else {
-			http.Error(w, "ID utilisateur invalide", http.StatusBadRequest)
-			return
+			return Validation("ID utilisateur invalide")
 		}
 	}
 
 	// Récupération des données de base
-	user, err := getUserByID(profileID)
+	user, err := f.Users.GetByID(ctx, profileID)
 	if err != nil {
-		fmt.Println("Erreur dans getUserByID:", err)
-		http.Error(w, "Erreur lors de la récupération du profil", http.StatusInternalServerError)
-		return
-	}
-
-	// Récupérer le rôle pour afficher les boutons admin
-	if uwr, err := database.GetUserWithRole(profileID); err == nil {
-		user.Role = uwr.Role
-	}
-
-	// Statistiques
-	postsLiked, commentsCount, err := database.GetUserStats(profileID)
-	if err != nil {
-		postsLiked = 0
-		commentsCount = 0
-	}
-
-	// Dernier post
-	lastPostTime, err := database.GetLastPostDate(profileID)
-	lastPostStr := "Aucun post"
-	if err == nil && !lastPostTime.IsZero() {
-		lastPostStr = lastPostTime.Format("02/01/2006 15:04:05")
-	}
-
-	// Dernière activité
-	lastActivityTime, err := database.GetLastActivityDate(profileID)
-	lastActivityStr := "Aucune activité"
-	if err == nil && !lastActivityTime.IsZero() {
-		lastActivityStr = lastActivityTime.Format("02/01/2006 15:04:05")
-	}
-
-	// Dernière connexion
-	lastConnectionTime, err := database.GetLastConnection(profileID)
-	lastConnectionStr := "Inconnue"
-	if err == nil && !lastConnectionTime.IsZero() {
-		lastConnectionStr = lastConnectionTime.Format("02/01/2006 15:04:05")
+		return lookupError(err, "Profil introuvable")
 	}
 
-	data := ProfileData{
-		User:               user,
-		PostsLiked:         postsLiked,
-		CommentsCount:      commentsCount,
-		LastPostDate:       lastPostStr,
-		LastActivityDate:   lastActivityStr,
-		LastConnectionDate: lastConnectionStr,
+	// Statistiques et dates d'activité, affichées dans le fuseau du lecteur
+	data := ProfileData{Page: f.newPage(r), Profile: user, Own: profileID == connectedID}
+	if a, err := f.Users.Activity(ctx, profileID); err == nil {
+		data.PostsLiked, data.CommentsCount = a.PostsLiked, a.Comments
+		data.LastPostDate, data.LastActivityDate, data.LastConnectionDate = a.LastPost, a.LastActivity, a.LastConnection
 	}
 
-	t, err := template.ParseFiles("templates/profil.html")
-	if err != nil {
-		fmt.Println("Erreur lors du parsing du template:", err)
-		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
-		return
-	}
-	if err := t.Execute(w, data); err != nil {
-		fmt.Println("Erreur lors de l'exécution du template:", err)
-		http.Error(w, "Erreur lors de l'affichage du profil", http.StatusInternalServerError)
-		return
-	}
-}
-
-func getUserByID(id int) (database.User, error) {
-	var user database.User
-	query := "SELECT id, username, email, created_at, photo FROM users WHERE id = ?"
-	row := database.DB.QueryRow(query, id)
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.Photo)
-	if err != nil {
-		fmt.Println("Erreur dans row.Scan de getUserByID:", err)
-		return user, err
-	}
-	if user.Photo == "" {
-		user.Photo = "default.png"
-	}
-	return user, nil
+	return f.renderTemplate(w, r, "profil.html", data)
 }
 
-func ModifyProfileHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
+func (f *Forum) ModifyProfileHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	userID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	userID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 
 	if r.Method == http.MethodGet {
-		user, err := getUserByID(userID)
+		user, err := f.Users.GetByID(ctx, userID)
 		if err != nil {
-			http.Error(w, "Erreur lors de la récupération du profil", http.StatusInternalServerError)
-			return
+			return lookupError(err, "Profil introuvable")
 		}
-		t, err := template.ParseFiles("templates/modify_profil.html")
-		if err != nil {
-			http.Error(w, "Erreur lors du chargement du template", http.StatusInternalServerError)
-			return
+		timezones := Timezones
+		if user.Timezone != "" && !slices.Contains(timezones, user.Timezone) {
+			timezones = append([]string{user.Timezone}, timezones...)
 		}
-		t.Execute(w, user)
+		data := struct {
+			Page
+			Profile         database.User
+			Timezones       []string
+			DefaultTimezone string
+		}{f.newPage(r), user, timezones, f.location().String()}
+		return f.renderTemplate(w, r, "modify_profil.html", data)
 
 	} else if r.Method == http.MethodPost {
 		err := r.ParseForm()
 		if err != nil {
-			http.Error(w, "Erreur lors de la soumission du formulaire", http.StatusBadRequest)
-			return
+			return Validation("Erreur lors de la soumission du formulaire")
 		}
 		newUsername := r.FormValue("username")
 		newPhoto := r.FormValue("photo")
@@ -161,18 +95,22 @@ func ModifyProfileHandler(w http.ResponseWriter, r *http.Request) {
 			newPhoto = "default.png"
 		}
 		if newUsername == "" {
-			http.Error(w, "Le nom d'utilisateur est requis", http.StatusBadRequest)
-			return
+			return Validation("Le nom d'utilisateur est requis")
 		}
-		updateQuery := "UPDATE users SET username = ?, photo = ? WHERE id = ?"
-		_, err = database.DB.Exec(updateQuery, newUsername, newPhoto, userID)
-		if err != nil {
-			http.Error(w, "Erreur lors de la mise à jour du profil", http.StatusInternalServerError)
-			return
+		timezone := r.FormValue("timezone")
+		if !validTimezone(timezone) {
+			return Validation("Fuseau horaire inconnu")
+		}
+		if err := f.Users.UpdateProfile(ctx, userID, newUsername, newPhoto); err != nil {
+			return Internal(err, "Erreur lors de la mise à jour du profil")
+		}
+		if err := f.Users.SetTimezone(ctx, userID, timezone); err != nil {
+			return Internal(err, "Erreur lors de la mise à jour du profil")
 		}
 		http.Redirect(w, r, "/profil", http.StatusSeeOther)
 
 	} else {
-		http.Error(w, "Méthode non supportée", http.StatusMethodNotAllowed)
+		return MethodNotAllowed()
 	}
+	return nil
 }
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth"
+)
+
+// oauthStateCookie conserve la connexion OAuth en cours le temps de
+// l'aller-retour chez le fournisseur.
+const oauthStateCookie = "oauth_state"
+
+// OAuth regroupe les fournisseurs OAuth et OpenID Connect d'un forum et le
+// cookie qui conserve l'état de la connexion en cours. Un Forum sans OAuth
+// ne propose aucun fournisseur.
+type OAuth struct {
+	store     sessions.Store
+	providers map[string]goth.Provider
+	oidc      map[string]OIDCConfig // configuration des fournisseurs OIDC, par nom
+}
+
+// NewOAuth crée un ensemble de fournisseurs vide ; store chiffre et signe le
+// cookie d'état.
+func NewOAuth(store sessions.Store) *OAuth {
+	return &OAuth{store: store, providers: map[string]goth.Provider{}, oidc: map[string]OIDCConfig{}}
+}
+
+// Use ajoute des fournisseurs, indexés par leur nom.
+func (o *OAuth) Use(providers ...goth.Provider) {
+	for _, p := range providers {
+		o.providers[p.Name()] = p
+	}
+}
+
+// provider renvoie le fournisseur nommé, s'il est configuré.
+func (o *OAuth) provider(name string) (goth.Provider, bool) {
+	if o == nil {
+		return nil, false
+	}
+	p, ok := o.providers[name]
+	return p, ok
+}
+
+// names renvoie les noms des fournisseurs configurés.
+func (o *OAuth) names() []string {
+	if o == nil {
+		return nil
+	}
+	names := make([]string, 0, len(o.providers))
+	for name := range o.providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// label renvoie le nom affiché d'un fournisseur.
+func (o *OAuth) label(name string) string {
+	if o != nil {
+		if cfg, ok := o.oidc[name]; ok {
+			return cfg.Label
+		}
+	}
+	return providerLabel(name)
+}
+
+// beginAuth ouvre une connexion chez p, dont l'état aléatoire est gardé
+// dans le cookie, et renvoie l'URL d'autorisation du fournisseur.
+func (o *OAuth) beginAuth(w http.ResponseWriter, r *http.Request, p goth.Provider) (string, error) {
+	state := make([]byte, 32)
+	if _, err := rand.Read(state); err != nil {
+		return "", err
+	}
+	sess, err := p.BeginAuth(base64.RawURLEncoding.EncodeToString(state))
+	if err != nil {
+		return "", err
+	}
+	authURL, err := sess.GetAuthURL()
+	if err != nil {
+		return "", err
+	}
+	cookie, _ := o.store.New(r, oauthStateCookie)
+	cookie.Values = map[interface{}]interface{}{p.Name(): sess.Marshal()}
+	if err := cookie.Save(r, w); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// completeAuth termine la connexion chez p au retour du fournisseur et
+// renvoie le compte obtenu. Le cookie d'état est effacé : il ne sert qu'une
+// fois.
+func (o *OAuth) completeAuth(w http.ResponseWriter, r *http.Request, p goth.Provider) (goth.User, error) {
+	cookie, err := o.store.Get(r, oauthStateCookie)
+	if err != nil {
+		return goth.User{}, err
+	}
+	value, ok := cookie.Values[p.Name()].(string)
+	cookie.Values = map[interface{}]interface{}{}
+	cookie.Options.MaxAge = -1
+	_ = cookie.Save(r, w)
+	if !ok {
+		return goth.User{}, errors.New("oauth: aucune connexion en cours")
+	}
+	sess, err := p.UnmarshalSession(value)
+	if err != nil {
+		return goth.User{}, err
+	}
+	authURL, err := sess.GetAuthURL()
+	if err != nil {
+		return goth.User{}, err
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return goth.User{}, err
+	}
+	// Les fournisseurs OAuth 1 (Twitter) n'ont pas d'état.
+	if state := u.Query().Get("state"); state != "" && state != r.URL.Query().Get("state") {
+		return goth.User{}, errors.New("oauth: état invalide")
+	}
+	if _, err := sess.Authorize(p, r.URL.Query()); err != nil {
+		return goth.User{}, err
+	}
+	return p.FetchUser(sess)
+}
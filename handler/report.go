@@ -10,49 +10,50 @@ import (
 
 // ReportPostHandler permet à un utilisateur de signaler un post.
 // Ce signalement envoie une notification aux administrateurs et modérateurs.
-func ReportPostHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_id")
-	if err != nil || cookie.Value == "" {
+func (f *Forum) ReportPostHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	reporterID, ok := currentUserID(r)
+	if !ok {
 		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
-	}
-	reporterID, err := strconv.Atoi(cookie.Value)
-	if err != nil {
-		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
-		return
+		return nil
 	}
 	postIDStr := r.FormValue("post_id")
 	if postIDStr == "" {
-		http.Error(w, "ID de post manquant", http.StatusBadRequest)
-		return
+		return Validation("ID de post manquant")
 	}
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
-		http.Error(w, "ID de post invalide", http.StatusBadRequest)
-		return
+		return Validation("ID de post invalide")
 	}
 	// Récupérer le post pour obtenir le titre
-	post, err := database.GetPostByID(postID)
+	post, err := f.Posts.GetByID(ctx, postID)
 	if err != nil {
-		http.Error(w, "Post introuvable", http.StatusNotFound)
-		return
+		return NotFound("Post introuvable")
 	}
 	// Récupérer l'utilisateur qui signale
-	reporter, err := database.GetUserWithRole(reporterID)
+	reporter, err := f.Users.GetByID(ctx, reporterID)
 	if err != nil {
-		http.Error(w, "Utilisateur introuvable", http.StatusUnauthorized)
-		return
+		return StatusError(http.StatusUnauthorized, "Utilisateur introuvable", nil)
 	}
 	// Composer le message de signalement
 	message := fmt.Sprintf("Le post \"%s\" (ID:%d) a été signalé par %s (ID:%d)", post.Title, post.ID, reporter.Username, reporter.ID)
-	// Envoyer une notification à tous les admins et modérateurs
-	mods, err := database.GetModeratorsAndAdmins()
-	if err == nil {
+	// Notifier tous les admins et modérateurs, puis le reporter : le
+	// signalement est envoyé à tous ou à personne.
+	err = f.InTx(ctx, func(tx database.Stores) error {
+		mods, err := tx.Users.ListStaff(ctx)
+		if err != nil {
+			return err
+		}
 		for _, mod := range mods {
-			_ = database.CreateNotification(mod.ID, message, post.ID, 0)
+			if err := tx.Notifications.Create(ctx, mod.ID, message, post.ID, 0); err != nil {
+				return err
+			}
 		}
+		return tx.Notifications.Create(ctx, reporter.ID, "Votre signalement a été envoyé aux modérateurs.", post.ID, 0)
+	})
+	if err != nil {
+		return Internal(err, "Erreur lors de l'envoi du signalement")
 	}
-	// Notifier le reporter que son signalement a été envoyé
-	_ = database.CreateNotification(reporter.ID, "Votre signalement a été envoyé aux modérateurs.", post.ID, 0)
 	http.Redirect(w, r, "/post?id="+strconv.Itoa(post.ID), http.StatusSeeOther)
+	return nil
 }
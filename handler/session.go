@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/database"
+	"forum/middleware"
+	"github.com/google/uuid"
+)
+
+// currentUserID renvoie l'utilisateur de la session serveur chargée par
+// middleware.Sessions.
+func currentUserID(r *http.Request) (int, bool) {
+	s, ok := middleware.CurrentSession(r)
+	if !ok {
+		return 0, false
+	}
+	return s.UserID, true
+}
+
+// startSession crée la session serveur et pose le cookie de connexion.
+func (f *Forum) startSession(w http.ResponseWriter, r *http.Request, userID int, remember bool) error {
+	ctx := r.Context()
+	now := f.now()
+	s := database.Session{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		UserAgent:  r.UserAgent(),
+		IP:         middleware.ClientIP(r),
+		Remember:   remember,
+		CSRFToken:  middleware.NewCSRFToken(),
+		LastSeenAt: now,
+		ExpiresAt:  f.SessionPolicy.Expiry(now, remember),
+	}
+	if err := f.Sessions.Create(ctx, s); err != nil {
+		return err
+	}
+	middleware.SetSessionCookie(w, s)
+	clearLegacyUserCookie(w)
+	return nil
+}
+
+// clearLegacyUserCookie supprime l'ancien cookie user_id, qui n'authentifie plus rien.
+func clearLegacyUserCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "user_id",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+}
+
+// SessionView décrit une session dans la page /profil/sessions.
+type SessionView struct {
+	RowID      int64
+	Device     string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	Remember   bool
+	Current    bool
+}
+
+// SessionsHandler liste les appareils connectés et permet de les déconnecter
+// un par un ou tous à la fois.
+func (f *Forum) SessionsHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	current, ok := middleware.CurrentSession(r)
+	if !ok {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := f.Sessions.ListByUser(ctx, current.UserID, f.now())
+		if err != nil {
+			return Internal(err, "Erreur lors de la récupération des sessions")
+		}
+		views := make([]SessionView, 0, len(sessions))
+		for _, s := range sessions {
+			views = append(views, SessionView{
+				RowID:      s.RowID,
+				Device:     describeUserAgent(s.UserAgent),
+				IP:         s.IP,
+				CreatedAt:  s.CreatedAt,
+				LastSeenAt: s.LastSeenAt,
+				ExpiresAt:  s.ExpiresAt,
+				Remember:   s.Remember,
+				Current:    s.ID == current.ID,
+			})
+		}
+		return f.renderTemplate(w, r, "sessions.html", struct {
+			Page
+			Sessions []SessionView
+		}{f.newPage(r), views})
+
+	case http.MethodPost:
+		switch r.FormValue("action") {
+		case "revoke":
+			rowID, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+			if err != nil {
+				return Validation("ID de session invalide")
+			}
+			if err := f.Sessions.DeleteForUser(ctx, current.UserID, rowID); err != nil {
+				return Internal(err, "Erreur lors de la déconnexion de l'appareil")
+			}
+			if rowID == current.RowID {
+				middleware.ClearSessionCookie(w)
+				http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+				return nil
+			}
+		case "revoke-all":
+			if err := f.Sessions.DeleteAllForUser(ctx, current.UserID); err != nil {
+				return Internal(err, "Erreur lors de la déconnexion des appareils")
+			}
+			middleware.ClearSessionCookie(w)
+			http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+			return nil
+		default:
+			return Validation("Action inconnue")
+		}
+		http.Redirect(w, r, "/profil/sessions", http.StatusSeeOther)
+
+	default:
+		return MethodNotAllowed()
+	}
+	return nil
+}
+
+// describeUserAgent résume un User-Agent en « navigateur sur système ».
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "Appareil inconnu"
+	}
+	browser := "Navigateur inconnu"
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "curl/"):
+		browser = "curl"
+	}
+	system := ""
+	switch {
+	case strings.Contains(ua, "Android"):
+		system = "Android"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		system = "iOS"
+	case strings.Contains(ua, "Windows"):
+		system = "Windows"
+	case strings.Contains(ua, "Mac OS X"):
+		system = "macOS"
+	case strings.Contains(ua, "Linux"):
+		system = "Linux"
+	}
+	if system == "" {
+		return browser
+	}
+	return browser + " sur " + system
+}
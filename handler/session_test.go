@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+	"forum/middleware"
+)
+
+const firefoxUA = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+
+// sessionCookie renvoie le cookie de session posé par la réponse, s'il y en a un.
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == middleware.SessionCookie {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestLoginRecordsDevice(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+		f := NewForum(stores)
+		f.Now = clk.now
+		f.SessionPolicy = database.SessionPolicy{Lifetime: time.Hour, RememberLifetime: 48 * time.Hour}
+		userID := createLoginUser(t, stores, "alice")
+
+		tests := []struct {
+			name     string
+			remember string
+			lifetime time.Duration
+		}{
+			{"session du navigateur", "", time.Hour},
+			{"se souvenir de moi", "on", 48 * time.Hour},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := newFormRequest(http.MethodPost, "/connexion", url.Values{"identifier": {"alice"}, "password": {"secret"}, "remember": {tt.remember}})
+				r.Header.Set("User-Agent", firefoxUA)
+				w := httptest.NewRecorder()
+				HandlerFunc(f.ConnexionHandler).ServeHTTP(w, r)
+				c := sessionCookie(w)
+				if w.Code != http.StatusSeeOther || c == nil {
+					t.Fatalf("connexion : statut %d, cookie %v", w.Code, c)
+				}
+				// Sans « Se souvenir de moi », le cookie disparaît avec le navigateur.
+				if remember := !c.Expires.IsZero(); remember != (tt.remember == "on") {
+					t.Errorf("cookie persistant : %v, attendu %v", remember, tt.remember == "on")
+				}
+				s, err := stores.Sessions.Get(ctx, c.Value, clk.t)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.UserID != userID || s.UserAgent != firefoxUA || s.IP != clientIP() {
+					t.Errorf("session %+v, attendu l'appareil de la requête", s)
+				}
+				if !s.LastSeenAt.Equal(clk.t) || !s.ExpiresAt.Equal(clk.t.Add(tt.lifetime)) {
+					t.Errorf("vue à %v, expire à %v ; attendu %v et %v", s.LastSeenAt, s.ExpiresAt, clk.t, clk.t.Add(tt.lifetime))
+				}
+			})
+		}
+	})
+}
+
+func TestSessionSlidingExpiry(t *testing.T) {
+	stores := dbtest.New(t)
+	ctx := context.Background()
+	clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	policy := database.SessionPolicy{Lifetime: time.Hour}
+	f := NewForum(stores)
+	f.Now = clk.now
+	f.SessionPolicy = policy
+	h := middleware.Sessions{Store: stores.Sessions, Policy: policy, Now: clk.now}.Load(HandlerFunc(f.SessionsHandler))
+	userID := createLoginUser(t, stores, "alice")
+	s := database.Session{ID: "glissante", UserID: userID, LastSeenAt: clk.t, ExpiresAt: policy.Expiry(clk.t, false)}
+	if err := stores.Sessions.Create(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	get := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/profil/sessions", nil)
+		r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: s.ID})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	expiry := func() time.Time {
+		t.Helper()
+		got, err := stores.Sessions.Get(ctx, s.ID, clk.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.ExpiresAt
+	}
+
+	// Une activité rapprochée ne réécrit pas la session.
+	clk.t = clk.t.Add(30 * time.Second)
+	if w := get(); w.Code != http.StatusOK {
+		t.Fatalf("session active : statut %d", w.Code)
+	}
+	if got := expiry(); !got.Equal(s.ExpiresAt) {
+		t.Errorf("expiration déplacée après 30 s : %v", got)
+	}
+	// Au-delà d'une minute, l'expiration glisse.
+	clk.t = clk.t.Add(time.Minute)
+	get()
+	if got := expiry(); !got.Equal(clk.t.Add(time.Hour)) {
+		t.Errorf("expiration %v, attendu %v", got, clk.t.Add(time.Hour))
+	}
+	// Sans activité pendant toute la durée de vie, la session est refusée et supprimée.
+	clk.t = clk.t.Add(time.Hour + time.Second)
+	if w := get(); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/connexion" {
+		t.Fatalf("session expirée : statut %d vers %q, attendu /connexion", w.Code, w.Header().Get("Location"))
+	}
+	if n, _ := stores.Sessions.DeleteAll(ctx); n != 0 {
+		t.Errorf("%d session(s) expirée(s) encore en base", n)
+	}
+}
+
+func TestSessionsPageRevoke(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		f := NewForum(stores)
+		h := middleware.Sessions{Store: stores.Sessions}.Load(HandlerFunc(f.SessionsHandler))
+		aliceID := createLoginUser(t, stores, "alice")
+		bobID := createLoginUser(t, stores, "bob")
+		current, other, bobs := signIn(t, stores, aliceID), signIn(t, stores, aliceID), signIn(t, stores, bobID)
+		rowID := func(userID int, c *http.Cookie) string {
+			t.Helper()
+			sessions, _ := stores.Sessions.ListByUser(ctx, userID, time.Now())
+			for _, s := range sessions {
+				if s.ID == c.Value {
+					return strconv.FormatInt(s.RowID, 10)
+				}
+			}
+			t.Fatalf("session %s introuvable", c.Value)
+			return ""
+		}
+		alive := func(c *http.Cookie) bool {
+			_, err := stores.Sessions.Get(ctx, c.Value, time.Now())
+			return err == nil
+		}
+		do := func(r *http.Request) *httptest.ResponseRecorder {
+			r.AddCookie(current)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w
+		}
+		post := func(form url.Values) *httptest.ResponseRecorder {
+			return do(newFormRequest(http.MethodPost, "/profil/sessions", form))
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/profil/sessions", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/connexion" {
+			t.Fatalf("visiteur anonyme : statut %d vers %q", w.Code, w.Header().Get("Location"))
+		}
+		if w := do(httptest.NewRequest(http.MethodGet, "/profil/sessions", nil)); w.Code != http.StatusOK || strings.Count(w.Body.String(), `name="action" value="revoke"`) != 2 {
+			t.Fatalf("liste : statut %d, attendu les 2 sessions d'alice", w.Code)
+		}
+
+		// Une session d'un autre utilisateur ne peut pas être révoquée.
+		post(url.Values{"action": {"revoke"}, "id": {rowID(bobID, bobs)}})
+		if !alive(bobs) {
+			t.Fatal("session de bob révoquée par alice")
+		}
+		if w := post(url.Values{"action": {"revoke"}, "id": {"abc"}}); w.Code != http.StatusBadRequest {
+			t.Fatalf("identifiant invalide : statut %d, attendu %d", w.Code, http.StatusBadRequest)
+		}
+		if w := post(url.Values{"action": {"inconnue"}}); w.Code != http.StatusBadRequest {
+			t.Fatalf("action inconnue : statut %d, attendu %d", w.Code, http.StatusBadRequest)
+		}
+
+		if w := post(url.Values{"action": {"revoke"}, "id": {rowID(aliceID, other)}}); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/profil/sessions" {
+			t.Fatalf("révocation : statut %d vers %q", w.Code, w.Header().Get("Location"))
+		}
+		if alive(other) || !alive(current) {
+			t.Fatal("seule l'autre session d'alice doit être révoquée")
+		}
+
+		otherAgain := signIn(t, stores, aliceID)
+		w = post(url.Values{"action": {"revoke-all"}})
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/connexion" {
+			t.Fatalf("déconnexion partout : statut %d vers %q", w.Code, w.Header().Get("Location"))
+		}
+		if c := sessionCookie(w); c == nil || c.MaxAge >= 0 {
+			t.Errorf("cookie de session non effacé : %v", c)
+		}
+		if alive(current) || alive(otherAgain) || !alive(bobs) {
+			t.Fatal("déconnexion partout : seules les sessions d'alice doivent disparaître")
+		}
+	})
+}
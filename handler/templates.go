@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"forum/middleware"
+)
+
+// Templates garde les pages analysées une fois pour toutes. Chaque page de
+// templates/ est associée à la mise en page (templates/layouts) et aux
+// partiels (templates/partials) ; une page qui commence par
+// {{template "base" .}} n'a plus qu'à définir ses blocs.
+type Templates struct {
+	dir    string
+	reload bool
+
+	mu       sync.RWMutex
+	pages    map[string]*template.Template
+	loadedAt time.Time
+}
+
+// defaultTemplates sert les Forum sans Templates et les erreurs rendues hors
+// d'un Forum ; il est chargé au premier affichage.
+var defaultTemplates = NewTemplates("templates", false)
+
+// NewTemplates prépare le chargement de dir. Avec reload, les fichiers
+// modifiés depuis le dernier chargement sont relus avant chaque affichage.
+func NewTemplates(dir string, reload bool) *Templates {
+	return &Templates{dir: dir, reload: reload}
+}
+
+// Load analyse toutes les pages et remplace l'ensemble courant. Appelé au
+// démarrage, il fait d'une erreur de syntaxe un échec du lancement plutôt
+// qu'une erreur à la première visite.
+func (t *Templates) Load() error {
+	var shared []string
+	for _, sub := range []string{"layouts", "partials"} {
+		files, err := filepath.Glob(filepath.Join(t.dir, sub, "*.html"))
+		if err != nil {
+			return err
+		}
+		shared = append(shared, files...)
+	}
+	files, err := filepath.Glob(filepath.Join(t.dir, "*.html"))
+	if err != nil {
+		return err
+	}
+
+	pages := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		name := filepath.Base(file)
+		tmpl := template.New(name).Funcs(templateFuncs(nil, time.UTC, time.Time{}))
+		if len(shared) > 0 {
+			if _, err := tmpl.ParseFiles(shared...); err != nil {
+				return err
+			}
+		}
+		if _, err := tmpl.ParseFiles(file); err != nil {
+			return err
+		}
+		pages[name] = tmpl
+	}
+	loadedAt, err := t.lastModified()
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.pages = pages
+	t.loadedAt = loadedAt
+	t.mu.Unlock()
+	return nil
+}
+
+// lastModified renvoie la date de modification la plus récente du dossier.
+func (t *Templates) lastModified() (time.Time, error) {
+	var latest time.Time
+	err := filepath.WalkDir(t.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest, err
+}
+
+// Lookup renvoie une copie de la page, prête à être exécutée avec les
+// fonctions propres à la requête (jeton CSRF, nonce CSP), au fuseau loc du
+// lecteur et à l'heure now du forum. La page en cache
+// n'est jamais exécutée elle-même, ce qui permet de la cloner indéfiniment.
+func (t *Templates) Lookup(r *http.Request, name string, loc *time.Location, now time.Time) (*template.Template, error) {
+	if err := t.refresh(); err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	page := t.pages[name]
+	t.mu.RUnlock()
+	if page == nil {
+		return nil, fmt.Errorf("template %q introuvable", name)
+	}
+	clone, err := page.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.Funcs(templateFuncs(r, loc, now)), nil
+}
+
+// refresh charge l'ensemble s'il ne l'est pas encore, ou le recharge en mode
+// développement quand un fichier a changé.
+func (t *Templates) refresh() error {
+	t.mu.RLock()
+	loaded, loadedAt := t.pages != nil, t.loadedAt
+	t.mu.RUnlock()
+	if loaded && !t.reload {
+		return nil
+	}
+	if loaded {
+		latest, err := t.lastModified()
+		if err != nil || !latest.After(loadedAt) {
+			return err
+		}
+	}
+	return t.Load()
+}
+
+// templateFuncs renvoie les fonctions communes à tous les templates :
+//   - csrfField insère le champ caché du jeton CSRF, csrfToken le renvoie brut ;
+//   - cspNonce donne le nonce des <script> en ligne ;
+//   - asset donne l'URL versionnée d'un fichier de ./static ;
+//   - avatar donne l'URL d'une photo de profil ;
+//   - date, datetime et clock formatent une date dans le fuseau loc,
+//     isodate en UTC (attribut datetime) ;
+//   - when l'affiche en temps relatif à now (« il y a 5 min ») ;
+//   - excerpt tronque un texte sans couper de caractère.
+//
+// Sans requête (analyse au démarrage), les fonctions liées à la requête sont
+// des substituts remplacés à chaque affichage par Lookup.
+func templateFuncs(r *http.Request, loc *time.Location, now time.Time) template.FuncMap {
+	token, nonce := "", ""
+	if r != nil {
+		token, nonce = middleware.CSRFToken(r), middleware.CSPNonce(r)
+	}
+	return template.FuncMap{
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + middleware.CSRFField + `" value="` + template.HTMLEscapeString(token) + `">`)
+		},
+		"csrfToken": func() string { return token },
+		"cspNonce":  func() string { return nonce },
+		"asset":     middleware.StaticAssets.URL,
+		"avatar":    avatarURL,
+		"date":      func(t time.Time) string { return t.In(loc).Format("02/01/2006") },
+		"datetime":  func(t time.Time) string { return t.In(loc).Format("02/01/2006 15:04") },
+		"clock":     func(t time.Time) string { return t.In(loc).Format("15:04") },
+		"isodate":   func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+		"when":      func(t time.Time) template.HTML { return timeTag(t, loc, now) },
+		"excerpt":   excerpt,
+	}
+}
+
+// defaultAvatar est affiché pour les comptes sans photo.
+const defaultAvatar = "/static/images/profil/default.png"
+
+// avatarURL renvoie l'URL d'une photo de profil : nom de fichier de
+// static/images/profil, ou URL complète fournie par un fournisseur OAuth.
+func avatarURL(photo string) string {
+	switch {
+	case photo == "":
+		return defaultAvatar
+	case strings.HasPrefix(photo, "http://"), strings.HasPrefix(photo, "https://"):
+		return photo
+	}
+	if _, err := os.Stat(filepath.Join("static", "images", "profil", filepath.Base(photo))); err != nil {
+		return defaultAvatar
+	}
+	return "/static/images/profil/" + filepath.Base(photo)
+}
+
+// excerpt renvoie les n premiers caractères de s, suivis de « … » s'il a été
+// tronqué.
+func excerpt(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
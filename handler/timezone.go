@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"math"
+	"time"
+)
+
+// Timezones sont les fuseaux proposés dans le profil ; tout nom IANA valide
+// reste accepté.
+var Timezones = []string{
+	"Europe/Paris",
+	"Europe/Brussels",
+	"Europe/Zurich",
+	"Europe/London",
+	"Africa/Casablanca",
+	"Africa/Algiers",
+	"Africa/Tunis",
+	"Africa/Dakar",
+	"Africa/Abidjan",
+	"America/Montreal",
+	"America/New_York",
+	"America/Los_Angeles",
+	"America/Martinique",
+	"America/Guadeloupe",
+	"America/Cayenne",
+	"Indian/Reunion",
+	"Indian/Mayotte",
+	"Pacific/Noumea",
+	"Pacific/Tahiti",
+	"UTC",
+}
+
+// loadLocation renvoie le fuseau nommé, ou celui du forum si le nom est
+// vide ou inconnu.
+func (f *Forum) loadLocation(name string) *time.Location {
+	if name == "" {
+		return f.location()
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return f.location()
+	}
+	return loc
+}
+
+// userLocation renvoie le fuseau d'un utilisateur.
+func (f *Forum) userLocation(ctx context.Context, userID int) *time.Location {
+	tz, err := f.Users.Timezone(ctx, userID)
+	if err != nil {
+		return f.location()
+	}
+	return f.loadLocation(tz)
+}
+
+// validTimezone indique si name peut être enregistré comme préférence
+// (vide : fuseau du forum).
+func validTimezone(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// timeTag affiche t en temps relatif dans un élément <time>, avec la date
+// complète dans le fuseau du lecteur en infobulle.
+func timeTag(t time.Time, loc *time.Location, now time.Time) template.HTML {
+	if t.IsZero() {
+		return ""
+	}
+	return template.HTML(`<time datetime="` + t.UTC().Format(time.RFC3339) + `" title="` +
+		t.In(loc).Format("02/01/2006 15:04") + `">` + template.HTMLEscapeString(relativeTime(t, loc, now)) + `</time>`)
+}
+
+// relativeTime formule l'écart entre t et now : « à l'instant »,
+// « il y a 5 min », « dans 3 h », « hier à 14:05 », puis la date.
+func relativeTime(t time.Time, loc *time.Location, now time.Time) string {
+	d := now.Sub(t)
+	prefix := "il y a "
+	if d < 0 {
+		d, prefix = -d, "dans "
+	}
+	switch {
+	case d < time.Minute:
+		return "à l'instant"
+	case d < time.Hour:
+		return fmt.Sprintf("%s%d min", prefix, int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%s%d h", prefix, int(d/time.Hour))
+	}
+	local, today := t.In(loc), now.In(loc)
+	days := int(math.Round(dayStart(today).Sub(dayStart(local)).Hours() / 24))
+	switch {
+	case days == 1:
+		return "hier à " + local.Format("15:04")
+	case days == -1:
+		return "demain à " + local.Format("15:04")
+	case days > 1 && days < 7:
+		return fmt.Sprintf("il y a %d jours", days)
+	case days < -1 && days > -7:
+		return fmt.Sprintf("dans %d jours", -days)
+	}
+	return "le " + local.Format("02/01/2006")
+}
+
+// dayStart renvoie minuit du jour de t, dans son fuseau.
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
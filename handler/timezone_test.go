@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/database/dbtest"
+)
+
+func TestRelativeTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10:30 à Paris (heure d'été).
+	now := time.Date(2025, 4, 15, 8, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		at   time.Time
+		want string
+	}{
+		{now.Add(-20 * time.Second), "à l'instant"},
+		{now.Add(-5 * time.Minute), "il y a 5 min"},
+		{now.Add(-3 * time.Hour), "il y a 3 h"},
+		{now.Add(20 * time.Minute), "dans 20 min"},
+		{time.Date(2025, 4, 14, 6, 15, 0, 0, time.UTC), "hier à 08:15"},
+		{time.Date(2025, 4, 16, 20, 0, 0, 0, time.UTC), "demain à 22:00"},
+		{time.Date(2025, 4, 11, 12, 0, 0, 0, time.UTC), "il y a 4 jours"},
+		{time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), "le 01/03/2025"},
+		// 23:30 UTC la veille est déjà le 15 à Paris : « il y a 9 h ».
+		{time.Date(2025, 4, 14, 23, 30, 0, 0, time.UTC), "il y a 9 h"},
+	}
+	for _, c := range cases {
+		if got := relativeTime(c.at, paris, now); got != c.want {
+			t.Errorf("relativeTime(%s) = %q, want %q", c.at, got, c.want)
+		}
+	}
+}
+
+func TestRelativeTimeUsesReaderLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 14/04 20:00 UTC est le 15/04 05:00 à Tokyo ; now est le 16/04 partout.
+	at := time.Date(2025, 4, 14, 20, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 4, 16, 2, 0, 0, 0, time.UTC)
+	if got := relativeTime(at, tokyo, now); got != "hier à 05:00" {
+		t.Errorf("Tokyo : %q", got)
+	}
+	if got := relativeTime(at, time.UTC, now); got != "il y a 2 jours" {
+		t.Errorf("UTC : %q", got)
+	}
+}
+
+// TestTemplatesUseForumClock vérifie que les dates relatives des pages sont
+// calculées à l'heure du forum, pas à celle de la machine.
+func TestTemplatesUseForumClock(t *testing.T) {
+	stores := dbtest.New(t)
+	ctx := context.Background()
+	published := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	f := NewForum(stores)
+	f.Now = func() time.Time { return published.Add(5 * time.Minute) }
+	authorID := createLoginUser(t, stores, "alice")
+	postID, err := stores.Posts.Create(ctx, authorID, "Titre", "contenu", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Backdate(ctx, "posts", postID, published); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	HandlerFunc(f.PostDetailHandler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/post?id="+strconv.Itoa(postID), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "il y a 5 min") {
+		t.Fatalf("statut %d, attendu « il y a 5 min » à l'heure du forum", w.Code)
+	}
+}
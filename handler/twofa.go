@@ -0,0 +1,569 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/database"
+	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	loginChallengeCookie   = "login_challenge"
+	loginChallengeLifetime = 5 * time.Minute
+	maxChallengeAttempts   = 5
+	recoveryCodeCount      = 10
+	totpIssuer             = "CinéForum"
+	// Les codes durent totpPeriod secondes ; ceux des totpSkew pas voisins
+	// sont acceptés pour tolérer le décalage d'horloge du téléphone.
+	totpPeriod = 30
+	totpSkew   = 1
+)
+
+// twoFactorLoginPage alimente connexion_2fa.html.
+type twoFactorLoginPage struct {
+	Page
+	Error string
+}
+
+// twoFactorPage alimente twofa_setup.html, qui sert à la fois à l'enrôlement
+// depuis le profil et à l'enrôlement forcé pendant la connexion.
+type twoFactorPage struct {
+	Page
+	Action        string
+	Enabled       bool
+	Required      bool
+	QRCode        template.URL
+	Secret        string
+	URI           string
+	RecoveryCodes []string
+	Remaining     int
+	ContinueURL   string
+	Error         string
+}
+
+// completeLogin termine une connexion dont le premier facteur (mot de passe ou
+// OAuth) est validé : soit la session est créée, soit l'utilisateur est envoyé
+// vers la saisie du code TOTP ou vers l'enrôlement imposé par la politique.
+// redirect, la page où l'envoyer une fois connecté, est conservée d'une étape
+// à l'autre.
+func (f *Forum) completeLogin(w http.ResponseWriter, r *http.Request, userID int, remember bool, redirect string) error {
+	ctx := r.Context()
+	redirect = localRedirect(redirect)
+	user, err := f.Users.GetByID(ctx, userID)
+	if err != nil {
+		return StatusError(http.StatusUnauthorized, "Utilisateur introuvable", err)
+	}
+	if !user.BannedAt.IsZero() {
+		return Forbidden("Ce compte est suspendu")
+	}
+	_, enabled, err := f.TwoFactor.Get(ctx, userID)
+	if err != nil {
+		return Internal(err, "Erreur interne du serveur")
+	}
+	if !enabled && !f.twoFactorRequired(ctx, user.Role) {
+		if err := f.startSession(w, r, userID, remember); err != nil {
+			return Internal(err, "Erreur création session")
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return nil
+	}
+
+	token := uuid.NewString()
+	expiry := f.now().Add(loginChallengeLifetime)
+	challenge := database.LoginChallenge{UserID: userID, Remember: remember, Redirect: redirect, ExpiresAt: expiry}
+	if err := f.TwoFactor.CreateChallenge(ctx, token, challenge); err != nil {
+		return Internal(err, "Erreur création session")
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginChallengeCookie,
+		Value:    token,
+		Path:     "/connexion/2fa",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  expiry,
+	})
+	if enabled {
+		http.Redirect(w, r, "/connexion/2fa", http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, "/connexion/2fa/enroll", http.StatusSeeOther)
+	}
+	return nil
+}
+
+// loginChallenge est une connexion dont seul le premier facteur est validé.
+type loginChallenge struct {
+	token    string
+	userID   int
+	remember bool
+	redirect string // page où envoyer l'utilisateur une fois connecté
+}
+
+// localRedirect renvoie target s'il désigne une page du forum, "/index"
+// sinon : « //hôte » ou « /\hôte » mèneraient hors du site.
+func localRedirect(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(target, "/") ||
+		strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/index"
+	}
+	return target
+}
+
+// twoFactorRequired indique si la politique d'administration impose la
+// double authentification au rôle.
+func (f *Forum) twoFactorRequired(ctx context.Context, role string) bool {
+	if role != "admin" && role != "moderator" {
+		return false
+	}
+	value, err := f.Settings.Get(ctx, database.SettingStaff2FARequired, "0")
+	return err == nil && value == "1"
+}
+
+// challengeFromRequest retrouve la connexion en attente du second facteur.
+func (f *Forum) challengeFromRequest(r *http.Request) (loginChallenge, bool) {
+	c, err := r.Cookie(loginChallengeCookie)
+	if err != nil || c.Value == "" {
+		return loginChallenge{}, false
+	}
+	challenge, err := f.TwoFactor.GetChallenge(r.Context(), c.Value, f.now())
+	if err != nil {
+		return loginChallenge{}, false
+	}
+	return loginChallenge{token: c.Value, userID: challenge.UserID, remember: challenge.Remember, redirect: localRedirect(challenge.Redirect)}, true
+}
+
+func clearChallengeCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginChallengeCookie,
+		Value:    "",
+		Path:     "/connexion/2fa",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+}
+
+// TwoFactorLoginHandler demande le code TOTP (ou un code de secours) avant de
+// créer la session.
+func (f *Forum) TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	challenge, ok := f.challengeFromRequest(r)
+	if !ok {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
+	token, userID := challenge.token, challenge.userID
+	secret, enabled, err := f.TwoFactor.Get(ctx, userID)
+	if err != nil {
+		return Internal(err, "Erreur interne du serveur")
+	}
+	if !enabled {
+		http.Redirect(w, r, "/connexion/2fa/enroll", http.StatusSeeOther)
+		return nil
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return f.renderTemplate(w, r, "connexion_2fa.html", twoFactorLoginPage{Page: f.newPage(r)})
+
+	case http.MethodPost:
+		if !f.checkSecondFactor(ctx, userID, secret, r.FormValue("code")) {
+			attempts, _ := f.TwoFactor.RecordChallengeFailure(ctx, token)
+			if attempts >= maxChallengeAttempts {
+				_ = f.TwoFactor.DeleteChallenge(ctx, token)
+				clearChallengeCookie(w)
+				http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+				return nil
+			}
+			return f.renderFormError(w, r, http.StatusUnauthorized, "Code invalide", "connexion_2fa.html", twoFactorLoginPage{Page: f.newPage(r), Error: "Code invalide"})
+		}
+		_ = f.TwoFactor.DeleteChallenge(ctx, token)
+		clearChallengeCookie(w)
+		if err := f.startSession(w, r, userID, challenge.remember); err != nil {
+			return Internal(err, "Erreur création session")
+		}
+		http.Redirect(w, r, challenge.redirect, http.StatusSeeOther)
+
+	default:
+		return MethodNotAllowed()
+	}
+	return nil
+}
+
+// TwoFactorEnrollLoginHandler impose l'enrôlement TOTP aux comptes concernés
+// par la politique d'administration avant de leur ouvrir une session.
+func (f *Forum) TwoFactorEnrollLoginHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	challenge, ok := f.challengeFromRequest(r)
+	if !ok {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
+	token, userID := challenge.token, challenge.userID
+	user, err := f.Users.GetByID(ctx, userID)
+	if err != nil {
+		return StatusError(http.StatusUnauthorized, "Utilisateur introuvable", nil)
+	}
+	if _, enabled, err := f.TwoFactor.Get(ctx, userID); err != nil || enabled {
+		http.Redirect(w, r, "/connexion/2fa", http.StatusSeeOther)
+		return nil
+	}
+
+	page := twoFactorPage{Page: f.newPage(r), Action: "/connexion/2fa/enroll", Required: true}
+	switch r.Method {
+	case http.MethodGet:
+		if err := f.beginEnrollment(ctx, user, &page, true); err != nil {
+			return Internal(err, "Erreur interne du serveur")
+		}
+		return f.renderTemplate(w, r, "twofa_setup.html", page)
+
+	case http.MethodPost:
+		codes, err := f.confirmEnrollment(ctx, userID, r.FormValue("code"))
+		if err != nil && !errors.Is(err, errInvalidCode) {
+			return Internal(err, "Erreur interne du serveur")
+		}
+		if err != nil {
+			attempts, _ := f.TwoFactor.RecordChallengeFailure(ctx, token)
+			if attempts >= maxChallengeAttempts {
+				_ = f.TwoFactor.DeleteChallenge(ctx, token)
+				clearChallengeCookie(w)
+				http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+				return nil
+			}
+			page.Error = err.Error()
+			if err := f.beginEnrollment(ctx, user, &page, true); err != nil {
+				return Internal(err, "Erreur interne du serveur")
+			}
+			return f.renderFormError(w, r, http.StatusBadRequest, page.Error, "twofa_setup.html", page)
+		}
+		_ = f.TwoFactor.DeleteChallenge(ctx, token)
+		clearChallengeCookie(w)
+		if err := f.startSession(w, r, userID, challenge.remember); err != nil {
+			return Internal(err, "Erreur création session")
+		}
+		page.Enabled = true
+		page.RecoveryCodes = codes
+		page.ContinueURL = challenge.redirect
+		return f.renderTemplate(w, r, "twofa_setup.html", page)
+
+	default:
+		return MethodNotAllowed()
+	}
+}
+
+// TwoFactorSettingsHandler permet d'activer, de désactiver la double
+// authentification et de régénérer les codes de secours depuis le profil.
+func (f *Forum) TwoFactorSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
+	user, err := f.Users.GetByID(ctx, userID)
+	if err != nil {
+		return StatusError(http.StatusUnauthorized, "Utilisateur non trouvé", nil)
+	}
+	secret, enabled, err := f.TwoFactor.Get(ctx, userID)
+	if err != nil {
+		return Internal(err, "Erreur interne du serveur")
+	}
+
+	page := twoFactorPage{
+		Page:     f.newPage(r),
+		Action:   "/profil/2fa",
+		Enabled:  enabled,
+		Required: f.twoFactorRequired(ctx, user.Role),
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		page.Remaining, _ = f.TwoFactor.CountRecoveryCodes(ctx, userID)
+		return f.renderTemplate(w, r, "twofa_setup.html", page)
+
+	case http.MethodPost:
+		switch r.FormValue("action") {
+		case "start":
+			if enabled {
+				http.Redirect(w, r, "/profil/2fa", http.StatusSeeOther)
+				return nil
+			}
+			if err := f.beginEnrollment(ctx, user, &page, false); err != nil {
+				return Internal(err, "Erreur interne du serveur")
+			}
+		case "confirm":
+			codes, err := f.confirmEnrollment(ctx, userID, r.FormValue("code"))
+			if err != nil && !errors.Is(err, errInvalidCode) {
+				return Internal(err, "Erreur interne du serveur")
+			}
+			if err != nil {
+				page.Error = err.Error()
+				if err := f.beginEnrollment(ctx, user, &page, true); err != nil {
+					return Internal(err, "Erreur interne du serveur")
+				}
+				break
+			}
+			page.Enabled = true
+			page.RecoveryCodes = codes
+			page.ContinueURL = "/profil"
+		case "regenerate":
+			if !enabled || !f.checkSecondFactor(ctx, userID, secret, r.FormValue("code")) {
+				page.Error = "Code invalide"
+				break
+			}
+			codes, err := generateRecoveryCodes()
+			if err == nil {
+				err = f.TwoFactor.ReplaceRecoveryCodes(ctx, userID, codes)
+			}
+			if err != nil {
+				return Internal(err, "Erreur lors de la génération des codes de secours")
+			}
+			page.RecoveryCodes = codes
+			page.ContinueURL = "/profil"
+		case "disable":
+			if page.Required {
+				return Forbidden("La double authentification est obligatoire pour votre rôle")
+			}
+			if !enabled || !f.checkSecondFactor(ctx, userID, secret, r.FormValue("code")) {
+				page.Error = "Code invalide"
+				break
+			}
+			if err := f.TwoFactor.Disable(ctx, userID); err != nil {
+				return Internal(err, "Erreur lors de la désactivation")
+			}
+			http.Redirect(w, r, "/profil/2fa", http.StatusSeeOther)
+			return nil
+		default:
+			return Validation("Action inconnue")
+		}
+		if page.Enabled && page.RecoveryCodes == nil {
+			page.Remaining, _ = f.TwoFactor.CountRecoveryCodes(ctx, userID)
+		}
+		if page.Error != "" {
+			return f.renderFormError(w, r, http.StatusBadRequest, page.Error, "twofa_setup.html", page)
+		}
+		return f.renderTemplate(w, r, "twofa_setup.html", page)
+
+	default:
+		return MethodNotAllowed()
+	}
+}
+
+// beginEnrollment prépare un secret en attente et remplit la page avec l'URI
+// de provisionnement et son QR code. Avec keepPending, le secret déjà en
+// attente est réutilisé pour ne pas obliger à rescanner après une faute de frappe.
+func (f *Forum) beginEnrollment(ctx context.Context, user database.User, page *twoFactorPage, keepPending bool) error {
+	opts := totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Username,
+		Period:      totpPeriod,
+	}
+	if keepPending {
+		if secret, enabled, err := f.TwoFactor.Get(ctx, user.ID); err == nil && secret != "" && !enabled {
+			if raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret); err == nil {
+				opts.Secret = raw
+			}
+		}
+	}
+	key, err := totp.Generate(opts)
+	if err != nil {
+		return err
+	}
+	if opts.Secret == nil {
+		if err := f.TwoFactor.SetPendingSecret(ctx, user.ID, key.Secret()); err != nil {
+			return err
+		}
+	}
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	page.Secret = key.Secret()
+	page.URI = key.URL()
+	page.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+	return nil
+}
+
+// confirmEnrollment vérifie le premier code saisi, active la double
+// authentification et renvoie les codes de secours en clair (affichés une fois).
+func (f *Forum) confirmEnrollment(ctx context.Context, userID int, code string) ([]string, error) {
+	secret, _, err := f.TwoFactor.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, errInvalidCode
+	}
+	ok, err := f.acceptTOTP(ctx, userID, secret, normalizeCode(code))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalidCode
+	}
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.TwoFactor.ReplaceRecoveryCodes(ctx, userID, codes); err != nil {
+		return nil, err
+	}
+	if err := f.TwoFactor.Enable(ctx, userID); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkSecondFactor accepte un code TOTP ou, à défaut, un code de secours.
+func (f *Forum) checkSecondFactor(ctx context.Context, userID int, secret, code string) bool {
+	code = normalizeCode(code)
+	if code == "" {
+		return false
+	}
+	if ok, err := f.acceptTOTP(ctx, userID, secret, code); err == nil && ok {
+		return true
+	}
+	used, err := f.TwoFactor.UseRecoveryCode(ctx, userID, code)
+	return err == nil && used
+}
+
+// acceptTOTP accepte un code TOTP valide qui n'a pas déjà servi : son pas de
+// temps doit suivre celui du dernier code accepté (RFC 6238, §5.2).
+func (f *Forum) acceptTOTP(ctx context.Context, userID int, secret, code string) (bool, error) {
+	step, ok := totpStep(secret, code, f.now())
+	if !ok {
+		return false, nil
+	}
+	return f.TwoFactor.AcceptStep(ctx, userID, step)
+}
+
+// totpStep renvoie le pas de temps auquel code est valide autour de now. Les
+// pas de la fenêtre sont essayés un à un pour savoir lequel correspond.
+func totpStep(secret, code string, now time.Time) (int64, bool) {
+	opts := totp.ValidateOpts{Period: totpPeriod, Skew: 0, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	for i := -totpSkew; i <= totpSkew; i++ {
+		t := now.Add(time.Duration(i*totpPeriod) * time.Second)
+		if ok, err := totp.ValidateCustom(code, secret, t, opts); err == nil && ok {
+			return t.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+// generateRecoveryCodes tire des codes de la forme "abcd-efgh".
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	buf := make([]byte, 5)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		codes[i] = s[:4] + "-" + s[4:]
+	}
+	return codes, nil
+}
+
+type twoFactorError string
+
+func (e twoFactorError) Error() string { return string(e) }
+
+const errInvalidCode = twoFactorError("Code invalide, vérifiez l'heure de votre téléphone et réessayez")
+
+// AdminSecurityHandler permet aux administrateurs d'imposer la double
+// authentification aux administrateurs et modérateurs.
+func (f *Forum) AdminSecurityHandler(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	adminID, ok := currentUserID(r)
+	if !ok {
+		http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+		return nil
+	}
+	admin, err := f.Users.GetByID(ctx, adminID)
+	if err != nil || admin.Role != "admin" {
+		return Forbidden("Accès réservé aux administrateurs")
+	}
+
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "unlock":
+			userID, err := strconv.Atoi(r.FormValue("user_id"))
+			if err != nil {
+				return Validation("ID utilisateur invalide")
+			}
+			if err := f.Throttle.Clear(ctx, database.ThrottleUser, strconv.Itoa(userID)); err != nil {
+				return Internal(err, "Erreur lors du déverrouillage du compte")
+			}
+		default:
+			value := "0"
+			if r.FormValue("staff_2fa_required") == "on" {
+				value = "1"
+			}
+			if err := f.Settings.Set(ctx, database.SettingStaff2FARequired, value); err != nil {
+				return Internal(err, "Erreur lors de l'enregistrement du réglage")
+			}
+		}
+		http.Redirect(w, r, "/admin/security", http.StatusSeeOther)
+		return nil
+	}
+	if r.Method != http.MethodGet {
+		return MethodNotAllowed()
+	}
+
+	type staffMember struct {
+		database.User
+		TwoFactor bool
+	}
+	staff, err := f.Users.ListStaff(ctx)
+	if err != nil {
+		return Internal(err, "Erreur lors de la récupération des utilisateurs")
+	}
+	members := make([]staffMember, 0, len(staff))
+	for _, u := range staff {
+		_, enabled, _ := f.TwoFactor.Get(ctx, u.ID)
+		members = append(members, staffMember{User: u, TwoFactor: enabled})
+	}
+	locked, err := f.Throttle.LockedAccounts(ctx, f.now())
+	if err != nil {
+		return Internal(err, "Erreur lors de la récupération des comptes verrouillés")
+	}
+	required, _ := f.Settings.Get(ctx, database.SettingStaff2FARequired, "0")
+	data := struct {
+		Page
+		Admin    database.User
+		Required bool
+		Staff    []staffMember
+		Locked   []database.LockedAccount
+	}{
+		Page:     f.newPage(r),
+		Admin:    admin,
+		Required: required == "1",
+		Staff:    members,
+		Locked:   locked,
+	}
+	return f.renderTemplate(w, r, "admin_security.html", data)
+}
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+	"forum/middleware"
+	"github.com/pquerna/otp/totp"
+)
+
+// clock est une horloge de test que les tests avancent à la main.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newFormRequest(method, path string, form url.Values) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// enableTOTP active la double authentification de userID et renvoie son secret.
+func enableTOTP(t *testing.T, stores database.Stores, userID int) string {
+	t.Helper()
+	ctx := context.Background()
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: totpIssuer, AccountName: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.TwoFactor.SetPendingSecret(ctx, userID, key.Secret()); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.TwoFactor.Enable(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	return key.Secret()
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	stores := dbtest.New(t)
+	ctx := context.Background()
+	clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	f := NewForum(stores)
+	f.Now = clk.now
+	h := middleware.Sessions{Store: stores.Sessions}.Load(HandlerFunc(f.TwoFactorSettingsHandler))
+	userID, _ := stores.Users.Create(ctx, "alice", "alice@example.com", "x")
+	session := signIn(t, stores, userID)
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		r := newFormRequest(http.MethodPost, "/profil/2fa", form)
+		r.AddCookie(session)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := post(url.Values{"action": {"start"}}); w.Code != http.StatusOK {
+		t.Fatalf("start : statut %d", w.Code)
+	}
+	secret, enabled, err := stores.TwoFactor.Get(ctx, userID)
+	if err != nil || secret == "" || enabled {
+		t.Fatalf("après start : secret %q, activé %v, %v ; attendu un secret en attente", secret, enabled, err)
+	}
+
+	if w := post(url.Values{"action": {"confirm"}, "code": {"000000"}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("mauvais code : statut %d, attendu %d", w.Code, http.StatusBadRequest)
+	}
+	if _, enabled, _ := stores.TwoFactor.Get(ctx, userID); enabled {
+		t.Fatal("activée avec un mauvais code")
+	}
+	// Le secret en attente est conservé après une faute de frappe.
+	if again, _, _ := stores.TwoFactor.Get(ctx, userID); again != secret {
+		t.Fatal("secret en attente remplacé après un mauvais code")
+	}
+
+	code, _ := totp.GenerateCode(secret, clk.t)
+	if w := post(url.Values{"action": {"confirm"}, "code": {code}}); w.Code != http.StatusOK {
+		t.Fatalf("confirmation : statut %d", w.Code)
+	}
+	if _, enabled, _ := stores.TwoFactor.Get(ctx, userID); !enabled {
+		t.Fatal("double authentification non activée")
+	}
+	if n, _ := stores.TwoFactor.CountRecoveryCodes(ctx, userID); n != recoveryCodeCount {
+		t.Errorf("%d code(s) de secours, attendu %d", n, recoveryCodeCount)
+	}
+
+	// Le code de confirmation ne sert pas une seconde fois.
+	if w := post(url.Values{"action": {"disable"}, "code": {code}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("désactivation avec le code déjà utilisé : statut %d, attendu %d", w.Code, http.StatusBadRequest)
+	}
+	clk.t = clk.t.Add(totpPeriod * time.Second)
+	code, _ = totp.GenerateCode(secret, clk.t)
+	if w := post(url.Values{"action": {"disable"}, "code": {code}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("désactivation : statut %d, attendu %d", w.Code, http.StatusSeeOther)
+	}
+	if _, enabled, _ := stores.TwoFactor.Get(ctx, userID); enabled {
+		t.Fatal("double authentification toujours active")
+	}
+}
+
+func TestTwoFactorLoginChallenge(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+		f := NewForum(stores)
+		f.Now = clk.now
+		userID, _ := stores.Users.Create(ctx, "alice", "alice@example.com", "x")
+		secret := enableTOTP(t, stores, userID)
+		if err := stores.TwoFactor.ReplaceRecoveryCodes(ctx, userID, []string{"abcd-efgh"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// submit présente code pour une nouvelle connexion en attente.
+		submit := func(code string) *httptest.ResponseRecorder {
+			t.Helper()
+			token := middleware.NewCSRFToken()
+			if err := stores.TwoFactor.CreateChallenge(ctx, token, database.LoginChallenge{UserID: userID, Redirect: "/index", ExpiresAt: clk.t.Add(loginChallengeLifetime)}); err != nil {
+				t.Fatal(err)
+			}
+			r := newFormRequest(http.MethodPost, "/connexion/2fa", url.Values{"code": {code}})
+			r.AddCookie(&http.Cookie{Name: loginChallengeCookie, Value: token})
+			w := httptest.NewRecorder()
+			HandlerFunc(f.TwoFactorLoginHandler).ServeHTTP(w, r)
+			return w
+		}
+		accepted := func(w *httptest.ResponseRecorder) bool {
+			return w.Code == http.StatusSeeOther && w.Header().Get("Location") == "/index"
+		}
+
+		if w := submit("123456"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("mauvais code : statut %d, attendu %d", w.Code, http.StatusUnauthorized)
+		}
+
+		code, _ := totp.GenerateCode(secret, clk.t)
+		if w := submit(code); !accepted(w) {
+			t.Fatalf("bon code : statut %d vers %q", w.Code, w.Header().Get("Location"))
+		}
+		if w := submit(code); w.Code != http.StatusUnauthorized {
+			t.Fatalf("code rejoué : statut %d, attendu %d", w.Code, http.StatusUnauthorized)
+		}
+		// Le code précédent reste dans la fenêtre de tolérance mais a déjà servi.
+		clk.t = clk.t.Add(totpPeriod * time.Second)
+		if w := submit(code); w.Code != http.StatusUnauthorized {
+			t.Fatalf("code rejoué au pas suivant : statut %d, attendu %d", w.Code, http.StatusUnauthorized)
+		}
+		next, _ := totp.GenerateCode(secret, clk.t)
+		if w := submit(next); !accepted(w) {
+			t.Fatalf("code du pas suivant : statut %d", w.Code)
+		}
+
+		if w := submit("ABCD-EFGH"); !accepted(w) {
+			t.Fatalf("code de secours : statut %d", w.Code)
+		}
+		if w := submit("abcd-efgh"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("code de secours réutilisé : statut %d, attendu %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestTwoFactorChallengeExpiresWithForumClock(t *testing.T) {
+	stores := dbtest.New(t)
+	ctx := context.Background()
+	// Horloge du forum loin dans le passé : le défi doit expirer selon elle,
+	// pas selon l'heure réelle.
+	clk := &clock{time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)}
+	f := NewForum(stores)
+	f.Now = clk.now
+	userID, _ := stores.Users.Create(ctx, "alice", "alice@example.com", "x")
+	enableTOTP(t, stores, userID)
+	if err := stores.TwoFactor.CreateChallenge(ctx, "defi", database.LoginChallenge{UserID: userID, ExpiresAt: clk.t.Add(loginChallengeLifetime)}); err != nil {
+		t.Fatal(err)
+	}
+	get := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/connexion/2fa", nil)
+		r.AddCookie(&http.Cookie{Name: loginChallengeCookie, Value: "defi"})
+		w := httptest.NewRecorder()
+		HandlerFunc(f.TwoFactorLoginHandler).ServeHTTP(w, r)
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusOK {
+		t.Fatalf("défi en cours : statut %d, attendu %d", w.Code, http.StatusOK)
+	}
+	clk.t = clk.t.Add(loginChallengeLifetime + time.Second)
+	if w := get(); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/connexion" {
+		t.Fatalf("défi expiré : statut %d vers %q, attendu /connexion", w.Code, w.Header().Get("Location"))
+	}
+}
+
+// TestTwoFactorLoginKeepsRedirect vérifie que la page de retour choisie au
+// premier facteur survit au second, tant qu'elle reste sur le forum.
+func TestTwoFactorLoginKeepsRedirect(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		clk := &clock{time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+		f := NewForum(stores)
+		f.Now = clk.now
+		userID, _ := stores.Users.Create(ctx, "alice", "alice@example.com", "x")
+		secret := enableTOTP(t, stores, userID)
+		login := func(redirect string) string {
+			t.Helper()
+			w := httptest.NewRecorder()
+			if err := f.completeLogin(w, httptest.NewRequest(http.MethodGet, "/auth/corp/callback", nil), userID, false, redirect); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/connexion/2fa" {
+				t.Fatalf("premier facteur : statut %d vers %q", w.Code, w.Header().Get("Location"))
+			}
+			var challenge *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == loginChallengeCookie {
+					challenge = c
+				}
+			}
+			if challenge == nil {
+				t.Fatal("cookie de connexion en attente absent")
+			}
+			clk.t = clk.t.Add(totpPeriod * time.Second)
+			code, _ := totp.GenerateCode(secret, clk.t)
+			r := newFormRequest(http.MethodPost, "/connexion/2fa", url.Values{"code": {code}})
+			r.AddCookie(challenge)
+			w = httptest.NewRecorder()
+			HandlerFunc(f.TwoFactorLoginHandler).ServeHTTP(w, r)
+			if w.Code != http.StatusSeeOther {
+				t.Fatalf("second facteur : statut %d", w.Code)
+			}
+			return w.Header().Get("Location")
+		}
+
+		tests := []struct{ redirect, want string }{
+			{"/profil", "/profil"},
+			{"/post?id=3", "/post?id=3"},
+			{"", "/index"},
+			{"profil", "/index"},
+			{"//evil.example/", "/index"},
+			{`/\evil.example/`, "/index"},
+			{"https://evil.example/", "/index"},
+		}
+		for _, tt := range tests {
+			if got := login(tt.redirect); got != tt.want {
+				t.Errorf("retour %q : redirigé vers %q, attendu %q", tt.redirect, got, tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,92 @@
+// Package logging configure le journal structuré (log/slog) et rattache à
+// chaque ligne l'identifiant de la requête et l'utilisateur en cours.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// New crée un logger écrivant sur w au format "text" ou "json".
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("niveau de log %q inconnu (debug, info, warn, error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text", "":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("format de log %q inconnu (text ou json)", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// requestInfo est partagée par tous les middlewares d'une même requête : la
+// session, chargée plus loin dans la chaîne, y inscrit l'utilisateur.
+type requestInfo struct {
+	id     string
+	userID atomic.Int64
+}
+
+type requestKey struct{}
+
+// WithRequestID attache l'identifiant de requête au contexte.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestKey{}, &requestInfo{id: id})
+}
+
+// RequestID renvoie l'identifiant de la requête, ou "" hors requête.
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// SetUserID indique l'utilisateur authentifié de la requête.
+func SetUserID(ctx context.Context, userID int) {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		info.userID.Store(int64(userID))
+	}
+}
+
+// UserID renvoie l'utilisateur authentifié de la requête, 0 sinon.
+func UserID(ctx context.Context) int {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		return int(info.userID.Load())
+	}
+	return 0
+}
+
+// contextHandler ajoute request_id et user_id aux enregistrements émis avec
+// un contexte de requête (slog.InfoContext, slog.ErrorContext…).
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		rec.AddAttrs(slog.String("request_id", info.id))
+		if id := info.userID.Load(); id != 0 {
+			rec.AddAttrs(slog.Int64("user_id", id))
+		}
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
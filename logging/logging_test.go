@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// record décode la seule ligne JSON écrite dans buf.
+func record(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("ligne %q : %v", buf.String(), err)
+	}
+	buf.Reset()
+	return rec
+}
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("format inconnu accepté")
+	}
+	if _, err := New(&bytes.Buffer{}, "json", "trace"); err == nil {
+		t.Error("niveau inconnu accepté")
+	}
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, "text", "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("ignorée")
+	logger.Warn("gardée")
+	if out := buf.String(); strings.Contains(out, "ignorée") || !strings.Contains(out, "gardée") {
+		t.Errorf("niveau warn non respecté : %q", out)
+	}
+}
+
+func TestRequestContextInRecords(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hors requête, aucun identifiant n'est ajouté.
+	logger.InfoContext(context.Background(), "démarrage")
+	if rec := record(t, &buf); rec["request_id"] != nil || rec["user_id"] != nil {
+		t.Errorf("identifiants hors requête : %v", rec)
+	}
+
+	ctx := WithRequestID(context.Background(), "req-42")
+	if RequestID(ctx) != "req-42" || UserID(ctx) != 0 {
+		t.Fatalf("contexte : requête %q, utilisateur %d", RequestID(ctx), UserID(ctx))
+	}
+	logger.InfoContext(ctx, "anonyme")
+	if rec := record(t, &buf); rec["request_id"] != "req-42" || rec["user_id"] != nil {
+		t.Errorf("visiteur anonyme : %v", rec)
+	}
+
+	// L'utilisateur inscrit plus loin dans la chaîne est vu par tous les
+	// loggers de la requête, y compris ceux dérivés par With.
+	SetUserID(ctx, 7)
+	logger.With("module", "test").InfoContext(ctx, "connecté")
+	if rec := record(t, &buf); rec["request_id"] != "req-42" || rec["user_id"] != float64(7) || rec["module"] != "test" {
+		t.Errorf("logger dérivé : %v", rec)
+	}
+}
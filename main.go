@@ -1,9 +1,83 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
 	"forum/server"
 )
 
+// command est une commande de « forum <commande> [options] ».
+type command struct {
+	run     func(args []string, out io.Writer) error
+	summary string
+}
+
+// commands sont les commandes du binaire ; sans commande, le forum démarre
+// (serve).
+var commands = map[string]command{
+	"serve":          {server.Serve, "démarrer le forum (par défaut)"},
+	"migrate":        {server.Migrate, "créer les tables et appliquer les migrations"},
+	"create-user":    {server.CreateUser, "créer un compte : -email adresse [-role rôle] [-password mdp] nom"},
+	"set-role":       {server.SetRole, "changer le rôle d'un compte : nom user|moderator|admin"},
+	"reset-password": {server.ResetPassword, "remplacer le mot de passe d'un compte : [-password mdp] nom"},
+	"ban":            {server.Ban, "suspendre un compte, ou lever sa suspension : [-lift] nom"},
+	"purge-sessions": {server.PurgeSessions, "supprimer les sessions expirées : [-all | -user nom]"},
+	"reindex-search": {server.ReindexSearch, "reconstruire les index de la base"},
+	"seed-demo-data": {server.SeedDemoData, "créer les comptes de démonstration et un forum fictif : [-seed n] [-posts n]…"},
+	"export":         {server.Export, "exporter la base en JSON : [-o fichier]"},
+	"import":         {server.Import, "charger un export dans une base vide : fichier"},
+	"check":          {server.CheckDatabase, "lister les lignes orphelines : [-repair]"},
+	"backup":         {server.BackupDatabase, "sauvegarder la base et les images : [-o archive]"},
+	"restore":        {server.RestoreDatabase, "restaurer une sauvegarde, forum arrêté : archive"},
+}
+
 func main() {
-	server.StartServer()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run exécute la commande désignée par args et renvoie le code de sortie :
+// 0 en cas de succès, 1 si la commande échoue, 2 si elle est inconnue.
+func run(args []string, stdout, stderr io.Writer) int {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	switch name {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return 0
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "commande %q inconnue\n\n", name)
+		usage(stderr)
+		return 2
+	}
+	// -h affiche déjà les options de la commande.
+	if err := cmd.run(args, stdout); err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage : forum [commande] [options]")
+	fmt.Fprintln(w)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	width := slices.MaxFunc(names, func(a, b string) int { return len(a) - len(b) })
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-*s  %s\n", len(width), name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "« forum commande -h » détaille les options d'une commande.")
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"forum/database"
+	"forum/database/dbtest"
+)
+
+func TestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forum.db")
+	t.Setenv("FORUM_CONFIG", "")
+	t.Setenv("DATABASE_DRIVER", database.SQLite)
+	t.Setenv("DATABASE_PATH", path)
+	stores := dbtest.NewAt(t, path)
+	if _, err := stores.Users.Create(context.Background(), "alice", "alice@example.com", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{"aide", []string{"help"}, 0, "usage : forum [commande]", ""},
+		{"commande inconnue", []string{"inconnue"}, 2, "", `commande "inconnue" inconnue`},
+		{"aide d'une commande", []string{"ban", "-h"}, 0, "", ""},
+		{"commande réussie", []string{"set-role", "alice", "moderator"}, 0, "alice : user -> moderator", ""},
+		{"utilisateur inconnu", []string{"set-role", "inconnu", "admin"}, 1, "", `utilisateur "inconnu" introuvable`},
+		{"arguments invalides", []string{"create-user", "bob"}, 1, "", "usage : forum create-user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("code de sortie %d, attendu %d (%s)", code, tt.code, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.stdout) {
+				t.Errorf("sortie %q, attendu %q", stdout.String(), tt.stdout)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) || (tt.stderr == "" && stderr.Len() > 0) {
+				t.Errorf("erreurs %q, attendu %q", stderr.String(), tt.stderr)
+			}
+		})
+	}
+
+	if u, err := stores.Users.GetByUsername(context.Background(), "alice"); err != nil || u.Role != "moderator" {
+		t.Errorf("alice : %+v, %v ; attendu le rôle moderator", u, err)
+	}
+}
@@ -0,0 +1,174 @@
+// Package metrics expose les métriques Prometheus du forum : trafic HTTP,
+// limitation de débit, base de données, services externes et état du forum.
+package metrics
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry regroupe les métriques du forum et celles du runtime Go.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_http_requests_total",
+		Help: "Requêtes HTTP traitées, par route, méthode et statut.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "forum_http_request_duration_seconds",
+		Help:    "Durée de traitement des requêtes HTTP, par route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_rate_limit_rejections_total",
+		Help: "Requêtes refusées (429) par le limiteur de débit, par politique.",
+	}, []string{"policy"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "forum_db_query_duration_seconds",
+		Help:    "Durée des requêtes SQL, par opération et table.",
+		Buckets: []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"op", "table"})
+
+	upstreamRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_upstream_requests_total",
+		Help: "Appels aux services externes, par service et résultat.",
+	}, []string{"service", "result"})
+
+	upstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "forum_upstream_request_duration_seconds",
+		Help:    "Durée des appels aux services externes.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 15},
+	}, []string{"service"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, rateLimited, dbDuration,
+		upstreamRequests, upstreamDuration,
+	)
+}
+
+// ObserveRequest enregistre une requête HTTP terminée.
+func ObserveRequest(route, method string, status int, d time.Duration) {
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(route, method).Observe(d.Seconds())
+}
+
+// RateLimited compte un refus du limiteur de débit.
+func RateLimited(policy string) {
+	rateLimited.WithLabelValues(policy).Inc()
+}
+
+// ObserveQuery enregistre la durée d'une requête SQL.
+func ObserveQuery(op, table string, d time.Duration) {
+	dbDuration.WithLabelValues(op, table).Observe(d.Seconds())
+}
+
+// ObserveUpstream enregistre un appel à un service externe. result vaut
+// "ok", "error" (réseau) ou la classe du statut HTTP ("4xx", "5xx").
+func ObserveUpstream(service, result string, d time.Duration) {
+	upstreamRequests.WithLabelValues(service, result).Inc()
+	upstreamDuration.WithLabelValues(service).Observe(d.Seconds())
+}
+
+// UpstreamResult classe la réponse d'un service externe.
+func UpstreamResult(resp *http.Response, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case resp.StatusCode < 400:
+		return "ok"
+	case resp.StatusCode < 500:
+		return "4xx"
+	}
+	return "5xx"
+}
+
+// Gauge calcule une valeur au moment de la collecte (file de modération,
+// sessions actives…).
+type Gauge func() (int, error)
+
+// Gauges regroupe les jauges d'un forum, interrogées à chaque collecte
+// plutôt que maintenues en mémoire où elles divergeraient de la base. Chaque
+// Server a les siennes, lues sur sa propre base.
+type Gauges struct {
+	mu     sync.Mutex
+	gauges map[string]stateGauge
+}
+
+type stateGauge struct {
+	desc *prometheus.Desc
+	read Gauge
+}
+
+// NewGauges crée un ensemble de jauges vide.
+func NewGauges() *Gauges {
+	return &Gauges{gauges: map[string]stateGauge{}}
+}
+
+// Add déclare une jauge lue à chaque collecte ; un second appel avec le même
+// nom remplace la fonction.
+func (c *Gauges) Add(name, help string, read Gauge) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gauges[name] = stateGauge{prometheus.NewDesc(name, help, nil, nil), read}
+}
+
+// Describe n'annonce volontairement aucune description : Gauges est un
+// collecteur non vérifié, car Add peut déclarer une jauge après son
+// enregistrement. Le registre ne contrôle alors plus les doublons ; Add les
+// écarte en indexant les jauges par nom.
+func (c *Gauges) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *Gauges) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, g := range c.gauges {
+		v, err := g.read()
+		if err != nil {
+			slog.Error("lecture de la jauge", "metric", name, "err", err)
+			ch <- prometheus.NewInvalidMetric(g.desc, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, float64(v))
+	}
+}
+
+// Handler sert les métriques du processus et les jauges gauges (si non nil)
+// au format Prometheus. Avec un jeton, la requête doit porter
+// « Authorization: Bearer <jeton> ».
+func Handler(token string, gauges *Gauges) http.Handler {
+	gatherers := prometheus.Gatherers{Registry}
+	if gauges != nil {
+		own := prometheus.NewRegistry()
+		own.MustRegister(gauges)
+		gatherers = append(gatherers, own)
+	}
+	h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+	if token == "" {
+		return h
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Jeton requis", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
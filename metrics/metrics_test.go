@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape interroge h comme le ferait Prometheus, avec l'en-tête
+// Authorization auth s'il n'est pas vide.
+func scrape(h http.Handler, auth string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerToken(t *testing.T) {
+	h := Handler("jeton", nil)
+	tests := []struct {
+		name string
+		auth string
+		want int
+	}{
+		{"sans jeton", "", http.StatusUnauthorized},
+		{"mauvais jeton", "Bearer autre", http.StatusUnauthorized},
+		{"jeton sans schéma", "jeton", http.StatusUnauthorized},
+		{"bon jeton", "Bearer jeton", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := scrape(h, tt.auth)
+			if w.Code != tt.want {
+				t.Fatalf("statut %d, attendu %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && (w.Header().Get("WWW-Authenticate") == "" || strings.Contains(w.Body.String(), "go_goroutines")) {
+				t.Errorf("refus sans WWW-Authenticate ou avec les métriques : %q", w.Body.String())
+			}
+			if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), "go_goroutines") {
+				t.Error("métriques du runtime absentes")
+			}
+		})
+	}
+
+	if w := scrape(Handler("", nil), ""); w.Code != http.StatusOK {
+		t.Errorf("sans jeton configuré : statut %d, attendu %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestGaugesReadAtCollection(t *testing.T) {
+	queue := 3
+	gauges := NewGauges()
+	gauges.Add("forum_test_queue", "File de test.", func() (int, error) { return queue, nil })
+	h := Handler("", gauges)
+
+	if body := scrape(h, "").Body.String(); !strings.Contains(body, "forum_test_queue 3\n") || !strings.Contains(body, "# HELP forum_test_queue File de test.") {
+		t.Fatalf("jauge absente :\n%s", body)
+	}
+	// La valeur est relue à chaque collecte, même après l'enregistrement.
+	queue = 5
+	gauges.Add("forum_test_sessions", "Sessions de test.", func() (int, error) { return 2, nil })
+	body := scrape(h, "").Body.String()
+	if !strings.Contains(body, "forum_test_queue 5\n") || !strings.Contains(body, "forum_test_sessions 2\n") {
+		t.Fatalf("jauges non relues :\n%s", body)
+	}
+
+	gauges.Add("forum_test_sessions", "Sessions de test.", func() (int, error) { return 0, errors.New("base fermée") })
+	if w := scrape(h, ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("jauge en échec : statut %d, attendu %d", w.Code, http.StatusInternalServerError)
+	}
+}
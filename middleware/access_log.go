@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"forum/logging"
+)
+
+// RequestIDHeader porte l'identifiant de requête dans la réponse (et dans la
+// requête quand un proxy de confiance l'a déjà attribué).
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID attribue un identifiant à chaque requête, le renvoie dans
+// X-Request-ID et le place dans le contexte : toute ligne de log émise avec
+// ce contexte le reprend. Doit être le premier middleware de la chaîne.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) || !fromTrustedProxy(r) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// AccessLogger journalise une ligne par requête : méthode, route, statut,
+// taille, durée, utilisateur et IP. Routes sert à retrouver le motif de la
+// route (« /auth/{provider} ») plutôt que le chemin brut.
+type AccessLogger struct {
+	Logger *slog.Logger
+	Routes *http.ServeMux
+}
+
+// Log est le middleware ; à placer juste après RequestID.
+func (a *AccessLogger) Log(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		logger := a.Logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		logger.LogAttrs(r.Context(), level, "requête",
+			slog.String("method", r.Method),
+			slog.String("route", routePattern(a.Routes, r)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", ClientIP(r)),
+		)
+	})
+}
+
+// routePattern renvoie le motif enregistré pour la requête, ou le chemin à
+// défaut.
+func routePattern(routes *http.ServeMux, r *http.Request) string {
+	if routes != nil {
+		if _, pattern := routes.Handler(r); pattern != "" {
+			return pattern
+		}
+	}
+	return r.URL.Path
+}
+
+// statusRecorder retient le statut et la taille de la réponse.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap expose le ResponseWriter d'origine à http.ResponseController.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
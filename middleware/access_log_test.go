@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/logging"
+)
+
+var generatedID = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+func TestRequestIDHeader(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen string
+	h := proxies.Resolve(RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	})))
+
+	tests := []struct {
+		name     string
+		remote   string
+		incoming string
+		keep     bool
+	}{
+		{"sans identifiant", "10.0.0.1:1234", "", false},
+		{"identifiant du proxy", "10.0.0.1:1234", "proxy-req.42_A", true},
+		{"identifiant d'un client direct", "203.0.113.7:1234", "client-req", false},
+		{"caractères interdits", "10.0.0.1:1234", "req\nfausse=ligne", false},
+		{"identifiant trop long", "10.0.0.1:1234", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.incoming != "" {
+				r.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			got := w.Header().Get(RequestIDHeader)
+			if got != seen {
+				t.Fatalf("en-tête %q, contexte %q : attendu le même identifiant", got, seen)
+			}
+			if tt.keep && got != tt.incoming {
+				t.Errorf("identifiant %q, attendu celui du proxy %q", got, tt.incoming)
+			}
+			if !tt.keep && !generatedID.MatchString(got) {
+				t.Errorf("identifiant %q, attendu un identifiant généré", got)
+			}
+		})
+	}
+}
+
+func TestAccessLogLine(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /post/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// Une ligne émise par le handler reprend l'identifiant de la requête.
+		logger.InfoContext(r.Context(), "handler")
+		io.WriteString(w, "bonjour")
+	})
+	mux.HandleFunc("POST /panne", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "panne", http.StatusInternalServerError)
+	})
+	accessLog := &AccessLogger{Logger: logger, Routes: mux}
+	h := proxies.Resolve(RequestID(accessLog.Log(mux)))
+
+	serve := func(method, path string) (string, []map[string]any) {
+		t.Helper()
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", "198.51.100.7")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var lines []map[string]any
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var rec map[string]any
+			if err := dec.Decode(&rec); err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, rec)
+		}
+		buf.Reset()
+		return w.Header().Get(RequestIDHeader), lines
+	}
+
+	id, lines := serve(http.MethodGet, "/post/42")
+	if len(lines) != 2 {
+		t.Fatalf("%d lignes, attendu celle du handler puis celle de l'accès", len(lines))
+	}
+	if lines[0]["request_id"] != id {
+		t.Errorf("ligne du handler %v, attendu request_id %q", lines[0], id)
+	}
+	line := lines[1]
+	want := map[string]any{
+		"level":      slog.LevelInfo.String(),
+		"request_id": id,
+		"method":     "GET",
+		"route":      "GET /post/{id}",
+		"path":       "/post/42",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(len("bonjour")),
+		"ip":         "198.51.100.7",
+	}
+	for key, v := range want {
+		if line[key] != v {
+			t.Errorf("%s = %v, attendu %v", key, line[key], v)
+		}
+	}
+	if latency, ok := line["latency"].(float64); !ok || latency < 0 || time.Duration(latency) > time.Minute {
+		t.Errorf("durée %v invalide", line["latency"])
+	}
+
+	// Les erreurs serveur sont journalisées au niveau ERROR.
+	if _, lines := serve(http.MethodPost, "/panne"); len(lines) != 1 || lines[0]["level"] != slog.LevelError.String() || lines[0]["status"] != float64(http.StatusInternalServerError) {
+		t.Errorf("erreur serveur : %v", lines)
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies liste les réseaux dont on accepte les en-têtes
+// X-Forwarded-For, X-Forwarded-Proto et X-Request-ID.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies lit les proxys de confiance (adresses IP ou CIDR).
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+	var nets TrustedProxies
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			if ip := net.ParseIP(e); ip != nil && ip.To4() != nil {
+				e += "/32"
+			} else {
+				e += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("proxy de confiance invalide %q: %w", e, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (p TrustedProxies) contains(ip net.IP) bool {
+	for _, n := range p {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientKey struct{}
+
+// client est l'origine d'une requête, établie par Resolve.
+type client struct {
+	ip       string
+	viaProxy bool // la connexion vient d'un proxy de confiance
+}
+
+// Resolve établit l'adresse du client et place dans le contexte de quoi
+// répondre à ClientIP et savoir si la requête passe par un proxy de
+// confiance. Doit envelopper toute la chaîne : sans lui, les en-têtes des
+// proxys sont ignorés.
+func (p TrustedProxies) Resolve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := client{ip: remoteHost(r)}
+		if ip := net.ParseIP(c.ip); ip != nil && p.contains(ip) {
+			c.viaProxy = true
+			c.ip = p.forwardedFor(r, c.ip)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, c)))
+	})
+}
+
+// forwardedFor lit X-Forwarded-For de droite à gauche jusqu'à la première
+// adresse qui n'est pas un proxy de confiance.
+func (p TrustedProxies) forwardedFor(r *http.Request, host string) string {
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		if !p.contains(hop) {
+			return hop.String()
+		}
+		host = hop.String()
+	}
+	return host
+}
+
+// remoteHost renvoie l'adresse de la connexion, sans le port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIP renvoie l'adresse IP du client, sans le port : celle établie par
+// TrustedProxies.Resolve, ou à défaut celle de la connexion.
+func ClientIP(r *http.Request) string {
+	if c, ok := r.Context().Value(clientKey{}).(client); ok {
+		return c.ip
+	}
+	return remoteHost(r)
+}
+
+// fromTrustedProxy indique si la requête vient d'un proxy de confiance.
+func fromTrustedProxy(r *http.Request) bool {
+	c, ok := r.Context().Value(clientKey{}).(client)
+	return ok && c.viaProxy
+}
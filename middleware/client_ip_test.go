@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	h := proxies.Resolve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientIP(r)
+	}))
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"sans proxy", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"en-tête d'un client non fiable ignoré", "203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"proxy de confiance", "10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"adresse falsifiée à gauche ignorée", "10.0.0.1:1234", []string{"6.6.6.6, 198.51.100.1"}, "198.51.100.1"},
+		{"chaîne de proxys de confiance", "10.0.0.1:1234", []string{"198.51.100.1, 192.168.1.5"}, "198.51.100.1"},
+		{"en-têtes répétés", "10.0.0.1:1234", []string{"198.51.100.1", "192.168.1.5"}, "198.51.100.1"},
+		{"proxy non fiable au milieu", "10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.9"}, "203.0.113.9"},
+		{"entrée invalide", "10.0.0.1:1234", []string{"198.51.100.1, n'importe quoi"}, "10.0.0.1"},
+		{"uniquement des proxys", "10.0.0.1:1234", []string{"192.168.1.5"}, "192.168.1.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("ClientIP = %q, attendu %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("CIDR invalide accepté")
+	}
+}
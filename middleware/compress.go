@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Compressor compresse les réponses textuelles (HTML, CSS, JS, JSON, SVG…)
+// d'au moins MinSize octets, en Brotli si activé et accepté, sinon en gzip.
+// Les formats déjà compressés (JPEG, PNG, WebP…) sont transmis tels quels.
+type Compressor struct {
+	MinSize int
+	Brotli  bool
+}
+
+// encoder est l'interface commune à gzip.Writer et brotli.Writer.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var (
+	gzipPool   = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	brotliPool = sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, 5) }}
+)
+
+// compressibleTypes liste les types MIME qui gagnent à être compressés.
+var compressibleTypes = map[string]bool{
+	"application/javascript":    true,
+	"application/json":          true,
+	"application/manifest+json": true,
+	"application/rss+xml":       true,
+	"application/xml":           true,
+	"image/svg+xml":             true,
+	"text/javascript":           true,
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
+
+// Compress est le middleware de compression.
+func (c *Compressor) Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := c.negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, minSize: c.MinSize, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiate choisit l'encodage à partir de l'en-tête Accept-Encoding.
+func (c *Compressor) negotiate(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(name)] = true
+	}
+	switch {
+	case c.Brotli && accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter retarde l'envoi des en-têtes jusqu'à connaître le type et la
+// taille de la réponse : les réponses courtes, déjà encodées ou non textuelles
+// (y compris les erreurs écrites par http.Error) passent sans compression.
+type compressWriter struct {
+	http.ResponseWriter
+	minSize  int
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.minSize {
+			return len(b), nil
+		}
+		cw.decide(true)
+		if err := cw.flushBuffer(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide fixe l'encodage et envoie les en-têtes. large indique que la réponse
+// atteint la taille minimale (ou est diffusée en continu).
+func (cw *compressWriter) decide(large bool) {
+	cw.decided = true
+	h := cw.Header()
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	compressible := isCompressible(h.Get("Content-Type"))
+	if compressible {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if large && compressible && cw.status == http.StatusOK &&
+		h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		// La représentation compressée n'est plus identique octet pour octet.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.enc = acquireEncoder(cw.encoding, cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressWriter) flushBuffer() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush permet le streaming : la décision est prise sans attendre MinSize.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(true)
+		_ = cw.flushBuffer()
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack transmet la connexion brute (WebSocket…) sans compression.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("compress: le ResponseWriter ne gère pas Hijack")
+	}
+	cw.decided = true
+	return h.Hijack()
+}
+
+// Unwrap expose le ResponseWriter d'origine à http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return // le handler n'a rien écrit : net/http enverra un 200 vide
+		}
+		cw.decide(false)
+		_ = cw.flushBuffer()
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		releaseEncoder(cw.encoding, cw.enc)
+		cw.enc = nil
+	}
+}
+
+func acquireEncoder(encoding string, w io.Writer) encoder {
+	var enc encoder
+	if encoding == "br" {
+		enc = brotliPool.Get().(*brotli.Writer)
+	} else {
+		enc = gzipPool.Get().(*gzip.Writer)
+	}
+	enc.Reset(w)
+	return enc
+}
+
+func releaseEncoder(encoding string, enc encoder) {
+	enc.Reset(io.Discard)
+	if encoding == "br" {
+		brotliPool.Put(enc)
+	} else {
+		gzipPool.Put(enc)
+	}
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+var largeText = strings.Repeat("Bonjour le forum. ", 200)
+
+// compressed sert body avec le type contentType derrière c.
+func compressed(c *Compressor, acceptEncoding, contentType, body string) *httptest.ResponseRecorder {
+	h := c.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		io.WriteString(w, body)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decode décompresse le corps selon son Content-Encoding.
+func decode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var r io.Reader = w.Body
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(w.Body)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCompressNegotiation(t *testing.T) {
+	tests := []struct {
+		name   string
+		brotli bool
+		accept string
+		want   string
+	}{
+		{"sans Accept-Encoding", true, "", ""},
+		{"gzip", true, "gzip, deflate", "gzip"},
+		{"brotli préféré", true, "gzip, deflate, br", "br"},
+		{"brotli désactivé", false, "gzip, br", "gzip"},
+		{"brotli refusé par q=0", true, "br;q=0, gzip", "gzip"},
+		{"aucun encodage connu", true, "deflate", ""},
+		{"casse ignorée", false, "GZIP", "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := compressed(&Compressor{MinSize: 1024, Brotli: tt.brotli}, tt.accept, "text/html; charset=utf-8", largeText)
+			if got := w.Header().Get("Content-Encoding"); got != tt.want {
+				t.Fatalf("Content-Encoding %q, attendu %q", got, tt.want)
+			}
+			if body := decode(t, w); body != largeText {
+				t.Errorf("corps décodé différent de l'original (%d octets)", len(body))
+			}
+		})
+	}
+}
+
+func TestCompressSkipsSmallAndCompressedBodies(t *testing.T) {
+	c := &Compressor{MinSize: 1024, Brotli: true}
+	if w := compressed(c, "gzip, br", "text/html", "court"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != "court" {
+		t.Errorf("réponse courte compressée : %q", w.Header().Get("Content-Encoding"))
+	}
+	for _, ct := range []string{"image/png", "image/jpeg", "application/zip", "font/woff2"} {
+		w := compressed(c, "gzip, br", ct, largeText)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.String() != largeText {
+			t.Errorf("%s recompressé en %q", ct, w.Header().Get("Content-Encoding"))
+		}
+		if w.Header().Get("Vary") != "" {
+			t.Errorf("%s : Vary %q pour une réponse jamais compressée", ct, w.Header().Get("Vary"))
+		}
+	}
+	if w := compressed(c, "gzip", "application/json", largeText); w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("JSON : Content-Encoding %q, Vary %q", w.Header().Get("Content-Encoding"), w.Header().Get("Vary"))
+	}
+}
+
+func TestCompressWeakensETag(t *testing.T) {
+	h := (&Compressor{MinSize: 1024}).Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Header().Set("ETag", `"abc"`)
+		io.WriteString(w, largeText)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got := w.Header().Get("ETag"); got != `W/"abc"` {
+		t.Errorf("ETag %q, attendu W/\"abc\"", got)
+	}
+}
+
+func TestCompressFlushPassthrough(t *testing.T) {
+	h := (&Compressor{MinSize: 1024}).Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: un\n\n")
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Error("le ResponseWriter compressé n'implémente pas http.Flusher")
+			return
+		}
+		f.Flush()
+		io.WriteString(w, "data: deux\n\n")
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if !w.Flushed {
+		t.Fatal("Flush non transmis au ResponseWriter d'origine")
+	}
+	// Un flux vidé avant MinSize est tout de même compressé.
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding %q, attendu gzip", w.Header().Get("Content-Encoding"))
+	}
+	if body := decode(t, w); body != "data: un\n\ndata: deux\n\n" {
+		t.Errorf("corps %q", body)
+	}
+}
+
+func TestCompressSkipsErrorStatuses(t *testing.T) {
+	c := &Compressor{MinSize: 10}
+	h := c.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, largeText)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("erreur : statut %d, Content-Encoding %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+}
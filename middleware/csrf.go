@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	// CSRFField est le nom du champ caché ajouté aux formulaires.
+	CSRFField = "csrf_token"
+	// CSRFHeader porte le jeton pour les requêtes fetch (JSON).
+	CSRFHeader = "X-CSRF-Token"
+	// csrfCookie porte le jeton des visiteurs sans session (connexion, inscription).
+	csrfCookie = "csrf_token"
+	// csrfMaxMemory aligne l'analyse des formulaires multipart sur les handlers.
+	csrfMaxMemory = 10 << 20
+	// CSRFRejected explique le refus d'une requête au jeton absent ou expiré.
+	CSRFRejected = "Requête refusée : le jeton de sécurité du formulaire est absent ou a expiré. Rechargez la page puis renvoyez le formulaire."
+)
+
+type csrfKey struct{}
+
+// CSRF vérifie le jeton de toute requête qui modifie l'état (méthode autre que
+// GET/HEAD/OPTIONS). Le jeton est lié à la session serveur ; sans session, il
+// est conservé dans un cookie dédié.
+type CSRF struct {
+	// Reject répond aux requêtes refusées ; sans lui, un texte brut 403.
+	Reject http.HandlerFunc
+}
+
+// Protect est le middleware : il place aussi le jeton attendu dans le
+// contexte pour les templates. Doit être placé après Sessions.
+func (c CSRF) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := sessionCSRFToken(r)
+		if token == "" {
+			token = anonymousCSRFToken(w, r)
+		}
+
+		// Les rapports CSP sont envoyés par le navigateur, sans jeton.
+		if !isSafeMethod(r.Method) && r.URL.Path != CSPReportPath {
+			sent := r.Header.Get(CSRFHeader)
+			if sent == "" {
+				if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+					_ = r.ParseMultipartForm(csrfMaxMemory)
+				}
+				sent = r.PostFormValue(CSRFField)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				slog.WarnContext(r.Context(), "jeton CSRF invalide", "method", r.Method, "path", r.URL.Path, "ip", ClientIP(r))
+				c.reject(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey{}, token)))
+	})
+}
+
+// CSRFToken renvoie le jeton à insérer dans les formulaires de la requête.
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+// sessionCSRFToken renvoie le jeton de la session courante.
+func sessionCSRFToken(r *http.Request) string {
+	s, ok := CurrentSession(r)
+	if !ok {
+		return ""
+	}
+	return s.CSRFToken
+}
+
+func anonymousCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookie); err == nil && c.Value != "" {
+		return c.Value
+	}
+	token := NewCSRFToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	// Une requête non sûre sans cookie ne peut pas présenter de jeton valide.
+	if !isSafeMethod(r.Method) {
+		return ""
+	}
+	return token
+}
+
+// NewCSRFToken génère un jeton aléatoire de 256 bits.
+func NewCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func (c CSRF) reject(w http.ResponseWriter, r *http.Request) {
+	if c.Reject != nil {
+		c.Reject(w, r)
+		return
+	}
+	http.Error(w, CSRFRejected, http.StatusForbidden)
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"forum/metrics"
+)
+
+// RequestMetrics alimente les métriques HTTP (nombre et durée des requêtes)
+// par motif de route : le chemin brut ferait exploser le nombre de séries.
+// Les requêtes sans route enregistrée sont regroupées sous "autre".
+type RequestMetrics struct {
+	Routes *http.ServeMux
+}
+
+// Measure est le middleware.
+func (m *RequestMetrics) Measure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := "autre"
+		if m.Routes != nil {
+			if _, pattern := m.Routes.Handler(r); pattern != "" {
+				route = pattern
+			}
+		}
+		metrics.ObserveRequest(route, r.Method, status, time.Since(start))
+	})
+}
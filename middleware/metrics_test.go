@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"forum/metrics"
+)
+
+func TestRequestMetricsUseRoutePattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /mesure/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "absent" {
+			http.NotFound(w, r)
+		}
+	})
+	m := &RequestMetrics{Routes: mux}
+	h := m.Measure(mux)
+	for _, path := range []string{"/mesure/1", "/mesure/2", "/mesure/absent", "/ailleurs"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler("", nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`forum_http_requests_total{method="GET",route="GET /mesure/{id}",status="200"} 2`,
+		`forum_http_requests_total{method="GET",route="GET /mesure/{id}",status="404"} 1`,
+		`forum_http_request_duration_seconds_count{method="GET",route="GET /mesure/{id}"} 3`,
+		// Sans route enregistrée, les requêtes sont regroupées.
+		`forum_http_requests_total{method="GET",route="autre",status="404"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("série %s absente", want)
+		}
+	}
+	if strings.Contains(body, `route="/mesure/1"`) || strings.Contains(body, `route="/ailleurs"`) {
+		t.Error("chemin brut utilisé comme étiquette")
+	}
+}
@@ -1,36 +1,161 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"forum/metrics"
+
 	"golang.org/x/time/rate"
 )
 
-var visitors = make(map[string]*rate.Limiter)
-var mu sync.Mutex
+// RateLimited explique le refus d'une requête au-delà de la limite de débit.
+const RateLimited = "Trop de requêtes, réessayez plus tard"
+
+// Policy fixe le débit autorisé (jetons par seconde) et la rafale tolérée.
+type Policy struct {
+	Name  string
+	Rate  rate.Limit
+	Burst int
+}
+
+// RoutePolicy associe une politique à un chemin et à ses sous-chemins.
+type RoutePolicy struct {
+	Prefix string
+	Policy Policy
+}
+
+// LimiterStore conserve l'état des compteurs. Allow consomme un jeton pour
+// key et, en cas de refus, indique le délai avant la prochaine requête admise.
+// L'implémentation mémoire suffit pour une instance ; un store partagé
+// (Redis…) peut la remplacer derrière plusieurs instances.
+type LimiterStore interface {
+	Allow(key string, p Policy, now time.Time) (bool, time.Duration)
+}
+
+// MemoryStore garde un token bucket par clé et oublie les clés inactives
+// depuis plus de idleTTL, ce qui borne la mémoire utilisée.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*limiterEntry
+	idleTTL   time.Duration
+	lastSweep time.Time
+}
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewMemoryStore crée un store en mémoire. idleTTL doit dépasser le temps de
+// remplissage complet des buckets, sinon un client bavard serait « oublié »
+// avant d'avoir récupéré ses jetons.
+func NewMemoryStore(idleTTL time.Duration) *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*limiterEntry), idleTTL: idleTTL}
+}
+
+func (s *MemoryStore) Allow(key string, p Policy, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= s.idleTTL {
+		s.evict(now)
+		s.lastSweep = now
+	}
+	e, ok := s.entries[key]
+	if !ok {
+		e = &limiterEntry{limiter: rate.NewLimiter(p.Rate, p.Burst)}
+		s.entries[key] = e
+	}
+	e.lastSeen = now
+
+	res := e.limiter.ReserveN(now, 1)
+	if !res.OK() {
+		return false, time.Minute
+	}
+	if delay := res.DelayFrom(now); delay > 0 {
+		res.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// Len renvoie le nombre de clés suivies.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func (s *MemoryStore) evict(now time.Time) {
+	for key, e := range s.entries {
+		if now.Sub(e.lastSeen) > s.idleTTL {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// RateLimiter applique la politique de la route la plus spécifique, par
+// utilisateur connecté ou, à défaut, par adresse IP du client.
+type RateLimiter struct {
+	Store   LimiterStore
+	Default Policy
+	Routes  []RoutePolicy
+	Now     func() time.Time // horloge ; time.Now si nil
+	// ByIP compte toutes les requêtes par adresse, même celles des
+	// utilisateurs connectés : le limiteur peut alors précéder Sessions et
+	// refuser un flot de requêtes avant qu'elles n'atteignent la base.
+	ByIP bool
+	// Reject répond aux requêtes refusées, Retry-After déjà posé ; sans
+	// lui, un texte brut 429.
+	Reject http.HandlerFunc
+}
 
-func getVisitor(ip string) *rate.Limiter {
-	mu.Lock()
-	defer mu.Unlock()
-	limiter, exists := visitors[ip]
-	if !exists {
-		limiter = rate.NewLimiter(rate.Every(time.Second), 5) // 1 req/sec, burst 5
-		visitors[ip] = limiter
+func (rl *RateLimiter) now() time.Time {
+	if rl.Now != nil {
+		return rl.Now()
+	}
+	return time.Now()
+}
+
+// policyFor renvoie la politique du préfixe le plus long correspondant au chemin.
+func (rl *RateLimiter) policyFor(path string) Policy {
+	best, bestLen := rl.Default, -1
+	for _, rp := range rl.Routes {
+		prefix := strings.TrimSuffix(rp.Prefix, "/")
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) > bestLen {
+			best, bestLen = rp.Policy, len(prefix)
+		}
 	}
-	return limiter
+	return best
 }
 
-// RateLimit applique un rate limit par IP sur toutes les requêtes
-func RateLimit(next http.Handler) http.Handler {
+// Limit est le middleware ; sauf avec ByIP, il doit être placé après Sessions
+// pour que les utilisateurs connectés soient comptés par compte et non par IP.
+func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		limiter := getVisitor(ip)
-		if !limiter.Allow() {
-			http.Error(w, "Trop de requêtes, réessayez plus tard", http.StatusTooManyRequests)
+		p := rl.policyFor(r.URL.Path)
+		key := "ip:" + ClientIP(r)
+		if s, ok := CurrentSession(r); ok && !rl.ByIP {
+			key = "user:" + strconv.Itoa(s.UserID)
+		}
+		if ok, wait := rl.Store.Allow(p.Name+"|"+key, p, rl.now()); !ok {
+			metrics.RateLimited(p.Name)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			rl.reject(w, r)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (rl *RateLimiter) reject(w http.ResponseWriter, r *http.Request) {
+	if rl.Reject != nil {
+		rl.Reject(w, r)
+		return
+	}
+	http.Error(w, RateLimited, http.StatusTooManyRequests)
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"forum/database"
+
+	"golang.org/x/time/rate"
+)
+
+func TestMemoryStoreEvictsIdleKeys(t *testing.T) {
+	s := NewMemoryStore(time.Minute)
+	p := Policy{Name: "test", Rate: rate.Every(time.Hour), Burst: 1}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.Allow("a", p, start)
+	s.Allow("b", p, start.Add(30*time.Second))
+	if n := s.Len(); n != 2 {
+		t.Fatalf("%d clé(s) suivie(s), attendu 2", n)
+	}
+	// Le balayage suivant oublie a, inactive depuis plus d'une minute, et
+	// garde b.
+	s.Allow("c", p, start.Add(61*time.Second))
+	if n := s.Len(); n != 2 {
+		t.Fatalf("après le balayage : %d clé(s), attendu 2", n)
+	}
+	if ok, _ := s.Allow("b", p, start.Add(61*time.Second)); ok {
+		t.Error("b oubliée : son bucket vide a été remplacé par un neuf")
+	}
+}
+
+func TestLimitSetsRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rl := &RateLimiter{
+		Store:   NewMemoryStore(time.Minute),
+		Default: Policy{Name: "test", Rate: rate.Every(10 * time.Second), Burst: 1},
+		Now:     func() time.Time { return now },
+	}
+	h := rl.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusOK {
+		t.Fatalf("première requête : statut %d", w.Code)
+	}
+	now = now.Add(2500 * time.Millisecond)
+	w := get()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "8" {
+		t.Fatalf("statut %d, Retry-After %q ; attendu %d et 8", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+}
+
+func TestLimitByIPIgnoresSession(t *testing.T) {
+	for _, byIP := range []bool{false, true} {
+		rl := &RateLimiter{Store: NewMemoryStore(time.Minute), Default: Policy{Name: "test", Rate: 1, Burst: 1}, ByIP: byIP}
+		h := rl.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		// Deux comptes derrière la même adresse.
+		codes := make([]int, 2)
+		for i := range codes {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, database.Session{UserID: i + 1}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			codes[i] = w.Code
+		}
+		want := http.StatusOK
+		if byIP {
+			want = http.StatusTooManyRequests
+		}
+		if codes[1] != want {
+			t.Errorf("ByIP=%v : second compte de la même adresse, statut %d, attendu %d", byIP, codes[1], want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"html"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// scriptNonce extrait le nonce d'une balise <script nonce="…"> rendue.
+var scriptNonce = regexp.MustCompile(`<script nonce="([^"]+)">`)
+
+func TestSecureNoncePerRequest(t *testing.T) {
+	page := template.Must(template.New("page").Parse(`<script nonce="{{ . }}">ok()</script>`))
+	h := DefaultSecurityHeaders().Secure(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page.Execute(w, CSPNonce(r))
+	}))
+
+	seen := map[string]bool{}
+	for range 3 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		m := scriptNonce.FindStringSubmatch(w.Body.String())
+		if m == nil || m[1] == "" {
+			t.Fatalf("pas de nonce dans la page : %s", w.Body.String())
+		}
+		// Le navigateur décode les entités de l'attribut (« + » devient &#43;).
+		nonce := html.UnescapeString(m[1])
+		csp := w.Header().Get("Content-Security-Policy")
+		if !strings.Contains(csp, "'nonce-"+nonce+"'") || strings.Contains(csp, "{nonce}") {
+			t.Fatalf("CSP %q ne porte pas le nonce de la page %q", csp, nonce)
+		}
+		if seen[nonce] {
+			t.Fatalf("nonce %q réutilisé", nonce)
+		}
+		seen[nonce] = true
+	}
+}
+
+func TestSecureReportOnly(t *testing.T) {
+	s := DefaultSecurityHeaders()
+	s.CSPReportOnly = true
+	w := httptest.NewRecorder()
+	s.Secure(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Header().Get("Content-Security-Policy") != "" {
+		t.Error("politique appliquée en mode rapport seul")
+	}
+	if csp := w.Header().Get("Content-Security-Policy-Report-Only"); !strings.Contains(csp, "report-uri "+CSPReportPath) {
+		t.Errorf("Content-Security-Policy-Report-Only %q", csp)
+	}
+	if w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Errorf("X-Frame-Options %q", w.Header().Get("X-Frame-Options"))
+	}
+}
+
+func TestSecureHSTSOnlyOverTLS(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := proxies.Resolve(DefaultSecurityHeaders().Secure(http.NotFoundHandler()))
+
+	tests := []struct {
+		name  string
+		tls   bool
+		proxy string
+		proto string
+		want  bool
+	}{
+		{"HTTP", false, "203.0.113.7:1234", "", false},
+		{"TLS direct", true, "203.0.113.7:1234", "", true},
+		{"TLS terminé par un proxy de confiance", false, "10.0.0.1:1234", "https", true},
+		{"X-Forwarded-Proto d'un client non fiable", false, "203.0.113.7:1234", "https", false},
+		{"proxy de confiance en HTTP", false, "10.0.0.1:1234", "http", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.proxy
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Header().Get("Strict-Transport-Security") != ""; got != tt.want {
+				t.Errorf("HSTS envoyé : %v, attendu %v", got, tt.want)
+			}
+		})
+	}
+}
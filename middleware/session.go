@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"forum/database"
+	"forum/logging"
+)
+
+// SessionCookie est le nom du cookie portant l'identifiant de session serveur.
+const SessionCookie = "session_id"
+
+// sessionTouchInterval limite les écritures en base : une session n'est
+// prolongée qu'une fois par minute au plus.
+const sessionTouchInterval = time.Minute
+
+type sessionKey struct{}
+
+// Sessions charge la session serveur correspondant au cookie depuis Store, la
+// fait glisser (last_seen_at, expires_at) et la place dans le contexte de la
+// requête. Les sessions ouvertes avant l'introduction du jeton CSRF en
+// reçoivent un au passage.
+type Sessions struct {
+	Store  database.SessionStore
+	Policy database.SessionPolicy // durée de vie des sessions prolongées
+	Now    func() time.Time       // horloge ; time.Now si nil
+}
+
+func (m Sessions) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// Load enveloppe next avec le chargement de la session.
+func (m Sessions) Load(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(SessionCookie)
+		if err != nil || c.Value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		now := m.now()
+		s, err := m.Store.Get(ctx, c.Value, now)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if now.Sub(s.LastSeenAt) >= sessionTouchInterval {
+			s.LastSeenAt = now
+			s.ExpiresAt = m.Policy.Expiry(now, s.Remember)
+			s.UserAgent = r.UserAgent()
+			s.IP = ClientIP(r)
+			if err := m.Store.Touch(ctx, s.ID, s.UserAgent, s.IP, s.LastSeenAt, s.ExpiresAt); err == nil {
+				SetSessionCookie(w, s)
+			}
+		}
+		if s.CSRFToken == "" {
+			token := NewCSRFToken()
+			if err := m.Store.SetCSRFToken(ctx, s.ID, token); err == nil {
+				s.CSRFToken = token
+			}
+		}
+		logging.SetUserID(ctx, s.UserID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, sessionKey{}, s)))
+	})
+}
+
+// CurrentSession renvoie la session valide attachée à la requête, s'il y en a une.
+func CurrentSession(r *http.Request) (database.Session, bool) {
+	s, ok := r.Context().Value(sessionKey{}).(database.Session)
+	return s, ok
+}
+
+// SetSessionCookie pose le cookie de session. Sans « Se souvenir de moi », le
+// cookie disparaît à la fermeture du navigateur.
+func SetSessionCookie(w http.ResponseWriter, s database.Session) {
+	c := &http.Cookie{
+		Name:     SessionCookie,
+		Value:    s.ID,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if s.Remember {
+		c.Expires = s.ExpiresAt
+	}
+	http.SetCookie(w, c)
+}
+
+// ClearSessionCookie efface le cookie de session du navigateur.
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+}
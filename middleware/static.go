@@ -1,48 +1,126 @@
 package middleware
 
 import (
-	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"net/http"
+	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
-// GzipAndCacheMiddleware active la compression GZIP et le cache navigateur.
-func GzipAndCacheMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Gestion du cache pour les fichiers statiques (images, css, js)
-		if strings.HasPrefix(r.URL.Path, "/static/") {
-			ext := filepath.Ext(r.URL.Path)
-			switch ext {
-			case ".css", ".js", ".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg":
-				w.Header().Set("Cache-Control", "public, max-age=86400") // 1 jour
-			}
-		}
+// StaticAssets sert le dossier ./static et fournit aux templates les URLs
+// versionnées des fichiers (fonction de template asset).
+var StaticAssets = NewAssets("static")
 
-		// Vérifie si le client accepte gzip
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			next.ServeHTTP(w, r)
-			return
-		}
+// fingerprintPattern reconnaît « nom.<empreinte>.ext » dans une URL versionnée.
+var fingerprintPattern = regexp.MustCompile(`^(.+)\.([0-9a-f]{8})(\.[A-Za-z0-9]+)$`)
+
+// Assets sert des fichiers statiques avec ETag et Last-Modified. Les URLs
+// versionnées (empreinte du contenu dans le nom) sont mises en cache un an
+// comme immuables ; les autres une journée, puis revalidées par ETag.
+type Assets struct {
+	root string
+
+	mu     sync.Mutex
+	hashes map[string]assetHash
+}
+
+type assetHash struct {
+	modTime time.Time
+	size    int64
+	sum     string
+}
 
-		// On prépare la réponse compressée
-		w.Header().Set("Content-Encoding", "gzip")
-		w.Header().Set("Vary", "Accept-Encoding")
+// NewAssets crée un serveur de fichiers statiques pour le dossier root.
+func NewAssets(root string) *Assets {
+	return &Assets{root: root, hashes: make(map[string]assetHash)}
+}
 
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
+// URL renvoie l'URL versionnée de name (ex. "css/main.css" devient
+// "/static/css/main.1a2b3c4d.css"), ou l'URL simple si le fichier est absent.
+func (a *Assets) URL(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	sum, err := a.hash(name)
+	if err != nil {
+		return "/static/" + name
+	}
+	ext := path.Ext(name)
+	return "/static/" + strings.TrimSuffix(name, ext) + "." + sum[:8] + ext
+}
 
-		gw := gzipResponseWriter{Writer: gz, ResponseWriter: w}
-		next.ServeHTTP(gw, r)
-	})
+// hash renvoie l'empreinte SHA-256 du fichier, recalculée s'il a changé.
+func (a *Assets) hash(name string) (string, error) {
+	p := filepath.Join(a.root, filepath.FromSlash(name))
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	h, ok := a.hashes[name]
+	a.mu.Unlock()
+	if ok && h.modTime.Equal(info.ModTime()) && h.size == info.Size() {
+		return h.sum, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := sha256.New()
+	if _, err := io.Copy(s, f); err != nil {
+		return "", err
+	}
+	h = assetHash{modTime: info.ModTime(), size: info.Size(), sum: hex.EncodeToString(s.Sum(nil))}
+	a.mu.Lock()
+	a.hashes[name] = h
+	a.mu.Unlock()
+	return h.sum, nil
 }
 
-type gzipResponseWriter struct {
-	io.Writer
-	http.ResponseWriter
+// ServeHTTP sert le fichier demandé ; à monter avec http.StripPrefix("/static/", …).
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	immutable := false
+	if m := fingerprintPattern.FindStringSubmatch(name); m != nil && !a.exists(name) {
+		name = m[1] + m[3]
+		if sum, err := a.hash(name); err == nil && sum[:8] == m[2] {
+			immutable = true
+		}
+	}
+
+	f, err := os.Open(filepath.Join(a.root, filepath.FromSlash(name)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	sum, err := a.hash(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+sum[:16]+`"`)
+	if immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
 }
 
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+func (a *Assets) exists(name string) bool {
+	info, err := os.Stat(filepath.Join(a.root, filepath.FromSlash(name)))
+	return err == nil && !info.IsDir()
 }
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestAssets sert un dossier contenant css/main.css.
+func newTestAssets(t *testing.T) *Assets {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "css"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "css", "main.css"), []byte("body { color: red; }"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return NewAssets(root)
+}
+
+func serveAsset(a *Assets, path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	http.StripPrefix("/static/", a).ServeHTTP(w, r)
+	return w
+}
+
+func TestAssetsETagRevalidation(t *testing.T) {
+	a := newTestAssets(t)
+	w := serveAsset(a, "/static/css/main.css", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("statut %d, ETag %q", w.Code, etag)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+		t.Errorf("URL simple : Cache-Control %q", cc)
+	}
+
+	w = serveAsset(a, "/static/css/main.css", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("revalidation : statut %d, %d octet(s) ; attendu %d sans corps", w.Code, w.Body.Len(), http.StatusNotModified)
+	}
+	w = serveAsset(a, "/static/css/main.css", http.Header{"If-None-Match": {`"autre"`}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("ETag périmé : statut %d, attendu %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAssetsFingerprintedURL(t *testing.T) {
+	a := newTestAssets(t)
+	url := a.URL("css/main.css")
+	if !fingerprintPattern.MatchString(strings.TrimPrefix(url, "/static/")) {
+		t.Fatalf("URL %q non versionnée", url)
+	}
+	if got := a.URL("css/absent.css"); got != "/static/css/absent.css" {
+		t.Errorf("fichier absent : URL %q", got)
+	}
+
+	w := serveAsset(a, url, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "body { color: red; }" {
+		t.Fatalf("URL versionnée : statut %d, corps %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Errorf("URL versionnée : Cache-Control %q", cc)
+	}
+
+	// Une empreinte périmée sert le fichier actuel sans le déclarer immuable.
+	w = serveAsset(a, "/static/css/main.00000000.css", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "public, max-age=86400" {
+		t.Errorf("empreinte périmée : statut %d, Cache-Control %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestAssetsRejectsDirectoriesAndTraversal(t *testing.T) {
+	a := newTestAssets(t)
+	for _, path := range []string{"/static/css", "/static/../static_test.go", "/static/absent.css"} {
+		if w := serveAsset(a, path, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s : statut %d, attendu %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package seed
+
+// Listes dont sont tirés les comptes, catégories et contenus générés.
+var (
+	firstNames = []string{
+		"camille", "lucas", "lea", "hugo", "chloe", "louis", "manon", "gabriel",
+		"ines", "arthur", "jade", "nathan", "sarah", "tom", "emma", "jules",
+		"alice", "noah", "lina", "adam", "zoe", "theo", "rose", "sacha",
+	}
+	lastNames = []string{
+		"martin", "bernard", "dubois", "thomas", "robert", "richard", "petit",
+		"durand", "leroy", "moreau", "simon", "laurent", "lefebvre", "michel",
+		"garcia", "david", "bertrand", "roux", "vincent", "fournier",
+	}
+	categoryNames = []string{
+		"Science-fiction", "Horreur", "Comédie", "Drame", "Animation", "Thriller",
+		"Documentaire", "Séries", "Policier", "Fantastique", "Western", "Romance",
+	}
+	films = []string{
+		"Dune", "Inception", "Parasite", "Interstellar", "Alien", "Matrix",
+		"Le Voyage de Chihiro", "Les Intouchables", "Amélie Poulain", "Blade Runner",
+		"Le Parrain", "Pulp Fiction", "La Haine", "Mad Max: Fury Road", "Her",
+		"Drive", "Shining", "Whiplash", "Arrival", "Titanic", "Oppenheimer",
+		"Le Seigneur des anneaux", "Breaking Bad", "Dark", "Twin Peaks",
+	}
+	titleTemplates = []string{
+		"Votre avis sur %s ?",
+		"Théorie : la fin de %s expliquée",
+		"%s : chef-d'œuvre ou surcoté ?",
+		"Les meilleures scènes de %s",
+		"Revu %s hier soir",
+		"%s mérite-t-il sa réputation ?",
+		"Ce détail de %s que personne n'a remarqué",
+		"Par où commencer après %s ?",
+	}
+	sentences = []string{
+		"La mise en scène m'a scotché du début à la fin.",
+		"Je ne m'attendais pas du tout à ce retournement.",
+		"La bande originale fait la moitié du travail.",
+		"Certains personnages secondaires sont sous-exploités.",
+		"La photographie est sublime, chaque plan pourrait être un tableau.",
+		"Le rythme s'essouffle un peu dans le deuxième acte.",
+		"Je l'ai vu trois fois et je découvre encore des détails.",
+		"La fin reste ouverte, et c'est tant mieux.",
+		"Le casting est irréprochable.",
+		"Honnêtement, je n'ai pas compris l'engouement.",
+		"Les effets spéciaux ont étonnamment bien vieilli.",
+		"Le scénario tient en deux lignes mais l'exécution est parfaite.",
+		"À voir absolument en version originale.",
+		"Le livre allait beaucoup plus loin sur ce point.",
+	}
+	replies = []string{
+		"Entièrement d'accord !",
+		"Pas du tout mon ressenti, je l'ai trouvé long.",
+		"Merci, je n'avais jamais vu ça sous cet angle.",
+		"Tu as oublié la scène du début, la meilleure selon moi.",
+		"Je le regarde ce week-end, je reviens donner mon avis.",
+		"Spoiler alert quand même…",
+		"Le réalisateur en parle dans une interview, c'est voulu.",
+		"Meilleur film de la décennie, point.",
+		"Je préfère largement le précédent.",
+		"Quelqu'un sait s'il existe une version longue ?",
+	}
+)
@@ -0,0 +1,57 @@
+package seed
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"os"
+)
+
+// Dimensions des images générées, au format des affiches paysage.
+const (
+	imageWidth  = 640
+	imageHeight = 360
+)
+
+// writeImage écrit dans path un PNG en dégradé entre deux couleurs tirées de
+// rng, barré d'une bande plus claire : une illustration légère mais
+// distincte pour chaque post.
+func writeImage(rng *rand.Rand, path string) error {
+	from := randomColor(rng)
+	to := randomColor(rng)
+	band := rng.IntN(imageHeight)
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	for y := range imageHeight {
+		for x := range imageWidth {
+			t := float64(x+y) / float64(imageWidth+imageHeight)
+			c := color.RGBA{
+				R: mix(from.R, to.R, t),
+				G: mix(from.G, to.G, t),
+				B: mix(from.B, to.B, t),
+				A: 255,
+			}
+			if d := y - band; d > -12 && d < 12 {
+				c.R, c.G, c.B = c.R/2+127, c.G/2+127, c.B/2+127
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func randomColor(rng *rand.Rand) color.RGBA {
+	return color.RGBA{R: uint8(rng.IntN(256)), G: uint8(rng.IntN(256)), B: uint8(rng.IntN(256)), A: 255}
+}
+
+func mix(a, b uint8, t float64) uint8 {
+	return uint8(float64(a)*(1-t) + float64(b)*t)
+}
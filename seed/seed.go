@@ -0,0 +1,439 @@
+// Package seed génère des données de démonstration : comptes, catégories,
+// posts illustrés, fils de commentaires, votes et notifications. Les données
+// découlent d'une graine : la même graine donne le même forum sur une base
+// vide, ce qui permet de s'en servir dans les tests comme en local
+// (« forum seed-demo-data »).
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/database"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Options règle le volume et la forme des données générées.
+type Options struct {
+	Seed       uint64
+	Users      int
+	Categories int
+	Posts      int
+	// Comments et Votes bornent le nombre de commentaires et de votes de
+	// chaque post publié ; le nombre exact est tiré au sort.
+	Comments int
+	Votes    int
+	// Pending est la part des posts d'utilisateurs laissés en attente de
+	// modération, Images celle des posts illustrés.
+	Pending float64
+	Images  float64
+	// ImageDir reçoit les images des posts (handler.UploadDir) ; vide, les
+	// posts n'ont pas d'image.
+	ImageDir string
+	// Password est le mot de passe commun des comptes générés.
+	Password string
+	// Les posts s'étalent sur Span jusqu'à Now (zéro : l'instant présent).
+	Now  time.Time
+	Span time.Duration
+}
+
+// Defaults renvoie un forum de taille moyenne, suffisant pour parcourir
+// plusieurs pages et la file de modération.
+func Defaults() Options {
+	return Options{
+		Seed:       1,
+		Users:      20,
+		Categories: 6,
+		Posts:      60,
+		Comments:   6,
+		Votes:      8,
+		Pending:    0.1,
+		Images:     0.3,
+		Password:   "demo",
+		Span:       90 * 24 * time.Hour,
+	}
+}
+
+// Result compte ce qui a été créé.
+type Result struct {
+	Users         int
+	Categories    int
+	Posts         int
+	Pending       int
+	Images        int
+	Comments      int
+	Votes         int
+	Notifications int
+}
+
+func (o Options) validate() error {
+	var errs []error
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"users", o.Users}, {"categories", o.Categories}, {"posts", o.Posts},
+		{"comments", o.Comments}, {"votes", o.Votes},
+	} {
+		if v.value < 0 {
+			errs = append(errs, fmt.Errorf("%s ne peut pas être négatif", v.name))
+		}
+	}
+	if o.Categories > len(categoryNames) {
+		errs = append(errs, fmt.Errorf("categories : au plus %d", len(categoryNames)))
+	}
+	if o.Posts > 0 && o.Users == 0 {
+		errs = append(errs, errors.New("des posts demandent au moins un utilisateur"))
+	}
+	if o.Pending < 0 || o.Pending > 1 || o.Images < 0 || o.Images > 1 {
+		errs = append(errs, errors.New("pending et images sont des proportions entre 0 et 1"))
+	}
+	if o.Users > 0 && o.Password == "" {
+		errs = append(errs, errors.New("password ne peut pas être vide"))
+	}
+	if o.Span < 0 {
+		errs = append(errs, errors.New("span ne peut pas être négatif"))
+	}
+	return errors.Join(errs...)
+}
+
+// Generate crée les données dans une seule transaction : en cas d'erreur,
+// la base est inchangée et les images écrites sont supprimées. Sur une base
+// qui contient déjà des comptes, les noms pris reçoivent un suffixe.
+func Generate(ctx context.Context, stores database.Stores, opts Options) (Result, error) {
+	if err := opts.validate(); err != nil {
+		return Result{}, err
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	g := &generator{
+		ctx:  ctx,
+		opts: opts,
+		rng:  rand.New(rand.NewPCG(opts.Seed, 0)),
+		used: map[string]bool{},
+	}
+	if opts.Users > 0 {
+		// Un seul hachage pour tous les comptes : bcrypt est lent à dessein.
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return Result{}, err
+		}
+		g.hash = string(hash)
+	}
+	if opts.ImageDir != "" && opts.Posts > 0 && opts.Images > 0 {
+		if err := os.MkdirAll(opts.ImageDir, 0o755); err != nil {
+			return Result{}, err
+		}
+	}
+	err := stores.InTx(ctx, func(tx database.Stores) error {
+		g.tx = tx
+		return g.run()
+	})
+	if err != nil {
+		for _, path := range g.written {
+			os.Remove(path)
+		}
+		return Result{}, err
+	}
+	return g.result, nil
+}
+
+// author est un compte généré, auteur possible de posts et de commentaires.
+type author struct {
+	id    int
+	staff bool
+}
+
+type generator struct {
+	ctx     context.Context
+	opts    Options
+	rng     *rand.Rand
+	tx      database.Stores
+	hash    string
+	used    map[string]bool // noms attribués pendant cette génération
+	written []string        // images créées, supprimées en cas d'échec
+
+	users      []author
+	categories []int
+	result     Result
+}
+
+func (g *generator) run() error {
+	if err := g.createUsers(); err != nil {
+		return fmt.Errorf("comptes : %w", err)
+	}
+	if err := g.createCategories(); err != nil {
+		return fmt.Errorf("catégories : %w", err)
+	}
+	staff, err := g.tx.Users.ListStaff(g.ctx)
+	if err != nil {
+		return err
+	}
+	start := g.opts.Now.Add(-g.opts.Span)
+	for i := range g.opts.Posts {
+		// Les posts se suivent dans le temps, avec un peu de désordre.
+		at := start.Add(time.Duration((float64(i) + g.rng.Float64()) / float64(g.opts.Posts) * float64(g.opts.Span)))
+		if err := g.createPost(i, at, staff); err != nil {
+			return fmt.Errorf("post %d : %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// createUsers crée les comptes, inscrits dans le mois qui précède le premier
+// post ; un sur dix est modérateur.
+func (g *generator) createUsers() error {
+	joined := g.opts.Now.Add(-g.opts.Span)
+	for i := range g.opts.Users {
+		name := g.pick(firstNames) + "." + g.pick(lastNames)
+		username, err := g.freeUsername(name)
+		if err != nil {
+			return err
+		}
+		id, err := g.tx.Users.Create(g.ctx, username, username+"@example.com", g.hash)
+		if err != nil {
+			return err
+		}
+		role := "user"
+		if i < g.opts.Users/10 {
+			role = "moderator"
+		}
+		if err := g.tx.Users.SetRole(g.ctx, 0, id, role); err != nil {
+			return err
+		}
+		at := joined.Add(-time.Duration(g.rng.Float64() * float64(30*24*time.Hour)))
+		if err := g.tx.Backdate(g.ctx, "users", id, at); err != nil {
+			return err
+		}
+		g.users = append(g.users, author{id: id, staff: role != "user"})
+		g.result.Users++
+	}
+	return nil
+}
+
+// freeUsername renvoie name, suivi d'un numéro s'il est déjà pris.
+func (g *generator) freeUsername(name string) (string, error) {
+	for n := 1; ; n++ {
+		candidate := name
+		if n > 1 {
+			candidate += strconv.Itoa(n)
+		}
+		if g.used[candidate] {
+			continue
+		}
+		_, err := g.tx.Users.GetByUsername(g.ctx, candidate)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+		g.used[candidate] = true
+		return candidate, nil
+	}
+}
+
+func (g *generator) createCategories() error {
+	for _, i := range g.rng.Perm(len(categoryNames))[:g.opts.Categories] {
+		id, err := g.tx.Categories.Ensure(g.ctx, categoryNames[i])
+		if err != nil {
+			return err
+		}
+		g.categories = append(g.categories, id)
+		g.result.Categories++
+	}
+	return nil
+}
+
+// createPost crée le post n° i comme le ferait le forum : publié d'emblée
+// pour le staff, sinon soumis à la modération (et approuvé pour la plupart),
+// avec les notifications correspondantes. Seuls les posts publiés reçoivent
+// commentaires et votes.
+func (g *generator) createPost(i int, at time.Time, staff []database.User) error {
+	a := g.users[g.rng.IntN(len(g.users))]
+	title := fmt.Sprintf(g.pick(titleTemplates), g.pick(films))
+	content := g.paragraph(2, 5)
+	pending := !a.staff && g.rng.Float64() < g.opts.Pending
+	illustrated := g.rng.Float64() < g.opts.Images
+
+	imagePath := ""
+	if illustrated && g.opts.ImageDir != "" {
+		var err error
+		if imagePath, err = g.image(i); err != nil {
+			return err
+		}
+	}
+	id, err := g.tx.Posts.Create(g.ctx, a.id, title, content, imagePath, !pending)
+	if err != nil {
+		return err
+	}
+	if err := g.tx.Backdate(g.ctx, "posts", id, at); err != nil {
+		return err
+	}
+	g.result.Posts++
+	for _, c := range g.pickCategories() {
+		if err := g.tx.Categories.AddPost(g.ctx, id, c); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case a.staff:
+		err = g.notify(a.id, fmt.Sprintf("Votre post \"%s\" a bien été publié.", title), id, 0)
+	case pending:
+		g.result.Pending++
+		err = g.notify(a.id, fmt.Sprintf("Votre post \"%s\" a été soumis à vérification.", title), id, 0)
+		for _, mod := range staff {
+			if err == nil {
+				err = g.notify(mod.ID, fmt.Sprintf("Nouveau post \"%s\" en attente de vérification.", title), id, 0)
+			}
+		}
+		return err
+	default:
+		err = g.notify(a.id, fmt.Sprintf("Votre post \"%s\" a été approuvé.", title), id, 0)
+	}
+	if err != nil {
+		return err
+	}
+	if err := g.comment(id, a.id, at); err != nil {
+		return err
+	}
+	return g.votePost(id, a.id)
+}
+
+// comment ajoute au post un fil de commentaires, postérieurs au post.
+func (g *generator) comment(postID, authorID int, postedAt time.Time) error {
+	n := g.rng.IntN(g.opts.Comments + 1)
+	offsets := make([]time.Duration, n)
+	for j := range offsets {
+		offsets[j] = time.Duration(g.rng.Float64() * float64(g.opts.Now.Sub(postedAt)))
+	}
+	slices.Sort(offsets)
+	for _, offset := range offsets {
+		commenter := g.users[g.rng.IntN(len(g.users))]
+		content := g.pick(replies)
+		if g.rng.IntN(3) == 0 {
+			content += " " + g.pick(sentences)
+		}
+		id, err := g.tx.Comments.Create(g.ctx, postID, commenter.id, content)
+		if err != nil {
+			return err
+		}
+		if err := g.tx.Backdate(g.ctx, "comments", id, postedAt.Add(offset)); err != nil {
+			return err
+		}
+		g.result.Comments++
+		if commenter.id != authorID {
+			if err := g.notify(authorID, "Quelqu'un a commenté votre post.", postID, 0); err != nil {
+				return err
+			}
+		}
+		for _, voter := range g.voters(2) {
+			value, what := g.vote()
+			if err := g.tx.Comments.SetVote(g.ctx, voter, id, value); err != nil {
+				return err
+			}
+			g.result.Votes++
+			if voter != commenter.id {
+				if err := g.notify(commenter.id, "Quelqu'un a "+what+" votre commentaire", postID, id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (g *generator) votePost(postID, authorID int) error {
+	for _, voter := range g.voters(g.opts.Votes) {
+		value, what := g.vote()
+		if err := g.tx.Posts.SetVote(g.ctx, voter, postID, value); err != nil {
+			return err
+		}
+		g.result.Votes++
+		if voter != authorID {
+			if err := g.notify(authorID, "Quelqu'un a "+what+" votre post", postID, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// voters tire au plus limit votants distincts.
+func (g *generator) voters(limit int) []int {
+	n := min(g.rng.IntN(limit+1), len(g.users))
+	ids := make([]int, n)
+	for j, k := range g.rng.Perm(len(g.users))[:n] {
+		ids[j] = g.users[k].id
+	}
+	return ids
+}
+
+// vote tire un like (quatre fois sur cinq) ou un dislike, avec le verbe de
+// la notification.
+func (g *generator) vote() (int, string) {
+	if g.rng.IntN(5) == 0 {
+		return -1, "disliké"
+	}
+	return 1, "liké"
+}
+
+func (g *generator) notify(userID int, message string, postID, commentID int) error {
+	g.result.Notifications++
+	return g.tx.Notifications.Create(g.ctx, userID, message, postID, commentID)
+}
+
+// image écrit l'illustration du post n° i et renvoie son chemin. Son
+// générateur est dérivé de la graine et du numéro du post : une image déjà
+// présente (même graine) est réutilisée sans décaler les tirages suivants.
+func (g *generator) image(i int) (string, error) {
+	path := filepath.Join(g.opts.ImageDir, fmt.Sprintf("seed-%d-%d.png", g.opts.Seed, i+1))
+	if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+		return path, nil
+	}
+	if err := writeImage(rand.New(rand.NewPCG(g.opts.Seed, uint64(i)+1)), path); err != nil {
+		return "", err
+	}
+	g.written = append(g.written, path)
+	g.result.Images++
+	return path, nil
+}
+
+// pickCategories tire une ou deux catégories distinctes.
+func (g *generator) pickCategories() []int {
+	if len(g.categories) == 0 {
+		return nil
+	}
+	n := min(1+g.rng.IntN(2), len(g.categories))
+	picked := make([]int, n)
+	for j, k := range g.rng.Perm(len(g.categories))[:n] {
+		picked[j] = g.categories[k]
+	}
+	return picked
+}
+
+// paragraph assemble entre lo et hi phrases distinctes.
+func (g *generator) paragraph(lo, hi int) string {
+	n := lo + g.rng.IntN(hi-lo+1)
+	parts := make([]string, n)
+	for j, k := range g.rng.Perm(len(sentences))[:n] {
+		parts[j] = sentences[k]
+	}
+	return strings.Join(parts, " ")
+}
+
+func (g *generator) pick(list []string) string {
+	return list[g.rng.IntN(len(list))]
+}
@@ -0,0 +1,157 @@
+package seed
+
+import (
+	"context"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+)
+
+// snapshot résume les données visibles d'une base générée.
+func snapshot(t *testing.T, stores database.Stores) []string {
+	t.Helper()
+	ctx := context.Background()
+	users, _ := stores.Users.List(ctx)
+	posts, err := stores.Posts.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, u := range users {
+		lines = append(lines, u.Username+" "+u.Role+" "+u.CreatedAt.Format(time.DateTime))
+	}
+	for _, p := range posts {
+		lines = append(lines, p.Username+" "+p.Title+" "+p.ImagePath+" "+p.CreatedAt.Format(time.DateTime))
+		comments, _ := stores.Comments.ListByPost(ctx, p.ID)
+		for _, c := range comments {
+			lines = append(lines, "  "+c.Content)
+		}
+	}
+	return lines
+}
+
+func small(seed uint64, images string) Options {
+	opts := Defaults()
+	opts.Seed = seed
+	opts.Users, opts.Posts = 8, 15
+	opts.Images = 0.5
+	opts.ImageDir = images
+	opts.Now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	return opts
+}
+
+func TestGenerateIsReproducible(t *testing.T) {
+	ctx := context.Background()
+	images := t.TempDir()
+	stores := dbtest.New(t)
+	first, err := Generate(ctx, stores, small(42, images))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := snapshot(t, stores)
+
+	stores = dbtest.New(t)
+	second, err := Generate(ctx, stores, small(42, images))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := snapshot(t, stores)
+	if len(a) != len(b) {
+		t.Fatalf("%d lignes puis %d avec la même graine", len(a), len(b))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("ligne %d : %q puis %q avec la même graine", i, a[i], b[i])
+		}
+	}
+	// Les images de la première génération sont réutilisées.
+	if second.Images != 0 || first.Images == 0 {
+		t.Errorf("images écrites : %d puis %d", first.Images, second.Images)
+	}
+
+	stores = dbtest.New(t)
+	if _, err := Generate(ctx, stores, small(7, t.TempDir())); err != nil {
+		t.Fatal(err)
+	}
+	if c := snapshot(t, stores); len(c) == len(a) && c[0] == a[0] && c[len(c)-1] == a[len(a)-1] {
+		t.Error("une autre graine donne les mêmes données")
+	}
+}
+
+func TestGenerateVolumes(t *testing.T) {
+	ctx := context.Background()
+	stores := dbtest.New(t)
+	stores.Users.Create(ctx, "camille.martin", "camille@example.com", "x")
+	images := t.TempDir()
+	opts := small(3, images)
+	opts.Users, opts.Posts, opts.Categories = 20, 30, 4
+	opts.Pending, opts.Images = 0.5, 1
+
+	res, err := Generate(ctx, stores, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Users != 20 || res.Posts != 30 || res.Categories != 4 || res.Pending == 0 || res.Comments == 0 || res.Votes == 0 || res.Notifications == 0 {
+		t.Fatalf("Result = %+v", res)
+	}
+	users, _ := stores.Users.List(ctx)
+	staff, _ := stores.Users.ListStaff(ctx)
+	if len(users) != 21 || len(staff) != 2 {
+		t.Errorf("%d comptes dont %d modérateurs, attendu 21 dont 2", len(users), len(staff))
+	}
+	posts, _ := stores.Posts.List(ctx)
+	pending, _ := stores.Posts.CountPending(ctx)
+	if len(posts)+pending != 30 || pending != res.Pending {
+		t.Errorf("%d publiés et %d en attente, Result = %+v", len(posts), pending, res)
+	}
+	for _, p := range posts {
+		if p.CreatedAt.Before(opts.Now.Add(-opts.Span)) || p.CreatedAt.After(opts.Now) {
+			t.Errorf("post du %v hors de la période", p.CreatedAt)
+		}
+		if categories, _ := stores.Categories.ListByPost(ctx, p.ID); len(categories) == 0 || len(categories) > 2 {
+			t.Errorf("post %d : %d catégorie(s)", p.ID, len(categories))
+		}
+		f, err := os.Open(p.ImagePath)
+		if err != nil {
+			t.Fatalf("image du post %d : %v", p.ID, err)
+		}
+		if _, err := png.Decode(f); err != nil {
+			t.Errorf("%s : %v", p.ImagePath, err)
+		}
+		f.Close()
+	}
+	if entries, _ := os.ReadDir(images); len(entries) != res.Images || res.Images != 30 {
+		t.Errorf("%d fichier(s) pour %d image(s)", len(entries), res.Images)
+	}
+}
+
+func TestGenerateRollsBackOnError(t *testing.T) {
+	ctx := context.Background()
+	stores := dbtest.New(t)
+	images := filepath.Join(t.TempDir(), "uploads")
+	opts := small(5, images)
+	opts.Images = 1
+	opts.Categories = len(categoryNames) + 1
+	if _, err := Generate(ctx, stores, opts); err == nil {
+		t.Fatal("options invalides acceptées")
+	}
+
+	// Un nom de fichier occupé par un répertoire fait échouer l'écriture
+	// d'une image au milieu de la génération.
+	opts.Categories = 2
+	os.MkdirAll(filepath.Join(images, "seed-5-3.png"), 0o755)
+	if _, err := Generate(ctx, stores, opts); err == nil {
+		t.Fatal("génération réussie malgré l'image impossible à écrire")
+	}
+	if users, _ := stores.Users.List(ctx); len(users) != 0 {
+		t.Errorf("%d compte(s) conservé(s) après l'échec", len(users))
+	}
+	if entries, _ := os.ReadDir(images); len(entries) != 1 {
+		t.Errorf("%d entrée(s) dans le répertoire d'images, attendu le seul répertoire piège", len(entries))
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"forum/backup"
+	"forum/config"
+	"forum/database"
+	"forum/handler"
+)
+
+// startBackups écrit une sauvegarde toutes les c.Interval et ne garde que les
+// c.Keep plus récentes, datées par now. La première attend un intervalle
+// complet : un redémarrage ne déclenche pas de sauvegarde. La fonction
+// renvoyée arrête la planification et attend la fin de la sauvegarde en cours.
+func startBackups(stores database.Stores, c config.Backup, now func() time.Time) (stop func()) {
+	if c.Interval.Duration == 0 {
+		slog.Info("sauvegardes planifiées désactivées (BACKUP_INTERVAL)")
+		return func() {}
+	}
+	if stores.Backend() != database.SQLite {
+		slog.Warn("sauvegardes planifiées indisponibles avec PostgreSQL, utiliser pg_dump")
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(c.Interval.Duration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			path, err := backup.Snapshot(context.Background(), stores, c.Dir, handler.UploadDir, now())
+			if err != nil {
+				slog.Error("sauvegarde planifiée", "err", err)
+				continue
+			}
+			slog.Info("sauvegarde écrite", "path", path)
+			removed, err := backup.Prune(c.Dir, c.Keep)
+			if err != nil {
+				slog.Error("suppression des anciennes sauvegardes", "err", err)
+			} else if len(removed) > 0 {
+				slog.Info("anciennes sauvegardes supprimées", "count", len(removed))
+			}
+		}
+	}()
+	slog.Info("sauvegardes planifiées", "dir", c.Dir, "interval", c.Interval.Duration, "keep", c.Keep)
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// BackupDatabase implémente « forum backup [-o archive] » : une sauvegarde à
+// chaud de la base configurée et des images, possible pendant que le forum
+// tourne, écrite par défaut dans le répertoire des sauvegardes planifiées.
+func BackupDatabase(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := fs.String("o", "", "archive à écrire (par défaut, une archive datée dans backup.dir)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := commandConfig()
+	if err != nil {
+		return err
+	}
+	stores, err := openDatabase(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	ctx := context.Background()
+	path := *output
+	if path == "" {
+		if path, err = backup.Snapshot(ctx, stores, cfg.Backup.Dir, handler.UploadDir, time.Now()); err != nil {
+			return err
+		}
+	} else if err := writeArchive(ctx, stores, path); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "sauvegarde écrite dans %s\n", path)
+	return nil
+}
+
+func writeArchive(ctx context.Context, stores database.Stores, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := backup.Write(ctx, stores, f, handler.UploadDir); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// RestoreDatabase implémente « forum restore archive » : la base SQLite
+// configurée et les images sont remplacées par celles de l'archive, vérifiée
+// et migrée au préalable. Le forum doit être arrêté.
+func RestoreDatabase(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage : forum restore archive.tar.gz")
+	}
+	cfg, err := commandConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Database.Driver != database.SQLite {
+		return database.ErrBackupUnsupported
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := backup.Restore(context.Background(), f, cfg.Database.Path, handler.UploadDir); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "base et images restaurées ; les précédentes sont conservées sous %s et %s\n",
+		cfg.Database.Path+backup.PreviousSuffix, handler.UploadDir+backup.PreviousSuffix)
+	return nil
+}
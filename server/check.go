@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// CheckDatabase implémente « forum check [-repair] » : il liste les lignes
+// orphelines de la base configurée et, avec -repair, les supprime.
+func CheckDatabase(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "supprimer les lignes orphelines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := commandConfig()
+	if err != nil {
+		return err
+	}
+	stores, err := openDatabase(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	orphans, err := stores.CheckConsistency(context.Background(), *repair)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		fmt.Fprintln(out, "aucune ligne orpheline")
+		return nil
+	}
+	for _, o := range orphans {
+		fmt.Fprintf(out, "%-16s %4d ligne(s) orpheline(s), parent %s\n", o.Table, o.Rows, o.Parent)
+	}
+	if *repair {
+		fmt.Fprintln(out, "lignes orphelines supprimées")
+	} else {
+		fmt.Fprintln(out, "relancer avec -repair pour les supprimer")
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"forum/config"
+	"forum/database"
+	"forum/handler"
+	"forum/seed"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// roles sont les rôles qu'un compte peut recevoir.
+var roles = []string{"user", "moderator", "admin"}
+
+// Serve implémente « forum serve », le serveur web ; c'est aussi ce que
+// lance le binaire sans commande.
+func Serve(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	StartServer()
+	return nil
+}
+
+// Migrate implémente « forum migrate » : crée les tables et applique les
+// migrations en attente sans démarrer le serveur, puis liste celles
+// appliquées.
+func Migrate(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	applied, err := stores.AppliedMigrations(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, m := range applied {
+		fmt.Fprintf(out, "%3d  %-50s %s\n", m.Version, m.Name, m.AppliedAt.Format(time.DateTime))
+	}
+	fmt.Fprintf(out, "schéma à jour (%s, %d migration(s))\n", stores.Backend(), len(applied))
+	return nil
+}
+
+// CreateUser implémente « forum create-user -email adresse [-role rôle]
+// [-password mot-de-passe] nom » ; sans -password, un mot de passe aléatoire
+// est généré et affiché.
+func CreateUser(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	email := fs.String("email", "", "adresse e-mail du compte")
+	role := fs.String("role", "user", "rôle : user, moderator ou admin")
+	password := fs.String("password", "", "mot de passe (par défaut, généré)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *email == "" {
+		return errors.New("usage : forum create-user -email adresse [-role rôle] [-password mot-de-passe] nom")
+	}
+	if !slices.Contains(roles, *role) {
+		return fmt.Errorf("rôle %q inconnu (user, moderator ou admin)", *role)
+	}
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	ctx := context.Background()
+	pwd, generated, err := passwordOrRandom(*password)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	err = stores.InTx(ctx, func(tx database.Stores) error {
+		id, err := tx.Users.Create(ctx, fs.Arg(0), *email, string(hash))
+		if err != nil {
+			return err
+		}
+		return tx.Users.SetRole(ctx, 0, id, *role)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "compte %s créé (%s)\n", fs.Arg(0), *role)
+	if generated {
+		fmt.Fprintf(out, "mot de passe : %s\n", pwd)
+	}
+	return nil
+}
+
+// SetRole implémente « forum set-role nom rôle ».
+func SetRole(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("set-role", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage : forum set-role nom user|moderator|admin")
+	}
+	role := fs.Arg(1)
+	if !slices.Contains(roles, role) {
+		return fmt.Errorf("rôle %q inconnu (user, moderator ou admin)", role)
+	}
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	ctx := context.Background()
+	user, err := findUser(ctx, stores.Users, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := stores.Users.SetRole(ctx, 0, user.ID, role); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s : %s -> %s\n", user.Username, user.Role, role)
+	return nil
+}
+
+// ResetPassword implémente « forum reset-password [-password mot-de-passe]
+// nom » : le mot de passe est remplacé (généré et affiché par défaut) et les
+// sessions du compte sont révoquées.
+func ResetPassword(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	password := fs.String("password", "", "nouveau mot de passe (par défaut, généré)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage : forum reset-password [-password mot-de-passe] nom")
+	}
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	ctx := context.Background()
+	user, err := findUser(ctx, stores.Users, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	pwd, generated, err := passwordOrRandom(*password)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := stores.Users.SetPassword(ctx, user.ID, string(hash)); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "mot de passe de %s remplacé, sessions révoquées\n", user.Username)
+	if generated {
+		fmt.Fprintf(out, "mot de passe : %s\n", pwd)
+	}
+	return nil
+}
+
+// Ban implémente « forum ban [-lift] nom » : le compte suspendu ne peut plus
+// se connecter et ses sessions sont révoquées ; -lift lève la suspension.
+func Ban(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("ban", flag.ContinueOnError)
+	lift := fs.Bool("lift", false, "lever la suspension")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage : forum ban [-lift] nom")
+	}
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	ctx := context.Background()
+	user, err := findUser(ctx, stores.Users, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := stores.Users.SetBanned(ctx, 0, user.ID, !*lift); err != nil {
+		return err
+	}
+	if *lift {
+		fmt.Fprintf(out, "suspension de %s levée\n", user.Username)
+	} else {
+		fmt.Fprintf(out, "%s suspendu, sessions révoquées\n", user.Username)
+	}
+	return nil
+}
+
+// PurgeSessions implémente « forum purge-sessions [-all | -user nom] » : par
+// défaut, les sessions et données de connexion expirées sont supprimées,
+// comme le fait le serveur toutes les heures ; -all déconnecte tout le monde
+// et -user un seul compte.
+func PurgeSessions(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("purge-sessions", flag.ContinueOnError)
+	all := fs.Bool("all", false, "supprimer toutes les sessions")
+	username := fs.String("user", "", "supprimer les sessions de ce compte")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *all && *username != "" {
+		return errors.New("usage : forum purge-sessions [-all | -user nom]")
+	}
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	ctx := context.Background()
+	switch {
+	case *all:
+		n, err := stores.Sessions.DeleteAll(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%d session(s) supprimée(s)\n", n)
+	case *username != "":
+		user, err := findUser(ctx, stores.Users, *username)
+		if err != nil {
+			return err
+		}
+		if err := stores.Sessions.DeleteAllForUser(ctx, user.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "sessions de %s supprimées\n", user.Username)
+	default:
+		now := time.Now()
+		n, err := stores.Sessions.PurgeExpired(ctx, now)
+		if err != nil {
+			return err
+		}
+		if err := stores.PurgeExpired(ctx, now); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%d session(s) expirée(s) supprimée(s)\n", n)
+	}
+	return nil
+}
+
+// ReindexSearch implémente « forum reindex-search » : voir Stores.Reindex.
+func ReindexSearch(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("reindex-search", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	if err := stores.Reindex(context.Background()); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "index reconstruits, statistiques à jour")
+	return nil
+}
+
+// demoUsers sont les comptes de démonstration ; leur mot de passe est leur
+// nom.
+var demoUsers = []struct {
+	username string
+	email    string
+	role     string
+}{
+	{"admin", "admin@example.com", "admin"},
+	{"moderateur", "mod@example.com", "moderator"},
+}
+
+// SeedDemoData implémente « forum seed-demo-data [options] » : crée les
+// comptes de démonstration, ou leur rend leur rôle s'ils existent déjà, puis
+// un forum fictif généré par le paquet seed (-users 0 -posts 0 pour s'en
+// tenir aux comptes). Le serveur créait ces comptes à chaque démarrage ; ils
+// n'ont rien à faire sur un forum en ligne.
+func SeedDemoData(args []string, out io.Writer) error {
+	opts := seed.Defaults()
+	opts.ImageDir = handler.UploadDir
+	fs := flag.NewFlagSet("seed-demo-data", flag.ContinueOnError)
+	fs.Uint64Var(&opts.Seed, "seed", opts.Seed, "graine : la même graine donne les mêmes données")
+	fs.IntVar(&opts.Users, "users", opts.Users, "comptes générés (un sur dix modérateur)")
+	fs.IntVar(&opts.Categories, "categories", opts.Categories, "catégories")
+	fs.IntVar(&opts.Posts, "posts", opts.Posts, "posts")
+	fs.IntVar(&opts.Comments, "comments", opts.Comments, "commentaires par post, au plus")
+	fs.IntVar(&opts.Votes, "votes", opts.Votes, "votes par post, au plus")
+	fs.Float64Var(&opts.Pending, "pending", opts.Pending, "part des posts en attente de modération")
+	fs.Float64Var(&opts.Images, "images", opts.Images, "part des posts illustrés")
+	fs.DurationVar(&opts.Span, "span", opts.Span, "période couverte par les posts")
+	fs.StringVar(&opts.Password, "password", opts.Password, "mot de passe des comptes générés")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	ctx := context.Background()
+	for _, u := range demoUsers {
+		user, err := stores.Users.GetByUsername(ctx, u.username)
+		if errors.Is(err, sql.ErrNoRows) {
+			hash, err := bcrypt.GenerateFromPassword([]byte(u.username), bcrypt.DefaultCost)
+			if err != nil {
+				return err
+			}
+			if user.ID, err = stores.Users.Create(ctx, u.username, u.email, string(hash)); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "compte %s créé (mot de passe : %s)\n", u.username, u.username)
+		} else if err != nil {
+			return err
+		}
+		if err := stores.Users.SetRole(ctx, 0, user.ID, u.role); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s : rôle %s\n", u.username, u.role)
+	}
+
+	res, err := seed.Generate(ctx, stores, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "graine %d : %d compte(s) (mot de passe : %s), %d catégorie(s), %d post(s) dont %d en attente et %d image(s), %d commentaire(s), %d vote(s), %d notification(s)\n",
+		opts.Seed, res.Users, opts.Password, res.Categories, res.Posts, res.Pending, res.Images, res.Comments, res.Votes, res.Notifications)
+	return nil
+}
+
+// Export implémente « forum export [-o fichier] » : voir Stores.Export.
+// Sans -o, l'export est écrit sur la sortie standard.
+func Export(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fs.String("o", "", "fichier à écrire (par défaut, la sortie standard)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	ctx := context.Background()
+	if *output == "" {
+		return stores.Export(ctx, out)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := stores.Export(ctx, f); err != nil {
+		f.Close()
+		os.Remove(*output)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "export écrit dans %s\n", *output)
+	return nil
+}
+
+// Import implémente « forum import fichier » : le contenu d'un export est
+// chargé dans la base configurée, qui doit être vide (voir Stores.Import).
+func Import(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage : forum import fichier.json")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stores, err := openStores()
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	if err := stores.Import(context.Background(), f); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s importé\n", fs.Arg(0))
+	return nil
+}
+
+// findUser renvoie le compte nommé username, avec une erreur lisible s'il
+// n'existe pas.
+func findUser(ctx context.Context, users database.UserStore, username string) (database.User, error) {
+	user, err := users.GetByUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, fmt.Errorf("utilisateur %q introuvable", username)
+	}
+	return user, err
+}
+
+// passwordOrRandom renvoie password, ou un mot de passe aléatoire s'il est
+// vide (generated vaut alors true).
+func passwordOrRandom(password string) (pwd string, generated bool, err error) {
+	if password != "" {
+		return password, false, nil
+	}
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), true, nil
+}
+
+// openStores charge la configuration et ouvre la base pour une commande ;
+// l'appelant la ferme avec Stores.Close.
+func openStores() (database.Stores, error) {
+	cfg, err := commandConfig()
+	if err != nil {
+		return database.Stores{}, err
+	}
+	return openDatabase(cfg.Database)
+}
+
+// commandConfig charge la configuration pour une commande d'administration,
+// comme le serveur (.env compris).
+func commandConfig() (*config.Config, error) {
+	_ = godotenv.Load()
+	return config.Load(configPath())
+}
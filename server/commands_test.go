@@ -0,0 +1,324 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/database"
+	"forum/database/dbtest"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// commandStores crée une base jetable et la désigne aux commandes par
+// l'environnement, comme le ferait un administrateur.
+func commandStores(t *testing.T) database.Stores {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "forum.db")
+	t.Setenv("FORUM_CONFIG", "")
+	t.Setenv("DATABASE_DRIVER", database.SQLite)
+	t.Setenv("DATABASE_PATH", path)
+	return dbtest.NewAt(t, path)
+}
+
+// auditEntry est une ligne du journal d'audit, lue dans un export.
+type auditEntry struct {
+	Action string
+	Target int
+	Detail string
+}
+
+// auditLog renvoie le journal d'audit de la base, dans l'ordre d'écriture.
+func auditLog(t *testing.T, stores database.Stores) []auditEntry {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := stores.Export(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	var dump struct {
+		Tables []struct {
+			Name    string
+			Columns []string
+			Rows    [][]any
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	var entries []auditEntry
+	for _, table := range dump.Tables {
+		if table.Name != "audit_log" {
+			continue
+		}
+		col := func(row []any, name string) any { return row[slices.Index(table.Columns, name)] }
+		for _, row := range table.Rows {
+			e := auditEntry{Action: col(row, "action").(string)}
+			if target, ok := col(row, "target_id").(float64); ok {
+				e.Target = int(target)
+			}
+			if detail, ok := col(row, "detail").(string); ok {
+				e.Detail = detail
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// sessionIDs renvoie les sessions d'un compte, expirées comprises.
+func sessionIDs(t *testing.T, stores database.Stores, userID int) []string {
+	t.Helper()
+	sessions, err := stores.Sessions.ListByUser(context.Background(), userID, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func checkPassword(t *testing.T, stores database.Stores, username, password string) {
+	t.Helper()
+	u, err := stores.Users.GetByUsername(context.Background(), username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) != nil {
+		t.Errorf("le mot de passe de %s n'est pas %q", username, password)
+	}
+}
+
+var generatedPassword = regexp.MustCompile(`mot de passe : (\S+)`)
+
+func TestCommands(t *testing.T) {
+	ctx := context.Background()
+	type fixture struct {
+		stores         database.Stores
+		alice, charlie int
+	}
+	userRole := func(t *testing.T, fx fixture, username string) string {
+		t.Helper()
+		u, err := fx.stores.Users.GetByUsername(ctx, username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.Role
+	}
+
+	tests := []struct {
+		name    string
+		run     func(args []string, out io.Writer) error
+		args    []string
+		setup   func(t *testing.T, fx fixture)
+		wantErr string // extrait de l'erreur attendue, vide en cas de succès
+		wantOut string
+		audit   func(fx fixture) []auditEntry
+		check   func(t *testing.T, fx fixture, out string)
+	}{
+		{
+			name:    "create-user",
+			run:     CreateUser,
+			args:    []string{"-email", "bob@example.com", "-role", "moderator", "-password", "motdepasse", "bob"},
+			wantOut: "compte bob créé (moderator)",
+			audit: func(fx fixture) []auditEntry {
+				u, _ := fx.stores.Users.GetByUsername(ctx, "bob")
+				return []auditEntry{{"role", u.ID, "user -> moderator"}}
+			},
+			check: func(t *testing.T, fx fixture, out string) {
+				checkPassword(t, fx.stores, "bob", "motdepasse")
+				if strings.Contains(out, "mot de passe :") {
+					t.Error("mot de passe fourni réaffiché")
+				}
+			},
+		},
+		{
+			name:    "create-user avec mot de passe généré",
+			run:     CreateUser,
+			args:    []string{"-email", "bob@example.com", "bob"},
+			wantOut: "compte bob créé (user)",
+			check: func(t *testing.T, fx fixture, out string) {
+				m := generatedPassword.FindStringSubmatch(out)
+				if m == nil {
+					t.Fatalf("mot de passe généré absent : %q", out)
+				}
+				checkPassword(t, fx.stores, "bob", m[1])
+			},
+		},
+		{name: "create-user sans email", run: CreateUser, args: []string{"bob"}, wantErr: "usage : forum create-user"},
+		{name: "create-user rôle inconnu", run: CreateUser, args: []string{"-email", "bob@example.com", "-role", "root", "bob"}, wantErr: `rôle "root" inconnu`},
+		{name: "create-user option inconnue", run: CreateUser, args: []string{"-admin", "bob"}, wantErr: "-admin"},
+		{
+			name:    "create-user nom pris",
+			run:     CreateUser,
+			args:    []string{"-email", "alice2@example.com", "-role", "admin", "-password", "x", "alice"},
+			wantErr: "UNIQUE",
+			check: func(t *testing.T, fx fixture, out string) {
+				if role := userRole(t, fx, "alice"); role != "user" {
+					t.Errorf("rôle d'alice changé en %s", role)
+				}
+			},
+		},
+		{
+			name:    "set-role",
+			run:     SetRole,
+			args:    []string{"alice", "admin"},
+			wantOut: "alice : user -> admin",
+			audit:   func(fx fixture) []auditEntry { return []auditEntry{{"role", fx.alice, "user -> admin"}} },
+			check: func(t *testing.T, fx fixture, out string) {
+				if role := userRole(t, fx, "alice"); role != "admin" {
+					t.Errorf("rôle %s, attendu admin", role)
+				}
+			},
+		},
+		{name: "set-role utilisateur inconnu", run: SetRole, args: []string{"inconnu", "admin"}, wantErr: `utilisateur "inconnu" introuvable`},
+		{name: "set-role rôle inconnu", run: SetRole, args: []string{"alice", "root"}, wantErr: `rôle "root" inconnu`},
+		{name: "set-role sans rôle", run: SetRole, args: []string{"alice"}, wantErr: "usage : forum set-role"},
+		{
+			name:    "ban",
+			run:     Ban,
+			args:    []string{"alice"},
+			wantOut: "alice suspendu",
+			audit:   func(fx fixture) []auditEntry { return []auditEntry{{"ban", fx.alice, ""}} },
+			check: func(t *testing.T, fx fixture, out string) {
+				if u, _ := fx.stores.Users.GetByUsername(ctx, "alice"); u.BannedAt.IsZero() {
+					t.Error("alice n'est pas suspendue")
+				}
+				if ids := sessionIDs(t, fx.stores, fx.alice); len(ids) != 0 {
+					t.Errorf("sessions d'alice conservées : %v", ids)
+				}
+				if ids := sessionIDs(t, fx.stores, fx.charlie); len(ids) != 1 {
+					t.Errorf("sessions de charlie : %v", ids)
+				}
+			},
+		},
+		{
+			name: "ban -lift",
+			run:  Ban,
+			args: []string{"-lift", "alice"},
+			setup: func(t *testing.T, fx fixture) {
+				if err := fx.stores.Users.SetBanned(ctx, 0, fx.alice, true); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantOut: "suspension de alice levée",
+			audit:   func(fx fixture) []auditEntry { return []auditEntry{{"ban", fx.alice, ""}, {"unban", fx.alice, ""}} },
+			check: func(t *testing.T, fx fixture, out string) {
+				if u, _ := fx.stores.Users.GetByUsername(ctx, "alice"); !u.BannedAt.IsZero() {
+					t.Error("alice est toujours suspendue")
+				}
+			},
+		},
+		{name: "ban utilisateur inconnu", run: Ban, args: []string{"inconnu"}, wantErr: `utilisateur "inconnu" introuvable`},
+		{
+			name:    "reset-password",
+			run:     ResetPassword,
+			args:    []string{"-password", "nouveau", "alice"},
+			wantOut: "mot de passe de alice remplacé",
+			check: func(t *testing.T, fx fixture, out string) {
+				checkPassword(t, fx.stores, "alice", "nouveau")
+				if ids := sessionIDs(t, fx.stores, fx.alice); len(ids) != 0 {
+					t.Errorf("sessions d'alice conservées : %v", ids)
+				}
+			},
+		},
+		{name: "reset-password utilisateur inconnu", run: ResetPassword, args: []string{"inconnu"}, wantErr: `utilisateur "inconnu" introuvable`},
+		{name: "reset-password sans nom", run: ResetPassword, wantErr: "usage : forum reset-password"},
+		{
+			name:    "purge-sessions",
+			run:     PurgeSessions,
+			wantOut: "1 session(s) expirée(s) supprimée(s)",
+			check: func(t *testing.T, fx fixture, out string) {
+				if ids := sessionIDs(t, fx.stores, fx.alice); !slices.Equal(ids, []string{"alice-active"}) {
+					t.Errorf("sessions d'alice : %v, attendu la seule session active", ids)
+				}
+			},
+		},
+		{
+			name:    "purge-sessions -all",
+			run:     PurgeSessions,
+			args:    []string{"-all"},
+			wantOut: "3 session(s) supprimée(s)",
+			check: func(t *testing.T, fx fixture, out string) {
+				if n := len(sessionIDs(t, fx.stores, fx.alice)) + len(sessionIDs(t, fx.stores, fx.charlie)); n != 0 {
+					t.Errorf("%d session(s) restante(s)", n)
+				}
+			},
+		},
+		{
+			name:    "purge-sessions -user",
+			run:     PurgeSessions,
+			args:    []string{"-user", "alice"},
+			wantOut: "sessions de alice supprimées",
+			check: func(t *testing.T, fx fixture, out string) {
+				if ids := sessionIDs(t, fx.stores, fx.alice); len(ids) != 0 {
+					t.Errorf("sessions d'alice conservées : %v", ids)
+				}
+				if ids := sessionIDs(t, fx.stores, fx.charlie); len(ids) != 1 {
+					t.Errorf("sessions de charlie : %v", ids)
+				}
+			},
+		},
+		{name: "purge-sessions utilisateur inconnu", run: PurgeSessions, args: []string{"-user", "inconnu"}, wantErr: `utilisateur "inconnu" introuvable`},
+		{name: "purge-sessions -all et -user", run: PurgeSessions, args: []string{"-all", "-user", "alice"}, wantErr: "usage : forum purge-sessions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fx := fixture{stores: commandStores(t)}
+			var err error
+			if fx.alice, err = fx.stores.Users.Create(ctx, "alice", "alice@example.com", "x"); err != nil {
+				t.Fatal(err)
+			}
+			if fx.charlie, err = fx.stores.Users.Create(ctx, "charlie", "charlie@example.com", "x"); err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			for _, s := range []database.Session{
+				{ID: "alice-active", UserID: fx.alice, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+				{ID: "alice-expiree", UserID: fx.alice, LastSeenAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+				{ID: "charlie-active", UserID: fx.charlie, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+			} {
+				if err := fx.stores.Sessions.Create(ctx, s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.setup != nil {
+				tt.setup(t, fx)
+			}
+			before := auditLog(t, fx.stores)
+
+			var out bytes.Buffer
+			err = tt.run(tt.args, &out)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("erreur : %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("erreur %v, attendu %q", err, tt.wantErr)
+			}
+			if !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("sortie %q, attendu %q", out.String(), tt.wantOut)
+			}
+
+			want := before
+			if tt.audit != nil {
+				want = tt.audit(fx)
+			}
+			if got := auditLog(t, fx.stores); !slices.Equal(got, want) {
+				t.Errorf("journal d'audit %v, attendu %v", got, want)
+			}
+			if tt.check != nil {
+				tt.check(t, fx, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"forum/config"
+	"forum/database"
+	"forum/database/dbtest"
+	"forum/middleware"
+)
+
+func TestSignupLoginLogout(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		s := newSite(t, stores)
+		c := s.client()
+		c.register(t, "nouveau", "un-mot-de-passe")
+		c.login(t, "nouveau@example.com", "un-mot-de-passe")
+
+		if resp := c.get(t, "/profil"); resp.Status != http.StatusOK || !strings.Contains(resp.Body, "nouveau") {
+			t.Fatalf("profil : statut %d", resp.Status)
+		}
+		if resp := c.post(t, "/deconnexion", nil); resp.Status != http.StatusSeeOther || resp.Location != "/index" {
+			t.Fatalf("déconnexion : statut %d vers %q", resp.Status, resp.Location)
+		}
+		if resp := c.get(t, "/profil"); resp.Status != http.StatusSeeOther || resp.Location != "/connexion" {
+			t.Fatalf("profil après déconnexion : statut %d vers %q", resp.Status, resp.Location)
+		}
+	})
+}
+
+func TestCSRFRequired(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		s := newSite(t, stores)
+		c := s.actAs(t, "user")
+		c.token = "jeton-invalide"
+		resp := c.post(t, "/notifications/mark-read", nil)
+		if resp.Status != http.StatusForbidden || !strings.Contains(resp.Body, "jeton de sécurité") {
+			t.Fatalf("jeton invalide : statut %d, attendu %d avec la page d'erreur", resp.Status, http.StatusForbidden)
+		}
+		// Un client JSON reçoit l'erreur en JSON, avec la référence de la requête.
+		resp = c.do(t, request{Method: http.MethodPost, Path: "/notifications/mark-read", JSON: map[string]string{}})
+		if resp.Status != http.StatusForbidden || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") ||
+			!strings.Contains(resp.Body, `"request_id":"`+resp.Header.Get(middleware.RequestIDHeader)+`"`) {
+			t.Fatalf("jeton invalide en JSON : statut %d, %s", resp.Status, resp.Body)
+		}
+		// Un autre site ne peut pas déconnecter le visiteur.
+		if resp := c.post(t, "/deconnexion", nil); resp.Status != http.StatusForbidden {
+			t.Fatalf("déconnexion sans jeton valide : statut %d, attendu %d", resp.Status, http.StatusForbidden)
+		}
+		c.token = ""
+		if resp := c.post(t, "/notifications/mark-read", nil); resp.Status != http.StatusSeeOther {
+			t.Fatalf("jeton de la session : statut %d, attendu %d", resp.Status, http.StatusSeeOther)
+		}
+	})
+}
+
+// TestModerationFlow suit un post de sa publication par un utilisateur à son
+// approbation par un modérateur.
+func TestModerationFlow(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		s := newSite(t, stores)
+		author, mod := s.actAs(t, "user"), s.actAs(t, "moderator")
+
+		resp := author.do(t, request{Method: http.MethodPost, Path: "/nouveau-post", Multipart: true,
+			Form: url.Values{"title": {"Théorie sur la fin"}, "content": {"Tout était un rêve."}}})
+		if resp.Status != http.StatusSeeOther {
+			t.Fatalf("publication : statut %d", resp.Status)
+		}
+		pending, err := stores.Posts.Pending(ctx)
+		if err != nil || len(pending) != 1 {
+			t.Fatalf("posts en attente : %d (%v), attendu 1", len(pending), err)
+		}
+		id := strconv.Itoa(pending[0].ID)
+		if strings.Contains(author.get(t, "/posts").Body, "Théorie sur la fin") {
+			t.Fatal("post en attente visible dans /posts")
+		}
+		if !strings.Contains(mod.get(t, "/moderation").Body, "Théorie sur la fin") {
+			t.Fatal("post en attente absent de /moderation")
+		}
+
+		if resp := author.post(t, "/moderation/approve", url.Values{"post_id": {id}}); resp.Status != http.StatusForbidden {
+			t.Fatalf("approbation par l'auteur : statut %d", resp.Status)
+		}
+		if resp := mod.post(t, "/moderation/approve", url.Values{"post_id": {id}}); resp.Location != "/moderation" {
+			t.Fatalf("approbation : statut %d vers %q", resp.Status, resp.Location)
+		}
+		if !strings.Contains(author.get(t, "/posts").Body, "Théorie sur la fin") {
+			t.Fatal("post approuvé absent de /posts")
+		}
+		var notifs []database.Notification
+		if err := json.Unmarshal([]byte(author.get(t, "/notifications").Body), &notifs); err != nil {
+			t.Fatal(err)
+		}
+		approved := slices.ContainsFunc(notifs, func(n database.Notification) bool {
+			return strings.Contains(n.Message, "approuvé")
+		})
+		if !approved {
+			t.Fatalf("notifications de l'auteur : %+v", notifs)
+		}
+	})
+}
+
+// TestReportFlow vérifie qu'un signalement arrive dans /admin/reports et
+// que seul l'auteur d'un post ou l'équipe peut le supprimer.
+func TestReportFlow(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		ctx := context.Background()
+		s := newSite(t, stores)
+		author, reader, admin := s.actAs(t, "user"), s.actAs(t, "user"), s.actAs(t, "admin")
+		postID, err := stores.Posts.Create(ctx, author.userID, "Critique", "contenu", "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := strconv.Itoa(postID)
+
+		if resp := reader.post(t, "/report-post", url.Values{"post_id": {id}}); resp.Location != "/post?id="+id {
+			t.Fatalf("signalement : statut %d vers %q", resp.Status, resp.Location)
+		}
+		if resp := admin.get(t, "/admin/reports"); !strings.Contains(resp.Body, "Critique") {
+			t.Fatalf("signalement absent de /admin/reports (statut %d)", resp.Status)
+		}
+
+		reader.post(t, "/delete-post", url.Values{"id": {id}})
+		if _, err := stores.Posts.GetByID(ctx, postID); err != nil {
+			t.Fatalf("post supprimé par un autre utilisateur : %v", err)
+		}
+		admin.post(t, "/delete-post", url.Values{"id": {id}})
+		if _, err := stores.Posts.GetByID(ctx, postID); err == nil {
+			t.Fatal("post non supprimé par l'administrateur")
+		}
+	})
+}
+
+// TestExternalAPIs vérifie que les pages des services externes affichent les
+// réponses des doublures.
+func TestExternalAPIs(t *testing.T) {
+	s := newSite(t, dbtest.New(t))
+	c := s.client()
+	if body := c.get(t, "/api-tmdb").Body; !strings.Contains(body, fakeMovie) {
+		t.Error("film de TMDB absent de /api-tmdb")
+	}
+	if body := c.get(t, "/actualites").Body; !strings.Contains(body, fakeArticle) {
+		t.Error("article de NewsAPI absent de /actualites")
+	}
+	resp := c.do(t, request{Method: http.MethodPost, Path: "/api/gemini-chat", JSON: map[string]string{"message": "bonjour"}})
+	var chat struct {
+		Reply string `json:"reply"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &chat); err != nil || chat.Reply != "écho : bonjour" {
+		t.Errorf("réponse Gemini %q (statut %d, %v)", chat.Reply, resp.Status, err)
+	}
+}
+
+// TestAuthRateLimit vérifie la limite de débit de l'authentification à
+// l'horloge du serveur : cinq requêtes d'une même adresse, puis 429 jusqu'au
+// jeton suivant, six secondes plus tard, avec la page d'erreur du forum.
+// L'inscription a son propre compteur.
+func TestAuthRateLimit(t *testing.T) {
+	var now atomic.Int64
+	now.Store(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).UnixNano())
+	clock := func() time.Time { return time.Unix(0, now.Load()) }
+	s := newSite(t, dbtest.New(t), WithClock(clock), WithLimiterStore(middleware.NewMemoryStore(time.Minute)))
+	c := s.client()
+	for i := range 6 {
+		want := http.StatusOK
+		if i == 5 {
+			want = http.StatusTooManyRequests
+		}
+		resp := c.get(t, "/connexion")
+		if resp.Status != want {
+			t.Fatalf("requête %d : statut %d, attendu %d", i+1, resp.Status, want)
+		}
+		if want == http.StatusTooManyRequests && (resp.Header.Get("Retry-After") != "6" ||
+			!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || !strings.Contains(resp.Body, middleware.RateLimited)) {
+			t.Fatalf("refus : Retry-After %q, Content-Type %q, corps %q ; attendu la page d'erreur et 6", resp.Header.Get("Retry-After"), resp.Header.Get("Content-Type"), resp.Body)
+		}
+	}
+	if resp := c.get(t, "/inscription"); resp.Status != http.StatusOK {
+		t.Fatalf("inscription après la limite de connexion : statut %d, attendu %d", resp.Status, http.StatusOK)
+	}
+	now.Add(int64(6 * time.Second))
+	if resp := c.get(t, "/connexion"); resp.Status != http.StatusOK {
+		t.Fatalf("six secondes plus tard : statut %d, attendu %d", resp.Status, http.StatusOK)
+	}
+}
+
+// TestSessionsFollowServerClock vérifie que les sessions expirent à l'horloge
+// du serveur, loin de l'heure réelle, après la durée configurée.
+func TestSessionsFollowServerClock(t *testing.T) {
+	var now atomic.Int64
+	now.Store(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC).UnixNano())
+	clock := func() time.Time { return time.Unix(0, now.Load()) }
+	s := newSite(t, dbtest.New(t), WithClock(clock))
+	c := s.actAs(t, "user")
+	if resp := c.get(t, "/profil"); resp.Status != http.StatusOK {
+		t.Fatalf("profil après connexion : statut %d, attendu %d", resp.Status, http.StatusOK)
+	}
+	now.Add(int64(config.Default().Session.Lifetime.Duration + time.Minute))
+	if resp := c.get(t, "/profil"); resp.Status != http.StatusSeeOther || resp.Location != "/connexion" {
+		t.Fatalf("session expirée : statut %d vers %q, attendu /connexion", resp.Status, resp.Location)
+	}
+}
+
+// TestCSPNonceInPage vérifie que le script en ligne d'une page porte le nonce
+// de la politique envoyée avec elle, et que ce nonce change à chaque requête.
+func TestCSPNonceInPage(t *testing.T) {
+	s := newSite(t, dbtest.New(t))
+	c := s.actAs(t, "user")
+	var nonces []string
+	for range 2 {
+		resp := c.get(t, "/modify-profil")
+		_, rest, ok := strings.Cut(resp.Body, `<script nonce="`)
+		nonce, _, _ := strings.Cut(rest, `"`)
+		nonce = html.UnescapeString(nonce)
+		if !ok || nonce == "" {
+			t.Fatalf("modification du profil sans <script nonce> : statut %d", resp.Status)
+		}
+		if csp := resp.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "'nonce-"+nonce+"'") {
+			t.Fatalf("CSP %q sans le nonce de la page %q", csp, nonce)
+		}
+		nonces = append(nonces, nonce)
+	}
+	if nonces[0] == nonces[1] {
+		t.Errorf("nonce %q réutilisé d'une requête à l'autre", nonces[0])
+	}
+}
+
+// TestPagesUseLayout vérifie que les pages HTML partagent la mise en page :
+// barre de navigation du visiteur et pied de page.
+func TestPagesUseLayout(t *testing.T) {
+	s := newSite(t, dbtest.New(t))
+	visitor, member := s.client(), s.actAs(t, "user")
+	pages := []struct {
+		c    *client
+		path string
+	}{
+		{visitor, "/connexion"},
+		{visitor, "/inscription"},
+		{visitor, "/theories-spoilers"},
+		{visitor, "/page-inconnue"},
+		{member, "/profil"},
+		{member, "/modify-profil"},
+		{member, "/profil/2fa"},
+		{member, "/actualites"},
+		{member, "/api-tmdb"},
+		{member, "/gemini-chat"},
+	}
+	for _, p := range pages {
+		resp := p.c.get(t, p.path)
+		if !strings.Contains(resp.Body, `class="site-header"`) || !strings.Contains(resp.Body, `class="site-footer"`) {
+			t.Errorf("%s : statut %d, page hors de la mise en page", p.path, resp.Status)
+			continue
+		}
+		if signedIn := strings.Contains(resp.Body, `action="/deconnexion"`); signedIn != (p.c == member) {
+			t.Errorf("%s : bouton de déconnexion affiché %v, attendu %v", p.path, signedIn, p.c == member)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"forum/database/dbtest"
+)
+
+// TestMain place les tests à la racine du dépôt, comme le binaire en
+// production : templates et fichiers statiques y sont lus par chemin relatif.
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		log.Fatal(err)
+	}
+	dbtest.Main(m)
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"forum/config"
+	"forum/database"
+	"forum/database/dbtest"
+	"forum/handler"
+)
+
+// statuses donne le statut attendu pour chaque visiteur : anonyme,
+// utilisateur, modérateur et administrateur.
+type statuses struct {
+	anon, user, mod, admin int
+}
+
+func all(status int) statuses { return statuses{status, status, status, status} }
+
+// Raccourcis des tableaux : 303 vers /connexion pour l'anonyme, puis le
+// statut des comptes connectés.
+func member(status int) statuses { return statuses{http.StatusSeeOther, status, status, status} }
+func staff(status int) statuses {
+	return statuses{http.StatusSeeOther, http.StatusForbidden, status, status}
+}
+func adminOnly(status int) statuses {
+	return statuses{http.StatusSeeOther, http.StatusForbidden, http.StatusForbidden, status}
+}
+
+// routeCase est une requête du tableau de TestRoutes. Avec fresh, la requête
+// change l'état du visiteur (déconnexion) : chaque rôle la rejoue avec un
+// nouveau client.
+type routeCase struct {
+	name  string
+	req   request
+	want  statuses
+	fresh bool
+}
+
+// fixtures sont les données que visent les requêtes du tableau.
+type fixtures struct {
+	backend                                      string
+	post, pending, comment, target, notification int
+}
+
+func newFixtures(t *testing.T, stores database.Stores) fixtures {
+	t.Helper()
+	ctx := context.Background()
+	authorID, err := stores.Users.Create(ctx, "auteur", "auteur@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fx := fixtures{backend: stores.Backend()}
+	if fx.post, err = stores.Posts.Create(ctx, authorID, "Post publié", "contenu", "", true); err != nil {
+		t.Fatal(err)
+	}
+	if fx.pending, err = stores.Posts.Create(ctx, authorID, "Post en attente", "contenu", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if fx.comment, err = stores.Comments.Create(ctx, fx.post, authorID, "commentaire"); err != nil {
+		t.Fatal(err)
+	}
+	if fx.target, err = stores.Users.Create(ctx, "cible", "cible@example.com", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Notifications.Create(ctx, authorID, "notification", fx.post, 0); err != nil {
+		t.Fatal(err)
+	}
+	notifs, err := stores.Notifications.ListByUser(ctx, authorID)
+	if err != nil || len(notifs) == 0 {
+		t.Fatalf("notification de test : %v", err)
+	}
+	fx.notification = notifs[0].ID
+	return fx
+}
+
+func routeCases(fx fixtures) []routeCase {
+	postID, pendingID := strconv.Itoa(fx.post), strconv.Itoa(fx.pending)
+	commentID, targetID := strconv.Itoa(fx.comment), strconv.Itoa(fx.target)
+	get := func(path string) request { return request{Method: http.MethodGet, Path: path} }
+	post := func(path string, form url.Values) request {
+		return request{Method: http.MethodPost, Path: path, Form: form}
+	}
+	backup := http.StatusOK
+	if fx.backend == database.Postgres {
+		backup = http.StatusBadRequest
+	}
+
+	return []routeCase{
+		{"statiques", get("/static/css/main.css"), all(http.StatusOK), false},
+		{"racine", get("/"), all(http.StatusSeeOther), false},
+		{"page inconnue", get("/inconnue"), all(http.StatusNotFound), false},
+		{"accueil", get("/index"), all(http.StatusOK), false},
+		{"sondes healthz", get("/healthz"), all(http.StatusOK), false},
+		{"sondes readyz", get("/readyz"), all(http.StatusOK), false},
+
+		{"inscription", get("/inscription"), all(http.StatusOK), false},
+		{"inscription incomplète", post("/inscription", url.Values{"username": {"x"}}), all(http.StatusBadRequest), false},
+		{"connexion", get("/connexion"), all(http.StatusOK), false},
+		{"connexion refusée", post("/connexion", url.Values{"identifier": {"inconnu"}, "password": {"x"}}), all(http.StatusUnauthorized), false},
+		{"second facteur sans connexion en cours", get("/connexion/2fa"), all(http.StatusSeeOther), false},
+		{"enrôlement sans connexion en cours", get("/connexion/2fa/enroll"), all(http.StatusSeeOther), false},
+		{"déconnexion par lien", get("/deconnexion"), all(http.StatusMethodNotAllowed), false},
+		{"déconnexion", post("/deconnexion", nil), all(http.StatusSeeOther), true},
+		{"inscription OAuth sans fournisseur", get("/inscription/oauth"), all(http.StatusSeeOther), false},
+		{"OAuth fournisseur inconnu", get("/auth/inconnu"), all(http.StatusNotFound), false},
+		{"OAuth retour fournisseur inconnu", get("/auth/inconnu/callback"), all(http.StatusNotFound), false},
+
+		{"profil", get("/profil"), member(http.StatusOK), false},
+		{"profil d'un autre", get("/profil?id=" + targetID), member(http.StatusOK), false},
+		{"profil introuvable", get("/profil?id=999999"), member(http.StatusNotFound), false},
+		{"double authentification", get("/profil/2fa"), member(http.StatusOK), false},
+		{"sessions", get("/profil/sessions"), member(http.StatusOK), false},
+		{"comptes liés", get("/profil/comptes"), member(http.StatusOK), false},
+		{"modifier le profil", get("/modify-profil"), member(http.StatusOK), false},
+
+		{"TMDB", get("/api-tmdb"), all(http.StatusOK), false},
+		{"actualités", get("/actualites"), all(http.StatusOK), false},
+		{"théories", get("/theories-spoilers"), all(http.StatusOK), false},
+		{"page Gemini", get("/gemini-chat"), all(http.StatusOK), false},
+		{"API Gemini", request{Method: http.MethodPost, Path: "/api/gemini-chat", JSON: map[string]string{"message": "bonjour"}}, all(http.StatusOK), false},
+		{"rapport CSP", request{Method: http.MethodPost, Path: "/csp-report", JSON: map[string]any{"csp-report": map[string]string{"document-uri": "https://forum.test/index", "violated-directive": "img-src"}}}, all(http.StatusNoContent), false},
+
+		{"nouveau post", get("/nouveau-post"), member(http.StatusOK), false},
+		{"publier un post", request{Method: http.MethodPost, Path: "/nouveau-post", Form: url.Values{"title": {"Titre"}, "content": {"contenu"}}, Multipart: true}, member(http.StatusSeeOther), false},
+		{"posts", get("/posts"), all(http.StatusOK), false},
+		{"post", get("/post?id=" + postID), all(http.StatusOK), false},
+		{"post sans identifiant", get("/post"), all(http.StatusBadRequest), false},
+		{"post introuvable", get("/post?id=999999"), all(http.StatusNotFound), false},
+		{"modifier le post d'un autre", get("/edit-post?id=" + postID), statuses{http.StatusSeeOther, http.StatusForbidden, http.StatusForbidden, http.StatusForbidden}, false},
+		{"supprimer un post sans identifiant", post("/delete-post", nil), member(http.StatusBadRequest), false},
+		{"supprimer un post en GET", get("/delete-post?id=" + postID), all(http.StatusMethodNotAllowed), false},
+		{"commenter", post("/add-comment", url.Values{"post_id": {postID}, "content": {"commentaire"}}), member(http.StatusSeeOther), false},
+		{"supprimer un commentaire sans identifiant", post("/delete-comment", nil), member(http.StatusBadRequest), false},
+		{"aimer un post", post("/like-post", url.Values{"post_id": {postID}}), member(http.StatusSeeOther), false},
+		{"ne pas aimer un post", post("/dislike-post", url.Values{"post_id": {postID}}), member(http.StatusSeeOther), false},
+		{"aimer un post introuvable", post("/like-post", url.Values{"post_id": {"999999"}}), member(http.StatusNotFound), false},
+		{"aimer un commentaire", post("/like-comment", url.Values{"comment_id": {commentID}, "post_id": {postID}}), member(http.StatusSeeOther), false},
+		{"ne pas aimer un commentaire", post("/dislike-comment", url.Values{"comment_id": {commentID}, "post_id": {postID}}), member(http.StatusSeeOther), false},
+		{"signaler un post", post("/report-post", url.Values{"post_id": {postID}}), member(http.StatusSeeOther), false},
+
+		{"notifications", get("/notifications"), statuses{http.StatusUnauthorized, http.StatusOK, http.StatusOK, http.StatusOK}, false},
+		{"page des notifications", get("/notifications-page"), member(http.StatusOK), false},
+		{"notifications lues", post("/notifications/mark-read", nil), statuses{http.StatusUnauthorized, http.StatusSeeOther, http.StatusSeeOther, http.StatusSeeOther}, false},
+
+		{"modération", get("/moderation"), staff(http.StatusOK), false},
+		{"approuver", post("/moderation/approve", url.Values{"post_id": {pendingID}}), staff(http.StatusSeeOther), false},
+		{"approuver en GET", get("/moderation/approve"), all(http.StatusMethodNotAllowed), false},
+		{"rejeter", post("/moderation/reject", url.Values{"post_id": {pendingID}}), staff(http.StatusSeeOther), false},
+
+		{"promouvoir", post("/admin/promote", url.Values{"user_id": {targetID}}), adminOnly(http.StatusSeeOther), false},
+		{"rétrograder", post("/admin/demote", url.Values{"user_id": {targetID}}), adminOnly(http.StatusSeeOther), false},
+		{"utilisateurs", get("/admin/users"), adminOnly(http.StatusOK), false},
+		{"changer un rôle", post("/admin/users/update", url.Values{"user_id": {targetID}, "action": {"promote"}}), adminOnly(http.StatusSeeOther), false},
+		{"changer un rôle sans action", post("/admin/users/update", url.Values{"user_id": {targetID}}), adminOnly(http.StatusBadRequest), false},
+		{"sécurité", get("/admin/security"), adminOnly(http.StatusOK), false},
+		{"sauvegarde", post("/admin/backup", nil), adminOnly(backup), false},
+		{"signalements", get("/admin/reports"), adminOnly(http.StatusOK), false},
+		{"répondre à un signalement", post("/admin/reports/respond", url.Values{"notif_id": {strconv.Itoa(fx.notification)}, "response": {"traité"}}), adminOnly(http.StatusSeeOther), false},
+		{"répondre à un signalement sans réponse", post("/admin/reports/respond", url.Values{"notif_id": {strconv.Itoa(fx.notification)}}), adminOnly(http.StatusBadRequest), false},
+	}
+}
+
+// TestRoutes rejoue le tableau des requêtes pour chaque rôle, à travers tous
+// les middlewares : redirection vers /connexion pour l'anonyme, 403 pour les
+// rôles insuffisants.
+func TestRoutes(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, stores database.Stores) {
+		s := newSite(t, stores)
+		fx := newFixtures(t, stores)
+		roles := []string{"", "user", "moderator", "admin"}
+		visitor := func(role string) *client {
+			if role == "" {
+				return s.client()
+			}
+			return s.actAs(t, role)
+		}
+		clients := make(map[string]*client, len(roles))
+		for _, role := range roles {
+			clients[role] = visitor(role)
+		}
+
+		for _, tc := range routeCases(fx) {
+			t.Run(tc.name, func(t *testing.T) {
+				for i, want := range []int{tc.want.anon, tc.want.user, tc.want.mod, tc.want.admin} {
+					c := clients[roles[i]]
+					if tc.fresh {
+						c = visitor(roles[i])
+					}
+					if got := c.do(t, tc.req).Status; got != want {
+						t.Errorf("%s %s en %q : statut %d, attendu %d", tc.req.Method, tc.req.Path, roles[i], got, want)
+					}
+				}
+			})
+		}
+	})
+}
+
+// TestRoutesCovered vérifie que le tableau de TestRoutes atteint chaque motif
+// enregistré par routes.
+func TestRoutesCovered(t *testing.T) {
+	mux := http.NewServeMux()
+	forum := handler.NewForum(database.Stores{})
+	registered := routes(forum, handler.NewAPIs(config.APIs{}, forum))
+	for _, r := range registered {
+		mux.Handle(r.pattern, r.handler)
+	}
+	covered := make(map[string]bool)
+	for _, tc := range routeCases(fixtures{}) {
+		path, _, _ := strings.Cut(tc.req.Path, "?")
+		_, pattern := mux.Handler(httptest.NewRequest(tc.req.Method, path, nil))
+		covered[pattern] = true
+	}
+	for _, r := range registered {
+		if !covered[r.pattern] {
+			t.Errorf("route %s absente de TestRoutes", r.pattern)
+		}
+	}
+}
@@ -2,203 +2,577 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
 
+	"forum/config"
 	"forum/database"
 	"forum/handler"
+	"forum/logging"
+	"forum/metrics"
 	"forum/middleware"
 
+	"github.com/gorilla/sessions"
 	"github.com/joho/godotenv"
-	"github.com/markbates/goth"
 	"github.com/markbates/goth/providers/facebook"
 	"github.com/markbates/goth/providers/github"
 	"github.com/markbates/goth/providers/google"
 	"github.com/markbates/goth/providers/twitter"
 	"golang.org/x/crypto/acme/autocert"
-	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/time/rate"
 )
 
-func seedDefaultUsers() {
-	defaults := []struct {
-		username string
-		email    string
-		pwd      string
-		role     string
-	}{
-		{"admin", "admin@example.com", "admin", "admin"},
-		{"moderateur", "mod@example.com", "moderateur", "moderator"},
+// startSessionJanitor supprime régulièrement les sessions expirées, qui sinon
+// ne disparaissent que lorsqu'un navigateur les présente encore, ainsi que les
+// autres données périmées (voir Stores.PurgeExpired) à l'heure de now. La
+// fonction renvoyée arrête la purge et attend la fin de celle en cours.
+func startSessionJanitor(stores database.Stores, interval time.Duration, now func() time.Time) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			t := now()
+			if n, err := stores.Sessions.PurgeExpired(context.Background(), t); err != nil {
+				slog.Error("purge des sessions expirées", "err", err)
+			} else if n > 0 {
+				slog.Info("sessions expirées supprimées", "count", n)
+			}
+			if err := stores.PurgeExpired(context.Background(), t); err != nil {
+				slog.Error("purge des données expirées", "err", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
 	}
+}
 
-	for _, u := range defaults {
-		user, err := database.GetUserByUsername(u.username)
-		if err != nil {
-			hash, _ := bcrypt.GenerateFromPassword([]byte(u.pwd), bcrypt.DefaultCost)
-			_ = database.CreateUser(u.username, u.email, string(hash))
-			user, _ = database.GetUserByUsername(u.username)
-			fmt.Printf("⚙️  Utilisateur %q créé\n", u.username)
-		}
-		if err := database.UpdateUserRole(user.ID, u.role); err != nil {
-			fmt.Printf("❌ Impossible de définir le rôle de %q: %v\n", u.username, err)
-		} else {
-			fmt.Printf("✅ Rôle de %q défini sur %q\n", u.username, u.role)
+// oidcConfig convertit la section OIDC de la configuration pour le handler.
+func oidcConfig(c config.OIDC) handler.OIDCConfig {
+	return handler.OIDCConfig{
+		Name:          c.Name,
+		Label:         c.Label,
+		Issuer:        c.Issuer,
+		ClientID:      c.ClientID,
+		ClientSecret:  c.ClientSecret.Value(),
+		Scopes:        c.Scopes,
+		UsernameClaim: c.UsernameClaim,
+		RoleClaim:     c.RoleClaim,
+		RoleMapping:   c.RoleMap,
+	}
+}
+
+// oauthStore configure le cookie qui conserve l'état OAuth le temps
+// de l'aller-retour chez le fournisseur. Sans secret configuré, une clé
+// aléatoire suffit : seules les connexions en cours sont perdues au redémarrage.
+func oauthStore(secret config.Secret, secure bool) *sessions.CookieStore {
+	key := []byte(secret.Value())
+	if len(key) == 0 {
+		slog.Warn("SESSION_SECRET non défini, clé aléatoire pour les cookies OAuth")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
 		}
 	}
+	store := sessions.NewCookieStore(key)
+	store.Options.Path = "/"
+	store.Options.HttpOnly = true
+	store.Options.Secure = secure
+	return store
+}
+
+// openDatabase applique les réglages de connexion puis ouvre la base.
+func openDatabase(c config.Database) (database.Stores, error) {
+	database.BusyTimeout = c.BusyTimeout.Duration
+	database.MaxOpenConns = c.MaxOpenConns
+	dsn := c.Path
+	if c.Driver == database.Postgres {
+		dsn = c.URL.Value()
+	}
+	return database.Open(c.Driver, dsn)
+}
+
+// configPath renvoie le fichier de configuration à lire (FORUM_CONFIG).
+func configPath() string {
+	if p := os.Getenv("FORUM_CONFIG"); p != "" {
+		return p
+	}
+	return config.DefaultPath
 }
 
-// StartServer initialise la config et démarre le serveur HTTP/HTTPS.
+// StartServer lit la configuration, démarre le forum et l'arrête proprement
+// sur SIGINT ou SIGTERM.
 func StartServer() {
 	// Charger .env si présent
-	if err := godotenv.Load(); err != nil {
-		log.Println("⚠️  Pas de fichier .env trouvé, on compte sur les vars d'environnement")
-	}
-
-	// ----- Configuration OAuth -----
-	domain := os.Getenv("DOMAIN")
-	scheme := "https"
-	if os.Getenv("CERT_FILE") == "" && domain == "" {
-		scheme = "http"
-		domain = "localhost:2020"
-	} else if domain == "" {
-		domain = "localhost"
-	}
-	baseURL := fmt.Sprintf("%s://%s", scheme, domain)
-
-	// Clés OAuth
-	googleKey := os.Getenv("GOOGLE_KEY")
-	googleSecret := os.Getenv("GOOGLE_SECRET")
-	facebookKey := os.Getenv("FACEBOOK_KEY")
-	facebookSecret := os.Getenv("FACEBOOK_SECRET")
-	githubKey := os.Getenv("GITHUB_KEY")
-	githubSecret := os.Getenv("GITHUB_SECRET")
-	twitterKey := os.Getenv("TWITTER_KEY")
-	twitterSecret := os.Getenv("TWITTER_SECRET")
-
-	goth.UseProviders(
-		google.New(googleKey, googleSecret, baseURL+"/auth/google/callback", "email", "profile"),
-		facebook.New(facebookKey, facebookSecret, baseURL+"/auth/facebook/callback", "email", "public_profile"),
-		github.New(githubKey, githubSecret, baseURL+"/auth/github/callback", "user", "user:email"),
-		twitter.New(twitterKey, twitterSecret, baseURL+"/auth/twitter/callback"),
-	)
-	// --------------------------------
+	envErr := godotenv.Load()
 
-	// Init DB
-	if err := database.InitDB("./forum.db"); err != nil {
-		log.Fatal(err)
+	cfg, err := config.Load(configPath())
+	if err != nil {
+		fatal("configuration", err)
+	}
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fatal("journalisation", err)
+	}
+	// Les appels restants à log.Print (bibliothèques) passent aussi par slog.
+	slog.SetDefault(logger)
+	if envErr != nil {
+		slog.Info("pas de fichier .env, configuration par fichier et variables d'environnement")
+	}
+	for _, api := range []struct {
+		name string
+		key  config.Secret
+	}{
+		{"TMDB_API_KEY (/api-tmdb)", cfg.APIs.TMDBKey},
+		{"NEWSAPI_KEY (/actualites)", cfg.APIs.NewsAPIKey},
+		{"GOOGLE_API_KEY (/api/gemini-chat)", cfg.APIs.GeminiKey},
+	} {
+		if api.key == "" {
+			slog.Warn("clé d'API absente, service désactivé", "key", api.name)
+		}
+	}
+
+	srv, err := New(cfg)
+	if err != nil {
+		fatal("démarrage", err)
+	}
+
+	// Les comptes ne sont plus créés au démarrage (forum create-user,
+	// forum seed-demo-data) : une base neuve n'a pas d'administrateur.
+	if staff, err := srv.stores.Users.ListStaff(context.Background()); err == nil &&
+		!slices.ContainsFunc(staff, func(u database.User) bool { return u.Role == "admin" }) {
+		slog.Warn("aucun administrateur, en créer un avec « forum create-user -role admin »")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := srv.ListenAndServe(ctx)
+	if err := srv.Close(); err != nil {
+		slog.Error("fermeture de la base", "err", err)
+	}
+	if serveErr != nil {
+		fatal("serveur interrompu", serveErr)
+	}
+	slog.Info("serveur arrêté")
+}
+
+// Server est le forum assemblé : un http.Handler (routes, middlewares, sondes
+// de santé) et les tâches qui tournent à côté (purge des sessions,
+// sauvegardes planifiées). New le construit, ListenAndServe l'expose selon la
+// configuration et Close libère ce que New a ouvert.
+type Server struct {
+	cfg     *config.Config
+	stores  database.Stores
+	health  *handler.Health
+	handler http.Handler
+	gauges  *metrics.Gauges
+	now     func() time.Time
+	ownsDB  bool // la base a été ouverte par New, Close la ferme
+
+	startOnce sync.Once
+	stopJobs  []func()
+}
+
+// Option règle la construction d'un Server (voir New).
+type Option func(*options)
+
+type options struct {
+	stores *database.Stores
+	client *http.Client
+	now    func() time.Time
+	limits middleware.LimiterStore
+}
+
+// WithStores sert le forum sur une base déjà ouverte (base de test…) : New
+// n'ouvre pas celle de la configuration et Close ne la ferme pas.
+func WithStores(stores database.Stores) Option {
+	return func(o *options) { o.stores = &stores }
+}
+
+// WithHTTPClient remplace le client des services externes (TMDB, NewsAPI,
+// Gemini), par exemple par un client vers des doublures.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) { o.client = client }
+}
+
+// WithClock remplace l'horloge du forum : durée des sessions, limitation des
+// connexions et du débit, tâches de fond.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) { o.now = now }
+}
+
+// WithLimiterStore remplace les compteurs en mémoire de la limite de débit,
+// par exemple par un store partagé entre plusieurs instances.
+func WithLimiterStore(store middleware.LimiterStore) Option {
+	return func(o *options) { o.limits = store }
+}
+
+// New construit le forum décrit par cfg. Sans WithStores, la base de
+// cfg.Database est ouverte (et migrée). Toute la configuration (durée des
+// sessions, fuseau par défaut, fournisseurs OAuth, templates, proxys de
+// confiance, jauges) reste propre au Server : plusieurs peuvent cohabiter
+// dans un même processus.
+func New(cfg *config.Config, opts ...Option) (*Server, error) {
+	o := options{now: time.Now, limits: middleware.NewMemoryStore(10 * time.Minute)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Templates analysés une fois ; rechargés à chaud avec TEMPLATES_RELOAD
+	templates := handler.NewTemplates("templates", cfg.Server.TemplatesReload)
+	if err := templates.Load(); err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+	proxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	policy := database.SessionPolicy{
+		Lifetime:         cfg.Session.Lifetime.Duration,
+		RememberLifetime: cfg.Session.RememberLifetime.Duration,
 	}
-	defer database.CloseDB()
 
-	// Seed users
-	seedDefaultUsers()
+	s := &Server{cfg: cfg, now: o.now}
+	if o.stores != nil {
+		s.stores = *o.stores
+	} else {
+		stores, err := openDatabase(cfg.Database)
+		if err != nil {
+			return nil, fmt.Errorf("base de données: %w", err)
+		}
+		s.stores, s.ownsDB = stores, true
+	}
+	s.health = &handler.Health{Stores: s.stores}
 
-	// Création du mux
 	mux := http.NewServeMux()
+	forum := handler.NewForum(s.stores)
+	forum.Now = o.now
+	forum.SessionPolicy = policy
+	forum.Templates = templates
+	forum.OAuth = newOAuth(cfg)
+	if loc, err := time.LoadLocation(cfg.Server.Timezone); err == nil {
+		forum.Location = loc
+	}
+	apis := handler.NewAPIs(cfg.APIs, forum)
+	if o.client != nil {
+		apis.Client = o.client
+	}
+	for _, r := range routes(forum, apis) {
+		mux.Handle(r.pattern, r.handler)
+	}
 
-	// Statiques
-	fs := http.FileServer(http.Dir("./static"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fs))
-
-	// Routes...
-	mux.HandleFunc("/", handler.RedirectToIndex)
-	mux.HandleFunc("/index", handler.IndexHandler)
-	mux.HandleFunc("/inscription", handler.InscriptionHandler)
-	mux.HandleFunc("/connexion", handler.ConnexionHandler)
-	mux.HandleFunc("/deconnexion", handler.DeconnexionHandler)
-	mux.HandleFunc("/profil", handler.ProfilHandler)
-	mux.HandleFunc("/modify-profil", handler.ModifyProfileHandler)
-	mux.HandleFunc("/api-tmdb", handler.TmdbHandler)
-	mux.HandleFunc("/actualites", handler.ActualitesHandler)
-	mux.HandleFunc("/theories-spoilers", handler.TheoriesSpoilersHandler)
-	mux.HandleFunc("/nouveau-post", handler.NewPostHandler)
-	mux.HandleFunc("/posts", handler.PostsHandler)
-	mux.HandleFunc("/post", handler.PostDetailHandler)
-	mux.HandleFunc("/delete-post", handler.DeletePostHandler)
-	mux.HandleFunc("/edit-post", handler.EditPostHandler)
-	mux.HandleFunc("/add-comment", handler.AddCommentHandler)
-	mux.HandleFunc("/delete-comment", handler.DeleteCommentHandler)
-	mux.HandleFunc("/notifications", handler.NotificationsHandler)
-	mux.HandleFunc("/notifications-page", handler.NotificationsPageHandler)
-	mux.HandleFunc("/notifications/mark-read", handler.MarkNotificationsAsReadHandler)
-	mux.HandleFunc("/like-post", handler.LikePostHandler)
-	mux.HandleFunc("/dislike-post", handler.DislikePostHandler)
-	mux.HandleFunc("/like-comment", handler.LikeCommentHandler)
-	mux.HandleFunc("/dislike-comment", handler.DislikeCommentHandler)
-	mux.HandleFunc("/auth/google", handler.GoogleAuthHandler)
-	mux.HandleFunc("/auth/google/callback", handler.GoogleCallbackHandler)
-	mux.HandleFunc("/auth/facebook", handler.FacebookAuthHandler)
-	mux.HandleFunc("/auth/facebook/callback", handler.FacebookCallbackHandler)
-	mux.HandleFunc("/auth/github", handler.GithubAuthHandler)
-	mux.HandleFunc("/auth/github/callback", handler.GithubCallbackHandler)
-	mux.HandleFunc("/auth/twitter", handler.TwitterAuthHandler)
-	mux.HandleFunc("/auth/twitter/callback", handler.TwitterCallbackHandler)
-	mux.HandleFunc("/moderation", handler.ModerationDashboardHandler)
-	mux.HandleFunc("/moderation/approve", handler.ApprovePostHandler)
-	mux.HandleFunc("/moderation/reject", handler.RejectPostHandler)
-	mux.HandleFunc("/admin/promote", handler.PromoteUserHandler)
-	mux.HandleFunc("/admin/demote", handler.DemoteUserHandler)
-	mux.HandleFunc("/admin/users", handler.AdminUsersHandler)
-	mux.HandleFunc("/admin/users/update", handler.AdminUsersUpdateHandler)
-	mux.HandleFunc("/report-post", handler.ReportPostHandler)
-	mux.HandleFunc("/admin/reports", handler.AdminReportsHandler)
-	mux.HandleFunc("/admin/reports/respond", handler.RespondReportHandler)
-
-	// Gemini Chat Routes
-	mux.HandleFunc("/gemini-chat", handler.GeminiChatPage)
-	mux.HandleFunc("/api/gemini-chat", handler.GeminiChatAPI)
-
-	// Rate Limiter
-	handlerWithRate := middleware.RateLimit(middleware.GzipAndCacheMiddleware(mux))
-
-	certFile := os.Getenv("CERT_FILE")
-	keyFile := os.Getenv("KEY_FILE")
-
-	// HTTPS local (PEM)
-	if certFile != "" && keyFile != "" {
-		url := "https://localhost"
-		fmt.Printf("✅ Serveur HTTPS démarré. Ouvrez ce lien dans votre navigateur :\n")
-		fmt.Printf("\x1b]8;;%s\x07%s\x1b]8;;\x07\n", url, url)
-		log.Fatal(http.ListenAndServeTLS(":443", certFile, keyFile, handlerWithRate))
-	}
-
-	// HTTP fallback
-	if domain == "localhost:2020" {
-		url := "http://localhost:2020"
-		fmt.Println("⚠️  Pas de DOMAIN défini, démarrage sur HTTP :2020")
-		fmt.Printf("✅ Accédez à votre site :\n")
-		fmt.Printf("\x1b]8;;%s\x07%s\x1b]8;;\x07\n", url, url)
-		log.Fatal(http.ListenAndServe(":2020", handlerWithRate))
-	}
-
-	// Let's Encrypt prod
-	m := &autocert.Manager{
-		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(domain),
-		Cache:      autocert.DirCache("cert-cache"),
-	}
-	tlsConfig := &tls.Config{
-		GetCertificate: m.GetCertificate,
-		MinVersion:     tls.VersionTLS12,
-	}
-	server := &http.Server{
-		Addr:      ":443",
-		Handler:   handlerWithRate,
-		TLSConfig: tlsConfig,
+	// Les refus des deux limites sont des pages d'erreur du forum, ou du JSON.
+	rateLimited := func(w http.ResponseWriter, r *http.Request) {
+		forum.RenderError(w, r, handler.StatusError(http.StatusTooManyRequests, middleware.RateLimited, nil))
 	}
-	go func() {
-		httpSrv := &http.Server{
-			Addr:    ":80",
-			Handler: m.HTTPHandler(mux),
+	// Limite par adresse, avant Sessions : un flot de requêtes (cookies de
+	// session inventés compris) est refusé sans interroger la base. Chaque
+	// formulaire d'authentification a son propre compteur.
+	ipLimiter := &middleware.RateLimiter{
+		Store:   o.limits,
+		Default: middleware.Policy{Name: "ip", Rate: 50, Burst: 200},
+		Routes: []middleware.RoutePolicy{
+			{Prefix: "/connexion", Policy: middleware.Policy{Name: "connexion", Rate: rate.Every(6 * time.Second), Burst: 5}},
+			{Prefix: "/inscription", Policy: middleware.Policy{Name: "inscription", Rate: rate.Every(6 * time.Second), Burst: 5}},
+		},
+		Now:    o.now,
+		ByIP:   true,
+		Reject: rateLimited,
+	}
+	// Limite par compte, après Sessions : stricte sur l'IA, large sur les statiques
+	limiter := &middleware.RateLimiter{
+		Store:   o.limits,
+		Default: middleware.Policy{Name: "default", Rate: 5, Burst: 20},
+		Routes: []middleware.RoutePolicy{
+			{Prefix: "/api/gemini-chat", Policy: middleware.Policy{Name: "gemini", Rate: rate.Every(3 * time.Second), Burst: 3}},
+			{Prefix: "/static/", Policy: middleware.Policy{Name: "static", Rate: 50, Burst: 200}},
+		},
+		Now:    o.now,
+		Reject: rateLimited,
+	}
+	compressor := &middleware.Compressor{MinSize: 1024, Brotli: cfg.Server.Brotli}
+	security := middleware.DefaultSecurityHeaders()
+	security.CSPReportOnly = cfg.Server.CSPReportOnly
+	sessions := middleware.Sessions{Store: s.stores.Sessions, Policy: policy, Now: o.now}
+	csrf := middleware.CSRF{Reject: func(w http.ResponseWriter, r *http.Request) {
+		forum.RenderError(w, r, handler.Forbidden(middleware.CSRFRejected))
+	}}
+	handlerWithRate := security.Secure(compressor.Compress(ipLimiter.Limit(sessions.Load(limiter.Limit(csrf.Protect(mux))))))
+
+	// Les sondes passent avant les middlewares : ni limite de débit, ni session.
+	root := http.NewServeMux()
+	root.HandleFunc("/healthz", s.health.Healthz)
+	root.HandleFunc("/readyz", s.health.Readyz)
+	accessLog := &middleware.AccessLogger{Routes: mux}
+	requestMetrics := &middleware.RequestMetrics{Routes: mux}
+	root.Handle("/", middleware.RequestID(accessLog.Log(requestMetrics.Measure(handlerWithRate))))
+
+	// Métriques Prometheus : écouteur dédié de préférence (voir
+	// ListenAndServe), sinon sur le site derrière un jeton.
+	s.gauges = metrics.NewGauges()
+	s.gauges.Add("forum_moderation_queue_depth", "Posts en attente de modération.", func() (int, error) {
+		return s.stores.Posts.CountPending(context.Background())
+	})
+	s.gauges.Add("forum_active_sessions", "Sessions non expirées.", func() (int, error) {
+		return s.stores.Sessions.CountActive(context.Background(), s.now())
+	})
+	if cfg.Metrics.Addr == "" && cfg.Metrics.Token != "" {
+		root.Handle("/metrics", metrics.Handler(cfg.Metrics.Token.Value(), s.gauges))
+	}
+	// Les proxys de confiance sont résolus en premier : sondes et journal
+	// d'accès voient déjà l'adresse du client.
+	s.handler = proxies.Resolve(root)
+	return s, nil
+}
+
+// newOAuth déclare les fournisseurs OAuth et OpenID Connect configurés.
+func newOAuth(cfg *config.Config) *handler.OAuth {
+	baseURL := cfg.BaseURL()
+	providers := handler.NewOAuth(oauthStore(cfg.Session.Secret, cfg.Mode() != "http"))
+	oauth := cfg.OAuth
+	providers.Use(
+		google.New(oauth.Google.Key, oauth.Google.Secret.Value(), baseURL+"/auth/google/callback", "email", "profile"),
+		facebook.New(oauth.Facebook.Key, oauth.Facebook.Secret.Value(), baseURL+"/auth/facebook/callback", "email", "public_profile"),
+		github.New(oauth.GitHub.Key, oauth.GitHub.Secret.Value(), baseURL+"/auth/github/callback", "user", "user:email"),
+		twitter.New(oauth.Twitter.Key, oauth.Twitter.Secret.Value(), baseURL+"/auth/twitter/callback"),
+	)
+	if cfg.OIDC.Enabled() {
+		if err := providers.RegisterOIDC(oidcConfig(cfg.OIDC), baseURL); err != nil {
+			slog.Error("fournisseur OIDC désactivé", "err", err)
+		} else {
+			slog.Info("fournisseur OIDC configuré", "name", cfg.OIDC.Name, "issuer", cfg.OIDC.Issuer)
 		}
-		log.Fatal(httpSrv.ListenAndServe())
-	}()
+	}
+	return providers
+}
 
-	// HTTPS prod
-	fmt.Printf("✅ Serveur HTTPS démarré sur %s\n", baseURL)
-	fmt.Printf("✅ Accédez à votre site :\n")
-	fmt.Printf("\x1b]8;;%s\x07%s\x1b]8;;\x07\n", baseURL, baseURL)
-	log.Fatal(server.ListenAndServeTLS("", ""))
+// ServeHTTP sert le forum : un Server peut être monté tel quel dans un autre
+// serveur HTTP ou dans httptest.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
 }
 
+// Start lance les tâches de fond : purge des sessions expirées et
+// sauvegardes planifiées. ListenAndServe l'appelle ; un Server monté ailleurs
+// l'appelle lui-même s'il en a besoin. Close les arrête.
+func (s *Server) Start() {
+	s.startOnce.Do(func() {
+		s.stopJobs = []func(){
+			startSessionJanitor(s.stores, time.Hour, s.now),
+			startBackups(s.stores, s.cfg.Backup, s.now),
+		}
+	})
+}
+
+// ListenAndServe lance les tâches de fond et les écouteurs de la
+// configuration (HTTP, TLS local ou Let's Encrypt, métriques), puis sert
+// jusqu'à l'annulation de ctx ou l'échec d'un écouteur : /readyz passe alors
+// en 503 et les requêtes en cours disposent du délai d'arrêt. L'erreur
+// renvoyée est celle de l'écouteur qui a échoué ; Close reste à appeler.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	s.Start()
+	cfg := s.cfg
+	timeouts := cfg.Server.Timeouts
+	newServer := func(addr string, h http.Handler) *http.Server {
+		return &http.Server{
+			Addr:              addr,
+			Handler:           h,
+			ReadHeaderTimeout: timeouts.ReadHeader.Duration,
+			ReadTimeout:       timeouts.Read.Duration,
+			WriteTimeout:      timeouts.Write.Duration,
+			IdleTimeout:       timeouts.Idle.Duration,
+			ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		}
+	}
+
+	var servers []*listener
+	switch {
+	case cfg.Metrics.Addr != "":
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler(cfg.Metrics.Token.Value(), s.gauges))
+		srv := newServer(cfg.Metrics.Addr, metricsMux)
+		servers = append(servers, &listener{srv, srv.ListenAndServe})
+		slog.Info("métriques exposées", "addr", cfg.Metrics.Addr)
+	case cfg.Metrics.Token != "":
+		slog.Info("métriques exposées sur /metrics (jeton requis)")
+	default:
+		slog.Info("métriques désactivées (METRICS_ADDR ou METRICS_TOKEN)")
+	}
+
+	switch cfg.Mode() {
+	case "tls":
+		// HTTPS local (PEM)
+		srv := newServer(cfg.Server.HTTPSAddr, s)
+		servers = append(servers, &listener{srv, func() error {
+			return srv.ListenAndServeTLS(cfg.Server.CertFile, cfg.Server.KeyFile)
+		}})
+	case "http":
+		// HTTP fallback
+		srv := newServer(cfg.Server.HTTPAddr, s)
+		servers = append(servers, &listener{srv, srv.ListenAndServe})
+	default:
+		// Let's Encrypt prod : HTTPS, plus le challenge HTTP-01 et la
+		// redirection vers HTTPS sur le port 80.
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.Server.Domain),
+			Cache:      autocert.DirCache(cfg.Server.CertCache),
+		}
+		srv := newServer(cfg.Server.HTTPSAddr, s)
+		srv.TLSConfig = &tls.Config{
+			GetCertificate: m.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+		acme := newServer(cfg.Server.ACMEAddr, m.HTTPHandler(nil))
+		servers = append(servers,
+			&listener{srv, func() error { return srv.ListenAndServeTLS("", "") }},
+			&listener{acme, acme.ListenAndServe},
+		)
+	}
+	slog.Info("serveur démarré", "url", cfg.BaseURL(), "mode", cfg.Mode())
+	return serve(ctx, servers, s.health, timeouts.Shutdown.Duration)
+}
+
+// Close arrête les tâches de fond et ferme la base si New l'a ouverte.
+func (s *Server) Close() error {
+	for _, stop := range s.stopJobs {
+		stop()
+	}
+	s.stopJobs = nil
+	if !s.ownsDB {
+		return nil
+	}
+	s.ownsDB = false
+	return s.stores.Close()
+}
+
+// route associe un motif du mux à son handler.
+type route struct {
+	pattern string
+	handler http.Handler
+}
+
+// routes renvoie les pages et actions du forum.
+func routes(forum *handler.Forum, apis *handler.APIs) []route {
+	return []route{
+		{"/static/", http.StripPrefix("/static/", middleware.StaticAssets)},
+		{"/", forum.Handle(handler.RedirectToIndex)},
+		{"/index", forum.Handle(forum.IndexHandler)},
+		{"/inscription", forum.Handle(forum.InscriptionHandler)},
+		{"/connexion", forum.Handle(forum.ConnexionHandler)},
+		{"/connexion/2fa", forum.Handle(forum.TwoFactorLoginHandler)},
+		{"/connexion/2fa/enroll", forum.Handle(forum.TwoFactorEnrollLoginHandler)},
+		{"/deconnexion", forum.Handle(forum.DeconnexionHandler)},
+		{"/profil", forum.Handle(forum.ProfilHandler)},
+		{"/profil/2fa", forum.Handle(forum.TwoFactorSettingsHandler)},
+		{"/profil/sessions", forum.Handle(forum.SessionsHandler)},
+		{"/profil/comptes", forum.Handle(forum.LinkedAccountsHandler)},
+		{"/modify-profil", forum.Handle(forum.ModifyProfileHandler)},
+		{"/api-tmdb", forum.Handle(apis.TmdbHandler)},
+		{"/actualites", forum.Handle(apis.ActualitesHandler)},
+		{"/theories-spoilers", forum.Handle(forum.TheoriesSpoilersHandler)},
+		{"/nouveau-post", forum.Handle(forum.NewPostHandler)},
+		{"/posts", forum.Handle(forum.PostsHandler)},
+		{"/post", forum.Handle(forum.PostDetailHandler)},
+		{"/delete-post", forum.Handle(forum.DeletePostHandler)},
+		{"/edit-post", forum.Handle(forum.EditPostHandler)},
+		{"/add-comment", forum.Handle(forum.AddCommentHandler)},
+		{"/delete-comment", forum.Handle(forum.DeleteCommentHandler)},
+		{"/notifications", forum.Handle(forum.NotificationsHandler)},
+		{"/notifications-page", forum.Handle(forum.NotificationsPageHandler)},
+		{"/notifications/mark-read", forum.Handle(forum.MarkNotificationsAsReadHandler)},
+		{"/like-post", forum.Handle(forum.LikePostHandler)},
+		{"/dislike-post", forum.Handle(forum.DislikePostHandler)},
+		{"/like-comment", forum.Handle(forum.LikeCommentHandler)},
+		{"/dislike-comment", forum.Handle(forum.DislikeCommentHandler)},
+		{"/auth/{provider}", forum.Handle(forum.OAuthBeginHandler)},
+		{"/auth/{provider}/callback", forum.Handle(forum.OAuthCallbackHandler)},
+		{"/inscription/oauth", forum.Handle(forum.OAuthUsernameHandler)},
+		{"/moderation", forum.Handle(forum.ModerationDashboardHandler)},
+		{"/moderation/approve", forum.Handle(forum.ApprovePostHandler)},
+		{"/moderation/reject", forum.Handle(forum.RejectPostHandler)},
+		{"/admin/promote", forum.Handle(forum.PromoteUserHandler)},
+		{"/admin/demote", forum.Handle(forum.DemoteUserHandler)},
+		{"/admin/users", forum.Handle(forum.AdminUsersHandler)},
+		{"/admin/users/update", forum.Handle(forum.AdminUsersUpdateHandler)},
+		{"/admin/security", forum.Handle(forum.AdminSecurityHandler)},
+		{"/admin/backup", forum.Handle(forum.AdminBackupHandler)},
+		{"/report-post", forum.Handle(forum.ReportPostHandler)},
+		{middleware.CSPReportPath, forum.Handle(forum.CSPReportHandler)},
+		{"/admin/reports", forum.Handle(forum.AdminReportsHandler)},
+		{"/admin/reports/respond", forum.Handle(forum.RespondReportHandler)},
+		{"/gemini-chat", forum.Handle(forum.GeminiChatPage)},
+		{"/api/gemini-chat", forum.Handle(apis.GeminiChatAPI)},
+	}
+}
+
+// fatal journalise une erreur bloquante et quitte le processus.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// listener associe un serveur à sa méthode de démarrage (HTTP ou TLS).
+type listener struct {
+	srv   *http.Server
+	start func() error
+}
+
+// serve démarre les serveurs et attend un signal d'arrêt (ou l'échec de l'un
+// d'eux). /readyz passe alors en 503, les écouteurs se ferment et les requêtes
+// en cours disposent de timeout pour se terminer. L'erreur renvoyée est celle
+// du serveur qui a échoué, le cas échéant.
+func serve(ctx context.Context, servers []*listener, health *handler.Health, timeout time.Duration) error {
+	errc := make(chan error, len(servers))
+	for _, l := range servers {
+		go func() {
+			if err := l.start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errc <- fmt.Errorf("%s: %w", l.srv.Addr, err)
+			}
+		}()
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("signal reçu, arrêt en cours")
+	case serveErr = <-errc:
+	}
+	health.Drain()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, l := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.srv.Shutdown(shutdownCtx); err != nil {
+				slog.Warn("requêtes interrompues à l'arrêt", "addr", l.srv.Addr, "timeout", timeout, "err", err)
+				l.srv.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	return serveErr
+}
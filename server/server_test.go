@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/config"
+	"forum/database"
+	"forum/database/dbtest"
+)
+
+// TestServerLifecycle construit le forum sur la base de la configuration,
+// le sert puis l'arrête : /readyz passe en 503 et Close ferme la base.
+func TestServerLifecycle(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "forum.db")
+	cfg.Server.HTTPAddr = "127.0.0.1:0"
+	cfg.Backup.Interval = config.Duration{}
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/readyz : statut %d, attendu %d", w.Code, http.StatusOK)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe(ctx) }()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("ListenAndServe : %v", err)
+	}
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz après l'arrêt : statut %d, attendu %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	stores := srv.stores
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Ping(context.Background()); err == nil {
+		t.Fatal("base encore ouverte après Close")
+	}
+}
+
+// roundTripFunc sert de transport aux clients des tests.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// TestWithHTTPClient vérifie que les services externes passent par le client
+// fourni, sans réseau.
+func TestWithHTTPClient(t *testing.T) {
+	cfg := config.Default()
+	cfg.APIs.TMDBKey = fakeTMDBKey
+	var hosts []string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		hosts = append(hosts, r.URL.Host)
+		body := `{"results":[{"title":"` + fakeMovie + `"}]}`
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+	})}
+	srv, err := New(cfg, WithStores(dbtest.New(t)), WithHTTPClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api-tmdb", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), fakeMovie) {
+		t.Fatalf("/api-tmdb : statut %d, film absent", w.Code)
+	}
+	if len(hosts) != 1 || hosts[0] != "api.themoviedb.org" {
+		t.Fatalf("requêtes du client : %v", hosts)
+	}
+}
+
+// TestMetricsEndpoint vérifie que /metrics n'est servi sur le site qu'avec un
+// jeton et que les jauges comptent les données de la base.
+func TestMetricsEndpoint(t *testing.T) {
+	ctx := context.Background()
+	stores := dbtest.New(t)
+	authorID, err := stores.Users.Create(ctx, "auteur", "auteur@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"En attente 1", "En attente 2"} {
+		if _, err := stores.Posts.Create(ctx, authorID, title, "contenu", "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stores.Posts.Create(ctx, authorID, "Publié", "contenu", "", true); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, s := range []database.Session{
+		{ID: "active", UserID: authorID, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "expiree", UserID: authorID, LastSeenAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+	} {
+		if err := stores.Sessions.Create(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.Default()
+	cfg.Metrics.Token = "jeton"
+	srv, err := New(cfg, WithStores(stores))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	scrape := func(srv *Server, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := scrape(srv, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("sans jeton : statut %d, attendu %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := scrape(srv, "Bearer autre"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("mauvais jeton : statut %d, attendu %d", w.Code, http.StatusUnauthorized)
+	}
+	w := scrape(srv, "Bearer jeton")
+	if w.Code != http.StatusOK {
+		t.Fatalf("bon jeton : statut %d, attendu %d", w.Code, http.StatusOK)
+	}
+	for _, want := range []string{"forum_moderation_queue_depth 2\n", "forum_active_sessions 1\n"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("jauge %q absente :\n%s", strings.TrimSpace(want), w.Body.String())
+		}
+	}
+
+	// Sans jeton ni écouteur dédié, /metrics n'existe pas sur le site.
+	open, err := New(config.Default(), WithStores(stores))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	if w := scrape(open, ""); w.Code != http.StatusNotFound {
+		t.Errorf("métriques non configurées : statut %d, attendu %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"forum/config"
+	"forum/database"
+	"forum/handler"
+	"forum/middleware"
+)
+
+// Doublures des services externes : clés attendues et contenus renvoyés.
+const (
+	fakeTMDBKey    = "tmdb-test"
+	fakeNewsAPIKey = "newsapi-test"
+	fakeGeminiKey  = "gemini-test"
+	fakeMovie      = "Le Film de Test"
+	fakeArticle    = "Une actualité de test"
+)
+
+// site est le forum complet (routes et middlewares de StartServer) servi en
+// HTTPS par httptest sur une base jetable ; TMDB, NewsAPI et Gemini sont
+// remplacés par des doublures locales.
+type site struct {
+	t      *testing.T
+	stores database.Stores
+	srv    *httptest.Server
+	users  atomic.Int32
+	ips    atomic.Int32
+}
+
+// unlimited laisse passer toutes les requêtes : les parcours des tests
+// dépassent vite les rafales autorisées à un visiteur.
+type unlimited struct{}
+
+func (unlimited) Allow(string, middleware.Policy, time.Time) (bool, time.Duration) { return true, 0 }
+
+// newSite démarre le site. Les requêtes ne sont pas limitées en débit, sauf
+// si opts fournit un autre store (WithLimiterStore).
+func newSite(t *testing.T, stores database.Stores, opts ...Option) *site {
+	t.Helper()
+	uploadDir := handler.UploadDir
+	handler.UploadDir = t.TempDir()
+	t.Cleanup(func() { handler.UploadDir = uploadDir })
+
+	cfg := config.Default()
+	// Chaque client se présente derrière un proxy local avec sa propre
+	// adresse (voir site.client).
+	cfg.Server.TrustedProxies = []string{"127.0.0.1"}
+	cfg.APIs = fakeAPIs(t)
+	opts = append([]Option{WithStores(stores), WithLimiterStore(unlimited{})}, opts...)
+	forum, err := New(cfg, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { forum.Close() })
+
+	// HTTPS : les cookies de session et CSRF sont Secure.
+	srv := httptest.NewTLSServer(forum)
+	t.Cleanup(srv.Close)
+	return &site{t: t, stores: stores, srv: srv}
+}
+
+// fakeAPIs démarre les doublures de TMDB, NewsAPI et Gemini. Une clé
+// inattendue donne une erreur 401, comme les vrais services.
+func fakeAPIs(t *testing.T) config.APIs {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tmdb/movie/popular", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api_key") != fakeTMDBKey {
+			http.Error(w, `{"status_message":"Invalid API key"}`, http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"results": []map[string]string{
+			{"title": fakeMovie, "overview": "Résumé.", "poster_path": "/affiche.jpg"},
+		}})
+	})
+	mux.HandleFunc("GET /news/everything", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != fakeNewsAPIKey {
+			http.Error(w, `{"status":"error","code":"apiKeyInvalid"}`, http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"status": "ok", "totalResults": 1, "articles": []map[string]any{{
+			"source":      map[string]string{"name": "Test"},
+			"title":       fakeArticle,
+			"description": "Description.",
+			"url":         "https://example.com/article",
+			"publishedAt": "2024-01-01T10:00:00Z",
+		}}})
+	})
+	mux.HandleFunc("POST /gemini/models/gemini-1.5-flash:generateContent", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-goog-api-key") != fakeGeminiKey {
+			http.Error(w, `{"error":{"code":401}}`, http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Contents []struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"contents"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Contents) == 0 || len(req.Contents[0].Parts) == 0 {
+			http.Error(w, `{"error":{"code":400}}`, http.StatusBadRequest)
+			return
+		}
+		reply := "écho : " + req.Contents[0].Parts[0].Text
+		json.NewEncoder(w).Encode(map[string]any{"candidates": []any{
+			map[string]any{"content": map[string]any{"parts": []any{map[string]string{"text": reply}}}},
+		}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return config.APIs{
+		TMDBKey:    fakeTMDBKey,
+		TMDBURL:    srv.URL + "/tmdb",
+		NewsAPIKey: fakeNewsAPIKey,
+		NewsAPIURL: srv.URL + "/news",
+		GeminiKey:  fakeGeminiKey,
+		GeminiURL:  srv.URL + "/gemini",
+	}
+}
+
+// client est un visiteur du site : il garde ses cookies et ne suit pas les
+// redirections, pour que les tests les vérifient.
+type client struct {
+	site   *site
+	http   *http.Client
+	ip     string // adresse transmise par le proxy (X-Forwarded-For)
+	userID int    // 0 pour un visiteur anonyme
+	token  string // jeton CSRF, lu sur une page au premier besoin
+}
+
+// client renvoie un nouveau visiteur anonyme.
+func (s *site) client() *client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	n := s.ips.Add(1)
+	ip := fmt.Sprintf("10.0.%d.%d", n/250, n%250+1)
+	return &client{site: s, ip: ip, http: &http.Client{
+		Transport: s.srv.Client().Transport,
+		Jar:       jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// response est une réponse dont le corps est déjà lu.
+type response struct {
+	Status   int
+	Location string
+	Header   http.Header
+	Body     string
+}
+
+// request décrit une requête du client ; Form est envoyé en
+// application/x-www-form-urlencoded, ou en multipart/form-data avec
+// Multipart, et JSON en application/json. Le jeton CSRF est ajouté aux
+// requêtes qui modifient l'état.
+type request struct {
+	Method    string
+	Path      string
+	Form      url.Values
+	Multipart bool
+	JSON      any
+}
+
+// do envoie req et lit la réponse.
+func (c *client) do(t *testing.T, req request) response {
+	t.Helper()
+	var body io.Reader
+	contentType := ""
+	safe := req.Method == http.MethodGet || req.Method == http.MethodHead
+	switch {
+	case req.JSON != nil:
+		b, err := json.Marshal(req.JSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, contentType = bytes.NewReader(b), "application/json"
+	case req.Multipart:
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for k, vs := range req.Form {
+			for _, v := range vs {
+				mw.WriteField(k, v)
+			}
+		}
+		if !safe {
+			mw.WriteField(middleware.CSRFField, c.csrfToken(t))
+		}
+		mw.Close()
+		body, contentType = &buf, mw.FormDataContentType()
+	case req.Form != nil || !safe:
+		form := url.Values{}
+		for k, vs := range req.Form {
+			form[k] = vs
+		}
+		if !safe {
+			form.Set(middleware.CSRFField, c.csrfToken(t))
+		}
+		body, contentType = strings.NewReader(form.Encode()), "application/x-www-form-urlencoded"
+	}
+
+	r, err := http.NewRequest(req.Method, c.site.srv.URL+req.Path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if req.JSON != nil && !safe {
+		r.Header.Set(middleware.CSRFHeader, c.csrfToken(t))
+	}
+	r.Header.Set("X-Forwarded-For", c.ip)
+	resp, err := c.http.Do(r)
+	if err != nil {
+		t.Fatalf("%s %s : %v", req.Method, req.Path, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response{Status: resp.StatusCode, Location: resp.Header.Get("Location"), Header: resp.Header, Body: string(b)}
+}
+
+func (c *client) get(t *testing.T, path string) response {
+	t.Helper()
+	return c.do(t, request{Method: http.MethodGet, Path: path})
+}
+
+func (c *client) post(t *testing.T, path string, form url.Values) response {
+	t.Helper()
+	return c.do(t, request{Method: http.MethodPost, Path: path, Form: form})
+}
+
+var csrfMeta = regexp.MustCompile(`<meta name="csrf-token" content="([^"]*)">`)
+
+// csrfToken renvoie le jeton CSRF du client, lu comme le ferait le script
+// des pages dans la balise meta de l'accueil.
+func (c *client) csrfToken(t *testing.T) string {
+	t.Helper()
+	if c.token == "" {
+		m := csrfMeta.FindStringSubmatch(c.get(t, "/index").Body)
+		if m == nil || m[1] == "" {
+			t.Fatal("jeton CSRF absent de /index")
+		}
+		c.token = m[1]
+	}
+	return c.token
+}
+
+// register crée un compte par le formulaire d'inscription et renvoie son
+// identifiant.
+func (c *client) register(t *testing.T, username, password string) int {
+	t.Helper()
+	resp := c.post(t, "/inscription", url.Values{
+		"username": {username},
+		"email":    {username + "@example.com"},
+		"password": {password},
+	})
+	if resp.Status != http.StatusSeeOther || resp.Location != "/connexion" {
+		t.Fatalf("inscription de %s : statut %d vers %q", username, resp.Status, resp.Location)
+	}
+	u, err := c.site.stores.Users.GetByUsername(context.Background(), username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.ID
+}
+
+// login se connecte par le formulaire ; la session change le jeton CSRF.
+func (c *client) login(t *testing.T, identifier, password string) {
+	t.Helper()
+	resp := c.post(t, "/connexion", url.Values{"identifier": {identifier}, "password": {password}})
+	if resp.Status != http.StatusSeeOther || resp.Location != "/index" {
+		t.Fatalf("connexion de %s : statut %d vers %q", identifier, resp.Status, resp.Location)
+	}
+	c.token = ""
+	users := c.site.stores.Users
+	lookup := users.GetByUsername
+	if strings.Contains(identifier, "@") {
+		lookup = users.GetByEmail
+	}
+	u, err := lookup(context.Background(), identifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.userID = u.ID
+}
+
+// actAs renvoie un client connecté à un nouveau compte de rôle role (user,
+// moderator ou admin) : inscription et connexion passent par HTTP, seul le
+// rôle est fixé directement en base.
+func (s *site) actAs(t *testing.T, role string) *client {
+	t.Helper()
+	c := s.client()
+	name := fmt.Sprintf("%s%d", role, s.users.Add(1))
+	id := c.register(t, name, "motdepasse-"+name)
+	if role != "user" {
+		if err := s.stores.Users.SetRole(context.Background(), 0, id, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.login(t, name, "motdepasse-"+name)
+	return c
+}
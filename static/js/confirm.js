@@ -0,0 +1,7 @@
+// Demande confirmation avant d'envoyer un formulaire dont le bouton porte data-confirm.
+document.addEventListener('click', function (e) {
+  const btn = e.target.closest('[data-confirm]');
+  if (btn && !confirm(btn.dataset.confirm)) {
+    e.preventDefault();
+  }
+});
@@ -53,7 +53,10 @@ form.addEventListener('submit', async function(e) {
   try {
     const res = await fetch('/api/gemini-chat', {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
+      headers: {
+        'Content-Type': 'application/json',
+        'X-CSRF-Token': document.querySelector('meta[name="csrf-token"]').content,
+      },
       body: JSON.stringify({ message: msg }),
     });
     if (!res.ok) {
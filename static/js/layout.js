@@ -0,0 +1,36 @@
+// /static/js/layout.js : thème clair/sombre et compteur de notifications de
+// la barre de navigation (templates/partials/navbar.html).
+(function () {
+  const toggle = document.querySelector('[data-theme-toggle]');
+  if (toggle) {
+    const apply = dark => {
+      document.body.classList.toggle('dark-mode', dark);
+      toggle.textContent = dark ? '☀' : '🌙';
+    };
+    apply(localStorage.getItem('theme') === 'dark');
+    toggle.addEventListener('click', () => {
+      const dark = !document.body.classList.contains('dark-mode');
+      apply(dark);
+      localStorage.setItem('theme', dark ? 'dark' : 'light');
+    });
+  }
+
+  const notif = document.querySelector('.nav-notif');
+  if (!notif) {
+    return;
+  }
+  const icon = notif.querySelector('img');
+  const count = notif.querySelector('.nav-notif-count');
+  const refresh = () => {
+    fetch('/notifications', { headers: { Accept: 'application/json' } })
+      .then(res => res.json())
+      .then(data => {
+        const unread = Array.isArray(data) ? data.length : 0;
+        icon.src = unread > 0 ? '/static/images/notif.png' : '/static/images/pas_de_notif.png';
+        count.textContent = unread;
+        count.hidden = unread === 0;
+      })
+      .catch(err => console.error('Erreur notifications:', err));
+  };
+  setInterval(refresh, 30000);
+})();